@@ -82,6 +82,13 @@ function build::ipam() {
   go build -o ${BIN_DIR}/galaxy-ipam ${GOBUILD_FLAGS} -ldflags "${GO_LDFLAGS}" ${PKG}/cmd/galaxy-ipam
 }
 
+function build::cmd() {
+  echo "Building $1"
+  echo "   $1"
+  echo go build -o ${BIN_DIR}/$1 ${GOBUILD_FLAGS} -ldflags "${GO_LDFLAGS}" ${PKG}/cmd/$1
+  go build -o ${BIN_DIR}/$1 ${GOBUILD_FLAGS} -ldflags "${GO_LDFLAGS}" ${PKG}/cmd/$1
+}
+
 function build::verify() {
   bad_files=$(gofmt -s -l cni/ pkg/ cmd/ tools/)
   if [[ -n "${bad_files}" ]]; then
@@ -103,6 +110,9 @@ function build::verify() {
     galaxy-ipam)
       build::ipam
       ;;
+    galaxy-scheduler|galaxyctl)
+      build::cmd $arg
+      ;;
     verify)
       build::verify
       ;;
@@ -23,6 +23,9 @@ DOCKER_VERSION ?= 19.03
 
 REGISTRY_PREFIX ?= tkestack
 
+# binaries without a Dockerfile such as galaxyctl are not built into images
+IMAGES ?= $(foreach bin,$(BINS),$(if $(wildcard $(ROOT_DIR)/build/docker/$(bin)/Dockerfile),$(bin)))
+
 EXTRA_ARGS ?=
 _DOCKER_BUILD_EXTRA_ARGS :=
 
@@ -59,10 +62,10 @@ image.buildx.install:
 	@$(ROOT_DIR)/build/lib/install-buildx.sh
 
 .PHONY: image.build
-image.build: image.buildx.verify $(addprefix image.build., $(addprefix $(PLATFORM)., $(BINS)))
+image.build: image.buildx.verify $(addprefix image.build., $(addprefix $(PLATFORM)., $(IMAGES)))
 
 .PHONY: image.build.multiarch
-image.build.multiarch: image.buildx.verify $(foreach p,$(PLATFORMS),$(addprefix image.build., $(addprefix $(p)., $(BINS))))
+image.build.multiarch: image.buildx.verify $(foreach p,$(PLATFORMS),$(addprefix image.build., $(addprefix $(p)., $(IMAGES))))
 
 .PHONY: image.build.%
 image.build.%:
@@ -77,10 +80,10 @@ image.build.%:
 	 -f $(ROOT_DIR)/build/docker/$(IMAGE)/Dockerfile $(ROOT_DIR)
 
 .PHONY: image.push
-image.push: image.buildx.verify $(addprefix image.push., $(addprefix $(PLATFORM)., $(BINS)))
+image.push: image.buildx.verify $(addprefix image.push., $(addprefix $(PLATFORM)., $(IMAGES)))
 
 .PHONY: image.push.multiarch
-image.push.multiarch: image.buildx.verify $(foreach p,$(PLATFORMS),$(addprefix image.push., $(addprefix $(p)., $(BINS))))
+image.push.multiarch: image.buildx.verify $(foreach p,$(PLATFORMS),$(addprefix image.push., $(addprefix $(p)., $(IMAGES))))
 
 .PHONY: image.push.%
 image.push.%: image.build.%
@@ -89,7 +92,7 @@ image.push.%: image.build.%
 
 .PHONY: image.manifest.push
 image.manifest.push: export DOCKER_CLI_EXPERIMENTAL := enabled
-image.manifest.push: image.buildx.verify $(addprefix image.manifest.push., $(addprefix $(PLATFORM)., $(BINS)))
+image.manifest.push: image.buildx.verify $(addprefix image.manifest.push., $(addprefix $(PLATFORM)., $(IMAGES)))
 
 .PHONY: image.manifest.push.%
 image.manifest.push.%: image.push.% image.manifest.remove.%
@@ -110,7 +113,7 @@ image.manifest.remove.%:
 	@rm -rf ${HOME}/.docker/manifests/docker.io_$(REGISTRY_PREFIX)_$(IMAGE)-$(VERSION)
 
 .PHONY: image.manifest.push.multiarch
-image.manifest.push.multiarch: image.push.multiarch $(addprefix image.manifest.push.multiarch., $(BINS))
+image.manifest.push.multiarch: image.push.multiarch $(addprefix image.manifest.push.multiarch., $(IMAGES))
 
 .PHONY: image.manifest.push.multiarch.%
 image.manifest.push.multiarch.%:
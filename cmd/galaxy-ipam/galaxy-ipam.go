@@ -27,11 +27,22 @@ import (
 	"k8s.io/component-base/logs"
 	glog "k8s.io/klog"
 
+	"tkestack.io/galaxy/pkg/ipam/galaxyctl"
 	"tkestack.io/galaxy/pkg/ipam/server"
 	"tkestack.io/galaxy/pkg/utils/ldflags"
 )
 
 func main() {
+	// galaxy-ipam check checks consistency of the running galaxy-ipam through its API
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		cmd := galaxyctl.NewCheckCommand()
+		cmd.SetArgs(os.Args[2:])
+		if err := cmd.Execute(); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err) // nolint: errcheck
+			os.Exit(1)
+		}
+		return
+	}
 	// initialize rand seed
 	rand.Seed(time.Now().UTC().UnixNano())
 
@@ -0,0 +1,46 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"k8s.io/component-base/logs"
+	"k8s.io/kubernetes/cmd/kube-scheduler/app"
+
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/framework"
+)
+
+// galaxy-scheduler is kube-scheduler with the FloatingIP framework plugin registered. Enable the plugin and pass the
+// floating ip configuration as its args in KubeSchedulerConfiguration.
+func main() {
+	// initialize rand seed
+	rand.Seed(time.Now().UTC().UnixNano())
+
+	cmd := app.NewSchedulerCommand(app.WithPlugin(framework.Name, framework.New))
+
+	logs.InitLogs()
+	defer logs.FlushLogs()
+
+	if err := cmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err) // nolint: errcheck
+		os.Exit(1)
+	}
+}
@@ -21,8 +21,7 @@ import (
 	"fmt"
 
 	"github.com/containernetworking/cni/pkg/skel"
-	"github.com/containernetworking/cni/pkg/types"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/ipam"
 	"tkestack.io/galaxy/pkg/api/cniutil"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
@@ -30,7 +29,8 @@ import (
 
 // Allocate tries to find IPInfo from args firstly
 // Otherwise invoke third party ipam binaries
-func Allocate(ipamType string, args *skel.CmdArgs) ([]uint16, []types.Result, error) {
+// Each of the returned results is expected to be set up on an interface
+func Allocate(ipamType string, args *skel.CmdArgs) ([]uint16, []*current.Result, error) {
 	var (
 		vlanId uint16
 		err    error
@@ -39,7 +39,7 @@ func Allocate(ipamType string, args *skel.CmdArgs) ([]uint16, []types.Result, er
 	if err != nil {
 		return nil, nil, err
 	}
-	var results []types.Result
+	var results []*current.Result
 	var vlanIDs []uint16
 	if ipInfoStr := kvMap[constant.IPInfosKey]; ipInfoStr != "" {
 		// get ipinfo from cni args
@@ -50,10 +50,7 @@ func Allocate(ipamType string, args *skel.CmdArgs) ([]uint16, []types.Result, er
 		if len(ipInfos) == 0 {
 			return nil, nil, fmt.Errorf("empty ipInfos")
 		}
-		for j := range ipInfos {
-			results = append(results, cniutil.IPInfoToResult(&ipInfos[j]))
-			vlanIDs = append(vlanIDs, ipInfos[j].Vlan)
-		}
+		vlanIDs, results := cniutil.IPInfosToResults(ipInfos)
 		return vlanIDs, results, nil
 	}
 	if ipamType == "" {
@@ -64,14 +61,19 @@ func Allocate(ipamType string, args *skel.CmdArgs) ([]uint16, []types.Result, er
 	if err != nil {
 		return nil, nil, err
 	}
-	result, err := t020.GetResult(generalResult)
+	result, err := current.NewResultFromResult(generalResult)
 	if err != nil {
 		return nil, nil, err
 	}
-	if result.IP4 == nil {
-		return nil, nil, fmt.Errorf("IPAM plugin returned missing IPv4 config")
+	if len(result.IPs) == 0 {
+		return nil, nil, fmt.Errorf("IPAM plugin returned missing IP config")
+	}
+	// interfaces are filled by the main plugin
+	result.Interfaces = nil
+	for _, ipc := range result.IPs {
+		ipc.Interface = nil
 	}
-	return append(vlanIDs, vlanId), append(results, generalResult), err
+	return append(vlanIDs, vlanId), append(results, result), err
 }
 
 func Release(ipamType string, args *skel.CmdArgs) error {
@@ -27,7 +27,7 @@ import (
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ns"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
@@ -78,24 +78,23 @@ func cmdAdd(args *skel.CmdArgs) error {
 	if err != nil {
 		return err
 	}
-	result020, err := t020.GetResult(results[0])
-	if err != nil {
-		return err
-	}
+	result := results[0]
 	netns, err := ns.GetNS(args.Netns)
 	if err != nil {
 		return fmt.Errorf("failed to open netns %q: %v", netns, err)
 	}
 	defer netns.Close() // nolint: errcheck
 
-	if err := setupVF(conf, result020, args.IfName, int(vlanIds[0]), netns); err != nil {
+	if err := setupVF(conf, result, args.IfName, int(vlanIds[0]), netns); err != nil {
 		return err
 	}
 	//send Gratuitous ARP to let switch knows IP floats onto this node
 	//ignore errors as we can't print logs and we do this as best as we can
-	_ = utils.SendGratuitousARP(args.IfName, result020.IP4.IP.IP.String(), args.Netns, false)
-	result020.DNS = conf.DNS
-	return result020.Print()
+	if ip := cniutil.ResultIPv4(result); ip != nil {
+		_ = utils.SendGratuitousARP(args.IfName, ip.String(), args.Netns, false)
+	}
+	result.DNS = conf.DNS
+	return cniutil.PrintResult(result, conf.CNIVersion)
 }
 
 func cmdDel(args *skel.CmdArgs) error {
@@ -116,16 +115,29 @@ func cmdDel(args *skel.CmdArgs) error {
 }
 
 func cmdCheck(args *skel.CmdArgs) error {
-	return nil
+	conf, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	result, err := cniutil.GetPrevResult(&conf.NetConf)
+	if err != nil {
+		return err
+	}
+	if _, err := netlink.LinkByName(conf.Device); err != nil {
+		return fmt.Errorf("failed to lookup master %q: %v", conf.Device, err)
+	}
+	_, err = utils.CheckContainerIfaces(args.Netns, args.IfName, result)
+	return err
 }
 
 func main() {
-	skel.PluginMain(cmdAdd, cmdCheck, cmdDel, version.Legacy, bv.BuildString("k8s-sriov"))
+	skel.PluginMain(cmdAdd, cmdCheck, cmdDel, version.All, bv.BuildString("k8s-sriov"))
 }
 
+// setupVF moves a VF device into netns and configures it, the VF device is appended to interfaces of the result
 // code from https://raw.githubusercontent.com/Intel-Corp/sriov-cni/master/sriov/sriov.go
 // #lizard forgives
-func setupVF(conf *NetConf, result *t020.Result, podifName string, vlan int, netns ns.NetNS) error {
+func setupVF(conf *NetConf, result *current.Result, podifName string, vlan int, netns ns.NetNS) error {
 	cpus := runtime.NumCPU()
 	ifName := conf.Device
 
@@ -157,7 +169,16 @@ func setupVF(conf *NetConf, result *t020.Result, podifName string, vlan int, net
 		if err != nil {
 			return fmt.Errorf("failed to rename %d vf of the device %q to %q: %v", vfIdx, vfName, ifName, err)
 		}
-		return cniutil.ConfigureIface(podifName, result)
+		if err := cniutil.ConfigureIface(podifName, result); err != nil {
+			return err
+		}
+		link, err := netlink.LinkByName(podifName)
+		if err != nil {
+			return fmt.Errorf("failed to lookup %q: %v", podifName, err)
+		}
+		cniutil.AddInterfaces(result, nil, &current.Interface{Name: podifName,
+			Mac: link.Attrs().HardwareAddr.String(), Sandbox: netns.Path()})
+		return nil
 	}); err != nil {
 		return err
 	}
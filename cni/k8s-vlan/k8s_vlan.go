@@ -23,10 +23,12 @@ import (
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+	"github.com/vishvananda/netlink"
 	"tkestack.io/galaxy/cni/ipam"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 	"tkestack.io/galaxy/pkg/network/vlan"
 	"tkestack.io/galaxy/pkg/utils"
 )
@@ -67,53 +69,55 @@ func cmdAdd(args *skel.CmdArgs) error {
 	if err := d.Init(); err != nil {
 		return fmt.Errorf("failed to setup bridge %v", err)
 	}
-	result020s, err := resultConvert(results)
+	adjustRoutes(results)
+	results, err = setupNetwork(results, vlanIds, args)
 	if err != nil {
 		return err
 	}
-	if err := setupNetwork(result020s, vlanIds, args); err != nil {
-		return err
-	}
-	result020s[0].DNS = conf.DNS
-	return result020s[0].Print()
+	result := cniutil.MergeResults(results...)
+	result.DNS = conf.DNS
+	return cniutil.PrintResult(result, conf.CNIVersion)
 }
 
-func setupNetwork(result020s []*t020.Result, vlanIds []uint16, args *skel.CmdArgs) error {
+// setupNetwork sets up the network of results and returns the results which are set up
+func setupNetwork(results []*current.Result, vlanIds []uint16, args *skel.CmdArgs) ([]*current.Result, error) {
 	if d.MacVlanMode() {
-		if err := setupMacvlan(result020s[0], vlanIds[0], args); err != nil {
-			return err
+		results = results[:1]
+		if err := setupMacvlan(results[0], vlanIds[0], args); err != nil {
+			return nil, err
 		}
 	} else if d.IPVlanMode() {
-		if err := setupIPVlan(result020s[0], vlanIds[0], args); err != nil {
-			return err
+		results = results[:1]
+		if err := setupIPVlan(results[0], vlanIds[0], args); err != nil {
+			return nil, err
 		}
 	} else {
 		ifName := args.IfName
-		if err := setupVlanDevice(result020s, vlanIds, args); err != nil {
-			return err
+		if err := setupVlanDevice(results, vlanIds, args); err != nil {
+			return nil, err
 		}
 		args.IfName = ifName
 	}
 	//send Gratuitous ARP to let switch knows IP floats onto this node
 	//ignore errors as we can't print logs and we do this as best as we can
 	if d.PureMode() {
-		_ = utils.SendGratuitousARP(d.Device, result020s[0].IP4.IP.IP.String(), "", d.GratuitousArpRequest)
+		sendGratuitousARP(d.Device, results[0], "")
 	}
-	return nil
+	return results, nil
 }
 
-func setupMacvlan(result *t020.Result, vlanId uint16, args *skel.CmdArgs) error {
+func setupMacvlan(result *current.Result, vlanId uint16, args *skel.CmdArgs) error {
 	if err := d.MaybeCreateVlanDevice(vlanId); err != nil {
 		return err
 	}
 	if err := utils.MacVlanConnectsHostWithContainer(result, args, d.DeviceIndex, d.MTU); err != nil {
 		return err
 	}
-	_ = utils.SendGratuitousARP(args.IfName, result.IP4.IP.IP.String(), args.Netns, d.GratuitousArpRequest)
+	sendGratuitousARP(args.IfName, result, args.Netns)
 	return nil
 }
 
-func setupIPVlan(result *t020.Result, vlanId uint16, args *skel.CmdArgs) error {
+func setupIPVlan(result *current.Result, vlanId uint16, args *skel.CmdArgs) error {
 	if err := d.MaybeCreateVlanDevice(vlanId); err != nil {
 		return err
 	}
@@ -123,19 +127,19 @@ func setupIPVlan(result *t020.Result, vlanId uint16, args *skel.CmdArgs) error {
 	}
 
 	if d.IpVlanMode == "l3" || d.IpVlanMode == "l3s" {
-		_ = utils.SendGratuitousARP(d.Device, result.IP4.IP.IP.String(), "", d.GratuitousArpRequest)
+		sendGratuitousARP(d.Device, result, "")
 		return nil
 	}
-	_ = utils.SendGratuitousARP(args.IfName, result.IP4.IP.IP.String(), args.Netns, d.GratuitousArpRequest)
+	sendGratuitousARP(args.IfName, result, args.Netns)
 	return nil
 }
 
-func setupVlanDevice(result020s []*t020.Result, vlanIds []uint16, args *skel.CmdArgs) error {
+func setupVlanDevice(results []*current.Result, vlanIds []uint16, args *skel.CmdArgs) error {
 	ifName := args.IfName
 	ifIndex := 0
-	for i := 0; i < len(result020s); i++ {
+	for i := 0; i < len(results); i++ {
 		vlanId := vlanIds[i]
-		result020 := result020s[i]
+		result := results[i]
 		bridgeName, err := d.CreateBridgeAndVlanDevice(vlanId)
 		if err != nil {
 			return err
@@ -149,35 +153,39 @@ func setupVlanDevice(result020s []*t020.Result, vlanIds []uint16, args *skel.Cmd
 				args.IfName = fmt.Sprintf("eth%d", ifIndex)
 			}
 		}
-		if err := utils.VethConnectsHostWithContainer(result020, args, bridgeName, suffix, nil); err != nil {
+		if err := utils.VethConnectsHostWithContainer(result, args, bridgeName, suffix, nil); err != nil {
 			return err
 		}
-		_ = utils.SendGratuitousARP(args.IfName, result020s[0].IP4.IP.IP.String(), args.Netns, d.GratuitousArpRequest)
+		sendGratuitousARP(args.IfName, results[0], args.Netns)
 	}
 	return nil
 }
 
-func resultConvert(results []types.Result) ([]*t020.Result, error) {
-	var result020s []*t020.Result
-	for i := 0; i < len(results); i++ {
-		result020, err := t020.GetResult(results[i])
-		if err != nil {
-			return nil, err
-		}
-		result020s = append(result020s, result020)
-	}
-	if len(result020s) == 2 {
-		routes := result020s[0].IP4.Routes
-		for i := 0; i < len(routes); i++ {
-			if routes[i].Dst.String() == "0.0.0.0/0" {
-				routes = append(routes[:i], routes[i+1:]...)
-				break
-			}
+// sendGratuitousARP sends gratuitous arp for the ipv4 address of the result, ipv6 addresses are announced by
+// neighbor discovery of kernel
+func sendGratuitousARP(dev string, result *current.Result, nns string) {
+	ip := cniutil.ResultIPv4(result)
+	if ip == nil {
+		return
+	}
+	_ = utils.SendGratuitousARP(dev, ip.String(), nns, d.GratuitousArpRequest)
+}
+
+// adjustRoutes routes private networks via the first interface and the default route via the second interface if
+// there are two interfaces
+func adjustRoutes(results []*current.Result) {
+	if len(results) != 2 || cniutil.ResultIPv4(results[0]) == nil {
+		return
+	}
+	routes := results[0].Routes
+	for i := 0; i < len(routes); i++ {
+		if routes[i].Dst.String() == "0.0.0.0/0" {
+			routes = append(routes[:i], routes[i+1:]...)
+			break
 		}
-		routes = append(routes, types.Route{Dst: *pANet}, types.Route{Dst: *pBNet}, types.Route{Dst: *pCNet})
-		result020s[0].IP4.Routes = routes
 	}
-	return result020s, nil
+	routes = append(routes, &types.Route{Dst: *pANet}, &types.Route{Dst: *pBNet}, &types.Route{Dst: *pCNet})
+	results[0].Routes = routes
 }
 
 func cmdDel(args *skel.CmdArgs) error {
@@ -191,11 +199,37 @@ func cmdDel(args *skel.CmdArgs) error {
 	return ipam.Release(conf.IPAM.Type, args)
 }
 
+// cmdCheck checks all interfaces of the pod which are described by prevResult
 func cmdCheck(args *skel.CmdArgs) error {
-	return nil
+	conf, err := d.LoadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	result, err := cniutil.GetPrevResult(&conf.NetConf)
+	if err != nil {
+		return err
+	}
+	links, err := utils.CheckContainerIfaces(args.Netns, args.IfName, result)
+	if err != nil {
+		return err
+	}
+	if d.MacVlanMode() || d.IPVlanMode() {
+		for name, link := range links {
+			if link.Type() != d.Switch {
+				return fmt.Errorf("interface %q is %s, expect %s", name, link.Type(), d.Switch)
+			}
+			// the parent index of the interface in container refers to the device in host netns
+			if _, err := netlink.LinkByIndex(link.Attrs().ParentIndex); err != nil {
+				return fmt.Errorf("failed to lookup parent of interface %q: %v", name, err)
+			}
+		}
+		return nil
+	}
+	// pure mode doesn't create bridge for vlan 0
+	return utils.CheckHostVeths(result, !d.PureMode())
 }
 
 func main() {
 	d = &vlan.VlanDriver{}
-	skel.PluginMain(cmdAdd, cmdCheck, cmdDel, version.Legacy, bv.BuildString("k8s-vlan"))
+	skel.PluginMain(cmdAdd, cmdCheck, cmdDel, version.All, bv.BuildString("k8s-vlan"))
 }
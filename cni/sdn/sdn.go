@@ -27,9 +27,11 @@ import (
 	"strings"
 
 	"github.com/containernetworking/cni/pkg/skel"
-	current "github.com/containernetworking/cni/pkg/types/current"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 	galaxyapi "tkestack.io/galaxy/pkg/api/galaxy"
 	"tkestack.io/galaxy/pkg/api/galaxy/private"
 )
@@ -110,13 +112,17 @@ func (p *cniPlugin) CmdAdd(args *skel.CmdArgs) (*current.Result, error) {
 }
 
 // Send the ADD command environment and config to the CNI server, printing
-// the IPAM result to stdout when called as a CNI plugin
+// the IPAM result to stdout as the cniVersion of config when called as a CNI plugin
 func (p *cniPlugin) skelCmdAdd(args *skel.CmdArgs) error {
+	conf := &types.NetConf{}
+	if err := json.Unmarshal(args.StdinData, conf); err != nil {
+		return fmt.Errorf("failed to load netconf: %v", err)
+	}
 	result, err := p.CmdAdd(args)
 	if err != nil {
 		return err
 	}
-	return result.Print()
+	return cniutil.PrintResult(result, conf.CNIVersion)
 }
 
 // Send the DEL command environment and config to the CNI server
@@ -125,11 +131,13 @@ func (p *cniPlugin) CmdDel(args *skel.CmdArgs) error {
 	return err
 }
 
-func (p *cniPlugin) cmdCheck(args *skel.CmdArgs) error {
-	return nil
+// Send the CHECK command environment and config to the CNI server
+func (p *cniPlugin) CmdCheck(args *skel.CmdArgs) error {
+	_, err := p.doCNI("http://dummy/cni", newCNIRequest(args))
+	return err
 }
 
 func main() {
 	p := NewCNIPlugin(private.GalaxySocketPath)
-	skel.PluginMain(p.skelCmdAdd, p.cmdCheck, p.CmdDel, version.All, bv.BuildString("galaxy-sdn"))
+	skel.PluginMain(p.skelCmdAdd, p.CmdCheck, p.CmdDel, version.All, bv.BuildString("galaxy-sdn"))
 }
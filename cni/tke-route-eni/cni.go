@@ -26,8 +26,7 @@ import (
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
-	current "github.com/containernetworking/cni/pkg/types/current"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	cniSpecVersion "github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/containernetworking/plugins/pkg/ns"
@@ -35,6 +34,7 @@ import (
 	"github.com/vishvananda/netlink"
 
 	galaxyIpam "tkestack.io/galaxy/cni/ipam"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 )
 
 const (
@@ -44,6 +44,8 @@ const (
 
 var (
 	defaultRouteTable = 1
+	// gatewayIP is the dummy next hop of pod's default route
+	gatewayIP = net.IPv4(169, 254, 1, 1)
 )
 
 type NetConf struct {
@@ -133,15 +135,13 @@ func cmdAdd(args *skel.CmdArgs) error {
 	if err != nil {
 		return err
 	}
-	result020, err := t020.GetResult(results[0])
-	if err != nil {
-		return err
+	savedIP := cniutil.ResultIPv4(results[0])
+	if savedIP == nil {
+		return fmt.Errorf("no ipv4 address allocated")
 	}
 
-	savedIP := result020.IP4.IP
-
 	addr := &net.IPNet{
-		IP:   savedIP.IP,
+		IP:   savedIP,
 		Mask: net.IPv4Mask(255, 255, 255, 255),
 	}
 
@@ -158,19 +158,24 @@ func cmdAdd(args *skel.CmdArgs) error {
 	contIndex := 1
 	ips := []*current.IPConfig{
 		{
-			Version:   "4",
 			Address:   *addr,
+			Gateway:   gatewayIP,
 			Interface: &contIndex,
 		},
 	}
 
 	result := &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
 		IPs:        ips,
 		Interfaces: infList,
-		DNS:        conf.DNS,
+		Routes: []*types.Route{
+			{Dst: net.IPNet{IP: gatewayIP, Mask: net.CIDRMask(32, 32)}},
+			{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, GW: gatewayIP},
+		},
+		DNS: conf.DNS,
 	}
 
-	return types.PrintResult(result, conf.CNIVersion)
+	return cniutil.PrintResult(result, conf.CNIVersion)
 }
 
 // generateHostVethName returns a name to be used on the host-side veth device.
@@ -191,13 +196,11 @@ func cmdDel(args *skel.CmdArgs) error {
 	if err != nil {
 		return err
 	}
-	result020, err := t020.GetResult(results[0])
-	if err != nil {
-		return err
+	savedIP := cniutil.ResultIPv4(results[0])
+	if savedIP == nil {
+		return fmt.Errorf("no ipv4 address allocated")
 	}
 
-	savedIP := result020.IP4.IP.IP
-
 	err = cleanHostRule(savedIP.String(), *conf.RouteTable)
 	if err != nil {
 		return fmt.Errorf("args %s savedIP %s %v", args.Args, savedIP.String(), err)
@@ -223,7 +226,23 @@ func cmdDel(args *skel.CmdArgs) error {
 }
 
 func cmdCheck(args *skel.CmdArgs) error {
-	return nil
+	conf, k8sArgs, err := loadConfAndK8SArgs(args)
+	if err != nil {
+		return err
+	}
+	prevResult, err := cniutil.GetPrevResult(&conf.NetConf)
+	if err != nil {
+		return err
+	}
+	if cniutil.ResultIPv4(prevResult) == nil {
+		return fmt.Errorf("prevResult has no ipv4 address")
+	}
+	if _, err := netlink.LinkByName(conf.Eni); err != nil {
+		return fmt.Errorf("failed to get link by name %s: %v", conf.Eni, err)
+	}
+	hostVethName := generateHostVethName(vethPrefix, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
+	addr := &net.IPNet{IP: cniutil.ResultIPv4(prevResult), Mask: net.CIDRMask(32, 32)}
+	return NewDriver().CheckNS(hostVethName, args.IfName, args.Netns, addr, *conf.RouteTable)
 }
 
 func main() {
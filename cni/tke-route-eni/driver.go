@@ -24,7 +24,7 @@ import (
 	"net"
 	"syscall"
 
-	"github.com/containernetworking/cni/pkg/types/current"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/vishvananda/netlink"
 )
@@ -44,6 +44,7 @@ type NetworkAPIs interface {
 	SetupNS(hostVethName string, podVethName string, netns string, addr *net.IPNet,
 		routeTable int) ([]*current.Interface, error)
 	TeardownNS(podVethName string, netns string, routeTable int) error
+	CheckNS(hostVethName string, podVethName string, netns string, addr *net.IPNet, routeTable int) error
 }
 
 type linuxNetwork struct {
@@ -195,6 +196,62 @@ func (network *linuxNetwork) TeardownNS(podVethName string, netns string, routeT
 	return nil
 }
 
+// CheckNS checks the pod veth, the host route and the ip rules which are set up by SetupNS
+func (network *linuxNetwork) CheckNS(hostVethName string, podVethName string, netns string, addr *net.IPNet,
+	routeTable int) error {
+	if err := ns.WithNetNSPath(netns, func(_ ns.NetNS) error {
+		return checkContainerNetwork(podVethName, addr)
+	}); err != nil {
+		return fmt.Errorf("failed to check container network: %v", err)
+	}
+
+	hostVeth, err := netlink.LinkByName(hostVethName)
+	if err != nil {
+		return fmt.Errorf("failed to find link %q: %v", hostVethName, err)
+	}
+	if hostVeth.Attrs().Flags&net.FlagUp == 0 {
+		return fmt.Errorf("link %q is down", hostVethName)
+	}
+	hostRoutes, err := netlink.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{
+		LinkIndex: hostVeth.Attrs().Index,
+		Dst:       &net.IPNet{IP: addr.IP, Mask: net.CIDRMask(32, 32)},
+	}, netlink.RT_FILTER_OIF|netlink.RT_FILTER_DST)
+	if err != nil {
+		return fmt.Errorf("failed to list host routes: %v", err)
+	}
+	if len(hostRoutes) == 0 {
+		return fmt.Errorf("host route to %s dev %s not found", addr.IP.String(), hostVethName)
+	}
+
+	rules, err := netlink.RuleList(netlink.FAMILY_V4)
+	if err != nil {
+		return fmt.Errorf("failed to list rules: %v", err)
+	}
+	if !hasRule(rules, addr, nil, mainRouteTable, toPodRulePriority) {
+		return fmt.Errorf("to pod rule of %s not found", addr.String())
+	}
+	if routeTable > 0 && !hasRule(rules, nil, addr, routeTable, fromPodRulePriority) {
+		return fmt.Errorf("from pod rule of %s not found", addr.String())
+	}
+	return nil
+}
+
+func hasRule(rules []netlink.Rule, dst, src *net.IPNet, table, priority int) bool {
+	for _, rule := range rules {
+		if rule.Table != table || rule.Priority != priority {
+			continue
+		}
+		if dst != nil && (rule.Dst == nil || rule.Dst.String() != dst.String()) {
+			continue
+		}
+		if src != nil && (rule.Src == nil || rule.Src.String() != src.String()) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
 type vethPairCreateContext struct {
 	hostVethName string
 	podVethName  string
@@ -300,6 +357,48 @@ func (ctx *vethPairCreateContext) setupContainerNetwork(hostNs ns.NetNS) (netlin
 	return contVeth, nil
 }
 
+func checkContainerNetwork(podVethName string, addr *net.IPNet) error {
+	podVeth, err := netlink.LinkByName(podVethName)
+	if err != nil {
+		return fmt.Errorf("failed to find link %q: %v", podVethName, err)
+	}
+	if podVeth.Attrs().Flags&net.FlagUp == 0 {
+		return fmt.Errorf("link %q is down", podVethName)
+	}
+	addrs, err := netlink.AddrList(podVeth, netlink.FAMILY_V4)
+	if err != nil {
+		return fmt.Errorf("failed to list addr of %q: %v", podVethName, err)
+	}
+	found := false
+	for _, a := range addrs {
+		if a.IPNet.String() == addr.String() {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("addr %s not found on %q", addr.String(), podVethName)
+	}
+	routes, err := netlink.RouteList(podVeth, netlink.FAMILY_V4)
+	if err != nil {
+		return fmt.Errorf("failed to list routes of %q: %v", podVethName, err)
+	}
+	gw := net.IPv4(169, 254, 1, 1)
+	gwNet := &net.IPNet{IP: gw, Mask: net.CIDRMask(32, 32)}
+	var direct, defaultGw bool
+	for _, route := range routes {
+		if route.Dst != nil && route.Dst.String() == gwNet.String() {
+			direct = true
+		} else if route.Dst == nil && gw.Equal(route.Gw) {
+			defaultGw = true
+		}
+	}
+	if !direct || !defaultGw {
+		return fmt.Errorf("routes via %s not found on %q", gw.String(), podVethName)
+	}
+	return nil
+}
+
 func addToPodRule(addr *net.IPNet) error {
 	podRule := netlink.NewRule()
 	podRule.Dst = addr
@@ -3,17 +3,16 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/containernetworking/cni/pkg/types/current"
 	"net"
 	"runtime"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
 	"github.com/containernetworking/cni/pkg/version"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
 	"github.com/vishvananda/netlink"
 	"tkestack.io/galaxy/cni/ipam"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 	"tkestack.io/galaxy/pkg/network"
 	"tkestack.io/galaxy/pkg/network/vlan"
 	"tkestack.io/galaxy/pkg/utils"
@@ -31,14 +30,35 @@ func main() {
 }
 
 func cmdDel(args *skel.CmdArgs) error {
+	ip6s, err := utils.ContainerIPv6Addrs(args.Netns)
+	if err != nil {
+		return err
+	}
 	if err := utils.DeleteAllVeth(args.Netns); err != nil {
 		return err
 	}
+	for _, ip := range ip6s {
+		if err := utils.DelNeighProxy(ip); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// cmdCheck checks all interfaces of the pod which are described by prevResult
 func cmdCheck(args *skel.CmdArgs) error {
-	return nil
+	conf := vlan.NetConf{}
+	if err := json.Unmarshal(args.StdinData, &conf); err != nil {
+		return fmt.Errorf("conf error: %v", err)
+	}
+	result, err := cniutil.GetPrevResult(&conf.NetConf)
+	if err != nil {
+		return err
+	}
+	if _, err := utils.CheckContainerIfaces(args.Netns, args.IfName, result); err != nil {
+		return err
+	}
+	return utils.CheckHostVeths(result, false)
 }
 
 func cmdAdd(args *skel.CmdArgs) error {
@@ -60,19 +80,19 @@ func cmdAdd(args *skel.CmdArgs) error {
 	ifIndex := 0
 	for i := range vlanIds {
 		vlanId := vlanIds[i]
-		result, err := t020.GetResult(results[i])
-		if err != nil {
-			return fmt.Errorf("result convert failed: %v", err)
-		}
+		result := results[i]
 		device := conf.Device
 		// fixme: make route configurable
 		if i != 0 {
-			result.IP4.Routes = []types.Route{{
-				Dst: net.IPNet{
-					IP:   result.IP4.IP.IP.Mask(result.IP4.IP.Mask),
-					Mask: result.IP4.IP.Mask,
-				},
-			}}
+			result.Routes = nil
+			for _, ipc := range result.IPs {
+				result.Routes = append(result.Routes, &types.Route{
+					Dst: net.IPNet{
+						IP:   ipc.Address.IP.Mask(ipc.Address.Mask),
+						Mask: ipc.Address.Mask,
+					},
+				})
+			}
 		}
 		var masterDevice netlink.Link
 		if masterDevice, err = vlan.SetupVlanInPureMode(device, vlanId); err != nil {
@@ -99,28 +119,20 @@ func cmdAdd(args *skel.CmdArgs) error {
 		if err := utils.VethConnectsHostWithContainer(result, args, "", suffix, src); err != nil {
 			return fmt.Errorf("veth connect failed: %v", err)
 		}
-		utils.SendGratuitousARP(masterDevice.Attrs().Name, result.IP4.IP.IP.String(), "", conf.GratuitousArpRequest)
+		for _, ipc := range result.IPs {
+			if ipc.Address.IP.To4() != nil {
+				utils.SendGratuitousARP(masterDevice.Attrs().Name, ipc.Address.IP.String(), "", conf.GratuitousArpRequest)
+				continue
+			}
+			// answer neighbor solicitations of the container ip from the underlay network
+			if err := utils.SetProxyNdp(masterDevice.Attrs().Name); err != nil {
+				return fmt.Errorf("error set proxy_ndp: %v", err)
+			}
+			if err := utils.AddNeighProxy(ipc.Address.IP, masterDevice); err != nil {
+				return err
+			}
+		}
 	}
 	args.IfName = ifName
-	result, _ := t020.GetResult(results[0])
-	if conf.CNIVersion == result.CNIVersion || conf.CNIVersion == "" {
-		return result.Print()
-	}
-
-	currentResult := &current.Result{}
-	currentResult.IPs = []*current.IPConfig{
-		{
-			Version: "4",
-			Gateway: result.IP4.Gateway,
-			Address: result.IP4.IP,
-		},
-	}
-	currentResult.Routes = []*types.Route{}
-
-	for _, r := range result.IP4.Routes {
-		currentResult.Routes = append(currentResult.Routes, &r)
-	}
-	currentResult.CNIVersion = conf.CNIVersion
-	currentResult.DNS = result.DNS
-	return currentResult.Print()
+	return cniutil.PrintResult(cniutil.MergeResults(results...), conf.CNIVersion)
 }
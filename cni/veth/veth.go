@@ -19,19 +19,19 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/containernetworking/cni/pkg/types/current"
 	"net"
 	"os"
 	"runtime"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ipam"
 	"github.com/containernetworking/plugins/pkg/ns"
 	bv "github.com/containernetworking/plugins/pkg/utils/buildversion"
 	"github.com/vishvananda/netlink"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 	"tkestack.io/galaxy/pkg/utils"
 )
 
@@ -66,7 +66,7 @@ func addHostRoute(containerIP *net.IPNet, vethHostName string, src string) error
 }
 
 // #lizard forgives
-func connectsHostWithContainer(result *t020.Result, args *skel.CmdArgs, conf *VethConf) error {
+func connectsHostWithContainer(result *current.Result, args *skel.CmdArgs, conf *VethConf) error {
 	mask32 := net.IPv4Mask(255, 255, 255, 255)
 	linkLocalAddress := net.IPv4(169, 254, 1, 1)
 	defaultDst := net.IPNet{IP: net.IPv4(0, 0, 0, 0), Mask: net.IPv4Mask(0, 0, 0, 0)}
@@ -75,16 +75,16 @@ func connectsHostWithContainer(result *t020.Result, args *skel.CmdArgs, conf *Ve
 	//ip netns exec $ctn ip route add default via 169.254.1.1 dev veth_sbx scope global
 
 	//only for outprint of the plugin.
-	result.IP4 = &t020.IPConfig{
-		IP: net.IPNet{
-			IP:   result.IP4.IP.IP,
+	result.IPs = []*current.IPConfig{{
+		Address: net.IPNet{
+			IP:   cniutil.ResultIPv4(result),
 			Mask: mask32,
 		},
 		Gateway: linkLocalAddress,
-		Routes: []types.Route{
-			{Dst: net.IPNet{IP: linkLocalAddress, Mask: mask32}},
-			{Dst: defaultDst, GW: linkLocalAddress},
-		},
+	}}
+	result.Routes = []*types.Route{
+		{Dst: net.IPNet{IP: linkLocalAddress, Mask: mask32}},
+		{Dst: defaultDst, GW: linkLocalAddress},
 	}
 	host, sbox, err := utils.CreateVeth(args.ContainerID, conf.Mtu, "")
 	if err != nil {
@@ -116,12 +116,15 @@ func connectsHostWithContainer(result *t020.Result, args *skel.CmdArgs, conf *Ve
 	if err = netlink.LinkSetNsFd(sbox, int(netns.Fd())); err != nil {
 		return fmt.Errorf("failed to move sbox device %q to netns: %v", sbox.Attrs().Name, err)
 	}
+	container := &current.Interface{Name: args.IfName, Mac: sbox.Attrs().HardwareAddr.String(), Sandbox: args.Netns}
+	cniutil.AddInterfaces(result, &current.Interface{Name: host.Attrs().Name,
+		Mac: host.Attrs().HardwareAddr.String()}, container)
 	return netns.Do(func(_ ns.NetNS) error {
 		if err := netlink.LinkSetName(sbox, args.IfName); err != nil {
 			return fmt.Errorf("failed to rename sbox device %q to %q: %v", sbox.Attrs().Name, args.IfName, err)
 		}
 		// Add IP and routes to sbox, including default route
-		if err := configureIface(args.IfName, &result.IP4.IP, []netlink.Route{
+		if err := configureIface(args.IfName, &result.IPs[0].Address, []netlink.Route{
 			{Dst: &net.IPNet{IP: linkLocalAddress, Mask: mask32}, Scope: netlink.SCOPE_LINK},
 			{Dst: &defaultDst, Gw: linkLocalAddress, Scope: netlink.SCOPE_UNIVERSE},
 		}); err != nil {
@@ -182,47 +185,21 @@ func cmdAdd(args *skel.CmdArgs) error {
 	if err != nil {
 		return err
 	}
-	result020, err := generalResult.GetAsVersion(t020.ImplementedSpecVersion)
+	result, err := current.NewResultFromResult(generalResult)
 	if err != nil {
 		return err
 	}
-	result, ok := result020.(*t020.Result)
-	if !ok {
-		return fmt.Errorf("failed to convert result")
-	}
-	if result.IP4 == nil {
+	if cniutil.ResultIPv4(result) == nil {
 		return fmt.Errorf("IPAM plugin returned missing IPv4 config")
 	}
 	if err := connectsHostWithContainer(result, args, conf); err != nil {
 		return err
 	}
-	if err := addHostRoute(&result.IP4.IP, utils.HostVethName(args.ContainerID, ""), conf.RouteSrc); err != nil {
+	if err := addHostRoute(&result.IPs[0].Address, utils.HostVethName(args.ContainerID, ""), conf.RouteSrc); err != nil {
 		return err
 	}
 	result.DNS = conf.DNS
-
-	isCurrent := false
-	for _, v := range current.SupportedVersions {
-		if v == generalResult.Version() {
-			isCurrent = true
-		}
-	}
-	if !isCurrent {
-		return result.Print()
-	}
-	currentResult, ok := generalResult.(*current.Result)
-	if ok {
-		for _, v := range currentResult.IPs {
-			if v.Version == "4" {
-				v.Address = result.IP4.IP
-				v.Gateway = result.IP4.Gateway
-				for _, route := range result.IP4.Routes {
-					currentResult.Routes = append(currentResult.Routes, &route)
-				}
-			}
-		}
-	}
-	return currentResult.Print()
+	return cniutil.PrintResult(result, conf.CNIVersion)
 }
 
 func cmdDel(args *skel.CmdArgs) error {
@@ -246,7 +223,21 @@ func cmdDel(args *skel.CmdArgs) error {
 }
 
 func cmdCheck(args *skel.CmdArgs) error {
-	return nil
+	conf, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+	result, err := cniutil.GetPrevResult(&conf.NetConf)
+	if err != nil {
+		return err
+	}
+	if cniutil.ResultIPv4(result) == nil {
+		return fmt.Errorf("prevResult missing IPv4 config")
+	}
+	if _, err := utils.CheckContainerIfaces(args.Netns, args.IfName, result); err != nil {
+		return err
+	}
+	return utils.CheckHostVeths(result, false)
 }
 
 func main() {
@@ -34,7 +34,7 @@ import (
 	"tkestack.io/galaxy/pkg/galaxy"
 
 	t020 "github.com/containernetworking/cni/pkg/types/020"
-	current "github.com/containernetworking/cni/pkg/types/current"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	glog "k8s.io/klog"
@@ -2,3 +2,4 @@
 
 package=tkestack.io/galaxy
 docker run --rm -v `pwd`:/go/src/$package -w /go/src/$package golang:1.11.4 go build -o /go/src/$package/bin/netlink_monitor -v $package/tools/netlink_monitor
+docker run --rm -v `pwd`:/go/src/$package -w /go/src/$package golang:1.11.4 go build -o /go/src/$package/bin/ipam_migrate -v $package/tools/ipam_migrate
@@ -28,8 +28,17 @@ set -o pipefail
   --output-base=./ \
   -h "$PWD/hack/boilerplate.go.txt"
 
+# v1 has deepcopy only since galaxy-ipam reads and writes the v1alpha1 storage version
+./hack/generate-groups.sh "deepcopy" \
+  tkestack.io/galaxy/pkg/ipam/client tkestack.io/galaxy/pkg/ipam/apis \
+  galaxy:v1 \
+  --output-base=./ \
+  -h "$PWD/hack/boilerplate.go.txt"
+
 rm ./pkg/ipam/apis/galaxy/v1alpha1/zz_generated.deepcopy.go
 cp tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1/zz_generated.deepcopy.go ./pkg/ipam/apis/galaxy/v1alpha1/zz_generated.deepcopy.go
+rm ./pkg/ipam/apis/galaxy/v1/zz_generated.deepcopy.go
+cp tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1/zz_generated.deepcopy.go ./pkg/ipam/apis/galaxy/v1/zz_generated.deepcopy.go
 
 rm -r ./pkg/ipam/client
 cp -r tkestack.io/galaxy/pkg/ipam/client ./pkg/ipam/
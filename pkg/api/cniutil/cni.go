@@ -32,9 +32,11 @@ import (
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	t020 "github.com/containernetworking/cni/pkg/types/020"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/cni/pkg/version"
 	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 )
@@ -53,8 +55,9 @@ const (
 	CNI_IFNAME      = "CNI_IFNAME"
 	CNI_PATH        = "CNI_PATH"
 
-	COMMAND_ADD = "ADD"
-	COMMAND_DEL = "DEL"
+	COMMAND_ADD   = "ADD"
+	COMMAND_DEL   = "DEL"
+	COMMAND_CHECK = "CHECK"
 
 	// CNITimeoutSec is set to be slightly less than 240sec/4mins, which is the default remote runtime request timeout.
 	CNITimeoutSec = 220
@@ -146,6 +149,36 @@ func DelegateDel(netconf map[string]interface{}, args *skel.CmdArgs, ifName stri
 	})
 }
 
+// DelegateCheck calles delegate cni binary to execute cmdCheck
+func DelegateCheck(netconf map[string]interface{}, args *skel.CmdArgs, ifName string) error {
+	cniTimeoutCtx, cancelFunc := context.WithTimeout(context.Background(), CNITimeoutSec*time.Second)
+	defer cancelFunc()
+	netconfBytes, err := json.Marshal(netconf)
+	if err != nil {
+		return fmt.Errorf("error serializing delegate netconf: %v", err)
+	}
+	typ, err := getNetworkType(netconf)
+	if err != nil {
+		return err
+	}
+	pluginPath, err := invoke.FindInPath(typ, strings.Split(args.Path, ":"))
+	if err != nil {
+		return err
+	}
+	glog.V(4).Infof("delegate check %s args %s conf %s", args.ContainerID, args.Args, string(netconfBytes))
+	return invoke.ExecPluginWithoutResult(cniTimeoutCtx, pluginPath, netconfBytes, &invoke.Args{
+		Command:       "CHECK",
+		ContainerID:   args.ContainerID,
+		NetNS:         args.Netns,
+		PluginArgsStr: args.Args,
+		IfName:        ifName,
+		Path:          args.Path,
+	}, &invoke.DefaultExec{
+		RawExec:       &invoke.RawExec{Stderr: os.Stderr},
+		PluginDecoder: version.PluginDecoder{},
+	})
+}
+
 func getNetworkType(netconf map[string]interface{}) (string, error) {
 	typ := netconf["type"]
 	if typ == nil {
@@ -160,8 +193,9 @@ func getNetworkType(netconf map[string]interface{}) (string, error) {
 	return typStr, nil
 }
 
-// CmdAdd saves networkInfos to disk and executes each cni binary to setup network
-func CmdAdd(cmdArgs *skel.CmdArgs, networkInfos []*NetworkInfo) (types.Result, error) {
+// CmdAdd saves networkInfos to disk and executes each cni binary to setup network. The result of the last network
+// of each interface is merged into the returned result, so that it lists all interfaces and ips of the pod.
+func CmdAdd(cmdArgs *skel.CmdArgs, networkInfos []*NetworkInfo) (*current.Result, error) {
 	if len(networkInfos) == 0 {
 		return nil, fmt.Errorf("No network info returned")
 	}
@@ -169,8 +203,10 @@ func CmdAdd(cmdArgs *skel.CmdArgs, networkInfos []*NetworkInfo) (types.Result, e
 		return nil, fmt.Errorf("Error save network info %v for %s: %v", networkInfos, cmdArgs.ContainerID, err)
 	}
 	var (
-		err    error
-		result types.Result
+		err       error
+		result    types.Result
+		ifNames   []string
+		ifResults = map[string]*current.Result{}
 	)
 	for idx, networkInfo := range networkInfos {
 		//append additional args from network info
@@ -178,7 +214,11 @@ func CmdAdd(cmdArgs *skel.CmdArgs, networkInfos []*NetworkInfo) (types.Result, e
 		if result != nil {
 			networkInfo.Conf["prevResult"] = result
 		}
+		var ifResult *current.Result
 		result, err = DelegateAdd(networkInfo.Conf, cmdArgs, networkInfo.IfName)
+		if err == nil {
+			ifResult, err = current.NewResultFromResult(result)
+		}
 		if err != nil {
 			//fail to add cni, then delete all established CNIs recursively
 			glog.Errorf("fail to add network %s: %v, begin to rollback and delete it", networkInfo.Args, err)
@@ -186,11 +226,24 @@ func CmdAdd(cmdArgs *skel.CmdArgs, networkInfos []*NetworkInfo) (types.Result, e
 			glog.Warningf("fail to delete cni in rollback %v", delErr)
 			return nil, fmt.Errorf("fail to establish network %s:%v", networkInfo.Args, err)
 		}
+		if networkInfo.Result, err = json.Marshal(result); err != nil {
+			return nil, fmt.Errorf("failed to marshal result of network %s: %v", networkInfo.Args, err)
+		}
+		// a chained plugin of the same interface returns the previous result with its changes
+		if _, ok := ifResults[networkInfo.IfName]; !ok {
+			ifNames = append(ifNames, networkInfo.IfName)
+		}
+		ifResults[networkInfo.IfName] = ifResult
 	}
-	if err != nil {
-		return nil, err
+	// save again to record the result of each network which is the prevResult of cmdCheck
+	if err := saveNetworkInfo(cmdArgs.ContainerID, networkInfos); err != nil {
+		glog.Warningf("Error save network info %v for %s: %v", networkInfos, cmdArgs.ContainerID, err)
+	}
+	var results []*current.Result
+	for _, ifName := range ifNames {
+		results = append(results, ifResults[ifName])
 	}
-	return result, nil
+	return MergeResults(results...), nil
 }
 
 // NetworkInfo wraps network infos which are needed for cni plugin to setup network
@@ -199,6 +252,8 @@ type NetworkInfo struct {
 	Args        map[string]string
 	Conf        map[string]interface{}
 	IfName      string
+	// Result is the result of cmdAdd returned by the cni binary
+	Result json.RawMessage `json:",omitempty"`
 }
 
 // NewNetworkInfo creates a NetworkInfo
@@ -248,25 +303,186 @@ func CmdDel(cmdArgs *skel.CmdArgs, lastIdx int) error {
 	return nil
 }
 
-// IPInfoToResult converts IPInfo to Result
-func IPInfoToResult(ipInfo *constant.IPInfo) *t020.Result {
-	return &t020.Result{
-		IP4: &t020.IPConfig{
-			IP:      net.IPNet(*ipInfo.IP),
+// CmdCheck restores networkInfos from disk and executes each cni binary to check network with the result of cmdAdd
+// as prevResult. Networks whose cni version is older than 0.4.0 don't support CHECK and are skipped.
+func CmdCheck(cmdArgs *skel.CmdArgs) error {
+	networkInfos, err := loadNetworkInfo(cmdArgs.ContainerID)
+	if err != nil {
+		return fmt.Errorf("Error load network info for %s: %v", cmdArgs.ContainerID, err)
+	}
+	args := cmdArgs.Args
+	for _, networkInfo := range networkInfos {
+		if !SupportCheck(networkInfo.Conf) {
+			glog.V(4).Infof("skip checking network %s of %s", networkInfo.NetworkType, cmdArgs.ContainerID)
+			continue
+		}
+		if len(networkInfo.Result) == 0 {
+			return fmt.Errorf("no result of network %s for %s", networkInfo.NetworkType, cmdArgs.ContainerID)
+		}
+		conf := make(map[string]interface{}, len(networkInfo.Conf)+1)
+		for k, v := range networkInfo.Conf {
+			conf[k] = v
+		}
+		conf["prevResult"] = networkInfo.Result
+		//append additional args from network info
+		cmdArgs.Args = strings.TrimRight(fmt.Sprintf("%s;%s", args, BuildCNIArgs(networkInfo.Args)), ";")
+		if err := DelegateCheck(conf, cmdArgs, networkInfo.IfName); err != nil {
+			return fmt.Errorf("failed to check network %s: %v", networkInfo.NetworkType, err)
+		}
+	}
+	return nil
+}
+
+// SupportCheck returns if the cniVersion of the netconf supports CHECK command
+func SupportCheck(netconf map[string]interface{}) bool {
+	cniVersion, _ := netconf["cniVersion"].(string)
+	if cniVersion == "" {
+		return false
+	}
+	ok, err := version.GreaterThanOrEqualTo(cniVersion, "0.4.0")
+	return err == nil && ok
+}
+
+// PrintResult prints the result as the given cniVersion, a result of 0.2.0 is printed if cniVersion is empty
+func PrintResult(result *current.Result, cniVersion string) error {
+	if cniVersion == "" {
+		cniVersion = t020.ImplementedSpecVersion
+	}
+	return types.PrintResult(result, cniVersion)
+}
+
+// GetPrevResult parses prevResult of the netconf and converts it to a current result
+func GetPrevResult(netconf *types.NetConf) (*current.Result, error) {
+	if netconf.RawPrevResult == nil {
+		return nil, fmt.Errorf("missing prevResult")
+	}
+	if err := version.ParsePrevResult(netconf); err != nil {
+		return nil, fmt.Errorf("failed to parse prevResult: %v", err)
+	}
+	return current.NewResultFromResult(netconf.PrevResult)
+}
+
+// IPInfoToResult converts IPInfo to Result with a default route of the ip family
+func IPInfoToResult(ipInfo *constant.IPInfo) *current.Result {
+	return &current.Result{
+		CNIVersion: current.ImplementedSpecVersion,
+		IPs: []*current.IPConfig{{
+			Address: net.IPNet(*ipInfo.IP),
 			Gateway: ipInfo.Gateway,
-			Routes: []types.Route{{
-				Dst: net.IPNet{
-					IP:   net.IPv4(0, 0, 0, 0),
-					Mask: net.IPv4Mask(0, 0, 0, 0),
-				},
-			}},
-		},
+		}},
+		Routes: []*types.Route{defaultRoute(ipInfo.IP.IP)},
+	}
+}
+
+func defaultRoute(ip net.IP) *types.Route {
+	if ip.To4() == nil {
+		return &types.Route{Dst: net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}}
+	}
+	return &types.Route{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}}
+}
+
+// IPInfosToResults converts IPInfos to Results, each of which is set up on an interface. An ipv6 IPInfo is merged
+// into the result of the preceding ipv4 IPInfo with the same vlan, so that a dual stack pod gets both addresses on
+// the same interface.
+func IPInfosToResults(ipInfos []constant.IPInfo) ([]uint16, []*current.Result) {
+	var (
+		vlanIDs []uint16
+		results []*current.Result
+	)
+	for i := range ipInfos {
+		result := IPInfoToResult(&ipInfos[i])
+		if ipInfos[i].IP.IP.To4() == nil {
+			merged := false
+			for j := range results {
+				if vlanIDs[j] == ipInfos[i].Vlan && ResultIPv6(results[j]) == nil {
+					results[j].IPs = append(results[j].IPs, result.IPs...)
+					results[j].Routes = append(results[j].Routes, result.Routes...)
+					merged = true
+					break
+				}
+			}
+			if merged {
+				continue
+			}
+		}
+		results = append(results, result)
+		vlanIDs = append(vlanIDs, ipInfos[i].Vlan)
 	}
+	return vlanIDs, results
 }
 
-// ConfigureIface takes the result of IPAM plugin and
-// applies to the ifName interface
-func ConfigureIface(ifName string, res *t020.Result) error {
+// ResultIP returns the first ipv4 address of the result or the first ipv6 address if the result has no ipv4 address
+func ResultIP(res *current.Result) net.IP {
+	if ip := ResultIPv4(res); ip != nil {
+		return ip
+	}
+	return ResultIPv6(res)
+}
+
+// ResultIPv4 returns the first ipv4 address of the result
+func ResultIPv4(res *current.Result) net.IP {
+	for _, ipc := range res.IPs {
+		if ipc.Address.IP.To4() != nil {
+			return ipc.Address.IP
+		}
+	}
+	return nil
+}
+
+// ResultIPv6 returns the first ipv6 address of the result
+func ResultIPv6(res *current.Result) net.IP {
+	for _, ipc := range res.IPs {
+		if ipc.Address.IP.To4() == nil {
+			return ipc.Address.IP
+		}
+	}
+	return nil
+}
+
+// AddInterfaces appends the host side interface if it is not nil and the container interface to the result, ips
+// of the result which are not assigned to any interface are assigned to the container interface
+func AddInterfaces(res *current.Result, host, container *current.Interface) {
+	if host != nil {
+		res.Interfaces = append(res.Interfaces, host)
+	}
+	res.Interfaces = append(res.Interfaces, container)
+	for _, ipc := range res.IPs {
+		if ipc.Interface == nil {
+			ipc.Interface = current.Int(len(res.Interfaces) - 1)
+		}
+	}
+}
+
+// MergeResults merges results of different interfaces into one result, interface indexes of ips are shifted
+// accordingly. DNS of the first result which has nameservers is kept.
+func MergeResults(results ...*current.Result) *current.Result {
+	merged := &current.Result{CNIVersion: current.ImplementedSpecVersion}
+	for _, res := range results {
+		offset := len(merged.Interfaces)
+		for _, iface := range res.Interfaces {
+			merged.Interfaces = append(merged.Interfaces, iface.Copy())
+		}
+		for _, ipc := range res.IPs {
+			ipc = ipc.Copy()
+			if ipc.Interface != nil {
+				ipc.Interface = current.Int(*ipc.Interface + offset)
+			}
+			merged.IPs = append(merged.IPs, ipc)
+		}
+		for _, route := range res.Routes {
+			merged.Routes = append(merged.Routes, route.Copy())
+		}
+		if len(merged.DNS.Nameservers) == 0 {
+			merged.DNS = *res.DNS.Copy()
+		}
+	}
+	return merged
+}
+
+// ConfigureIface takes the result of IPAM plugin and applies ips which are not assigned to other interfaces and
+// routes to the ifName interface. Routes without gateway are routed via the gateway of the first ip of the same
+// family.
+func ConfigureIface(ifName string, res *current.Result) error {
 	link, err := netlink.LinkByName(ifName)
 	if err != nil {
 		return fmt.Errorf("failed to lookup %q: %v", ifName, err)
@@ -276,16 +492,34 @@ func ConfigureIface(ifName string, res *t020.Result) error {
 		return fmt.Errorf("failed to set %q UP: %v", ifName, err)
 	}
 
-	// TODO(eyakubovich): IPv6
-	addr := &netlink.Addr{IPNet: &res.IP4.IP, Label: ""}
-	if err = netlink.AddrAdd(link, addr); err != nil {
-		return fmt.Errorf("failed to add IP addr to %q: %v", ifName, err)
+	var v4gw, v6gw net.IP
+	for _, ipc := range res.IPs {
+		if ipc.Interface != nil && *ipc.Interface < len(res.Interfaces) &&
+			res.Interfaces[*ipc.Interface].Name != ifName {
+			continue
+		}
+		addr := &netlink.Addr{IPNet: &ipc.Address, Label: ""}
+		if ipc.Address.IP.To4() == nil {
+			// skip duplicate address detection, the ip is assigned by galaxy-ipam
+			addr.Flags = unix.IFA_F_NODAD
+			if v6gw == nil {
+				v6gw = ipc.Gateway
+			}
+		} else if v4gw == nil {
+			v4gw = ipc.Gateway
+		}
+		if err = netlink.AddrAdd(link, addr); err != nil {
+			return fmt.Errorf("failed to add IP addr %s to %q: %v", ipc.Address.String(), ifName, err)
+		}
 	}
 
-	for _, r := range res.IP4.Routes {
+	for _, r := range res.Routes {
 		gw := r.GW
 		if gw == nil {
-			gw = res.IP4.Gateway
+			gw = v4gw
+			if r.Dst.IP.To4() == nil {
+				gw = v6gw
+			}
 		}
 		if err = ip.AddRoute(&r.Dst, gw, link); err != nil {
 			// we skip over duplicate routes as we assume the first one wins
@@ -298,7 +532,7 @@ func ConfigureIface(ifName string, res *t020.Result) error {
 	return nil
 }
 
-const (
+var (
 	stateDir = "/var/lib/cni/galaxy"
 )
 
@@ -315,10 +549,13 @@ func saveNetworkInfo(containerID string, infos []*NetworkInfo) error {
 }
 
 func consumeNetworkInfo(containerID string) ([]*NetworkInfo, error) {
+	defer os.Remove(filepath.Join(stateDir, containerID)) // nolint: errcheck
+	return loadNetworkInfo(containerID)
+}
+
+func loadNetworkInfo(containerID string) ([]*NetworkInfo, error) {
 	var infos []*NetworkInfo
 	path := filepath.Join(stateDir, containerID)
-	defer os.Remove(path) // nolint: errcheck
-
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return infos, err
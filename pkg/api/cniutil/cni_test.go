@@ -20,9 +20,16 @@ import (
 	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	t020 "github.com/containernetworking/cni/pkg/types/020"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 )
 
 func TestReverse(t *testing.T) {
@@ -71,3 +78,207 @@ func TestGetNetworkConfig(t *testing.T) {
 		t.Fatalf("nc %s, err %v", string(nc), err)
 	}
 }
+
+func TestIPInfosToResults(t *testing.T) {
+	var ipInfos []constant.IPInfo
+	if err := json.Unmarshal([]byte(`[{"ip":"10.0.0.2/24","vlan":2,"gateway":"10.0.0.1"},
+{"ip":"2001:db8::2/64","vlan":2,"gateway":"2001:db8::1"},{"ip":"10.0.1.2/24","vlan":3,"gateway":"10.0.1.1"}]`),
+		&ipInfos); err != nil {
+		t.Fatal(err)
+	}
+	vlanIDs, results := IPInfosToResults(ipInfos)
+	if len(results) != 2 || len(vlanIDs) != 2 || vlanIDs[0] != 2 || vlanIDs[1] != 3 {
+		t.Fatalf("expect ipv6 merged into the result of vlan 2, got %v %v", vlanIDs, results)
+	}
+	if len(results[0].IPs) != 2 || results[0].IPs[0].Address.String() != "10.0.0.2/24" ||
+		results[0].IPs[1].Address.String() != "2001:db8::2/64" || len(results[0].Routes) != 2 ||
+		results[0].Routes[1].Dst.String() != "::/0" {
+		t.Fatalf("unexpected result %v", results[0])
+	}
+	if ResultIPv6(results[1]) != nil || !ResultIP(results[1]).Equal(net.ParseIP("10.0.1.2")) {
+		t.Fatalf("unexpected result %v", results[1])
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	var ipInfos []constant.IPInfo
+	if err := json.Unmarshal([]byte(`[{"ip":"10.0.0.2/24","vlan":2,"gateway":"10.0.0.1"},
+{"ip":"2001:db8::2/64","vlan":2,"gateway":"2001:db8::1"},{"ip":"10.0.1.2/24","vlan":3,"gateway":"10.0.1.1"}]`),
+		&ipInfos); err != nil {
+		t.Fatal(err)
+	}
+	_, results := IPInfosToResults(ipInfos)
+	AddInterfaces(results[0], &current.Interface{Name: "v-h1"}, &current.Interface{Name: "eth0", Sandbox: "ns"})
+	AddInterfaces(results[1], &current.Interface{Name: "v-h2"}, &current.Interface{Name: "eth1", Sandbox: "ns"})
+	results[1].DNS = types.DNS{Nameservers: []string{"10.0.0.10"}}
+	merged := MergeResults(results...)
+	data, err := json.Marshal(merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"cniVersion":"1.0.0","interfaces":[{"name":"v-h1"},{"name":"eth0","sandbox":"ns"},{"name":"v-h2"},` +
+		`{"name":"eth1","sandbox":"ns"}],"ips":[{"interface":1,"address":"10.0.0.2/24","gateway":"10.0.0.1"},` +
+		`{"interface":1,"address":"2001:db8::2/64","gateway":"2001:db8::1"},{"interface":3,"address":"10.0.1.2/24",` +
+		`"gateway":"10.0.1.1"}],"routes":[{"dst":"0.0.0.0/0"},{"dst":"::/0"},{"dst":"0.0.0.0/0"}],` +
+		`"dns":{"nameservers":["10.0.0.10"]}}`
+	if string(data) != expect {
+		t.Fatalf("expect %s, got %s", expect, string(data))
+	}
+	// results of old versions keep the first ipv4 and ipv6 address
+	legacy, err := merged.GetAsVersion("0.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result020, err := t020.GetResult(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result020.IP4.IP.String() != "10.0.0.2/24" || result020.IP6.IP.String() != "2001:db8::2/64" {
+		t.Fatalf("unexpected result %v", result020)
+	}
+}
+
+func TestLoadNetworkInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadNetworkInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	stateDir = dir
+	infos := []*NetworkInfo{{NetworkType: "n1", Conf: map[string]interface{}{"cniVersion": "0.4.0"},
+		Result: json.RawMessage(`{"cniVersion":"0.4.0","ips":[{"version":"4","address":"10.0.0.2/24"}]}`)}}
+	if err := saveNetworkInfo("ctn1", infos); err != nil {
+		t.Fatal(err)
+	}
+	// load doesn't remove the file so that cmdCheck can be invoked repeatedly
+	for i := 0; i < 2; i++ {
+		loaded, err := loadNetworkInfo("ctn1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(loaded) != 1 || string(loaded[0].Result) != string(infos[0].Result) {
+			t.Fatalf("unexpected network infos %v", loaded)
+		}
+	}
+	if _, err := consumeNetworkInfo("ctn1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadNetworkInfo("ctn1"); !os.IsNotExist(err) {
+		t.Fatalf("expect not exist error, got %v", err)
+	}
+}
+
+func TestCmdCheckSkipsOldVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCmdCheckSkipsOldVersion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	stateDir = dir
+	// delegates which don't exist in the cni path will fail the check if they are invoked
+	infos := []*NetworkInfo{
+		{NetworkType: "n1", Conf: map[string]interface{}{"type": "not-exist", "cniVersion": "0.3.1"}},
+		{NetworkType: "n2", Conf: map[string]interface{}{"type": "not-exist"}},
+	}
+	if err := saveNetworkInfo("ctn1", infos); err != nil {
+		t.Fatal(err)
+	}
+	if err := CmdCheck(&skel.CmdArgs{ContainerID: "ctn1", Path: dir}); err != nil {
+		t.Fatal(err)
+	}
+	infos = append(infos, &NetworkInfo{NetworkType: "n3",
+		Conf: map[string]interface{}{"type": "not-exist", "cniVersion": "0.4.0"}})
+	if err := saveNetworkInfo("ctn1", infos); err != nil {
+		t.Fatal(err)
+	}
+	if err := CmdCheck(&skel.CmdArgs{ContainerID: "ctn1", Path: dir}); err == nil {
+		t.Fatal("expect error of missing result")
+	}
+	if err := CmdCheck(&skel.CmdArgs{ContainerID: "ctn2", Path: dir}); err == nil {
+		t.Fatal("expect error of missing network info")
+	}
+}
+
+// fakeDelegate records the stdin of each command into <plugin>.<command> and returns a result for ADD. CHECK fails
+// if prevResult is missing.
+const fakeDelegate = `#!/bin/sh
+cat > "$0.$CNI_COMMAND"
+case "$CNI_COMMAND" in
+ADD)
+  echo '{"cniVersion":"0.4.0","interfaces":[{"name":"eth0","sandbox":"/proc/1/ns/net"}],` +
+	`"ips":[{"version":"4","address":"10.0.0.2/24","interface":0}]}'
+  ;;
+CHECK)
+  grep -q prevResult "$0.CHECK" || exit 1
+  ;;
+esac
+`
+
+func TestCmdCheckDelegate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCmdCheckDelegate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	stateDir = dir
+	plugin := filepath.Join(dir, "fake-cni")
+	if err := ioutil.WriteFile(plugin, []byte(fakeDelegate), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmdArgs := &skel.CmdArgs{ContainerID: "ctn1", Netns: "/proc/1/ns/net", IfName: "eth0", Path: dir}
+	infos := []*NetworkInfo{NewNetworkInfo("fake", map[string]interface{}{"name": "fake", "type": "fake-cni",
+		"cniVersion": "0.4.0"}, "eth0")}
+	if _, err := CmdAdd(cmdArgs, infos); err != nil {
+		t.Fatal(err)
+	}
+	if err := CmdCheck(cmdArgs); err != nil {
+		t.Fatal(err)
+	}
+	// the delegate checks with the result of its ADD as prevResult
+	data, err := ioutil.ReadFile(plugin + ".CHECK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var netconf types.NetConf
+	if err := json.Unmarshal(data, &netconf); err != nil {
+		t.Fatal(err)
+	}
+	prevResult, err := GetPrevResult(&netconf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prevResult.IPs) != 1 || prevResult.IPs[0].Address.String() != "10.0.0.2/24" {
+		t.Fatalf("unexpected prevResult %v", prevResult)
+	}
+	// a failed check of the delegate fails CmdCheck
+	if err := ioutil.WriteFile(plugin, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := CmdCheck(cmdArgs); err == nil {
+		t.Fatal("expect check error")
+	}
+}
+
+func TestGetPrevResult(t *testing.T) {
+	for _, data := range []string{
+		`{"cniVersion":"0.4.0","prevResult":{"cniVersion":"0.4.0","ips":[{"version":"4","address":"10.0.0.2/24",
+"gateway":"10.0.0.1"}],"routes":[{"dst":"0.0.0.0/0"}]}}`,
+		`{"cniVersion":"0.2.0","prevResult":{"cniVersion":"0.2.0","ip4":{"ip":"10.0.0.2/24","gateway":"10.0.0.1",
+"routes":[{"dst":"0.0.0.0/0"}]}}}`,
+	} {
+		var conf types.NetConf
+		if err := json.Unmarshal([]byte(data), &conf); err != nil {
+			t.Fatal(err)
+		}
+		result, err := GetPrevResult(&conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.IPs) != 1 || result.IPs[0].Address.String() != "10.0.0.2/24" || len(result.Routes) != 1 {
+			t.Fatalf("unexpected result %v of %s", result, conf.CNIVersion)
+		}
+	}
+	if _, err := GetPrevResult(&types.NetConf{CNIVersion: "0.4.0"}); err == nil {
+		t.Fatal("expect error of missing prevResult")
+	}
+}
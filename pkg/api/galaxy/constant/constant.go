@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"time"
 
 	"tkestack.io/galaxy/pkg/utils/nets"
 )
@@ -30,6 +31,13 @@ const (
 
 	MultusCNIAnnotation = "k8s.v1.cni.cncf.io/networks"
 
+	// NamespaceDefaultNetworksAnnotation on a namespace defines the default networks of its pods which have no
+	// MultusCNIAnnotation. Its format is the same as MultusCNIAnnotation.
+	NamespaceDefaultNetworksAnnotation = "k8s.v1.cni.galaxy.io/default-networks"
+	// NamespaceDefaultArgsAnnotation on a namespace defines the extended cni args of its pods which use the default
+	// networks of the namespace. Its format is the same as ExtendedCNIArgsAnnotation.
+	NamespaceDefaultArgsAnnotation = "k8s.v1.cni.galaxy.io/default-args"
+
 	// For fip crd object which has this label, it's reserved by admin manually. IPAM will not allocate it to pods.
 	ReserveFIPLabel = "reserved"
 
@@ -50,12 +58,18 @@ const (
 	ReleasePolicyPodDelete ReleasePolicy = iota // release ip as soon as possible
 	ReleasePolicyImmutable
 	ReleasePolicyNever
+	ReleasePolicyTTL // release ip after the pod has been deleted for a period of time
 )
 
 const (
 	ReleasePolicyAnnotation = "k8s.v1.cni.galaxy.io/release-policy"
 	Immutable               = "immutable" // Release IP Only when deleting or scale down App
 	Never                   = "never"     // Never Release IP
+	TTL                     = "ttl"       // Release IP after the pod has been deleted for ReleaseTTLAnnotation
+	// ReleaseTTLAnnotation is the duration like 30m to keep ip of a deleted pod for ttl release policy
+	ReleaseTTLAnnotation = "k8s.v1.cni.galaxy.io/release-ttl"
+	// DefaultReleaseTTL is the ttl if ReleaseTTLAnnotation is not specified or invalid
+	DefaultReleaseTTL = 30 * time.Minute
 )
 
 func ConvertReleasePolicy(policyStr string) ReleasePolicy {
@@ -64,13 +78,15 @@ func ConvertReleasePolicy(policyStr string) ReleasePolicy {
 		return ReleasePolicyNever
 	case Immutable:
 		return ReleasePolicyImmutable
+	case TTL:
+		return ReleasePolicyTTL
 	default:
 		return ReleasePolicyPodDelete
 	}
 }
 
 func PolicyStr(policy ReleasePolicy) string {
-	return [...]string{"", Immutable, Never}[policy]
+	return [...]string{"", Immutable, Never, TTL}[policy]
 }
 
 const (
@@ -83,6 +99,9 @@ const (
 type CniArgs struct {
 	// RequestIPRange is the requested ip candidates to allocate, one ip per []nets.IPRange
 	RequestIPRange [][]nets.IPRange `json:"request_ip_range,omitempty"`
+	// RequestIPFamily is the requested ip families to allocate, one ip per family. It's ignored if RequestIPRange
+	// is not empty. Default is ipv4, set to ["ipv4","ipv6"] for a dual stack pod.
+	RequestIPFamily []nets.IPFamily `json:"request_ip_family,omitempty"`
 	// Common is the common args for cni plugins to setup network
 	Common CommonCniArgs `json:"common"`
 }
@@ -91,6 +110,21 @@ type CommonCniArgs struct {
 	IPInfos []IPInfo `json:"ipinfos,omitempty"`
 }
 
+// ValidateIPFamilies checks if ip families are valid and not duplicated
+func ValidateIPFamilies(families []nets.IPFamily) error {
+	seen := map[nets.IPFamily]bool{}
+	for _, family := range families {
+		if _, err := nets.ParseIPFamily(string(family)); err != nil {
+			return err
+		}
+		if seen[family] {
+			return fmt.Errorf("duplicated ip family %s", family)
+		}
+		seen[family] = true
+	}
+	return nil
+}
+
 // UnmarshalCniArgs unmarshal cni args from input str
 func UnmarshalCniArgs(str string) (*CniArgs, error) {
 	if str == "" {
@@ -100,6 +134,9 @@ func UnmarshalCniArgs(str string) (*CniArgs, error) {
 	if err := json.Unmarshal([]byte(str), &cniArgs); err != nil {
 		return nil, fmt.Errorf("unmarshal pod cni args: %v", err)
 	}
+	if err := ValidateIPFamilies(cniArgs.RequestIPFamily); err != nil {
+		return nil, fmt.Errorf("unmarshal pod cni args: %v", err)
+	}
 	return &cniArgs, nil
 }
 
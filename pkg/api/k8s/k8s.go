@@ -153,7 +153,6 @@ func ParsePodNetworkAnnotation(podNetworks string) ([]*NetworkSelectionElement,
 	}
 
 	//In multus-cni, network annotation written as <namespace>/<network name>@<ifname>
-	//Actually, namespace in annotation will be ignored in parsing
 	if strings.IndexAny(podNetworks, "[{\"") >= 0 {
 		if err := json.Unmarshal([]byte(podNetworks), &networks); err != nil {
 			return nil, fmt.Errorf("parsePodNetworkAnnotation: failed to parse pod Network Attachment Selection "+
@@ -166,12 +165,13 @@ func ParsePodNetworkAnnotation(podNetworks string) ([]*NetworkSelectionElement,
 			item = strings.TrimSpace(item)
 
 			// Parse network name (i.e. <namespace>/<network name>@<ifname>)
-			_, networkName, netIfName, err := parsePodNetworkObjectName(item)
+			netNsName, networkName, netIfName, err := parsePodNetworkObjectName(item)
 			if err != nil {
 				return nil, fmt.Errorf("parsePodNetworkAnnotation: %v", err)
 			}
 			networks = append(networks, &NetworkSelectionElement{
 				Name:             networkName,
+				Namespace:        netNsName,
 				InterfaceRequest: netIfName,
 			})
 		}
@@ -28,7 +28,7 @@ func TestParsePodNetworkAnnotation(t *testing.T) {
 		t.Errorf("case1 fail: %v", err)
 	}
 	if len(res1) == 2 {
-		if res1[0].Name != "galaxy-flannel" || res1[0].InterfaceRequest != "eth0" {
+		if res1[0].Name != "galaxy-flannel" || res1[0].InterfaceRequest != "eth0" || res1[0].Namespace != "test-ns" {
 			t.Errorf("network1 %s@%s not like galaxy-flannel@eth0", res1[0].Name, res1[0].InterfaceRequest)
 		}
 		if res1[1].Name != "galaxy-k8s-vlan" || res1[1].InterfaceRequest != "eth1" {
@@ -42,8 +42,8 @@ func TestParsePodNetworkAnnotation(t *testing.T) {
 	res3, err := ParsePodNetworkAnnotation(case3)
 	if err == nil {
 		if len(res3) == 1 {
-			if res3[0].Name != "galaxy-flannel" || res3[0].InterfaceRequest != "" {
-				t.Errorf("case3 network isn't galaxy-flannel@{empty}")
+			if res3[0].Name != "galaxy-flannel" || res3[0].InterfaceRequest != "" || res3[0].Namespace != "test-ns" {
+				t.Errorf("case3 network isn't test-ns/galaxy-flannel@{empty}")
 			}
 		} else {
 			t.Errorf("case3 parse failed: wrong network num")
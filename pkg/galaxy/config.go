@@ -0,0 +1,205 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/fsnotify/fsnotify"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/galaxy/metrics"
+)
+
+// jsonConfResyncPeriod is the interval of rereading json config in case of missing file events
+var jsonConfResyncPeriod = time.Minute
+
+// networkConfig is an immutable snapshot of json config. A CNI request uses the same snapshot from start to end even
+// if json config is reloaded meanwhile.
+type networkConfig struct {
+	JsonConf
+	// netConf maps network name to its config
+	netConf map[string]map[string]interface{}
+	// version is the sha256 of json config content
+	version  string
+	loadTime time.Time
+}
+
+// ConfigStatus is the response of GET /config
+type ConfigStatus struct {
+	Version  string    `json:"version"`
+	LoadTime time.Time `json:"loadTime"`
+	Config   JsonConf  `json:"config"`
+	// Error is the reason why the latest changed json config is rejected
+	Error string `json:"error,omitempty"`
+}
+
+func configVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// newNetworkConfig parses and validates json config
+func newNetworkConfig(data []byte) (*networkConfig, error) {
+	conf := &networkConfig{
+		netConf:  map[string]map[string]interface{}{},
+		version:  configVersion(data),
+		loadTime: time.Now(),
+	}
+	if err := json.Unmarshal(data, &conf.JsonConf); err != nil {
+		return nil, fmt.Errorf("bad config %s: %v", string(data), err)
+	}
+	for i := range conf.NetworkConf {
+		netConf := conf.NetworkConf[i]
+		// check if type is set and valid first
+		typeVal, ok := netConf["type"]
+		if !ok {
+			return nil, fmt.Errorf("bad network config %v, type is missing", netConf)
+		}
+		netType, ok := typeVal.(string)
+		if !ok {
+			return nil, fmt.Errorf("bad network config %v, type is not string", netConf)
+		}
+		var key string
+		// using name as key
+		if val, ok := netConf["name"]; ok {
+			if name, ok := val.(string); !ok {
+				return nil, fmt.Errorf("bad network config %v, name is not string", netConf)
+			} else {
+				key = name
+			}
+		} else {
+			// name empty, assume type name is network name
+			key = netType
+		}
+		if _, ok := conf.netConf[key]; ok {
+			return nil, fmt.Errorf("multiple network configuration with name %s", key)
+		}
+		conf.netConf[key] = conf.NetworkConf[i]
+	}
+	return conf, nil
+}
+
+// getConf returns the active json config
+func (g *Galaxy) getConf() *networkConfig {
+	return g.conf.Load().(*networkConfig)
+}
+
+// loadJsonConf reads json config and swaps it in if it changes. The previous config is kept if the new one is
+// invalid.
+func (g *Galaxy) loadJsonConf() error {
+	g.confLock.Lock()
+	defer g.confLock.Unlock()
+	data, err := ioutil.ReadFile(g.JsonConfigPath)
+	if err != nil {
+		return g.rejectJsonConf(fmt.Errorf("read json config: %v", err))
+	}
+	version := configVersion(data)
+	if version == g.getConf().version {
+		g.confErr = nil
+		return nil
+	}
+	if g.confErr != nil && version == g.rejectedVersion {
+		// already rejected
+		return g.confErr
+	}
+	conf, err := newNetworkConfig(data)
+	if err != nil {
+		g.rejectedVersion = version
+		return g.rejectJsonConf(err)
+	}
+	oldVersion := g.getConf().version
+	g.conf.Store(conf)
+	g.confErr = nil
+	metrics.ConfigVersion.DeleteLabelValues(oldVersion)
+	metrics.ConfigVersion.WithLabelValues(conf.version).Set(1)
+	metrics.ConfigReloadCount.WithLabelValues("success").Inc()
+	metrics.ConfigReloadTimestamp.Set(float64(conf.loadTime.Unix()))
+	glog.Infof("Json Config version %s: %s", conf.version, string(data))
+	return nil
+}
+
+func (g *Galaxy) rejectJsonConf(err error) error {
+	metrics.ConfigReloadCount.WithLabelValues("failure").Inc()
+	g.confErr = err
+	return err
+}
+
+// watchJsonConf reloads json config once the file or the ConfigMap it is mounted from changes. Kubelet updates a
+// ConfigMap volume by swapping a symlink in the same directory, so watch the directory instead of the file.
+func (g *Galaxy) watchJsonConf() {
+	quit := g.quitChan
+	var (
+		events <-chan fsnotify.Event
+		errs   <-chan error
+	)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		glog.Warningf("failed to create json config watcher, fall back to resync every %v: %v",
+			jsonConfResyncPeriod, err)
+	} else {
+		defer watcher.Close() // nolint: errcheck
+		if err := watcher.Add(filepath.Dir(g.JsonConfigPath)); err != nil {
+			glog.Warningf("failed to watch json config %s, fall back to resync every %v: %v", g.JsonConfigPath,
+				jsonConfResyncPeriod, err)
+		} else {
+			events, errs = watcher.Events, watcher.Errors
+		}
+	}
+	ticker := time.NewTicker(jsonConfResyncPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case event := <-events:
+			glog.V(4).Infof("json config event %s", event.String())
+		case err := <-errs:
+			glog.Warningf("json config watcher error: %v", err)
+			continue
+		case <-ticker.C:
+		}
+		g.reloadJsonConf()
+	}
+}
+
+func (g *Galaxy) reloadJsonConf() {
+	g.confLock.Lock()
+	lastErr := g.confErr
+	g.confLock.Unlock()
+	if err := g.loadJsonConf(); err != nil && err != lastErr {
+		glog.Errorf("rejected json config, keep using version %s: %v", g.getConf().version, err)
+	}
+}
+
+func (g *Galaxy) config(r *restful.Request, w *restful.Response) {
+	conf := g.getConf()
+	status := ConfigStatus{Version: conf.version, LoadTime: conf.loadTime, Config: conf.JsonConf}
+	g.confLock.Lock()
+	if g.confErr != nil {
+		status.Error = g.confErr.Error()
+	}
+	g.confLock.Unlock()
+	w.WriteHeaderAndEntity(http.StatusOK, status)
+}
@@ -0,0 +1,119 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func writeJsonConf(t *testing.T, path, data string) {
+	// write and rename to mimic how kubelet updates ConfigMap volumes
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadJsonConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galaxy-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	g := NewGalaxy()
+	g.JsonConfigPath = filepath.Join(dir, "galaxy.json")
+	if err := g.loadJsonConf(); err == nil {
+		t.Fatal("expect an error if json config doesn't exist")
+	}
+	writeJsonConf(t, g.JsonConfigPath, `{"NetworkConf":[{"type":"galaxy-flannel"}],"DefaultNetworks":["galaxy-flannel"]}`)
+	if err := g.loadJsonConf(); err != nil {
+		t.Fatal(err)
+	}
+	conf := g.getConf()
+	if conf.version == "" || g.confErr != nil {
+		t.Fatalf("expect a valid config, version %q, err %v", conf.version, g.confErr)
+	}
+	if _, ok := conf.netConf["galaxy-flannel"]; !ok {
+		t.Fatalf("expect network galaxy-flannel: %v", conf.netConf)
+	}
+
+	for _, invalid := range []string{
+		`{"NetworkConf":[`,
+		`{"NetworkConf":[{"name":"galaxy-flannel"}]}`,
+		`{"NetworkConf":[{"type":"galaxy-flannel"},{"type":"galaxy-flannel"}]}`,
+	} {
+		writeJsonConf(t, g.JsonConfigPath, invalid)
+		if err := g.loadJsonConf(); err == nil {
+			t.Fatalf("expect an error for config %s", invalid)
+		}
+		if g.getConf() != conf {
+			t.Fatalf("expect keeping previous config for invalid config %s", invalid)
+		}
+	}
+
+	writeJsonConf(t, g.JsonConfigPath, `{"NetworkConf":[{"type":"galaxy-flannel"},{"type":"galaxy-k8s-vlan"}],`+
+		`"DefaultNetworks":["galaxy-k8s-vlan"]}`)
+	if err := g.loadJsonConf(); err != nil {
+		t.Fatal(err)
+	}
+	newConf := g.getConf()
+	if newConf.version == conf.version || g.confErr != nil {
+		t.Fatalf("expect config reloaded, version %q, err %v", newConf.version, g.confErr)
+	}
+	if !reflect.DeepEqual(newConf.DefaultNetworks, []string{"galaxy-k8s-vlan"}) {
+		t.Fatalf("expect default networks galaxy-k8s-vlan: %v", newConf.DefaultNetworks)
+	}
+	// the previous snapshot used by in-flight requests is untouched
+	if !reflect.DeepEqual(conf.DefaultNetworks, []string{"galaxy-flannel"}) || len(conf.netConf) != 1 {
+		t.Fatalf("previous config changed: %v, %v", conf.DefaultNetworks, conf.netConf)
+	}
+}
+
+func TestWatchJsonConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "galaxy-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	g := NewGalaxy()
+	g.JsonConfigPath = filepath.Join(dir, "galaxy.json")
+	writeJsonConf(t, g.JsonConfigPath, `{"NetworkConf":[{"type":"galaxy-flannel"}],"DefaultNetworks":["galaxy-flannel"]}`)
+	if err := g.loadJsonConf(); err != nil {
+		t.Fatal(err)
+	}
+	go g.watchJsonConf()
+	defer g.Stop() // nolint: errcheck
+	// wait for the watcher to start
+	time.Sleep(100 * time.Millisecond)
+	writeJsonConf(t, g.JsonConfigPath, `{"NetworkConf":[{"type":"galaxy-k8s-vlan"}],"DefaultNetworks":["galaxy-k8s-vlan"]}`)
+	if err := wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		conf := g.getConf()
+		return len(conf.DefaultNetworks) == 1 && conf.DefaultNetworks[0] == "galaxy-k8s-vlan", nil
+	}); err != nil {
+		t.Fatalf("json config is not reloaded: %v", g.getConf().JsonConf)
+	}
+}
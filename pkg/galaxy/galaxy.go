@@ -17,16 +17,20 @@
 package galaxy
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/api/docker"
+	"tkestack.io/galaxy/pkg/galaxy/metrics"
 	"tkestack.io/galaxy/pkg/galaxy/options"
 	"tkestack.io/galaxy/pkg/gc"
 	"tkestack.io/galaxy/pkg/network/kernel"
@@ -36,14 +40,23 @@ import (
 )
 
 type Galaxy struct {
-	JsonConf
 	*options.ServerRunOptions
 	quitChan  chan struct{}
 	dockerCli *docker.DockerInterface
-	netConf   map[string]map[string]interface{}
 	pmhandler *portmapping.PortMappingHandler
 	client    kubernetes.Interface
 	pm        *policy.PolicyManager
+	// dynamicClient and nadLister are used to resolve networks from NetworkAttachmentDefinition objects
+	dynamicClient dynamic.Interface
+	nadLister     cache.GenericLister
+	// namespaceLister is used to resolve default networks of namespaces
+	namespaceLister corelisters.NamespaceLister
+	// conf stores the active *networkConfig which is swapped on reloading json config
+	conf     atomic.Value
+	confLock sync.Mutex
+	// confErr is the error of the latest rejected json config whose version is rejectedVersion
+	confErr         error
+	rejectedVersion string
 }
 
 type JsonConf struct {
@@ -58,8 +71,8 @@ func NewGalaxy() *Galaxy {
 	g := &Galaxy{
 		ServerRunOptions: options.NewServerRunOptions(),
 		quitChan:         make(chan struct{}),
-		netConf:          map[string]map[string]interface{}{},
 	}
+	g.conf.Store(&networkConfig{netConf: map[string]map[string]interface{}{}})
 	return g
 }
 
@@ -67,15 +80,7 @@ func (g *Galaxy) Init() error {
 	if g.JsonConfigPath == "" {
 		return fmt.Errorf("json config is required")
 	}
-	data, err := ioutil.ReadFile(g.JsonConfigPath)
-	if err != nil {
-		return fmt.Errorf("read json config: %v", err)
-	}
-	if err := json.Unmarshal(data, &g.JsonConf); err != nil {
-		return fmt.Errorf("bad config %s: %v", string(data), err)
-	}
-	glog.Infof("Json Config: %s", string(data))
-	if err := g.checkNetworkConf(); err != nil {
+	if err := g.loadJsonConf(); err != nil {
 		return err
 	}
 	dockerClient, err := docker.NewDockerInterface()
@@ -87,42 +92,12 @@ func (g *Galaxy) Init() error {
 	return nil
 }
 
-func (g *Galaxy) checkNetworkConf() error {
-	for i := range g.NetworkConf {
-		netConf := g.NetworkConf[i]
-		// check if type is set and valid first
-		typeVal, ok := netConf["type"]
-		if !ok {
-			return fmt.Errorf("bad network config %v, type is missing", netConf)
-		}
-		netType, ok := typeVal.(string)
-		if !ok {
-			return fmt.Errorf("bad network config %v, type is not string", netConf)
-		}
-		var key string
-		// using name as key
-		if val, ok := netConf["name"]; ok {
-			if name, ok := val.(string); !ok {
-				return fmt.Errorf("bad network config %v, name is not string", netConf)
-			} else {
-				key = name
-			}
-		} else {
-			// name empty, assume type name is network name
-			key = netType
-		}
-		if _, ok := g.netConf[key]; ok {
-			return fmt.Errorf("multiple network configuration with name %s", key)
-		}
-		g.netConf[key] = g.NetworkConf[i]
-	}
-	return nil
-}
-
 func (g *Galaxy) Start() error {
 	if err := g.Init(); err != nil {
 		return err
 	}
+	metrics.MustRegister()
+	go g.watchJsonConf()
 	g.initk8sClient()
 	gc.NewFlannelGC(g.client, g.dockerCli, g.quitChan, g.cleanIPtables).Run()
 	kernel.BridgeNFCallIptables(g.quitChan, g.BridgeNFCallIptables)
@@ -130,6 +105,10 @@ func (g *Galaxy) Start() error {
 	if err := g.setupIPtables(); err != nil {
 		return err
 	}
+	g.initNamespaceInformer()
+	if g.NetworkAttachmentDefinition {
+		g.initNetworkAttachmentDefinitionInformer()
+	}
 	if g.NetworkPolicy {
 		g.pm = policy.New(g.client, g.quitChan)
 		go wait.Until(g.pm.Run, 3*time.Minute, g.quitChan)
@@ -162,6 +141,10 @@ func (g *Galaxy) initk8sClient() {
 	if err != nil {
 		glog.Fatalf("Can not generate client from config: error(%v)", err)
 	}
+	g.dynamicClient, err = dynamic.NewForConfig(clientConfig)
+	if err != nil {
+		glog.Fatalf("Can not generate dynamic client from config: error(%v)", err)
+	}
 	glog.Infof("apiserver address %s", clientConfig.Host)
 }
 
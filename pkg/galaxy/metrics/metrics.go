@@ -0,0 +1,46 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ConfigVersion = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "galaxy_config_version_info",
+			Help: "Version of the active galaxy json config, the value is always 1",
+		}, []string{"version"})
+
+	ConfigReloadCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_config_reload_total",
+			Help: "Galaxy json config reload count by result",
+		}, []string{"result"})
+
+	ConfigReloadTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "galaxy_config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful galaxy json config reload",
+		})
+)
+
+// MustRegister registers all metrics
+func MustRegister() {
+	prometheus.MustRegister(ConfigVersion, ConfigReloadCount, ConfigReloadTimestamp)
+}
@@ -0,0 +1,88 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	glog "k8s.io/klog"
+)
+
+// networkAttachmentDefinitionGVR is the resource of multus NetworkAttachmentDefinition
+var networkAttachmentDefinitionGVR = schema.GroupVersionResource{
+	Group:    "k8s.cni.cncf.io",
+	Version:  "v1",
+	Resource: "network-attachment-definitions",
+}
+
+// initNetworkAttachmentDefinitionInformer starts watching NetworkAttachmentDefinition objects of all namespaces and
+// waits until the cache is synced
+func (g *Galaxy) initNetworkAttachmentDefinitionInformer() {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(g.dynamicClient, 0)
+	informer := factory.ForResource(networkAttachmentDefinitionGVR)
+	g.nadLister = informer.Lister()
+	glog.Infof("Watching network attachment definitions %s", networkAttachmentDefinitionGVR.String())
+	go informer.Informer().Run(g.quitChan)
+	cache.WaitForCacheSync(g.quitChan, informer.Informer().HasSynced)
+}
+
+// getNetworkAttachmentDefinitionConf returns the network config in spec.config of the NetworkAttachmentDefinition
+// object. It returns nil if the object doesn't exist or its config is empty.
+func (g *Galaxy) getNetworkAttachmentDefinitionConf(namespace, name string) (map[string]interface{}, error) {
+	if g.nadLister == nil || namespace == "" {
+		return nil, nil
+	}
+	obj, err := g.nadLister.ByNamespace(namespace).Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get network attachment definition %s/%s: %v", namespace, name, err)
+	}
+	nad, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("network attachment definition %s/%s can't be converted to a unstructured object",
+			namespace, name)
+	}
+	config, _, err := unstructured.NestedString(nad.UnstructuredContent(), "spec", "config")
+	if err != nil {
+		return nil, fmt.Errorf("bad network attachment definition %s/%s: %v", namespace, name, err)
+	}
+	if config == "" {
+		return nil, nil
+	}
+	return parseNetworkConf([]byte(config))
+}
+
+func parseNetworkConf(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("unmarshal networkinfo %s: %v", string(data), err)
+	}
+	// kubeconfig of host filesystem won't be reachable for galaxy.
+	// Since galaxy is running in pod, it can talk to apiserver via secret token
+	if m["kubeconfig"] != "" {
+		delete(m, "kubeconfig")
+	}
+	return m, nil
+}
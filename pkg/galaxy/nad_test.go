@@ -0,0 +1,167 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"tkestack.io/galaxy/pkg/api/k8s"
+)
+
+func newNetworkAttachmentDefinition(namespace, name, config string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "k8s.cni.cncf.io/v1",
+		"kind":       "NetworkAttachmentDefinition",
+		"metadata":   map[string]interface{}{"namespace": namespace, "name": name},
+		"spec":       map[string]interface{}{},
+	}}
+	if config != "" {
+		obj.Object["spec"] = map[string]interface{}{"config": config}
+	}
+	return obj
+}
+
+func TestGetNetworkConf(t *testing.T) {
+	confDir, err := ioutil.TempDir("", "galaxy-nad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(confDir) // nolint: errcheck
+	if err := ioutil.WriteFile(filepath.Join(confDir, "10-macvlan.conf"),
+		[]byte(`{"cniVersion":"0.4.0","name":"macvlan","type":"macvlan"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g := NewGalaxy()
+	g.NetworkConfDir = confDir
+	conf, err := newNetworkConfig([]byte(`{"NetworkConf":[{"name":"galaxy-flannel","type":"galaxy-flannel"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.dynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{networkAttachmentDefinitionGVR: "NetworkAttachmentDefinitionList"})
+	for _, nad := range []*unstructured.Unstructured{
+		newNetworkAttachmentDefinition("ns1", "galaxy-flannel", `{"type":"bridge"}`),
+		newNetworkAttachmentDefinition("ns1", "tenant-vlan", `{"type":"galaxy-k8s-vlan","kubeconfig":"/etc/kube"}`),
+		newNetworkAttachmentDefinition("ns1", "macvlan", ""),
+	} {
+		if _, err := g.dynamicClient.Resource(networkAttachmentDefinitionGVR).Namespace(nad.GetNamespace()).Create(
+			context.Background(), nad, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.initNetworkAttachmentDefinitionInformer()
+	defer g.Stop() // nolint: errcheck
+
+	for i, c := range []struct {
+		namespace, name string
+		expectType      string
+		expectErr       bool
+	}{
+		// json config takes precedence over NetworkAttachmentDefinition
+		{namespace: "ns1", name: "galaxy-flannel", expectType: "galaxy-flannel"},
+		{namespace: "ns1", name: "tenant-vlan", expectType: "galaxy-k8s-vlan"},
+		// NetworkAttachmentDefinition is namespace scoped
+		{namespace: "ns2", name: "tenant-vlan", expectErr: true},
+		// NetworkAttachmentDefinition without config falls back to confdir
+		{namespace: "ns1", name: "macvlan", expectType: "macvlan"},
+		{namespace: "ns2", name: "macvlan", expectType: "macvlan"},
+	} {
+		netConf, err := g.getNetworkConf(conf, c.namespace, c.name)
+		if c.expectErr {
+			if err == nil {
+				t.Errorf("case %d: expect an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if netConf["type"] != c.expectType {
+			t.Errorf("case %d: expect type %s, real %v", i, c.expectType, netConf["type"])
+		}
+		if _, ok := netConf["kubeconfig"]; ok {
+			t.Errorf("case %d: expect kubeconfig removed", i)
+		}
+	}
+}
+
+func TestSelectNetworksCrossNamespace(t *testing.T) {
+	confDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(confDir, "10-macvlan.conf"),
+		[]byte(`{"cniVersion":"0.4.0","name":"macvlan","type":"macvlan"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g := NewGalaxy()
+	g.NetworkConfDir = confDir
+	conf, err := newNetworkConfig([]byte(`{"NetworkConf":[{"name":"galaxy-flannel","type":"galaxy-flannel"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.dynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{networkAttachmentDefinitionGVR: "NetworkAttachmentDefinitionList"})
+	for _, nad := range []*unstructured.Unstructured{
+		newNetworkAttachmentDefinition("ns1", "tenant-vlan", `{"type":"galaxy-k8s-vlan"}`),
+		newNetworkAttachmentDefinition("ns2", "tenant-vlan", `{"type":"galaxy-k8s-vlan"}`),
+	} {
+		if _, err := g.dynamicClient.Resource(networkAttachmentDefinitionGVR).Namespace(nad.GetNamespace()).Create(
+			context.Background(), nad, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g.initNetworkAttachmentDefinitionInformer()
+	defer g.Stop() // nolint: errcheck
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}
+	for i, c := range []struct {
+		namespace, name string
+		allowCross      bool
+		expectErr       bool
+	}{
+		{name: "tenant-vlan"},
+		{namespace: "ns1", name: "tenant-vlan"},
+		// NetworkAttachmentDefinitions of other namespaces are rejected unless allowed
+		{namespace: "ns2", name: "tenant-vlan", expectErr: true},
+		{namespace: "ns2", name: "tenant-vlan", allowCross: true},
+		// json config and NetworkConfDir are cluster wide, the namespace doesn't matter
+		{namespace: "ns2", name: "galaxy-flannel"},
+		{namespace: "ns2", name: "macvlan"},
+	} {
+		g.AllowCrossNamespaceNetworks = c.allowCross
+		networkInfos, err := g.selectNetworks(conf, pod, "eth0",
+			[]*k8s.NetworkSelectionElement{{Namespace: c.namespace, Name: c.name}})
+		if c.expectErr {
+			if err == nil {
+				t.Errorf("case %d: expect an error", i)
+			}
+			continue
+		}
+		if err != nil || len(networkInfos) != 1 {
+			t.Errorf("case %d: expect a network, got %v, err %v", i, networkInfos, err)
+		}
+	}
+}
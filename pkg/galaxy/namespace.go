@@ -0,0 +1,69 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/api/k8s"
+)
+
+// initNamespaceInformer starts watching namespaces and waits until the cache is synced
+func (g *Galaxy) initNamespaceInformer() {
+	factory := informers.NewSharedInformerFactory(g.client, 0)
+	informer := factory.Core().V1().Namespaces()
+	g.namespaceLister = informer.Lister()
+	namespaceCachedInformer := informer.Informer()
+	glog.Infof("Watching namespaces")
+	go factory.Start(g.quitChan)
+	cache.WaitForCacheSync(g.quitChan, namespaceCachedInformer.HasSynced)
+}
+
+// namespaceDefaults returns the default networks and the extended cni args defined by the namespace's annotations
+func (g *Galaxy) namespaceDefaults(namespace string) ([]*k8s.NetworkSelectionElement, map[string]json.RawMessage,
+	error) {
+	if g.namespaceLister == nil {
+		return nil, nil, nil
+	}
+	ns, err := g.namespaceLister.Get(namespace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("get namespace %s: %v", namespace, err)
+	}
+	v := ns.Annotations[constant.NamespaceDefaultNetworksAnnotation]
+	if v == "" {
+		return nil, nil, nil
+	}
+	glog.V(4).Infof("namespace %s default networks annotation is %s", namespace, v)
+	networks, err := k8s.ParsePodNetworkAnnotation(v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad default networks of namespace %s: %v", namespace, err)
+	}
+	args, err := parseCommonCNIArgs(ns.Annotations[constant.NamespaceDefaultArgsAnnotation])
+	if err != nil {
+		return nil, nil, fmt.Errorf("bad default args of namespace %s: %v", namespace, err)
+	}
+	return networks, args, nil
+}
@@ -0,0 +1,123 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	galaxyapi "tkestack.io/galaxy/pkg/api/galaxy"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+)
+
+func newNamespace(name string, annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+}
+
+// #lizard forgives
+func TestResolveNetworksNamespaceDefaults(t *testing.T) {
+	conf, err := newNetworkConfig([]byte(`{"NetworkConf":[{"type":"galaxy-flannel"},{"type":"galaxy-k8s-vlan"},` +
+		`{"type":"galaxy-k8s-sriov"}],"DefaultNetworks":["galaxy-flannel"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGalaxy()
+	g.conf.Store(conf)
+	g.client = fake.NewSimpleClientset(
+		newNamespace("underlay", map[string]string{
+			constant.NamespaceDefaultNetworksAnnotation: "galaxy-k8s-vlan,galaxy-k8s-sriov@net1",
+			constant.NamespaceDefaultArgsAnnotation:     `{"common":{"ipinfos":[],"foo":"bar"}}`,
+		}),
+		newNamespace("overlay", nil),
+		newNamespace("bad", map[string]string{constant.NamespaceDefaultNetworksAnnotation: "galaxy-k8s-vlan@@eth1"}),
+	)
+	g.initNamespaceInformer()
+	defer g.Stop() // nolint: errcheck
+
+	for i, c := range []struct {
+		namespace   string
+		annotations map[string]string
+		expectErr   bool
+		expectNets  []string
+		expectIfs   []string
+		expectArgs  map[string]string
+	}{
+		{
+			namespace:  "underlay",
+			expectNets: []string{"galaxy-k8s-vlan", "galaxy-k8s-sriov"},
+			expectIfs:  []string{"eth0", "net1"},
+			expectArgs: map[string]string{"ipinfos": "[]", "foo": `"bar"`},
+		},
+		// pod's args take precedence over namespace's
+		{
+			namespace:   "underlay",
+			annotations: map[string]string{constant.ExtendedCNIArgsAnnotation: `{"common":{"foo":"baz"}}`},
+			expectNets:  []string{"galaxy-k8s-vlan", "galaxy-k8s-sriov"},
+			expectIfs:   []string{"eth0", "net1"},
+			expectArgs:  map[string]string{"ipinfos": "[]", "foo": `"baz"`},
+		},
+		// pod's networks take precedence over namespace's
+		{
+			namespace:   "underlay",
+			annotations: map[string]string{constant.MultusCNIAnnotation: "galaxy-flannel"},
+			expectNets:  []string{"galaxy-flannel"},
+			expectIfs:   []string{"eth0"},
+			expectArgs:  map[string]string{},
+		},
+		{namespace: "overlay", expectNets: []string{"galaxy-flannel"}, expectIfs: []string{"eth0"},
+			expectArgs: map[string]string{}},
+		{namespace: "not-exist", expectNets: []string{"galaxy-flannel"}, expectIfs: []string{"eth0"},
+			expectArgs: map[string]string{}},
+		{namespace: "bad", expectErr: true},
+	} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: c.namespace,
+			Annotations: c.annotations}}
+		req := &galaxyapi.PodRequest{CmdArgs: &skel.CmdArgs{IfName: "eth0"}}
+		infos, err := g.resolveNetworks(req, pod)
+		if c.expectErr {
+			if err == nil {
+				t.Errorf("case %d: expect an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if len(infos) != len(c.expectNets) {
+			t.Errorf("case %d: expect networks %v, real %d networks", i, c.expectNets, len(infos))
+			continue
+		}
+		for j := range infos {
+			if infos[j].NetworkType != c.expectNets[j] || infos[j].IfName != c.expectIfs[j] {
+				t.Errorf("case %d: expect network %s@%s, real %s@%s", i, c.expectNets[j], c.expectIfs[j],
+					infos[j].NetworkType, infos[j].IfName)
+			}
+			if len(infos[j].Args) != len(c.expectArgs) {
+				t.Errorf("case %d: expect args %v, real %v", i, c.expectArgs, infos[j].Args)
+			}
+			for k, v := range c.expectArgs {
+				if infos[j].Args[k] != v {
+					t.Errorf("case %d: expect args %v, real %v", i, c.expectArgs, infos[j].Args)
+				}
+			}
+		}
+	}
+}
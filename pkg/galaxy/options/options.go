@@ -34,6 +34,12 @@ type ServerRunOptions struct {
 	// To support dynamic changing network config or node specific network config
 	NetworkConfDir string
 	CNIPaths       []string
+	// Resolve networks from k8s.cni.cncf.io/v1 NetworkAttachmentDefinition objects of pod's namespace
+	NetworkAttachmentDefinition bool
+	// Allow pods to use NetworkAttachmentDefinitions of other namespaces, e.g. tenant-ns/macvlan-conf
+	AllowCrossNamespaceNetworks bool
+	// The address to serve prometheus metrics, metrics are always served on galaxy unix socket
+	MetricsAddress string
 }
 
 func NewServerRunOptions() *ServerRunOptions {
@@ -65,4 +71,10 @@ func (s *ServerRunOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.NetworkConfDir, "network-conf-dir", s.NetworkConfDir,
 		"Directory to additional network configs apart from those in json config")
 	fs.StringSliceVar(&s.CNIPaths, "cni-paths", s.CNIPaths, "Additional cni paths apart from those received from kubelet")
+	fs.BoolVar(&s.NetworkAttachmentDefinition, "network-attachment-definition", s.NetworkAttachmentDefinition,
+		"Resolve networks from NetworkAttachmentDefinition objects apart from those in json config")
+	fs.BoolVar(&s.AllowCrossNamespaceNetworks, "allow-cross-namespace-networks", s.AllowCrossNamespaceNetworks,
+		"Allow pods to use NetworkAttachmentDefinitions of other namespaces")
+	fs.StringVar(&s.MetricsAddress, "metrics-address", s.MetricsAddress, "The address to serve prometheus metrics, "+
+		"e.g. 127.0.0.1:9099. Disabled if empty")
 }
@@ -28,10 +28,9 @@ import (
 	"strings"
 	"time"
 
-	"github.com/containernetworking/cni/pkg/types"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
-	current "github.com/containernetworking/cni/pkg/types/current"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/emicklei/go-restful"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -55,6 +54,13 @@ func (g *Galaxy) StartServer() error {
 		}()
 	}
 	g.installHandlers()
+	if g.MetricsAddress != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+			glog.Fatal(http.ListenAndServe(g.MetricsAddress, mux))
+		}()
+	}
 	if err := os.MkdirAll(private.GalaxySocketDir, 0755); err != nil {
 		return fmt.Errorf("failed to create %s: %v", private.GalaxySocketDir, err)
 	}
@@ -80,7 +86,9 @@ func (g *Galaxy) installHandlers() {
 	ws := new(restful.WebService)
 	ws.Route(ws.GET("/cni").To(g.cni))
 	ws.Route(ws.POST("/cni").To(g.cni))
+	ws.Route(ws.GET("/config").To(g.config))
 	restful.Add(ws)
+	restful.DefaultContainer.Handle("/metrics", promhttp.Handler())
 }
 
 func (g *Galaxy) cni(r *restful.Request, w *restful.Response) {
@@ -129,7 +137,7 @@ func (g *Galaxy) requestFunc(req *galaxyapi.PodRequest) (data []byte, err error)
 			err = err1
 			return
 		} else {
-			result020, err2 := convertResult(result)
+			err2 := validateResult(result)
 			if err2 != nil {
 				err = err2
 			} else {
@@ -137,12 +145,12 @@ func (g *Galaxy) requestFunc(req *galaxyapi.PodRequest) (data []byte, err error)
 				if err != nil {
 					return
 				}
-				err = g.setupPortMapping(req, req.ContainerID, result020, pod)
+				err = g.setupPortMapping(req, req.ContainerID, result, pod)
 				if err != nil {
 					g.cleanupPortMapping(req)
 					return
 				}
-				pod.Status.PodIP = result020.IP4.IP.IP.String()
+				pod.Status.PodIP = cniutil.ResultIP(result).String()
 				if g.pm != nil {
 					if err := g.pm.SyncPodChains(pod); err != nil {
 						glog.Warning(err)
@@ -157,6 +165,11 @@ func (g *Galaxy) requestFunc(req *galaxyapi.PodRequest) (data []byte, err error)
 		if err == nil {
 			err = g.cleanupPortMapping(req)
 		}
+	} else if req.Command == cniutil.COMMAND_CHECK {
+		defer func() {
+			glog.Infof("%v err %v, %s-", req, err, start.Format(time.StampMicro))
+		}()
+		err = cniutil.CmdCheck(req.CmdArgs)
 	} else {
 		err = fmt.Errorf("unknown command %s", req.Command)
 	}
@@ -186,17 +199,33 @@ func parsePorts(pod *corev1.Pod) []k8s.Port {
 
 // #lizard forgives
 func (g *Galaxy) resolveNetworks(req *galaxyapi.PodRequest, pod *corev1.Pod) ([]*cniutil.NetworkInfo, error) {
-	var networkInfos []*cniutil.NetworkInfo
+	var (
+		networkInfos []*cniutil.NetworkInfo
+		defaultArgs  map[string]json.RawMessage
+		err          error
+	)
+	conf := g.getConf()
 	if pod.Annotations == nil || pod.Annotations[constant.MultusCNIAnnotation] == "" {
-		if utils.WantENIIP(&pod.Spec) && g.ENIIPNetwork != "" {
-			netConf, err := g.getNetworkConf(g.ENIIPNetwork)
+		var networks []*k8s.NetworkSelectionElement
+		networks, defaultArgs, err = g.namespaceDefaults(pod.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if len(networks) > 0 {
+			glog.V(4).Infof("pod %s_%s uses default networks of namespace", pod.Name, pod.Namespace)
+			networkInfos, err = g.selectNetworks(conf, pod, req.IfName, networks)
+			if err != nil {
+				return nil, err
+			}
+		} else if utils.WantENIIP(&pod.Spec) && conf.ENIIPNetwork != "" {
+			netConf, err := g.getNetworkConf(conf, pod.Namespace, conf.ENIIPNetwork)
 			if err != nil {
 				return nil, err
 			}
-			networkInfos = append(networkInfos, cniutil.NewNetworkInfo(g.ENIIPNetwork, netConf, req.IfName))
+			networkInfos = append(networkInfos, cniutil.NewNetworkInfo(conf.ENIIPNetwork, netConf, req.IfName))
 		} else {
-			for i, netName := range g.DefaultNetworks {
-				netConf, err := g.getNetworkConf(netName)
+			for i, netName := range conf.DefaultNetworks {
+				netConf, err := g.getNetworkConf(conf, pod.Namespace, netName)
 				if err != nil {
 					return nil, err
 				}
@@ -211,14 +240,9 @@ func (g *Galaxy) resolveNetworks(req *galaxyapi.PodRequest, pod *corev1.Pod) ([]
 		if err != nil {
 			return nil, err
 		}
-		//init networkInfo
-		for idx, network := range networks {
-			netConf, err := g.getNetworkConf(network.Name)
-			if err != nil {
-				return nil, err
-			}
-			networkInfos = append(networkInfos, cniutil.NewNetworkInfo(network.Name, netConf,
-				setNetInterface(network.InterfaceRequest, idx, req.CmdArgs.IfName)))
+		networkInfos, err = g.selectNetworks(conf, pod, req.IfName, networks)
+		if err != nil {
+			return nil, err
 		}
 	}
 	extendedCNIArgs, err := parseExtendedCNIArgs(pod)
@@ -226,6 +250,10 @@ func (g *Galaxy) resolveNetworks(req *galaxyapi.PodRequest, pod *corev1.Pod) ([]
 		return nil, err
 	}
 	for i := range networkInfos {
+		// pod's args take precedence over namespace's
+		for k, v := range defaultArgs {
+			networkInfos[i].Args[k] = string(v)
+		}
 		for k, v := range extendedCNIArgs {
 			networkInfos[i].Args[k] = string(v)
 		}
@@ -234,31 +262,69 @@ func (g *Galaxy) resolveNetworks(req *galaxyapi.PodRequest, pod *corev1.Pod) ([]
 	return networkInfos, nil
 }
 
-func (g *Galaxy) getNetworkConf(networkName string) (map[string]interface{}, error) {
-	if netConf, ok := g.netConf[networkName]; ok {
-		return netConf, nil
+// selectNetworks inits networkInfos of the selected networks
+func (g *Galaxy) selectNetworks(conf *networkConfig, pod *corev1.Pod, ifName string,
+	networks []*k8s.NetworkSelectionElement) ([]*cniutil.NetworkInfo, error) {
+	var networkInfos []*cniutil.NetworkInfo
+	for idx, network := range networks {
+		namespace := network.Namespace
+		if namespace == "" {
+			namespace = pod.Namespace
+		}
+		netConf, fromNAD, err := g.resolveNetworkConf(conf, namespace, network.Name)
+		if err != nil {
+			return nil, err
+		}
+		// json config and NetworkConfDir are cluster wide, only NetworkAttachmentDefinitions are namespaced
+		if fromNAD && namespace != pod.Namespace && !g.AllowCrossNamespaceNetworks {
+			return nil, fmt.Errorf("pod %s/%s is not allowed to reference network %s/%s of another namespace",
+				pod.Namespace, pod.Name, namespace, network.Name)
+		}
+		networkInfos = append(networkInfos, cniutil.NewNetworkInfo(network.Name, netConf,
+			setNetInterface(network.InterfaceRequest, idx, ifName)))
+	}
+	return networkInfos, nil
+}
+
+// getNetworkConf looks up network config from json config, NetworkAttachmentDefinition objects of the namespace and
+// files of NetworkConfDir in order
+func (g *Galaxy) getNetworkConf(conf *networkConfig, namespace, networkName string) (map[string]interface{}, error) {
+	netConf, _, err := g.resolveNetworkConf(conf, namespace, networkName)
+	return netConf, err
+}
+
+// resolveNetworkConf is getNetworkConf which also returns if the config is from a NetworkAttachmentDefinition
+func (g *Galaxy) resolveNetworkConf(conf *networkConfig, namespace,
+	networkName string) (map[string]interface{}, bool, error) {
+	if netConf, ok := conf.netConf[networkName]; ok {
+		// copy it as delegates may modify it, e.g. setting prevResult
+		m := make(map[string]interface{}, len(netConf))
+		for k, v := range netConf {
+			m[k] = v
+		}
+		return m, false, nil
 	}
-	// In the absence of existing network config from json
-	// config, load and execute a CNI .configlist
-	// or .config (in that order) file on-disk whose JSON
-	// “name” key matches this Network object’s name.
-	data, err := cniutil.GetNetworkConfig(networkName, g.NetworkConfDir)
+	netConf, err := g.getNetworkAttachmentDefinitionConf(namespace, networkName)
 	if err != nil {
-		return nil, fmt.Errorf("load network config %s from confdir %s: %v", networkName, g.NetworkConfDir, err)
+		return nil, false, err
 	}
-	var m map[string]interface{}
-	if err := json.Unmarshal(data, &m); err != nil {
-		return nil, fmt.Errorf("unmarshal networkinfo %s: %v", string(data), err)
+	if netConf != nil {
+		return netConf, true, nil
 	}
-	// kubeconfig of host filesystem won't be reachable for galaxy.
-	// Since galaxy is running in pod, it can talk to apiserver via secret token
-	if m["kubeconfig"] != "" {
-		delete(m, "kubeconfig")
+	// In the absence of existing network config from json
+	// config or NetworkAttachmentDefinition, load and execute
+	// a CNI .configlist or .config (in that order) file on-disk
+	// whose JSON “name” key matches this Network object’s name.
+	data, err := cniutil.GetNetworkConfig(networkName, g.NetworkConfDir)
+	if err != nil {
+		return nil, false, fmt.Errorf("load network config %s from confdir %s: %v", networkName, g.NetworkConfDir,
+			err)
 	}
-	return m, nil
+	netConf, err = parseNetworkConf(data)
+	return netConf, false, err
 }
 
-func (g *Galaxy) cmdAdd(req *galaxyapi.PodRequest, pod *corev1.Pod) (types.Result, error) {
+func (g *Galaxy) cmdAdd(req *galaxyapi.PodRequest, pod *corev1.Pod) (*current.Result, error) {
 	networkInfos, err := g.resolveNetworks(req, pod)
 	if err != nil {
 		return nil, err
@@ -271,7 +337,11 @@ func parseExtendedCNIArgs(pod *corev1.Pod) (map[string]json.RawMessage, error) {
 	if pod.Annotations == nil {
 		return nil, nil
 	}
-	args := pod.Annotations[constant.ExtendedCNIArgsAnnotation]
+	return parseCommonCNIArgs(pod.Annotations[constant.ExtendedCNIArgsAnnotation])
+}
+
+// parseCommonCNIArgs parses the common args of extended cni args
+func parseCommonCNIArgs(args string) (map[string]json.RawMessage, error) {
 	if args == "" {
 		return nil, nil
 	}
@@ -331,15 +401,19 @@ func (g *Galaxy) setupIPtables() error {
 	return nil
 }
 
-func (g *Galaxy) setupPortMapping(req *galaxyapi.PodRequest, containerID string, result *t020.Result,
+func (g *Galaxy) setupPortMapping(req *galaxyapi.PodRequest, containerID string, result *current.Result,
 	pod *corev1.Pod) error {
 	_, portMappingOn := pod.Annotations[k8s.PortMappingPortsAnnotation]
 	req.Ports = parsePorts(pod)
 	if len(req.Ports) == 0 {
 		return nil
 	}
+	podIP := cniutil.ResultIPv4(result)
+	if podIP == nil {
+		return fmt.Errorf("port mapping is not supported for pods without ipv4 address")
+	}
 	for i := range req.Ports {
-		req.Ports[i].PodIP = result.IP4.IP.IP.To4().String()
+		req.Ports[i].PodIP = podIP.To4().String()
 		req.Ports[i].PodName = req.PodName
 	}
 	if err := g.pmhandler.OpenHostports(k8s.GetPodFullName(req.PodName, req.PodNamespace), portMappingOn,
@@ -433,36 +507,22 @@ func (g *Galaxy) getPod(name, namespace string) (*corev1.Pod, error) {
 	return pod, nil
 }
 
-func convertResult(result types.Result) (*t020.Result, error) {
+func validateResult(result *current.Result) error {
 	if result == nil {
-		return nil, fmt.Errorf("result is nil")
-	}
-	resultCurrent, ok := result.(*current.Result)
-	var result020 *t020.Result
-	if !ok {
-		result020, ok = result.(*t020.Result)
-		if !ok {
-			return nil, fmt.Errorf("faild to convert result to current/020 result")
-		}
-	} else {
-		targetResult, err := resultCurrent.GetAsVersion(t020.ImplementedSpecVersion)
-		if err != nil {
-			return nil, err
-		}
-		result020, ok = targetResult.(*t020.Result)
-		if !ok {
-			return nil, fmt.Errorf("faild to convert result to 020 result")
-		}
+		return fmt.Errorf("result is nil")
 	}
-
-	if result020.IP4 == nil {
-		return nil, fmt.Errorf("CNI plugin reported no IPv4 address")
+	if len(result.IPs) == 0 {
+		return fmt.Errorf("CNI plugin reported no IP address")
 	}
-	ip4 := result020.IP4.IP.IP.To4()
-	if ip4 == nil {
-		return nil, fmt.Errorf("CNI plugin reported an invalid IPv4 address: %+v.", result020.IP4)
+	for _, ipc := range result.IPs {
+		if ipc.Address.IP == nil {
+			return fmt.Errorf("CNI plugin reported an invalid IP address: %+v.", ipc)
+		}
+		if ipc.Interface != nil && (*ipc.Interface < 0 || *ipc.Interface >= len(result.Interfaces)) {
+			return fmt.Errorf("CNI plugin reported an invalid interface index: %+v.", ipc)
+		}
 	}
-	return result020, nil
+	return nil
 }
 
 func setNetInterface(netIf string, idx int, argIf string) string {
@@ -65,6 +65,11 @@ type FloatingIP struct {
 	UpdateTime time.Time         `json:"updateTime,omitempty"`
 	Status     string            `json:"status,omitempty"`
 	Releasable bool              `json:"releasable,omitempty"`
+	Draining   bool              `json:"draining,omitempty"`
+	Subnet     string            `json:"subnet,omitempty"`
+	Reserved   bool              `json:"reserved,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Owner      string            `json:"owner,omitempty"`
 	labels     map[string]string `json:"-"`
 }
 
@@ -80,6 +85,11 @@ func (FloatingIP) SwaggerDoc() map[string]string {
 		"updateTime": "last allocate or release time of this ip",
 		"status":     "pod status if exists",
 		"releasable": "if the ip is releasable. An ip is releasable if it isn't belong to any pod",
+		"draining":   "if the ip range is removed from config. A draining ip won't be allocated again once released",
+		"subnet":     "subnet of the ip",
+		"reserved":   "if the ip is reserved manually",
+		"reason":     "why the ip is reserved",
+		"owner":      "who reserves the ip",
 	}
 }
 
@@ -87,6 +97,8 @@ func (FloatingIP) SwaggerDoc() map[string]string {
 type ListIPResp struct {
 	pageutil.Page
 	Content []FloatingIP `json:"content,omitempty"`
+	// ResourceVersion is the resource version to watch ip changes after this list from
+	ResourceVersion string `json:"resourceVersion,omitempty"`
 }
 
 // ListIPs lists floating ips
@@ -114,6 +126,8 @@ func (c *Controller) ListIPs(req *restful.Request, resp *restful.Response) {
 		key = util.NewKeyObj(appTypePrefix, namespace, appName, podName, poolName).KeyInDB
 	}
 	glog.V(4).Infof("list ips by %s, fuzzyQuery %v", key, fuzzyQuery)
+	// get resource version before listing, so that watching from it misses no changes
+	resourceVersion := c.ipam.ResourceVersion()
 	fips, err := listIPs(key, c.ipam, fuzzyQuery)
 	if err != nil {
 		httputil.InternalError(resp, err)
@@ -128,7 +142,8 @@ func (c *Controller) ListIPs(req *restful.Request, resp *restful.Response) {
 		pagedFips[i].Status = status
 		pagedFips[i].Releasable = releasable
 	}
-	resp.WriteEntity(ListIPResp{Page: *pagin, Content: pagedFips}) // nolint: errcheck
+	resp.WriteEntity(ListIPResp{Page: *pagin, Content: pagedFips, // nolint: errcheck
+		ResourceVersion: resourceVersion})
 }
 
 func (c *Controller) checkReleasableAndStatus(fip *FloatingIP) (releasable bool, status string) {
@@ -224,6 +239,9 @@ func sortFunc(sort string) func(a, b int, array []FloatingIP) bool {
 	}
 }
 
+// NotReleasableReason is the prefix of the reason of ips which are not released because they are bound to pods
+const NotReleasableReason = "releasable is false"
+
 // ReleaseIPReq is the request to release ips
 type ReleaseIPReq struct {
 	IPs []FloatingIP `json:"ips"`
@@ -272,10 +290,17 @@ func (c *Controller) ReleaseIPs(req *restful.Request, resp *restful.Response) {
 			httputil.BadRequest(resp, fmt.Errorf("unknown app type %q", temp.AppType))
 			return
 		}
+		if fip, err := c.ipam.ByIP(ip); err == nil {
+			if _, ok := fip.Labels[constant.ReserveFIPLabel]; ok {
+				unreleasedIP = append(unreleasedIP, temp.IP)
+				reasons = append(reasons, NotReleasableReason+", ip is reserved")
+				continue
+			}
+		}
 		releasable, status := c.checkReleasableAndStatus(&temp)
 		if !releasable {
 			unreleasedIP = append(unreleasedIP, temp.IP)
-			reasons = append(reasons, "releasable is false, pod status "+status)
+			reasons = append(reasons, NotReleasableReason+", pod status "+status)
 			continue
 		}
 		keyObj := util.NewKeyObj(appTypePrefix, temp.Namespace, temp.AppName, temp.PodName, temp.PoolName)
@@ -329,6 +354,11 @@ func listIPs(keyword string, ipam floatingip.IPAM, fuzzyQuery bool) ([]FloatingI
 // convert converts `floatingip.FloatingIP` to `FloatingIP`
 func convert(fip *floatingip.FloatingIP) FloatingIP {
 	keyObj := util.ParseKey(fip.Key)
+	_, reserved := fip.Labels[constant.ReserveFIPLabel]
+	var subnet string
+	if ipNet := fip.Subnet(); ipNet != nil {
+		subnet = ipNet.String()
+	}
 	return FloatingIP{IP: fip.IP.String(),
 		Namespace:  keyObj.Namespace,
 		AppName:    keyObj.AppName,
@@ -337,5 +367,10 @@ func convert(fip *floatingip.FloatingIP) FloatingIP {
 		AppType:    util.GetAppType(keyObj.AppTypePrefix),
 		Policy:     fip.Policy,
 		UpdateTime: fip.UpdatedAt,
+		Draining:   fip.Draining(),
+		Subnet:     subnet,
+		Reserved:   reserved,
+		Reason:     fip.Reason,
+		Owner:      fip.Owner,
 		labels:     fip.Labels}
 }
@@ -18,6 +18,9 @@ package api
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"reflect"
 	"testing"
 	"time"
 
@@ -28,6 +31,7 @@ import (
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/utils/nets"
 )
 
 func TestReserveFIP(t *testing.T) {
@@ -95,3 +99,69 @@ func TestCheckReleasableAndStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestReserveIPs(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Pod{
+		TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "xx-1", Namespace: "demo"},
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	factory := informers.NewSharedInformerFactoryWithOptions(client, time.Minute)
+	lister := factory.Core().V1().Pods().Lister()
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+	ipam, _ := floatingip.CreateTestIPAM(t)
+	if err := ipam.AllocateSpecificIP("sts_demo_xx_xx-1", net.ParseIP("10.49.27.205"),
+		floatingip.Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	c := NewController(ipam, lister, nil)
+	req := &ReserveIPReq{IPs: []string{"10.49.27.205"}, Reason: "gateway", Owner: "admin",
+		IPRanges: []nets.IPRange{*nets.ParseIPRange("10.49.27.216~10.49.27.217")}}
+	res, err := c.Reserve(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10.49.27.205 is bound to a running pod
+	if res.Code != http.StatusAccepted || !reflect.DeepEqual(res.Failed, []string{"10.49.27.205"}) ||
+		!reflect.DeepEqual(res.Succeeded, []string{"10.49.27.216", "10.49.27.217"}) {
+		t.Fatalf("%+v", res)
+	}
+	req.Force = true
+	if res, err = c.Reserve(req); err != nil || res.Code != http.StatusOK {
+		t.Fatalf("%v %+v", err, res)
+	}
+	fips, err := listIPs(floatingip.ReservedKey, ipam, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fips) != 3 {
+		t.Fatal(fips)
+	}
+	for _, fip := range fips {
+		if !fip.Reserved || fip.Reason != "gateway" || fip.Owner != "admin" {
+			t.Fatalf("%+v", fip)
+		}
+	}
+	if res, err = c.Unreserve(&ReserveIPReq{IPs: []string{"10.49.27.205", "10.49.27.218"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Failed, []string{"10.49.27.218"}) {
+		t.Fatalf("%+v", res)
+	}
+	for _, invalid := range []*ReserveIPReq{
+		{},
+		{IPs: []string{"10.49.27"}},
+		{IPRanges: []nets.IPRange{*nets.ParseIPRange("10.0.0.0~10.0.255.255")}},
+		// each range is within the limit but the total exceeds it
+		{IPRanges: []nets.IPRange{*nets.ParseIPRange("10.0.0.0~10.0.2.255"), *nets.ParseIPRange("10.0.3.0~10.0.4.255")}},
+		{IPs: []string{"10.0.0.1"}, IPRanges: []nets.IPRange{*nets.ParseIPRange("10.0.1.0~10.0.4.255")}},
+		{IPRanges: []nets.IPRange{*nets.ParseIPRange("2001:db8::~2001:db8::ffff:ffff:ffff:ffff")}},
+	} {
+		if _, err := c.Reserve(invalid); err == nil {
+			t.Fatalf("expect an error for %+v", invalid)
+		}
+	}
+}
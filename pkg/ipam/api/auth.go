@@ -0,0 +1,171 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/kubernetes"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+const (
+	// AuthGroup is the virtual api group of API requests in SubjectAccessReview, it's not served by apiserver and is
+	// used in RBAC rules only
+	AuthGroup = "ipam.galaxy.k8s.io"
+	// ResourceIPs is the virtual resource of /v1/ip APIs
+	ResourceIPs = "ips"
+	// ResourcePools is the virtual resource of /v1/pool APIs
+	ResourcePools = "pools"
+	// ResourceSubnets is the virtual resource of /v1/subnet APIs
+	ResourceSubnets = "subnets"
+	// ResourceChecks is the virtual resource of /v1/check APIs
+	ResourceChecks = "checks"
+	// ResourceBackups is the virtual resource of /v1/backup APIs
+	ResourceBackups = "backups"
+
+	authCacheSize = 4096
+	userAttribute = "galaxy.user"
+)
+
+// Auth authenticates bearer tokens of API requests by TokenReview and authorizes them by SubjectAccessReview against
+// AuthGroup resources. A nil Auth allows all requests.
+type Auth struct {
+	client kubernetes.Interface
+	// ttl is how long to cache TokenReview and SubjectAccessReview results
+	ttl        time.Duration
+	authnCache *cache.LRUExpireCache
+	authzCache *cache.LRUExpireCache
+}
+
+// NewAuth creates an Auth which caches review results for ttl
+func NewAuth(client kubernetes.Interface, ttl time.Duration) *Auth {
+	return &Auth{
+		client:     client,
+		ttl:        ttl,
+		authnCache: cache.NewLRUExpireCache(authCacheSize),
+		authzCache: cache.NewLRUExpireCache(authCacheSize),
+	}
+}
+
+// Authenticate is a restful filter which authenticates the bearer token by TokenReview
+func (a *Auth) Authenticate(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	if a == nil {
+		chain.ProcessFilter(req, resp)
+		return
+	}
+	auth := strings.TrimSpace(req.HeaderParameter("Authorization"))
+	token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	if token == "" || token == auth {
+		httputil.Unauthorized(resp, fmt.Errorf("bearer token is required"))
+		return
+	}
+	user, err := a.authenticate(req.Request.Context(), token)
+	if err != nil {
+		glog.Warningf("failed to authenticate %s %s: %v", req.Request.Method, req.Request.URL.Path, err)
+		httputil.Unauthorized(resp, err)
+		return
+	}
+	req.SetAttribute(userAttribute, user)
+	chain.ProcessFilter(req, resp)
+}
+
+func (a *Auth) authenticate(ctx context.Context, token string) (*authenticationv1.UserInfo, error) {
+	// cache by token hash to not keep tokens in memory
+	hash := sha256.Sum256([]byte(token))
+	if v, ok := a.authnCache.Get(hash); ok {
+		return v.(*authenticationv1.UserInfo), nil
+	}
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token}}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("token review: %v", err)
+	}
+	if !review.Status.Authenticated {
+		if review.Status.Error != "" {
+			return nil, fmt.Errorf("invalid token: %s", review.Status.Error)
+		}
+		return nil, fmt.Errorf("invalid token")
+	}
+	user := review.Status.User
+	a.authnCache.Add(hash, &user, a.ttl)
+	return &user, nil
+}
+
+// Authorize returns a restful route filter which checks by SubjectAccessReview if the user authenticated by
+// Authenticate can do verb on resource of AuthGroup. If nameParam is not empty, the path param is the resource name.
+func (a *Auth) Authorize(verb, resource, nameParam string) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		if a == nil {
+			chain.ProcessFilter(req, resp)
+			return
+		}
+		user, ok := req.Attribute(userAttribute).(*authenticationv1.UserInfo)
+		if !ok {
+			httputil.Unauthorized(resp, fmt.Errorf("unauthenticated request"))
+			return
+		}
+		attrs := &authorizationv1.ResourceAttributes{Verb: verb, Group: AuthGroup, Resource: resource}
+		if nameParam != "" {
+			attrs.Name = req.PathParameter(nameParam)
+		}
+		allowed, reason, err := a.authorize(req.Request.Context(), user, attrs)
+		if err != nil {
+			httputil.InternalError(resp, err)
+			return
+		}
+		if !allowed {
+			httputil.Forbidden(resp, fmt.Errorf("user %q cannot %s %s.%s %s: %s", user.Username, verb, resource,
+				AuthGroup, attrs.Name, reason))
+			return
+		}
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+func (a *Auth) authorize(ctx context.Context, user *authenticationv1.UserInfo,
+	attrs *authorizationv1.ResourceAttributes) (bool, string, error) {
+	key := fmt.Sprintf("%s/%s/%s/%s/%s/%s", user.UID, user.Username, strings.Join(user.Groups, ","), attrs.Verb,
+		attrs.Resource, attrs.Name)
+	if v, ok := a.authzCache.Get(key); ok {
+		status := v.(authorizationv1.SubjectAccessReviewStatus)
+		return status.Allowed, status.Reason, nil
+	}
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(ctx,
+		&authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: attrs, User: user.Username, Groups: user.Groups, UID: user.UID, Extra: extra,
+		}}, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("subject access review: %v", err)
+	}
+	a.authzCache.Add(key, review.Status, a.ttl)
+	return review.Status.Allowed, review.Status.Reason, nil
+}
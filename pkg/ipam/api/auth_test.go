@@ -0,0 +1,123 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newAuthTestServer(auth *Auth) *httptest.Server {
+	ok := func(req *restful.Request, resp *restful.Response) {
+		resp.WriteHeader(http.StatusOK)
+	}
+	ws := new(restful.WebService)
+	ws.Path("/v1").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON).Filter(auth.Authenticate)
+	ws.Route(ws.GET("/ip").To(ok).Filter(auth.Authorize("list", ResourceIPs, "")))
+	ws.Route(ws.POST("/ip").To(ok).Filter(auth.Authorize("release", ResourceIPs, "")))
+	ws.Route(ws.DELETE("/pool/{name}").To(ok).Filter(auth.Authorize("delete", ResourcePools, "name")))
+	container := restful.NewContainer()
+	container.Add(ws)
+	return httptest.NewServer(container)
+}
+
+func TestAuth(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var tokenReviews, accessReviews int
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tokenReviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "admin-token" || review.Spec.Token == "viewer-token" {
+			review.Status.Authenticated = true
+			review.Status.User.Username = review.Spec.Token[:len(review.Spec.Token)-len("-token")]
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object,
+		error) {
+		accessReviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		if attrs.Group != AuthGroup {
+			t.Errorf("unexpected group %s", attrs.Group)
+		}
+		review.Status.Allowed = review.Spec.User == "admin" ||
+			(attrs.Verb == "list" && attrs.Resource == ResourceIPs)
+		if attrs.Resource == ResourcePools && attrs.Name != "pool1" {
+			t.Errorf("expect pool1, got %s", attrs.Name)
+		}
+		return true, review, nil
+	})
+	server := newAuthTestServer(NewAuth(client, time.Minute))
+	defer server.Close()
+	for i, testCase := range []struct {
+		method, path, token string
+		expectCode          int
+	}{
+		{method: http.MethodGet, path: "/v1/ip", expectCode: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/v1/ip", token: "bad-token", expectCode: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/v1/ip", token: "viewer-token", expectCode: http.StatusOK},
+		{method: http.MethodPost, path: "/v1/ip", token: "viewer-token", expectCode: http.StatusForbidden},
+		{method: http.MethodDelete, path: "/v1/pool/pool1", token: "viewer-token", expectCode: http.StatusForbidden},
+		{method: http.MethodPost, path: "/v1/ip", token: "admin-token", expectCode: http.StatusOK},
+		{method: http.MethodDelete, path: "/v1/pool/pool1", token: "admin-token", expectCode: http.StatusOK},
+		// cached
+		{method: http.MethodGet, path: "/v1/ip", token: "viewer-token", expectCode: http.StatusOK},
+	} {
+		req, err := http.NewRequest(testCase.method, server.URL+testCase.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if testCase.token != "" {
+			req.Header.Set("Authorization", "Bearer "+testCase.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close() // nolint: errcheck
+		if resp.StatusCode != testCase.expectCode {
+			t.Fatalf("case %d: expect %d, got %d", i, testCase.expectCode, resp.StatusCode)
+		}
+	}
+	if tokenReviews != 3 || accessReviews != 5 {
+		t.Fatalf("expect 3 token reviews and 5 access reviews, got %d, %d", tokenReviews, accessReviews)
+	}
+}
+
+func TestNilAuth(t *testing.T) {
+	server := newAuthTestServer(nil)
+	defer server.Close()
+	resp, err := http.Post(server.URL+"/v1/ip", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close() // nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expect %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
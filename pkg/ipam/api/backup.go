@@ -0,0 +1,191 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/emicklei/go-restful"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/client/clientset/versioned"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+// BackupController serves the backup and restore APIs
+type BackupController struct {
+	Client versioned.Interface
+	IPAM   floatingip.IPAM
+}
+
+// RestoreReq is the request to restore a backup
+type RestoreReq struct {
+	Backup      floatingip.Backup `json:"backup"`
+	DryRun      bool              `json:"dryRun,omitempty"`
+	NodeSubnets map[string]string `json:"nodeSubnets,omitempty"`
+}
+
+// SwaggerDoc generates swagger doc for restore request
+func (RestoreReq) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"backup": "the backup got from GET /v1/backup",
+		"dryRun": "show what would be restored without changing anything",
+		"nodeSubnets": "maps node subnets of the backup to node subnets of this cluster, ips which are not within " +
+			"any pool are reallocated in the mapped node subnet",
+	}
+}
+
+// PoolRestoreResult is the result of restoring a pool
+type PoolRestoreResult struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RestoreResp is the response of restore
+type RestoreResp struct {
+	httputil.Resp
+	IPs   []floatingip.ImportResult `json:"ips"`
+	Pools []PoolRestoreResult       `json:"pools"`
+}
+
+// SwaggerDoc generates swagger doc for restore response
+func (RestoreResp) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"ips":   "the result of each ip, action is create, update, unchanged, reallocate, conflict or skip",
+		"pools": "the result of each pool, action is create, update or unchanged",
+	}
+}
+
+// Backup exports all allocated ips and pools
+func (c *BackupController) Backup(req *restful.Request, resp *restful.Response) {
+	backup := c.IPAM.Export()
+	pools, err := c.Client.GalaxyV1alpha1().Pools("kube-system").List(context.TODO(), v1.ListOptions{})
+	if err != nil {
+		httputil.InternalError(resp, fmt.Errorf("failed to list pools: %v", err))
+		return
+	}
+	for i := range pools.Items {
+		backup.Pools = append(backup.Pools, floatingip.BackupPool{Name: pools.Items[i].Name,
+			Size: pools.Items[i].Size, PreAllocateIP: pools.Items[i].PreAllocateIP})
+	}
+	sort.Slice(backup.Pools, func(i, j int) bool {
+		return backup.Pools[i].Name < backup.Pools[j].Name
+	})
+	resp.WriteEntity(backup) // nolint: errcheck
+}
+
+// Restore restores pools and ips of a backup. Pools are created or updated without pre-allocating ips.
+func (c *BackupController) Restore(req *restful.Request, resp *restful.Response) {
+	var restoreReq RestoreReq
+	if err := req.ReadEntity(&restoreReq); err != nil {
+		httputil.BadRequest(resp, err)
+		return
+	}
+	if restoreReq.Backup.Version != floatingip.BackupVersion {
+		httputil.BadRequest(resp, fmt.Errorf("unsupported backup version %q, expect %q",
+			restoreReq.Backup.Version, floatingip.BackupVersion))
+		return
+	}
+	nodeSubnets := map[string]string{}
+	for from, to := range restoreReq.NodeSubnets {
+		_, fromNet, err1 := net.ParseCIDR(from)
+		_, toNet, err2 := net.ParseCIDR(to)
+		if err1 != nil || err2 != nil {
+			httputil.BadRequest(resp, fmt.Errorf("invalid node subnet mapping %s=%s", from, to))
+			return
+		}
+		nodeSubnets[fromNet.String()] = toNet.String()
+	}
+	res := RestoreResp{Pools: []PoolRestoreResult{}}
+	for _, pool := range restoreReq.Backup.Pools {
+		res.Pools = append(res.Pools, c.restorePool(&pool, restoreReq.DryRun))
+	}
+	var err error
+	res.IPs, err = c.IPAM.Import(&restoreReq.Backup, floatingip.ImportOptions{DryRun: restoreReq.DryRun,
+		NodeSubnets: nodeSubnets})
+	if err != nil {
+		httputil.BadRequest(resp, err)
+		return
+	}
+	counts := map[string]int{}
+	var failed int
+	for _, r := range res.IPs {
+		counts[r.Action]++
+		if r.Error != "" {
+			failed++
+		}
+	}
+	for _, r := range res.Pools {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	msg := fmt.Sprintf("%d created, %d updated, %d reallocated, %d unchanged, %d conflicts, %d skipped, %d failed",
+		counts[floatingip.ImportCreate], counts[floatingip.ImportUpdate], counts[floatingip.ImportReallocate],
+		counts[floatingip.ImportUnchanged], counts[floatingip.ImportConflict], counts[floatingip.ImportSkip], failed)
+	if restoreReq.DryRun {
+		msg = "dry run: " + msg
+	}
+	code := http.StatusOK
+	if counts[floatingip.ImportConflict]+counts[floatingip.ImportSkip]+failed > 0 {
+		code = http.StatusAccepted
+	}
+	glog.Infof("restore backup created at %s: %s", restoreReq.Backup.CreatedAt, msg)
+	res.Resp = httputil.NewResp(code, msg)
+	resp.WriteHeaderAndEntity(code, res) // nolint: errcheck
+}
+
+func (c *BackupController) restorePool(pool *floatingip.BackupPool, dryRun bool) PoolRestoreResult {
+	result := PoolRestoreResult{Name: pool.Name}
+	pools := c.Client.GalaxyV1alpha1().Pools("kube-system")
+	p, err := pools.Get(context.TODO(), pool.Name, v1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			result.Error = err.Error()
+			return result
+		}
+		result.Action = floatingip.ImportCreate
+		if !dryRun {
+			_, err = pools.Create(context.TODO(), &v1alpha1.Pool{
+				TypeMeta:      v1.TypeMeta{Kind: "Pool", APIVersion: "v1alpha1"},
+				ObjectMeta:    v1.ObjectMeta{Name: pool.Name},
+				Size:          pool.Size,
+				PreAllocateIP: pool.PreAllocateIP,
+			}, v1.CreateOptions{})
+		}
+	} else if p.Size != pool.Size || p.PreAllocateIP != pool.PreAllocateIP {
+		result.Action = floatingip.ImportUpdate
+		if !dryRun {
+			p.Size, p.PreAllocateIP = pool.Size, pool.PreAllocateIP
+			_, err = pools.Update(context.TODO(), p, v1.UpdateOptions{})
+		}
+	} else {
+		result.Action = floatingip.ImportUnchanged
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
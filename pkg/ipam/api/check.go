@@ -0,0 +1,78 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+// CheckController serves the consistency check API
+type CheckController struct {
+	// CheckFunc checks consistency of ipam, and fixes the inconsistencies if fix is true
+	CheckFunc func(fix bool) ([]schedulerplugin.Inconsistency, error)
+}
+
+// CheckResp is the response of check
+type CheckResp struct {
+	httputil.Resp
+	Inconsistencies []schedulerplugin.Inconsistency `json:"inconsistencies"`
+}
+
+// SwaggerDoc generates swagger doc for check response
+func (CheckResp) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"inconsistencies": "inconsistencies found, fixed is true if it's fixed",
+	}
+}
+
+// Check reports inconsistencies
+func (c *CheckController) Check(req *restful.Request, resp *restful.Response) {
+	c.check(resp, false)
+}
+
+// Fix reports and fixes inconsistencies
+func (c *CheckController) Fix(req *restful.Request, resp *restful.Response) {
+	c.check(resp, true)
+}
+
+func (c *CheckController) check(resp *restful.Response, fix bool) {
+	incs, err := c.CheckFunc(fix)
+	if err != nil {
+		httputil.InternalError(resp, err)
+		return
+	}
+	var fixed int
+	for i := range incs {
+		if incs[i].Fixed {
+			fixed++
+		}
+	}
+	msg := fmt.Sprintf("found %d inconsistencies", len(incs))
+	if fix {
+		msg += fmt.Sprintf(", fixed %d", fixed)
+	}
+	if incs == nil {
+		incs = []schedulerplugin.Inconsistency{}
+	}
+	resp.WriteEntity(CheckResp{Resp: httputil.NewResp(http.StatusOK, msg), // nolint: errcheck
+		Inconsistencies: incs})
+}
@@ -0,0 +1,387 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+// Package client is a client of the galaxy-ipam REST API served by Server.startAPIServer.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"tkestack.io/galaxy/pkg/ipam/api"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+// Client talks to galaxy-ipam REST API
+type Client struct {
+	// base is the url prefix of the API, e.g. http://127.0.0.1:9041
+	base       string
+	httpClient *http.Client
+}
+
+// New creates a client for the galaxy-ipam API at server, e.g. http://127.0.0.1:9041. http.DefaultClient is used
+// if httpClient is nil.
+func New(server string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{base: strings.TrimSuffix(server, "/"), httpClient: httpClient}
+}
+
+// NewForServiceProxy creates a client which talks to the galaxy-ipam API through the kubernetes apiserver service
+// proxy of the given service, e.g. kube-system/galaxy-ipam:9041
+func NewForServiceProxy(config *rest.Config, namespace, service string, port int) (*Client, error) {
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, err
+	}
+	host := config.Host
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	base := fmt.Sprintf("%s%s/api/v1/namespaces/%s/services/%s:%d/proxy", strings.TrimSuffix(host, "/"),
+		strings.TrimSuffix(config.APIPath, "/"), namespace, service, port)
+	return New(base, httpClient), nil
+}
+
+// MaxPageSize is the max page size of ListIPs
+const MaxPageSize = 9999
+
+// ListIPOptions are the query params of ListIPs
+type ListIPOptions struct {
+	// Keyword does a fuzzy query, other filters are ignored if it's set
+	Keyword   string
+	PoolName  string
+	AppName   string
+	PodName   string
+	Namespace string
+	// AppType is deployment, statefulset or tapp, default statefulset
+	AppType string
+	// Sort is ip/namespace/podname/policy asc/desc
+	Sort string
+	Page int
+	Size int
+}
+
+func (o *ListIPOptions) query() url.Values {
+	query := url.Values{}
+	for k, v := range map[string]string{"keyword": o.Keyword, "poolName": o.PoolName, "appName": o.AppName,
+		"podName": o.PodName, "namespace": o.Namespace, "appType": o.AppType, "sort": o.Sort} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if o.Page > 0 {
+		query.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.Size > 0 {
+		query.Set("size", strconv.Itoa(o.Size))
+	}
+	return query
+}
+
+// ListIPs lists a page of floating ips
+func (c *Client) ListIPs(ctx context.Context, opts ListIPOptions) (*api.ListIPResp, error) {
+	var resp api.ListIPResp
+	if err := c.do(ctx, http.MethodGet, "/v1/ip", opts.query(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListAllIPs lists floating ips of all pages starting from opts.Page, opts.Size is the page size of each request.
+func (c *Client) ListAllIPs(ctx context.Context, opts ListIPOptions) ([]api.FloatingIP, error) {
+	if opts.Size <= 0 {
+		opts.Size = MaxPageSize
+	}
+	var fips []api.FloatingIP
+	for {
+		resp, err := c.ListIPs(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		fips = append(fips, resp.Content...)
+		if resp.Last || len(resp.Content) == 0 || opts.Page+1 >= resp.TotalPages {
+			return fips, nil
+		}
+		opts.Page++
+	}
+}
+
+// WatchIPOptions are the query params of WatchIPs
+type WatchIPOptions struct {
+	// ResourceVersion is the resource version to watch changes after, only new changes are watched if it's empty
+	ResourceVersion string
+	PoolName        string
+	AppName         string
+	Namespace       string
+	// AppType is deployment, statefulset or tapp, empty matches all
+	AppType        string
+	TimeoutSeconds int
+}
+
+func (o *WatchIPOptions) query() url.Values {
+	query := url.Values{}
+	for k, v := range map[string]string{"poolName": o.PoolName, "appName": o.AppName, "namespace": o.Namespace,
+		"appType": o.AppType} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if o.ResourceVersion != "" {
+		query.Set("resourceVersion", o.ResourceVersion)
+	}
+	if o.TimeoutSeconds > 0 {
+		query.Set("timeoutSeconds", strconv.Itoa(o.TimeoutSeconds))
+	}
+	return query
+}
+
+// WatchIPs watches ip changes. The returned channel is closed when ctx is done or the server stops the stream,
+// callers can watch again from the resource version of the last received event. If the resource version is too
+// old, an error which IsGone is returned, callers should list ips and watch from ListIPResp.ResourceVersion.
+func (c *Client) WatchIPs(ctx context.Context, opts WatchIPOptions) (<-chan api.IPEvent, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/v1/ip/watch", opts.query(), nil)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan api.IPEvent)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close() // nolint: errcheck
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var event api.IPEvent
+			if err := decoder.Decode(&event); err != nil {
+				return
+			}
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// ReleaseIPs releases floating ips. If some of them are not released, the response is returned with a
+// *PartialError.
+func (c *Client) ReleaseIPs(ctx context.Context, ips []api.FloatingIP) (*api.ReleaseIPResp, error) {
+	var resp api.ReleaseIPResp
+	if err := c.do(ctx, http.MethodPost, "/v1/ip", nil, api.ReleaseIPReq{IPs: ips}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Unreleased) > 0 {
+		return &resp, &PartialError{Failed: resp.Unreleased, Reasons: resp.Reason}
+	}
+	return &resp, nil
+}
+
+// ReserveIPs reserves floating ips. If some of them are not reserved, the response is returned with a
+// *PartialError.
+func (c *Client) ReserveIPs(ctx context.Context, req *api.ReserveIPReq) (*api.ReserveIPResp, error) {
+	return c.reserve(ctx, http.MethodPost, req)
+}
+
+// UnreserveIPs unreserves floating ips, req.Reason, req.Owner and req.Force are ignored. If some of them are not
+// unreserved, the response is returned with a *PartialError.
+func (c *Client) UnreserveIPs(ctx context.Context, req *api.ReserveIPReq) (*api.ReserveIPResp, error) {
+	return c.reserve(ctx, http.MethodDelete, req)
+}
+
+func (c *Client) reserve(ctx context.Context, method string, req *api.ReserveIPReq) (*api.ReserveIPResp, error) {
+	var resp api.ReserveIPResp
+	if err := c.do(ctx, method, "/v1/ip/reserve", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Failed) > 0 {
+		return &resp, &PartialError{Failed: resp.Failed, Reasons: resp.Reason}
+	}
+	return &resp, nil
+}
+
+// ListSubnets lists ip usage of each subnet. Empty subnet or nodeSubnet matches all.
+func (c *Client) ListSubnets(ctx context.Context, subnet, nodeSubnet string) ([]api.SubnetUsage, error) {
+	query := url.Values{}
+	if subnet != "" {
+		query.Set("subnet", subnet)
+	}
+	if nodeSubnet != "" {
+		query.Set("nodeSubnet", nodeSubnet)
+	}
+	var resp api.ListSubnetResp
+	if err := c.do(ctx, http.MethodGet, "/v1/subnet", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Subnets, nil
+}
+
+// GetPool gets a pool by name
+func (c *Client) GetPool(ctx context.Context, name string) (*api.Pool, error) {
+	var resp api.GetPoolResp
+	if err := c.do(ctx, http.MethodGet, "/v1/pool/"+url.PathEscape(name), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Pool, nil
+}
+
+// GetPoolUsage gets ip usage of a pool by name
+func (c *Client) GetPoolUsage(ctx context.Context, name string) (*api.PoolUsage, error) {
+	var resp api.GetPoolUsageResp
+	if err := c.do(ctx, http.MethodGet, "/v1/pool/"+url.PathEscape(name)+"/usage", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Usage, nil
+}
+
+// CreateOrUpdatePool creates or updates a pool. If pool.PreAllocateIP is true and there are no enough ips, the
+// response is returned with a *NoEnoughIPsError.
+func (c *Client) CreateOrUpdatePool(ctx context.Context, pool *api.Pool) (*api.UpdatePoolResp, error) {
+	var resp api.UpdatePoolResp
+	if err := c.do(ctx, http.MethodPost, "/v1/pool", nil, pool, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Code == http.StatusAccepted {
+		return &resp, &NoEnoughIPsError{Pool: pool.Name, RealPoolSize: resp.RealPoolSize}
+	}
+	return &resp, nil
+}
+
+// DeletePool deletes a pool by name
+func (c *Client) DeletePool(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/pool/"+url.PathEscape(name), nil, nil, &httputil.Resp{})
+}
+
+// Check checks consistency of galaxy-ipam and returns the inconsistencies. If fix is true, it fixes the
+// inconsistencies which can be fixed.
+func (c *Client) Check(ctx context.Context, fix bool) ([]schedulerplugin.Inconsistency, error) {
+	method, in := http.MethodGet, interface{}(nil)
+	if fix {
+		// the api consumes json only, so post an empty object
+		method, in = http.MethodPost, struct{}{}
+	}
+	var resp api.CheckResp
+	if err := c.do(ctx, method, "/v1/check", nil, in, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Inconsistencies, nil
+}
+
+// Backup exports all allocated ips and pools
+func (c *Client) Backup(ctx context.Context) (*floatingip.Backup, error) {
+	var backup floatingip.Backup
+	if err := c.do(ctx, http.MethodGet, "/v1/backup", nil, nil, &backup); err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// Restore restores pools and ips of a backup. If any ip conflicts, is skipped or fails, or any pool fails, the
+// response is returned with a *PartialError.
+func (c *Client) Restore(ctx context.Context, req *api.RestoreReq) (*api.RestoreResp, error) {
+	var resp api.RestoreResp
+	if err := c.do(ctx, http.MethodPost, "/v1/backup/restore", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != http.StatusAccepted {
+		return &resp, nil
+	}
+	partialErr := &PartialError{}
+	for _, r := range resp.Pools {
+		if r.Error != "" {
+			partialErr.Failed = append(partialErr.Failed, "pool "+r.Name)
+			partialErr.Reasons = append(partialErr.Reasons, r.Error)
+		}
+	}
+	for _, r := range resp.IPs {
+		if r.Error != "" {
+			partialErr.Failed = append(partialErr.Failed, r.IP)
+			partialErr.Reasons = append(partialErr.Reasons, r.Error)
+		} else if r.Action == floatingip.ImportConflict || r.Action == floatingip.ImportSkip {
+			partialErr.Failed = append(partialErr.Failed, r.IP)
+			partialErr.Reasons = append(partialErr.Reasons, r.Action+": "+r.Message)
+		}
+	}
+	return &resp, partialErr
+}
+
+// do sends a request and decodes the response into out. It returns a *StatusError if the response code is not 2xx.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %v", method, path, err)
+	}
+	return nil
+}
+
+// send sends a request and returns the response if the response code is 2xx, otherwise a *StatusError.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in interface{}) (*http.Response,
+	error) {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	statusErr := &StatusError{Method: method, Path: path, Code: resp.StatusCode,
+		Message: http.StatusText(resp.StatusCode)}
+	var r httputil.Resp
+	if data, err := io.ReadAll(resp.Body); err == nil && json.Unmarshal(data, &r) == nil && r.Message != "" {
+		statusErr.Message = r.Message
+	}
+	return nil, statusErr
+}
@@ -0,0 +1,313 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/api"
+	fakeGalaxyCli "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned/fake"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// newTestServer serves the API routes with real controllers
+func newTestServer(t *testing.T) (*httptest.Server, floatingip.IPAM) {
+	ipam, _ := floatingip.CreateTestIPAM(t)
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	factory := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), time.Minute)
+	podLister := factory.Core().V1().Pods().Lister()
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+	c := api.NewController(ipam, podLister, func(r *schedulerplugin.ReleaseRequest) error {
+		return ipam.Release(r.KeyObj.KeyInDB, r.IP)
+	})
+	galaxyCli := fakeGalaxyCli.NewSimpleClientset()
+	poolController := api.PoolController{Client: galaxyCli, IPAM: ipam,
+		LockPoolFunc: func(string) func() { return func() {} }}
+	backupController := api.BackupController{Client: galaxyCli, IPAM: ipam}
+	ws := new(restful.WebService)
+	ws.Path("/v1").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("/ip").To(c.ListIPs))
+	ws.Route(ws.GET("/ip/watch").To(c.WatchIPs))
+	ws.Route(ws.POST("/ip").To(c.ReleaseIPs))
+	ws.Route(ws.POST("/ip/reserve").To(c.ReserveIPs))
+	ws.Route(ws.DELETE("/ip/reserve").To(c.UnreserveIPs))
+	ws.Route(ws.GET("/subnet").To(c.ListSubnets))
+	ws.Route(ws.GET("/pool/{name}").To(poolController.Get))
+	ws.Route(ws.GET("/pool/{name}/usage").To(poolController.Usage))
+	ws.Route(ws.POST("/pool").To(poolController.CreateOrUpdate))
+	ws.Route(ws.DELETE("/pool/{name}").To(poolController.Delete))
+	checkController := api.CheckController{CheckFunc: func(fix bool) ([]schedulerplugin.Inconsistency, error) {
+		return []schedulerplugin.Inconsistency{{Type: schedulerplugin.InconsistencyOrphan, IP: "10.0.70.2",
+			Message: "pod is not running and release policy is podDelete", Fixed: fix}}, nil
+	}}
+	ws.Route(ws.GET("/backup").To(backupController.Backup))
+	ws.Route(ws.POST("/backup/restore").To(backupController.Restore))
+	ws.Route(ws.GET("/check").To(checkController.Check))
+	ws.Route(ws.POST("/check").To(checkController.Fix))
+	container := restful.NewContainer()
+	container.Add(ws)
+	server := httptest.NewServer(container)
+	t.Cleanup(server.Close)
+	return server, ipam
+}
+
+func TestListAllIPs(t *testing.T) {
+	server, ipam := newTestServer(t)
+	for i := 2; i <= 6; i++ {
+		ip := net.ParseIP(fmt.Sprintf("10.0.70.%d", i))
+		if err := ipam.AllocateSpecificIP(fmt.Sprintf("dp_demo_app_app-%d", i), ip, floatingip.Attr{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := New(server.URL, nil)
+	resp, err := c.ListIPs(context.Background(), ListIPOptions{AppType: "deployment", Namespace: "demo",
+		AppName: "app", Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Content) != 2 || resp.TotalElements != 5 || resp.Last {
+		t.Fatalf("%+v", resp)
+	}
+	fips, err := c.ListAllIPs(context.Background(), ListIPOptions{AppType: "deployment", Namespace: "demo",
+		AppName: "app", Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fips) != 5 || fips[0].IP != "10.0.70.2" || fips[4].IP != "10.0.70.6" {
+		t.Fatalf("%+v", fips)
+	}
+}
+
+func TestReleaseAndReserveIPs(t *testing.T) {
+	server, ipam := newTestServer(t)
+	c := New(server.URL, nil)
+	ctx := context.Background()
+	if err := ipam.AllocateSpecificIP("sts_demo_sts_sts-0", net.ParseIP("10.173.13.2"),
+		floatingip.Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	// the pod of sts_demo_sts_sts-0 doesn't exist, it's releasable
+	resp, err := c.ReleaseIPs(ctx, []api.FloatingIP{
+		{IP: "10.173.13.2", Namespace: "demo", AppName: "sts", PodName: "sts-0", AppType: "statefulset"},
+		{IP: "10.173.13.10", Namespace: "demo", AppName: "sts", PodName: "sts-1", AppType: "statefulset"},
+	})
+	if !IsPartial(err) || IsNotReleasable(err) || resp == nil || len(resp.Unreleased) != 1 ||
+		resp.Unreleased[0] != "10.173.13.10" {
+		t.Fatalf("%v %+v", err, resp)
+	}
+	reserveResp, err := c.ReserveIPs(ctx, &api.ReserveIPReq{Reason: "gateway", IPs: []string{"10.173.13.2"},
+		IPRanges: []nets.IPRange{*nets.ParseIPRange("10.173.13.10~10.173.13.11")}})
+	if err != nil || len(reserveResp.Succeeded) != 3 {
+		t.Fatalf("%v %+v", err, reserveResp)
+	}
+	// reserved ips are not releasable
+	_, err = c.ReleaseIPs(ctx, []api.FloatingIP{{IP: "10.173.13.2", PoolName: "reserved-by-api"}})
+	if !IsNotReleasable(err) {
+		t.Fatalf("expect a not releasable error, got %v", err)
+	}
+	_, err = c.UnreserveIPs(ctx, &api.ReserveIPReq{IPs: []string{"10.173.13.2", "10.173.13.12"}})
+	if !IsPartial(err) {
+		t.Fatalf("expect a partial error, got %v", err)
+	}
+	if _, err = c.ReserveIPs(ctx, &api.ReserveIPReq{}); !IsBadRequest(err) {
+		t.Fatalf("expect a bad request error, got %v", err)
+	}
+}
+
+func TestPool(t *testing.T) {
+	server, _ := newTestServer(t)
+	c := New(server.URL, nil)
+	ctx := context.Background()
+	if _, err := c.GetPool(ctx, "pool1"); !IsNotFound(err) {
+		t.Fatalf("expect a not found error, got %v", err)
+	}
+	if _, err := c.CreateOrUpdatePool(ctx, &api.Pool{Name: "pool1", Size: 2}); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := c.GetPool(ctx, "pool1")
+	if err != nil || pool.Size != 2 {
+		t.Fatalf("%v %+v", err, pool)
+	}
+	resp, err := c.CreateOrUpdatePool(ctx, &api.Pool{Name: "pool1", Size: 1000, PreAllocateIP: true})
+	if !IsNoEnoughIPs(err) || resp == nil || resp.RealPoolSize == 0 || resp.RealPoolSize >= 1000 {
+		t.Fatalf("%v %+v", err, resp)
+	}
+	if err := c.DeletePool(ctx, "pool1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeletePool(ctx, "pool1"); !IsNotFound(err) {
+		t.Fatalf("expect a not found error, got %v", err)
+	}
+	if err := c.DeletePool(ctx, ""); err == nil {
+		t.Fatal("expect an error")
+	}
+	if _, err := New("http://127.0.0.1:1", http.DefaultClient).GetPool(ctx, "pool1"); err == nil ||
+		IsNotFound(err) {
+		t.Fatalf("expect a connection error, got %v", err)
+	}
+}
+
+func TestWatchIPs(t *testing.T) {
+	server, ipam := newTestServer(t)
+	c := New(server.URL, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	list, err := c.ListIPs(ctx, ListIPOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := c.WatchIPs(ctx, WatchIPOptions{ResourceVersion: list.ResourceVersion, Namespace: "demo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"sts_other_xx_xx-0", "sts_demo_xx_xx-0"} {
+		if err := ipam.AllocateSpecificIP(key, net.ParseIP("10.0.70.2"), floatingip.Attr{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ipam.Release(key, net.ParseIP("10.0.70.2")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, typ := range []floatingip.EventType{floatingip.EventAllocate, floatingip.EventRelease} {
+		select {
+		case event := <-events:
+			if event.Type != typ || event.Object.Namespace != "demo" || event.Object.IP != "10.0.70.2" {
+				t.Fatalf("expect %s event of demo namespace, got %+v", typ, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s event", typ)
+		}
+	}
+	if _, err := c.WatchIPs(ctx, WatchIPOptions{ResourceVersion: "100"}); !IsBadRequest(err) {
+		t.Fatalf("expect a bad request error, got %v", err)
+	}
+	// resource versions of a previous galaxy-ipam process are gone
+	if _, err := c.WatchIPs(ctx, WatchIPOptions{ResourceVersion: "1-1"}); !IsGone(err) {
+		t.Fatalf("expect a gone error, got %v", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	server, ipam := newTestServer(t)
+	c := New(server.URL, nil)
+	ctx := context.Background()
+	if err := ipam.AllocateSpecificIP("pool__p1_dp_demo_app_app-xx-xx", net.ParseIP("10.0.70.2"),
+		floatingip.Attr{Uid: "uid1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.AllocateSpecificIP("pool__p1_", net.ParseIP("10.0.70.3"), floatingip.Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	subnets, err := c.ListSubnets(ctx, "10.0.70.0/24", "10.0.1.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subnets) != 1 || subnets[0].Total != 19 || subnets[0].Allocated != 1 || subnets[0].Held != 1 ||
+		subnets[0].Free != 17 {
+		t.Fatalf("%+v", subnets)
+	}
+	if subnets, err = c.ListSubnets(ctx, "", "10.9.0.0/24"); err != nil || len(subnets) != 0 {
+		t.Fatalf("%v %+v", err, subnets)
+	}
+	if _, err = c.ListSubnets(ctx, "10.0.70", ""); !IsBadRequest(err) {
+		t.Fatalf("expect a bad request error, got %v", err)
+	}
+	usage, err := c.GetPoolUsage(ctx, "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Size != 0 || usage.IPs != 2 || usage.Allocated != 1 || usage.Held != 1 ||
+		usage.Subnets["10.0.70.0/24"] != 2 {
+		t.Fatalf("%+v", usage)
+	}
+	if _, err = c.GetPoolUsage(ctx, "p2"); !IsNotFound(err) {
+		t.Fatalf("expect a not found error, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	server, _ := newTestServer(t)
+	c := New(server.URL, nil)
+	for _, fix := range []bool{false, true} {
+		incs, err := c.Check(context.Background(), fix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(incs) != 1 || incs[0].Type != schedulerplugin.InconsistencyOrphan || incs[0].IP != "10.0.70.2" ||
+			incs[0].Fixed != fix {
+			t.Fatalf("fix %v: %+v", fix, incs)
+		}
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	server, ipam := newTestServer(t)
+	if err := ipam.AllocateSpecificIP("sts_demo_sts_sts-0", net.ParseIP("10.0.70.2"),
+		floatingip.Attr{Policy: constant.ReleasePolicyNever}); err != nil {
+		t.Fatal(err)
+	}
+	c := New(server.URL, nil)
+	if _, err := c.CreateOrUpdatePool(context.Background(), &api.Pool{Name: "pool1", Size: 2}); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := c.Backup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backup.IPs) != 1 || backup.IPs[0].IP != "10.0.70.2" || len(backup.Pools) != 1 ||
+		backup.Pools[0] != (floatingip.BackupPool{Name: "pool1", Size: 2}) {
+		t.Fatalf("%+v", backup)
+	}
+	backup.Pools[0].Size = 3
+	resp, err := c.Restore(context.Background(), &api.RestoreReq{Backup: *backup, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.IPs) != 1 || resp.IPs[0].Action != floatingip.ImportUnchanged || len(resp.Pools) != 1 ||
+		resp.Pools[0].Action != floatingip.ImportUpdate {
+		t.Fatalf("%+v", resp)
+	}
+	if pool, err := c.GetPool(context.Background(), "pool1"); err != nil || pool.Size != 2 {
+		t.Fatalf("dry run updated pool %+v, err %v", pool, err)
+	}
+	backup.IPs[0].Key = "sts_demo_sts_sts-1"
+	resp, err = c.Restore(context.Background(), &api.RestoreReq{Backup: *backup})
+	if !IsPartial(err) || resp == nil || resp.IPs[0].Action != floatingip.ImportConflict {
+		t.Fatalf("expect a conflict, resp %+v, err %v", resp, err)
+	}
+	if pool, err := c.GetPool(context.Background(), "pool1"); err != nil || pool.Size != 3 {
+		t.Fatalf("expect pool size 3, real %+v, err %v", pool, err)
+	}
+	backup.Version = "v0"
+	if _, err := c.Restore(context.Background(), &api.RestoreReq{Backup: *backup}); !IsBadRequest(err) {
+		t.Fatalf("expect bad request, real %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"tkestack.io/galaxy/pkg/ipam/api"
+)
+
+// StatusError is returned if galaxy-ipam responds a non 2xx code
+type StatusError struct {
+	Method  string
+	Path    string
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.Code, e.Message)
+}
+
+// PartialError is returned if some of the ips of a release, reserve, unreserve or restore request failed. The
+// response is returned along with it.
+type PartialError struct {
+	// Failed are the failed ips, or pools prefixed by "pool " of a restore request
+	Failed []string
+	// Reasons is the reason of each failed ip
+	Reasons []string
+}
+
+func (e *PartialError) Error() string {
+	msgs := make([]string, 0, len(e.Failed))
+	for i := range e.Failed {
+		if i < len(e.Reasons) {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", e.Failed[i], e.Reasons[i]))
+		} else {
+			msgs = append(msgs, e.Failed[i])
+		}
+	}
+	return fmt.Sprintf("%d ips failed: %s", len(e.Failed), strings.Join(msgs, "; "))
+}
+
+// NotReleasable returns failed ips which are not released because they are bound to existing pods
+func (e *PartialError) NotReleasable() []string {
+	var ips []string
+	for i := range e.Failed {
+		if i < len(e.Reasons) && strings.HasPrefix(e.Reasons[i], api.NotReleasableReason) {
+			ips = append(ips, e.Failed[i])
+		}
+	}
+	return ips
+}
+
+// NoEnoughIPsError is returned if there are no enough ips to preallocate for a pool
+type NoEnoughIPsError struct {
+	Pool string
+	// RealPoolSize is the number of ips of the pool after preallocating
+	RealPoolSize int
+}
+
+func (e *NoEnoughIPsError) Error() string {
+	return fmt.Sprintf("no enough ips for pool %s, real pool size %d", e.Pool, e.RealPoolSize)
+}
+
+// IsNotFound returns true if the error is a not found StatusError
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsBadRequest returns true if the error is a bad request StatusError
+func IsBadRequest(err error) bool {
+	return statusCode(err) == http.StatusBadRequest
+}
+
+// IsGone returns true if the error is a gone StatusError, e.g. the resource version to watch from is too old
+func IsGone(err error) bool {
+	return statusCode(err) == http.StatusGone
+}
+
+// IsNotReleasable returns true if the error is a PartialError and any ip is not released because it's bound to pods
+func IsNotReleasable(err error) bool {
+	var partialErr *PartialError
+	return errors.As(err, &partialErr) && len(partialErr.NotReleasable()) > 0
+}
+
+// IsPartial returns true if the error is a PartialError
+func IsPartial(err error) bool {
+	var partialErr *PartialError
+	return errors.As(err, &partialErr)
+}
+
+// IsNoEnoughIPs returns true if the error is a NoEnoughIPsError
+func IsNoEnoughIPs(err error) bool {
+	var noEnoughErr *NoEnoughIPsError
+	return errors.As(err, &noEnoughErr)
+}
+
+func statusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+	return 0
+}
@@ -33,6 +33,7 @@ import (
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 	"tkestack.io/galaxy/pkg/utils/httputil"
+	"tkestack.io/galaxy/pkg/utils/nets"
 )
 
 type PoolController struct {
@@ -145,7 +146,7 @@ func (c *PoolController) preAllocateIP(req *restful.Request, resp *restful.Respo
 		httputil.InternalError(resp, err)
 		return
 	}
-	subnetSet, err := c.IPAM.NodeSubnetsByIPRanges(nil)
+	subnetSet, err := c.IPAM.NodeSubnetsByIPRanges("", nil, nil)
 	if err != nil {
 		httputil.InternalError(resp, err)
 		return
@@ -165,7 +166,8 @@ func (c *PoolController) preAllocateIP(req *restful.Request, resp *restful.Respo
 	}
 	needAllocateIPs := pool.Size - len(fips)
 	for i := 0; i < needAllocateIPs; i++ {
-		ip, err := c.IPAM.AllocateInSubnet(poolPrefix, subnetIPNet, floatingip.Attr{Policy: constant.ReleasePolicyNever})
+		ip, err := c.IPAM.AllocateInSubnet(poolPrefix, subnetIPNet, nets.IPv4Family,
+			floatingip.Attr{Policy: constant.ReleasePolicyNever})
 		if err == nil {
 			glog.Infof("allocated ip %s to %s during creating or updating pool", ip.String(), poolPrefix)
 			continue
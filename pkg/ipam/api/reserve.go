@@ -0,0 +1,196 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// maxReserveIPs is the max number of ips a reserve request can hold to protect from reserving a huge ip range
+const maxReserveIPs = 1024
+
+// ReserveIPReq is the request to reserve or unreserve ips
+type ReserveIPReq struct {
+	IPs      []string       `json:"ips,omitempty"`
+	IPRanges []nets.IPRange `json:"ipRanges,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+	Owner    string         `json:"owner,omitempty"`
+	Force    bool           `json:"force,omitempty"`
+}
+
+// SwaggerDoc generates swagger doc for reserve ip request
+func (ReserveIPReq) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"ips":      "ips to reserve or unreserve",
+		"ipRanges": "ip ranges to reserve or unreserve, e.g. 10.0.0.2~10.0.0.10",
+		"reason":   "why the ips are reserved",
+		"owner":    "who reserves the ips",
+		"force":    "reserve ips even if they are bound to existing pods",
+	}
+}
+
+// ReserveIPResp is the response of reserve or unreserve ips
+type ReserveIPResp struct {
+	httputil.Resp
+	Succeeded []string `json:"succeeded,omitempty"`
+	Failed    []string `json:"failed,omitempty"`
+	// Reason is the reason why this ip is failed
+	Reason []string `json:"reasons,omitempty"`
+}
+
+// SwaggerDoc generates swagger doc for reserve ip response
+func (ReserveIPResp) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"succeeded": "reserved or unreserved ips",
+		"failed":    "ips failed to reserve or unreserve, e.g. bound to pods or not within valid range",
+		"reasons":   "the reason of each failed ip",
+	}
+}
+
+// ReserveIPs reserves floating ips
+func (c *Controller) ReserveIPs(req *restful.Request, resp *restful.Response) {
+	c.handleReserve(req, resp, c.Reserve)
+}
+
+// UnreserveIPs unreserves floating ips
+func (c *Controller) UnreserveIPs(req *restful.Request, resp *restful.Response) {
+	c.handleReserve(req, resp, c.Unreserve)
+}
+
+func (c *Controller) handleReserve(req *restful.Request, resp *restful.Response,
+	f func(*ReserveIPReq) (*ReserveIPResp, error)) {
+	var reserveIPReq ReserveIPReq
+	if err := req.ReadEntity(&reserveIPReq); err != nil {
+		httputil.BadRequest(resp, err)
+		return
+	}
+	res, err := f(&reserveIPReq)
+	if err != nil {
+		httputil.BadRequest(resp, err)
+		return
+	}
+	resp.WriteHeaderAndEntity(res.Code, res) // nolint: errcheck
+}
+
+// Reserve reserves the requested ips with reason and owner. Ips bound to existing pods are rejected unless forced.
+// It returns an error if the request is invalid.
+func (c *Controller) Reserve(r *ReserveIPReq) (*ReserveIPResp, error) {
+	ips, err := r.expand()
+	if err != nil {
+		return nil, err
+	}
+	res := &ReserveIPResp{}
+	for _, ip := range ips {
+		if err := c.reserve(ip, r); err != nil {
+			res.Failed = append(res.Failed, ip.String())
+			res.Reason = append(res.Reason, err.Error())
+		} else {
+			res.Succeeded = append(res.Succeeded, ip.String())
+		}
+	}
+	glog.Infof("reserveIPs %v, reason %q, owner %q", res.Succeeded, r.Reason, r.Owner)
+	res.complete("Reserved")
+	return res, nil
+}
+
+func (c *Controller) reserve(ip net.IP, r *ReserveIPReq) error {
+	fip, err := c.ipam.ByIP(ip)
+	if err != nil {
+		return err
+	}
+	if fip.Key != "" && !r.Force {
+		if _, ok := fip.Labels[constant.ReserveFIPLabel]; !ok {
+			converted := convert(&fip)
+			if releasable, status := c.checkReleasableAndStatus(&converted); !releasable {
+				return fmt.Errorf("allocated to %s, pod status %s", fip.Key, status)
+			}
+		}
+	}
+	// the ip may be allocated to another pod after the check, ipam rejects it unless forced
+	return c.ipam.Reserve(ip, fip.Key, r.Force, floatingip.Attr{Reason: r.Reason, Owner: r.Owner})
+}
+
+// Unreserve unreserves the requested ips. Ips allocated to pods are not touched.
+// It returns an error if the request is invalid.
+func (c *Controller) Unreserve(r *ReserveIPReq) (*ReserveIPResp, error) {
+	ips, err := r.expand()
+	if err != nil {
+		return nil, err
+	}
+	res := &ReserveIPResp{}
+	for _, ip := range ips {
+		if err := c.ipam.Unreserve(ip); err != nil {
+			res.Failed = append(res.Failed, ip.String())
+			res.Reason = append(res.Reason, err.Error())
+		} else {
+			res.Succeeded = append(res.Succeeded, ip.String())
+		}
+	}
+	glog.Infof("unreserveIPs %v", res.Succeeded)
+	res.complete("Unreserved")
+	return res, nil
+}
+
+func (res *ReserveIPResp) complete(action string) {
+	if len(res.Failed) > 0 {
+		res.Resp = httputil.NewResp(http.StatusAccepted, fmt.Sprintf("%s %d ips, %d ips failed, please check the "+
+			"reasons why they failed", action, len(res.Succeeded), len(res.Failed)))
+	} else {
+		res.Resp = httputil.NewResp(http.StatusOK, "")
+	}
+}
+
+// expand returns all ips of the request. It rejects the request before expanding a range which would make the
+// total number of ips exceed maxReserveIPs
+func (r *ReserveIPReq) expand() ([]net.IP, error) {
+	if len(r.IPs) > maxReserveIPs {
+		return nil, fmt.Errorf("too many ips, at most %d ips are allowed in a request", maxReserveIPs)
+	}
+	var ips []net.IP
+	for _, str := range r.IPs {
+		ip := net.ParseIP(str)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not a valid ip", str)
+		}
+		ips = append(ips, ip)
+	}
+	total := uint64(len(ips))
+	for _, ipr := range r.IPRanges {
+		// Size saturates at math.MaxUint64, compare with the remaining quota to avoid overflowing total
+		size := ipr.Size()
+		if size > maxReserveIPs-total {
+			return nil, fmt.Errorf("too many ips, at most %d ips are allowed in a request", maxReserveIPs)
+		}
+		total += size
+		for ip := ipr.First; ip != nil && nets.CompareIP(ip, ipr.Last) <= 0; ip = nets.NextIP(ip) {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no ips in request")
+	}
+	return ips, nil
+}
@@ -0,0 +1,178 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+// SubnetUsage is the ip usage of an ip pool of a subnet
+type SubnetUsage struct {
+	Subnet      string   `json:"subnet"`
+	IPRanges    []string `json:"ipRanges"`
+	NodeSubnets []string `json:"nodeSubnets"`
+	Draining    bool     `json:"draining,omitempty"`
+	Total       uint64   `json:"total"`
+	Allocated   int      `json:"allocated"`
+	Reserved    int      `json:"reserved"`
+	Held        int      `json:"held"`
+	Free        uint64   `json:"free"`
+}
+
+// SwaggerDoc generates swagger doc for subnet usage
+func (SubnetUsage) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"subnet":      "subnet of the ip pool",
+		"ipRanges":    "ip ranges of the ip pool",
+		"nodeSubnets": "node subnets whose pods can get ips of the ip pool",
+		"draining":    "true if the ip ranges are removed from config and waiting for their ips to be released",
+		"total":       "number of ips, 0 for draining ip pools, 18446744073709551615 if there are more",
+		"allocated":   "number of ips bound to pods",
+		"reserved":    "number of reserved ips",
+		"held":        "number of ips bound to no pods, e.g. kept by release policy after pods are deleted",
+		"free":        "number of unallocated ips, 0 for draining ip pools",
+	}
+}
+
+// ListSubnetResp is the response of list subnets
+type ListSubnetResp struct {
+	httputil.Resp
+	Subnets []SubnetUsage `json:"subnets"`
+}
+
+// ListSubnets lists ip usage of ip pools, filtered by subnet and node subnet query params
+func (c *Controller) ListSubnets(req *restful.Request, resp *restful.Response) {
+	subnet, nodeSubnet := req.QueryParameter("subnet"), req.QueryParameter("nodeSubnet")
+	var nodeIPNet *net.IPNet
+	if nodeSubnet != "" {
+		var err error
+		if _, nodeIPNet, err = net.ParseCIDR(nodeSubnet); err != nil {
+			httputil.BadRequest(resp, fmt.Errorf("invalid nodeSubnet %s", nodeSubnet))
+			return
+		}
+	}
+	if subnet != "" {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			httputil.BadRequest(resp, fmt.Errorf("invalid subnet %s", subnet))
+			return
+		}
+		subnet = ipNet.String()
+	}
+	usages := []SubnetUsage{}
+	for _, u := range c.ipam.SubnetUsages() {
+		if subnet != "" && u.Subnet.String() != subnet {
+			continue
+		}
+		usage := SubnetUsage{Subnet: u.Subnet.String(), Draining: u.Draining, Total: u.Total,
+			Allocated: u.Allocated, Reserved: u.Reserved, Held: u.Held, Free: u.Free,
+			IPRanges: make([]string, len(u.IPRanges)), NodeSubnets: make([]string, len(u.NodeSubnets))}
+		for i := range u.IPRanges {
+			usage.IPRanges[i] = u.IPRanges[i].String()
+		}
+		matched := nodeIPNet == nil
+		for i := range u.NodeSubnets {
+			usage.NodeSubnets[i] = u.NodeSubnets[i].String()
+			matched = matched || usage.NodeSubnets[i] == nodeIPNet.String()
+		}
+		if !matched {
+			continue
+		}
+		usages = append(usages, usage)
+	}
+	resp.WriteEntity(ListSubnetResp{Resp: httputil.NewResp(http.StatusOK, ""), Subnets: usages}) // nolint: errcheck
+}
+
+// PoolUsage is the ip usage of a pool
+type PoolUsage struct {
+	Name      string         `json:"name"`
+	Size      int            `json:"size"`
+	IPs       int            `json:"ips"`
+	Allocated int            `json:"allocated"`
+	Held      int            `json:"held"`
+	Subnets   map[string]int `json:"subnets"`
+}
+
+// SwaggerDoc generates swagger doc for pool usage
+func (PoolUsage) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"name":      "pool name",
+		"size":      "pool size, 0 if the Pool is not created",
+		"ips":       "number of ips the pool holds",
+		"allocated": "number of ips bound to pods",
+		"held":      "number of ips bound to no pods, e.g. pre-allocated ips or ips of deleted pods",
+		"subnets":   "number of ips the pool holds in each subnet",
+	}
+}
+
+// GetPoolUsageResp is the response of get pool usage
+type GetPoolUsageResp struct {
+	httputil.Resp
+	Usage PoolUsage `json:"usage"`
+}
+
+// Usage gets ip usage of a pool. Pools are not required to be created in advance, it returns not found only if the
+// Pool is not created and holds no ips.
+func (c *PoolController) Usage(req *restful.Request, resp *restful.Response) {
+	name := req.PathParameter("name")
+	if name == "" {
+		httputil.BadRequest(resp, fmt.Errorf("pool name is empty"))
+		return
+	}
+	usage := PoolUsage{Name: name, Subnets: map[string]int{}}
+	var created bool
+	pool, err := c.Client.GalaxyV1alpha1().Pools("kube-system").Get(context.TODO(), name, v1.GetOptions{})
+	if err == nil {
+		created = true
+		usage.Size = pool.Size
+	} else if !errors.IsNotFound(err) {
+		httputil.InternalError(resp, err)
+		return
+	}
+	poolPrefix := util.NewKeyObj(util.DeploymentPrefixKey, "", "", "", name).PoolPrefix()
+	fips, err := c.IPAM.ByPrefix(poolPrefix)
+	if err != nil {
+		httputil.InternalError(resp, err)
+		return
+	}
+	if !created && len(fips) == 0 {
+		httputil.ItemNotFound(resp, fmt.Errorf("pool %s", name))
+		return
+	}
+	for _, fip := range fips {
+		usage.IPs++
+		if fip.State() == floatingip.StateAllocated {
+			usage.Allocated++
+		} else {
+			usage.Held++
+		}
+		if subnet := fip.Subnet(); subnet != nil {
+			usage.Subnets[subnet.String()]++
+		}
+	}
+	resp.WriteEntity(GetPoolUsageResp{Resp: httputil.NewResp(http.StatusOK, ""), Usage: usage}) // nolint: errcheck
+}
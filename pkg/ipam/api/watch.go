@@ -0,0 +1,131 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+// IPEvent is a change of a floating ip sent by the watch api
+type IPEvent struct {
+	// Type is one of allocate, release, reserve and update
+	Type floatingip.EventType `json:"type"`
+	// ResourceVersion is the resource version to resume watching from after this event
+	ResourceVersion string     `json:"resourceVersion"`
+	Object          FloatingIP `json:"object"`
+}
+
+// SwaggerDoc generates swagger doc for ip event
+func (IPEvent) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"type":            "allocate, release, reserve or update",
+		"resourceVersion": "resource version to resume watching from after this event",
+		"object":          "the ip after the change, or before the change for release event",
+	}
+}
+
+// watchFilter filters events of the watch api, empty fields match all
+type watchFilter struct {
+	poolName  string
+	namespace string
+	appName   string
+	appType   string
+}
+
+func (f *watchFilter) match(fip *FloatingIP) bool {
+	return (f.poolName == "" || f.poolName == fip.PoolName) &&
+		(f.namespace == "" || f.namespace == fip.Namespace) &&
+		(f.appName == "" || f.appName == fip.AppName) &&
+		(f.appType == "" || f.appType == fip.AppType)
+}
+
+// WatchIPs streams ip changes as a json object per line until the client disconnects, timeoutSeconds passes or
+// the client falls behind. Clients should resume by the resource version of the last received event.
+func (c *Controller) WatchIPs(req *restful.Request, resp *restful.Response) {
+	resourceVersion := req.QueryParameter("resourceVersion")
+	var timeout <-chan time.Time
+	if t := req.QueryParameter("timeoutSeconds"); t != "" {
+		seconds, err := strconv.Atoi(t)
+		if err != nil || seconds <= 0 {
+			httputil.BadRequest(resp, fmt.Errorf("invalid timeoutSeconds %s", t))
+			return
+		}
+		timer := time.NewTimer(time.Duration(seconds) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	filter := watchFilter{
+		poolName:  req.QueryParameter("poolName"),
+		namespace: req.QueryParameter("namespace"),
+		appName:   req.QueryParameter("appName"),
+		appType:   req.QueryParameter("appType"),
+	}
+	events, stop, err := c.ipam.Watch(resourceVersion)
+	if err == floatingip.ErrResourceVersionTooOld {
+		httputil.Gone(resp, err)
+		return
+	} else if err != nil {
+		httputil.BadRequest(resp, err)
+		return
+	}
+	defer stop()
+	flusher, _ := resp.ResponseWriter.(http.Flusher)
+	resp.Header().Set("Content-Type", restful.MIME_JSON)
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	encoder := json.NewEncoder(resp)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				glog.V(3).Infof("watcher %s falls behind, stop watching", req.Request.RemoteAddr)
+				return
+			}
+			fip := convert(&event.FloatingIP)
+			if !filter.match(&fip) {
+				continue
+			}
+			if event.Type != floatingip.EventRelease {
+				fip.Releasable, fip.Status = c.checkReleasableAndStatus(&fip)
+			}
+			if err := encoder.Encode(IPEvent{Type: event.Type, ResourceVersion: event.ResourceVersion,
+				Object: fip}); err != nil {
+				glog.V(3).Infof("failed to write event to %s: %v", req.Request.RemoteAddr, err)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-timeout:
+			return
+		case <-req.Request.Context().Done():
+			return
+		}
+	}
+}
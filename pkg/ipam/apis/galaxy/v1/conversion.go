@@ -0,0 +1,127 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+const (
+	// KindDeployment and KindStatefulSet are workload kinds of deployment and statefulset pods
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+)
+
+// attribute is the json format of v1alpha1 FloatingIPSpec.Attribute
+type attribute struct {
+	NodeName string
+	Uid      string
+	TTL      time.Duration `json:",omitempty"`
+	Reason   string        `json:",omitempty"`
+	Owner    string        `json:",omitempty"`
+	// Namespace is the namespace owning an ip whose key has no namespace, e.g. an ip held by a pool
+	Namespace string `json:",omitempty"`
+}
+
+// ConvertFromV1alpha1 converts a v1alpha1 FloatingIP to v1, the workload fields are resolved from its key and
+// selection labels are set accordingly. Subnet is left empty since it's unknown to v1alpha1.
+func ConvertFromV1alpha1(in *v1alpha1.FloatingIP, out *FloatingIP) error {
+	out.TypeMeta = metav1.TypeMeta{Kind: constant.ResourceKind, APIVersion: SchemeGroupVersion.String()}
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = FloatingIPSpec{Policy: in.Spec.Policy, UpdateTime: in.Spec.UpdateTime}
+	ResolveKey(in.Spec.Key, &out.Spec)
+	if in.Spec.Attribute != "" {
+		var attr attribute
+		if err := json.Unmarshal([]byte(in.Spec.Attribute), &attr); err != nil {
+			return fmt.Errorf("unmarshal attribute %s of %s: %v", in.Spec.Attribute, in.Name, err)
+		}
+		out.Spec.Node, out.Spec.UID, out.Spec.Reason, out.Spec.Owner = attr.NodeName, attr.Uid, attr.Reason,
+			attr.Owner
+		if out.Spec.Namespace == "" {
+			out.Spec.Namespace = attr.Namespace
+		}
+		if attr.TTL > 0 {
+			out.Spec.TTL = &metav1.Duration{Duration: attr.TTL}
+		}
+	}
+	SetSelectionLabels(&out.ObjectMeta, &out.Spec)
+	return nil
+}
+
+// ConvertToV1alpha1 converts a v1 FloatingIP to v1alpha1, the key is generated from the workload fields if it's
+// empty.
+func ConvertToV1alpha1(in *FloatingIP, out *v1alpha1.FloatingIP) error {
+	out.TypeMeta = metav1.TypeMeta{Kind: constant.ResourceKind, APIVersion: v1alpha1.SchemeGroupVersion.String()}
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	attr := attribute{NodeName: in.Spec.Node, Uid: in.Spec.UID, Reason: in.Spec.Reason, Owner: in.Spec.Owner}
+	if in.Spec.TTL != nil {
+		attr.TTL = in.Spec.TTL.Duration
+	}
+	key := in.Spec.Key
+	if key == "" {
+		key = GenerateKey(&in.Spec)
+	}
+	if util.ParseKey(key).Namespace == "" {
+		attr.Namespace = in.Spec.Namespace
+	}
+	data, err := json.Marshal(attr)
+	if err != nil {
+		return err
+	}
+	out.Spec = v1alpha1.FloatingIPSpec{Key: key, Attribute: string(data), Policy: in.Spec.Policy,
+		UpdateTime: in.Spec.UpdateTime}
+	return nil
+}
+
+// ResolveKey sets key and the pool and workload fields resolved from it on spec
+func ResolveKey(key string, spec *FloatingIPSpec) {
+	keyObj := util.ParseKey(key)
+	spec.Key = key
+	spec.Pool = keyObj.PoolName
+	spec.Namespace = keyObj.Namespace
+	spec.Pod = keyObj.PodName
+	switch keyObj.AppTypePrefix {
+	case "", util.NoRefAppTypePrefix:
+		spec.WorkloadKind, spec.WorkloadName = "", ""
+	case util.DeploymentPrefixKey:
+		spec.WorkloadKind, spec.WorkloadName = KindDeployment, keyObj.AppName
+	case util.StatefulsetPrefixKey:
+		spec.WorkloadKind, spec.WorkloadName = KindStatefulSet, keyObj.AppName
+	default:
+		spec.WorkloadKind, spec.WorkloadName = util.GetAppType(keyObj.AppTypePrefix), keyObj.AppName
+	}
+}
+
+// GenerateKey generates the ipam key from the pool and workload fields of spec
+func GenerateKey(spec *FloatingIPSpec) string {
+	if spec.Pod == "" {
+		// an ip reserved for the pool
+		return util.NewKeyObj("", "", "", "", spec.Pool).KeyInDB
+	}
+	prefix, appName := util.NoRefAppTypePrefix, util.NoRefAppName
+	if spec.WorkloadKind != "" {
+		prefix, appName = util.GetAppTypePrefix(spec.WorkloadKind), spec.WorkloadName
+	}
+	return util.NewKeyObj(prefix, spec.Namespace, appName, spec.Pod, spec.Pool).KeyInDB
+}
@@ -0,0 +1,129 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package v1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+)
+
+// #lizard forgives
+func TestConversion(t *testing.T) {
+	updateTime := metav1.NewTime(time.Unix(1600000000, 0))
+	for i, testCase := range []struct {
+		key, attr    string
+		expectSpec   FloatingIPSpec
+		expectLabels map[string]string
+	}{
+		{
+			key:  "dp_ns1_dp1_dp1-xxx-yyy",
+			attr: `{"NodeName":"node1","Uid":"uid1"}`,
+			expectSpec: FloatingIPSpec{Key: "dp_ns1_dp1_dp1-xxx-yyy", WorkloadKind: KindDeployment, Namespace: "ns1",
+				WorkloadName: "dp1", Pod: "dp1-xxx-yyy", UID: "uid1", Node: "node1"},
+			expectLabels: map[string]string{LabelWorkloadKind: KindDeployment, LabelNamespace: "ns1",
+				LabelWorkload: "dp1", LabelNode: "node1"},
+		},
+		{
+			key:  "sts_ns1_sts1_sts1-0",
+			attr: `{"NodeName":"node1","Uid":"uid1","TTL":3600000000000}`,
+			expectSpec: FloatingIPSpec{Key: "sts_ns1_sts1_sts1-0", WorkloadKind: KindStatefulSet, Namespace: "ns1",
+				WorkloadName: "sts1", Pod: "sts1-0", UID: "uid1", Node: "node1",
+				TTL: &metav1.Duration{Duration: time.Hour}},
+			expectLabels: map[string]string{LabelWorkloadKind: KindStatefulSet, LabelNamespace: "ns1",
+				LabelWorkload: "sts1", LabelNode: "node1"},
+		},
+		{
+			key:  "pool__pool1_dp_ns1_dp1_dp1-xxx-yyy",
+			attr: `{"NodeName":"","Uid":""}`,
+			expectSpec: FloatingIPSpec{Key: "pool__pool1_dp_ns1_dp1_dp1-xxx-yyy", Pool: "pool1",
+				WorkloadKind: KindDeployment, Namespace: "ns1", WorkloadName: "dp1", Pod: "dp1-xxx-yyy"},
+			expectLabels: map[string]string{LabelPool: "pool1", LabelWorkloadKind: KindDeployment,
+				LabelNamespace: "ns1", LabelWorkload: "dp1"},
+		},
+		{
+			key:          "pool__pool1_",
+			attr:         `{"NodeName":"","Uid":"","Reason":"for test","Owner":"admin"}`,
+			expectSpec:   FloatingIPSpec{Key: "pool__pool1_", Pool: "pool1", Reason: "for test", Owner: "admin"},
+			expectLabels: map[string]string{LabelPool: "pool1"},
+		},
+		{
+			key:          "pool__pool1_",
+			attr:         `{"NodeName":"","Uid":"","Namespace":"ns1"}`,
+			expectSpec:   FloatingIPSpec{Key: "pool__pool1_", Pool: "pool1", Namespace: "ns1"},
+			expectLabels: map[string]string{LabelPool: "pool1", LabelNamespace: "ns1"},
+		},
+		{
+			key:          "NULL_ns1_NULL_pod1",
+			attr:         `{"NodeName":"node1","Uid":"uid1"}`,
+			expectSpec:   FloatingIPSpec{Key: "NULL_ns1_NULL_pod1", Namespace: "ns1", Pod: "pod1", UID: "uid1", Node: "node1"},
+			expectLabels: map[string]string{LabelNamespace: "ns1", LabelNode: "node1"},
+		},
+		{
+			key:  "tapp_ns1_tapp1_tapp1-1",
+			attr: `{"NodeName":"node1","Uid":"uid1"}`,
+			expectSpec: FloatingIPSpec{Key: "tapp_ns1_tapp1_tapp1-1", WorkloadKind: "tapp", Namespace: "ns1",
+				WorkloadName: "tapp1", Pod: "tapp1-1", UID: "uid1", Node: "node1"},
+			expectLabels: map[string]string{LabelWorkloadKind: "tapp", LabelNamespace: "ns1", LabelWorkload: "tapp1",
+				LabelNode: "node1"},
+		},
+	} {
+		in := &v1alpha1.FloatingIP{
+			ObjectMeta: metav1.ObjectMeta{Name: "10.0.0.2", Labels: map[string]string{constant.ReserveFIPLabel: ""}},
+			Spec: v1alpha1.FloatingIPSpec{Key: testCase.key, Attribute: testCase.attr,
+				Policy: constant.ReleasePolicyImmutable, UpdateTime: updateTime},
+		}
+		var fip FloatingIP
+		if err := ConvertFromV1alpha1(in, &fip); err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		testCase.expectSpec.Policy, testCase.expectSpec.UpdateTime = constant.ReleasePolicyImmutable, updateTime
+		if !reflect.DeepEqual(fip.Spec, testCase.expectSpec) {
+			t.Fatalf("case %d: expect %+v, real %+v", i, testCase.expectSpec, fip.Spec)
+		}
+		testCase.expectLabels[constant.ReserveFIPLabel] = ""
+		if !reflect.DeepEqual(fip.Labels, testCase.expectLabels) {
+			t.Fatalf("case %d: expect labels %v, real %v", i, testCase.expectLabels, fip.Labels)
+		}
+		// converting back gets the same spec
+		var out v1alpha1.FloatingIP
+		if err := ConvertToV1alpha1(&fip, &out); err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(out.Spec, in.Spec) {
+			t.Fatalf("case %d: expect %+v, real %+v", i, in.Spec, out.Spec)
+		}
+		// key is generated from the typed fields if it's empty
+		fip.Spec.Key = ""
+		if key := GenerateKey(&fip.Spec); key != testCase.key {
+			t.Fatalf("case %d: expect key %s, real %s", i, testCase.key, key)
+		}
+	}
+}
+
+func TestSetSelectionLabels(t *testing.T) {
+	meta := metav1.ObjectMeta{Labels: map[string]string{LabelNode: "node1", "app": "foo"}}
+	SetSelectionLabels(&meta, &FloatingIPSpec{Namespace: "ns1", WorkloadName: strings.Repeat("a", 64)})
+	if expect := map[string]string{LabelNamespace: "ns1", "app": "foo"}; !reflect.DeepEqual(meta.Labels, expect) {
+		t.Fatalf("expect %v, real %v", expect, meta.Labels)
+	}
+}
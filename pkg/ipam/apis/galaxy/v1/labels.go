@@ -0,0 +1,61 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Labels set on FloatingIPs to select them by pool, workload or node
+const (
+	LabelPool         = "galaxy.k8s.io/pool"
+	LabelWorkloadKind = "galaxy.k8s.io/workload-kind"
+	LabelNamespace    = "galaxy.k8s.io/namespace"
+	LabelWorkload     = "galaxy.k8s.io/workload"
+	LabelNode         = "galaxy.k8s.io/node"
+)
+
+var selectionLabels = []string{LabelPool, LabelWorkloadKind, LabelNamespace, LabelWorkload, LabelNode}
+
+// SetSelectionLabels replaces the selection labels of meta with the pool, workload and node of spec. Empty values
+// and values which are not valid label values are skipped.
+func SetSelectionLabels(meta *metav1.ObjectMeta, spec *FloatingIPSpec) {
+	for _, label := range selectionLabels {
+		delete(meta.Labels, label)
+	}
+	values := []string{spec.Pool, spec.WorkloadKind, spec.Namespace, spec.WorkloadName, spec.Node}
+	for i, label := range selectionLabels {
+		if values[i] == "" || len(validation.IsValidLabelValue(values[i])) > 0 {
+			continue
+		}
+		if meta.Labels == nil {
+			meta.Labels = map[string]string{}
+		}
+		meta.Labels[label] = values[i]
+	}
+}
+
+// IsSelectionLabel returns true if label is one of the selection labels
+func IsSelectionLabel(label string) bool {
+	for i := range selectionLabels {
+		if selectionLabels[i] == label {
+			return true
+		}
+	}
+	return false
+}
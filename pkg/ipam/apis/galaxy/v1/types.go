@@ -0,0 +1,78 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FloatingIP is an allocated ip. Unlike v1alpha1, the workload identity and attributes of the ip are typed fields
+// instead of being encoded in key and attribute.
+type FloatingIP struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec defines the desired identities of FloatingIP.
+	Spec FloatingIPSpec `json:"spec"`
+}
+
+// FloatingIPSpec is spec of FloatingIP.
+type FloatingIPSpec struct {
+	// Key is the ipam key of the ip which the fields below are resolved from. It is generated from the fields below
+	// if it's empty.
+	Key string `json:"key,omitempty"`
+	// Pool is the name of the pool the ip belongs to
+	Pool string `json:"pool,omitempty"`
+	// WorkloadKind is the kind of the workload, i.e. Deployment, StatefulSet or a lower case custom resource kind
+	// like tapp. It is empty for pods without owners.
+	WorkloadKind string `json:"workloadKind,omitempty"`
+	// Namespace is the namespace of the pod, or the namespace owning an ip held by a pool
+	Namespace string `json:"namespace,omitempty"`
+	// WorkloadName is the name of the workload
+	WorkloadName string `json:"workloadName,omitempty"`
+	// Pod is the name of the pod
+	Pod string `json:"pod,omitempty"`
+	// UID is the uid of the pod
+	UID string `json:"uid,omitempty"`
+	// Node is the node name of the pod
+	Node string `json:"node,omitempty"`
+	// Policy is the release policy of the ip
+	Policy constant.ReleasePolicy `json:"policy"`
+	// TTL is how long to keep the ip after the pod is deleted for ttl release policy
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+	// Reason and Owner describe why and by whom the ip is reserved
+	Reason string `json:"reason,omitempty"`
+	Owner  string `json:"owner,omitempty"`
+	// Subnet is the cidr of the pool the ip belongs to, it is filled by galaxy-ipam when converting and is
+	// read only
+	Subnet string `json:"subnet,omitempty"`
+	// UpdateTime is the time the ip is allocated, released or updated
+	UpdateTime metav1.Time `json:"updateTime"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FloatingIPList is list of FloatingIP.
+type FloatingIPList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []FloatingIP `json:"items"`
+}
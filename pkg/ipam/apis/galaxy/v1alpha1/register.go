@@ -65,6 +65,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&FloatingIP{},
 		&FloatingIPList{},
+		&FloatingIPPool{},
+		&FloatingIPPoolList{},
 		&Pool{},
 		&PoolList{},
 	)
@@ -96,3 +96,61 @@ type PoolList struct {
 
 	Items []Pool `json:"items"`
 }
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FloatingIPPool provides configuration of a floating ip pool. It is the declarative replacement of an element
+// of floatingips in floatingip-config ConfigMap.
+type FloatingIPPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec defines the ips of the pool and the node subnets which can use them.
+	Spec FloatingIPPoolSpec `json:"spec"`
+	// Status reports ip usage of the pool.
+	Status FloatingIPPoolStatus `json:"status,omitempty"`
+}
+
+// FloatingIPPoolSpec is spec of FloatingIPPool, it mirrors floatingip.FloatingIPPoolConf.
+type FloatingIPPoolSpec struct {
+	// NodeSubnets are cidrs of the nodes which can use ips of the pool
+	NodeSubnets []string `json:"nodeSubnets"`
+	// Subnet is the cidr of the pool ips
+	Subnet string `json:"subnet"`
+	// IPs are ips or ip ranges like 10.0.0.2~10.0.0.10 within subnet
+	IPs []string `json:"ips"`
+	// Gateway of the pool ips
+	Gateway string `json:"gateway"`
+	// Vlan id of the pool ips
+	Vlan uint16 `json:"vlan,omitempty"`
+	// NamespaceQuotas maps namespace to the max number of ips it may hold in the pool, "*" matches any namespace
+	NamespaceQuotas map[string]int `json:"namespaceQuotas,omitempty"`
+	// ReleaseCooldown is a duration like 30s during which released ips are not allocatable
+	ReleaseCooldown string `json:"releaseCooldown,omitempty"`
+}
+
+// FloatingIPPoolStatus is status of FloatingIPPool.
+type FloatingIPPoolStatus struct {
+	// Total is the number of ips of the pool
+	Total int `json:"total"`
+	// Allocated is the number of allocated ips including reserved ones
+	Allocated int `json:"allocated"`
+	// Reserved is the number of manually reserved ips
+	Reserved int `json:"reserved"`
+	// Free is the number of unallocated ips
+	Free int `json:"free"`
+	// Message is the reason why the pool is not applied, empty if the pool is valid
+	Message string `json:"message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FloatingIPPoolList is list of FloatingIPPool.
+type FloatingIPPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []FloatingIPPool `json:"items"`
+}
@@ -84,6 +84,112 @@ func (in *FloatingIPList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FloatingIPPool) DeepCopyInto(out *FloatingIPPool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FloatingIPPool.
+func (in *FloatingIPPool) DeepCopy() *FloatingIPPool {
+	if in == nil {
+		return nil
+	}
+	out := new(FloatingIPPool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FloatingIPPool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FloatingIPPoolList) DeepCopyInto(out *FloatingIPPoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]FloatingIPPool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FloatingIPPoolList.
+func (in *FloatingIPPoolList) DeepCopy() *FloatingIPPoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(FloatingIPPoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FloatingIPPoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FloatingIPPoolSpec) DeepCopyInto(out *FloatingIPPoolSpec) {
+	*out = *in
+	if in.NodeSubnets != nil {
+		in, out := &in.NodeSubnets, &out.NodeSubnets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.IPs != nil {
+		in, out := &in.IPs, &out.IPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceQuotas != nil {
+		in, out := &in.NamespaceQuotas, &out.NamespaceQuotas
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FloatingIPPoolSpec.
+func (in *FloatingIPPoolSpec) DeepCopy() *FloatingIPPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FloatingIPPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FloatingIPPoolStatus) DeepCopyInto(out *FloatingIPPoolStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FloatingIPPoolStatus.
+func (in *FloatingIPPoolStatus) DeepCopy() *FloatingIPPoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FloatingIPPoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FloatingIPSpec) DeepCopyInto(out *FloatingIPSpec) {
 	*out = *in
@@ -32,6 +32,10 @@ func (c *FakeGalaxyV1alpha1) FloatingIPs() v1alpha1.FloatingIPInterface {
 	return &FakeFloatingIPs{c}
 }
 
+func (c *FakeGalaxyV1alpha1) FloatingIPPools() v1alpha1.FloatingIPPoolInterface {
+	return &FakeFloatingIPPools{c}
+}
+
 func (c *FakeGalaxyV1alpha1) Pools(namespace string) v1alpha1.PoolInterface {
 	return &FakePools{c, namespace}
 }
@@ -29,6 +29,7 @@ import (
 type GalaxyV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	FloatingIPsGetter
+	FloatingIPPoolsGetter
 	PoolsGetter
 }
 
@@ -41,6 +42,10 @@ func (c *GalaxyV1alpha1Client) FloatingIPs() FloatingIPInterface {
 	return newFloatingIPs(c)
 }
 
+func (c *GalaxyV1alpha1Client) FloatingIPPools() FloatingIPPoolInterface {
+	return newFloatingIPPools(c)
+}
+
 func (c *GalaxyV1alpha1Client) Pools(namespace string) PoolInterface {
 	return newPools(c, namespace)
 }
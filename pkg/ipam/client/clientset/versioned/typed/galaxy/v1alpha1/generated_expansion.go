@@ -20,4 +20,6 @@ package v1alpha1
 
 type FloatingIPExpansion interface{}
 
+type FloatingIPPoolExpansion interface{}
+
 type PoolExpansion interface{}
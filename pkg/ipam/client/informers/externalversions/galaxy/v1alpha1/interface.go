@@ -26,6 +26,8 @@ import (
 type Interface interface {
 	// FloatingIPs returns a FloatingIPInformer.
 	FloatingIPs() FloatingIPInformer
+	// FloatingIPPools returns a FloatingIPPoolInformer.
+	FloatingIPPools() FloatingIPPoolInformer
 	// Pools returns a PoolInformer.
 	Pools() PoolInformer
 }
@@ -46,6 +48,11 @@ func (v *version) FloatingIPs() FloatingIPInformer {
 	return &floatingIPInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
 }
 
+// FloatingIPPools returns a FloatingIPPoolInformer.
+func (v *version) FloatingIPPools() FloatingIPPoolInformer {
+	return &floatingIPPoolInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // Pools returns a PoolInformer.
 func (v *version) Pools() PoolInformer {
 	return &poolInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
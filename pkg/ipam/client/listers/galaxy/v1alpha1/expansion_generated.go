@@ -22,6 +22,10 @@ package v1alpha1
 // FloatingIPLister.
 type FloatingIPListerExpansion interface{}
 
+// FloatingIPPoolListerExpansion allows custom methods to be added to
+// FloatingIPPoolLister.
+type FloatingIPPoolListerExpansion interface{}
+
 // PoolListerExpansion allows custom methods to be added to
 // PoolLister.
 type PoolListerExpansion interface{}
@@ -28,6 +28,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	appv1 "k8s.io/client-go/listers/apps/v1"
 	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
 	crd_clientset "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned"
 	crdInformer "tkestack.io/galaxy/pkg/ipam/client/informers/externalversions"
 	galaxyinformer "tkestack.io/galaxy/pkg/ipam/client/informers/externalversions/galaxy/v1alpha1"
@@ -40,17 +41,21 @@ type IPAMContext struct {
 	GalaxyClient  crd_clientset.Interface
 	ExtClient     extensionClient.Interface
 	DynamicClient dynamic.Interface
+	// Recorder records events of pods and apps
+	Recorder record.EventRecorder
 
 	PodLister         corev1lister.PodLister
 	NodeLister        corev1lister.NodeLister
 	StatefulSetLister appv1.StatefulSetLister
 	DeploymentLister  appv1.DeploymentLister
 	PoolLister        list.PoolLister
+	FIPPoolLister     list.FloatingIPPoolLister
 	ExtensionLister   extensionlister.CustomResourceDefinitionLister
 
-	PodInformer  coreinformer.PodInformer
-	NodeInformer coreinformer.NodeInformer
-	FIPInformer  galaxyinformer.FloatingIPInformer
+	PodInformer     coreinformer.PodInformer
+	NodeInformer    coreinformer.NodeInformer
+	FIPInformer     galaxyinformer.FloatingIPInformer
+	FIPPoolInformer galaxyinformer.FloatingIPPoolInformer
 
 	informerFactory    informers.SharedInformerFactory
 	crdInformerFactory crdInformer.SharedInformerFactory
@@ -60,13 +65,22 @@ type IPAMContext struct {
 // NewIPAMContext creates a new IPAMContext given the clients
 func NewIPAMContext(client kubernetes.Interface, galaxyClient crd_clientset.Interface,
 	extClient extensionClient.Interface, DynamicClient dynamic.Interface) *IPAMContext {
+	return NewIPAMContextWithInformerFactory(client, informers.NewSharedInformerFactoryWithOptions(client,
+		time.Minute), galaxyClient, extClient, DynamicClient)
+}
+
+// NewIPAMContextWithInformerFactory creates a new IPAMContext which shares pod, node and workload informers of
+// informerFactory, e.g. the informer factory of kube-scheduler
+func NewIPAMContextWithInformerFactory(client kubernetes.Interface, informerFactory informers.SharedInformerFactory,
+	galaxyClient crd_clientset.Interface, extClient extensionClient.Interface,
+	DynamicClient dynamic.Interface) *IPAMContext {
 	ctx := &IPAMContext{
 		Client:        client,
 		GalaxyClient:  galaxyClient,
 		ExtClient:     extClient,
 		DynamicClient: DynamicClient,
 	}
-	ctx.informerFactory = informers.NewSharedInformerFactoryWithOptions(ctx.Client, time.Minute)
+	ctx.informerFactory = informerFactory
 	ctx.PodInformer = ctx.informerFactory.Core().V1().Pods()
 	ctx.NodeInformer = ctx.informerFactory.Core().V1().Nodes()
 	statefulsetInformer := ctx.informerFactory.Apps().V1().StatefulSets()
@@ -74,6 +88,7 @@ func NewIPAMContext(client kubernetes.Interface, galaxyClient crd_clientset.Inte
 	ctx.crdInformerFactory = crdInformer.NewSharedInformerFactory(ctx.GalaxyClient, 0)
 	poolInformer := ctx.crdInformerFactory.Galaxy().V1alpha1().Pools()
 	ctx.FIPInformer = ctx.crdInformerFactory.Galaxy().V1alpha1().FloatingIPs()
+	ctx.FIPPoolInformer = ctx.crdInformerFactory.Galaxy().V1alpha1().FloatingIPPools()
 	ctx.extensionFactory = extensioninformer.NewSharedInformerFactory(ctx.ExtClient, 0)
 	extensionInformer := ctx.extensionFactory.Apiextensions().V1().CustomResourceDefinitions()
 	extensionInformer.Informer() // call Informer to actually create an informer
@@ -83,6 +98,7 @@ func NewIPAMContext(client kubernetes.Interface, galaxyClient crd_clientset.Inte
 	ctx.StatefulSetLister = statefulsetInformer.Lister()
 	ctx.DeploymentLister = deploymentInformer.Lister()
 	ctx.PoolLister = poolInformer.Lister()
+	ctx.FIPPoolLister = ctx.FIPPoolInformer.Lister()
 
 	ctx.ExtensionLister = extensionInformer.Lister()
 	return ctx
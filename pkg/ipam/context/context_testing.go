@@ -21,6 +21,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	dynamic "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 	fakeGalaxyCli "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned/fake"
 )
 
@@ -28,6 +29,7 @@ import (
 func CreateTestIPAMContext(builtinObjs, crdObjs, crObjs []runtime.Object) (*IPAMContext, chan struct{}) {
 	ctx := NewIPAMContext(fake.NewSimpleClientset(builtinObjs...), fakeGalaxyCli.NewSimpleClientset(),
 		extensionClient.NewSimpleClientset(crdObjs...), dynamic.NewSimpleDynamicClient(runtime.NewScheme(), crObjs...))
+	ctx.Recorder = record.NewFakeRecorder(1024)
 	stopChan := make(chan struct{})
 	ctx.StartInformers(stopChan)
 	return ctx, stopChan
@@ -24,6 +24,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
 	glog "k8s.io/klog"
 
 	"tkestack.io/galaxy/pkg/ipam/apis/galaxy"
@@ -105,6 +106,112 @@ var floatingipCrd = &extensionsv1.CustomResourceDefinition{
 	},
 }
 
+// floatingipV1Version is the v1 version of floatingip crd, it's served only if the conversion webhook is configured
+var floatingipV1Version = extensionsv1.CustomResourceDefinitionVersion{
+	Name:    "v1",
+	Served:  true,
+	Storage: false,
+	AdditionalPrinterColumns: []extensionsv1.CustomResourceColumnDefinition{
+		{Name: "Subnet", Type: "string", JSONPath: ".spec.subnet"},
+		{Name: "Pool", Type: "string", JSONPath: ".spec.pool"},
+		{Name: "Kind", Type: "string", JSONPath: ".spec.workloadKind"},
+		{Name: "Namespace", Type: "string", JSONPath: ".spec.namespace"},
+		{Name: "Workload", Type: "string", JSONPath: ".spec.workloadName"},
+		{Name: "Pod", Type: "string", JSONPath: ".spec.pod"},
+		{Name: "Node", Type: "string", JSONPath: ".spec.node"},
+		{Name: "Policy", Type: "integer", JSONPath: ".spec.policy"},
+		{Name: "Key", Type: "string", JSONPath: ".spec.key", Priority: 1},
+		{Name: "UID", Type: "string", JSONPath: ".spec.uid", Priority: 1},
+		{Name: "Age", Type: "date", JSONPath: ".metadata.creationTimestamp"},
+	},
+	Schema: &extensionsv1.CustomResourceValidation{
+		OpenAPIV3Schema: &extensionsv1.JSONSchemaProps{
+			Description: "FloatingIP is an allocated ip.",
+			Properties: map[string]extensionsv1.JSONSchemaProps{
+				"apiVersion": {
+					Description: "APIVersion defines the versioned schema of this representation of an object.",
+					Type:        "string",
+				},
+				"kind": {
+					Description: "Kind is a string value representing the REST resource this object represents.",
+					Type:        "string",
+				},
+				"metadata": {
+					Type: "object",
+				},
+				"spec": {
+					Description: "Spec defines the desired identities of FloatingIP.",
+					Properties: map[string]extensionsv1.JSONSchemaProps{
+						"key": {
+							Description: "Key is the ipam key of the ip, it's generated from the fields below if " +
+								"it's empty",
+							Type: "string",
+						},
+						"pool": {
+							Description: "Pool is the name of the pool the ip belongs to",
+							Type:        "string",
+						},
+						"workloadKind": {
+							Description: "WorkloadKind is the kind of the workload, i.e. Deployment, StatefulSet " +
+								"or a lower case custom resource kind",
+							Type: "string",
+						},
+						"namespace": {
+							Description: "Namespace is the namespace of the pod",
+							Type:        "string",
+						},
+						"workloadName": {
+							Description: "WorkloadName is the name of the workload",
+							Type:        "string",
+						},
+						"pod": {
+							Description: "Pod is the name of the pod",
+							Type:        "string",
+						},
+						"uid": {
+							Description: "UID is the uid of the pod",
+							Type:        "string",
+						},
+						"node": {
+							Description: "Node is the node name of the pod",
+							Type:        "string",
+						},
+						"policy": {
+							Description: "Policy is the release policy of the ip",
+							Type:        "integer",
+						},
+						"ttl": {
+							Description: "TTL is how long to keep the ip after the pod is deleted",
+							Type:        "string",
+						},
+						"reason": {
+							Description: "Reason describes why the ip is reserved",
+							Type:        "string",
+						},
+						"owner": {
+							Description: "Owner describes by whom the ip is reserved",
+							Type:        "string",
+						},
+						"subnet": {
+							Description: "Subnet is the cidr of the pool the ip belongs to, it is read only",
+							Type:        "string",
+						},
+						"updateTime": {
+							Description: "UpdateTime is the time the ip is allocated, released or updated",
+							Format:      "date-time",
+							Type:        "string",
+						},
+					},
+					Required: []string{"policy", "updateTime"},
+					Type:     "object",
+				},
+			},
+			Required: []string{"spec"},
+			Type:     "object",
+		},
+	},
+}
+
 // poolCrd is the crd format of pool
 var poolCrd = &extensionsv1.CustomResourceDefinition{
 	ObjectMeta: metav1.ObjectMeta{
@@ -164,10 +271,130 @@ var poolCrd = &extensionsv1.CustomResourceDefinition{
 	},
 }
 
-// EnsureCRDCreated ensures floatingip and pool are created in apiserver
+// floatingIPPoolCrd is the crd format of floatingippool
+var floatingIPPoolCrd = &extensionsv1.CustomResourceDefinition{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "floatingippools.galaxy.k8s.io",
+		Annotations: map[string]string{
+			"api-approved.kubernetes.io": "https://github.com/kubernetes/kubernetes/pull/78458",
+		},
+	},
+	TypeMeta: metav1.TypeMeta{
+		Kind:       "CustomResourceDefinition",
+		APIVersion: "apiextensions.k8s.io/v1",
+	},
+	Spec: extensionsv1.CustomResourceDefinitionSpec{
+		Group: galaxy.GroupName,
+		Scope: extensionsv1.ClusterScoped,
+		Versions: []extensionsv1.CustomResourceDefinitionVersion{
+			{
+				Name:    "v1alpha1",
+				Served:  true,
+				Storage: true,
+				Subresources: &extensionsv1.CustomResourceSubresources{
+					Status: &extensionsv1.CustomResourceSubresourceStatus{},
+				},
+				AdditionalPrinterColumns: []extensionsv1.CustomResourceColumnDefinition{
+					{Name: "Subnet", Type: "string", JSONPath: ".spec.subnet"},
+					{Name: "Total", Type: "integer", JSONPath: ".status.total"},
+					{Name: "Allocated", Type: "integer", JSONPath: ".status.allocated"},
+					{Name: "Reserved", Type: "integer", JSONPath: ".status.reserved"},
+					{Name: "Free", Type: "integer", JSONPath: ".status.free"},
+				},
+				Schema: &extensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &extensionsv1.JSONSchemaProps{
+						Description: "FloatingIPPool provides configuration of a floating ip pool.",
+						Properties: map[string]extensionsv1.JSONSchemaProps{
+							"apiVersion": {
+								Description: "APIVersion defines the versioned schema of this representation of an object.",
+								Type:        "string",
+							},
+							"kind": {
+								Description: "Kind is a string value representing the REST resource this object represents.",
+								Type:        "string",
+							},
+							"metadata": {
+								Type: "object",
+							},
+							"spec": {
+								Description: "Spec defines the ips of the pool and the node subnets which can use them.",
+								Properties: map[string]extensionsv1.JSONSchemaProps{
+									"nodeSubnets": {
+										Description: "NodeSubnets are cidrs of the nodes which can use ips of the pool",
+										Type:        "array",
+										Items: &extensionsv1.JSONSchemaPropsOrArray{
+											Schema: &extensionsv1.JSONSchemaProps{Type: "string"},
+										},
+									},
+									"subnet": {
+										Description: "Subnet is the cidr of the pool ips",
+										Type:        "string",
+									},
+									"ips": {
+										Description: "IPs are ips or ip ranges like 10.0.0.2~10.0.0.10 within subnet",
+										Type:        "array",
+										Items: &extensionsv1.JSONSchemaPropsOrArray{
+											Schema: &extensionsv1.JSONSchemaProps{Type: "string"},
+										},
+									},
+									"gateway": {
+										Description: "Gateway of the pool ips",
+										Type:        "string",
+									},
+									"vlan": {
+										Description: "Vlan id of the pool ips",
+										Type:        "integer",
+									},
+									"namespaceQuotas": {
+										Description: "NamespaceQuotas maps namespace to the max number of ips it " +
+											"may hold in the pool, \"*\" matches any namespace",
+										Type: "object",
+										AdditionalProperties: &extensionsv1.JSONSchemaPropsOrBool{
+											Allows: true,
+											Schema: &extensionsv1.JSONSchemaProps{Type: "integer"},
+										},
+									},
+									"releaseCooldown": {
+										Description: "ReleaseCooldown is a duration like 30s during which released " +
+											"ips are not allocatable",
+										Type: "string",
+									},
+								},
+								Required: []string{"nodeSubnets", "subnet", "ips", "gateway"},
+								Type:     "object",
+							},
+							"status": {
+								Description: "Status reports ip usage of the pool.",
+								Properties: map[string]extensionsv1.JSONSchemaProps{
+									"total":     {Type: "integer"},
+									"allocated": {Type: "integer"},
+									"reserved":  {Type: "integer"},
+									"free":      {Type: "integer"},
+									"message":   {Type: "string"},
+								},
+								Type: "object",
+							},
+						},
+						Required: []string{"spec"},
+						Type:     "object",
+					},
+				},
+			},
+		},
+		Names: extensionsv1.CustomResourceDefinitionNames{
+			Kind:       "FloatingIPPool",
+			ListKind:   "FloatingIPPoolList",
+			Plural:     "floatingippools",
+			Singular:   "floatingippool",
+			ShortNames: []string{"fippool"},
+		},
+	},
+}
+
+// EnsureCRDCreated ensures floatingip, pool and floatingippool are created in apiserver
 func EnsureCRDCreated(client apiextensionsclient.Interface) error {
 	crdClient := client.ApiextensionsV1().CustomResourceDefinitions()
-	crds := []*extensionsv1.CustomResourceDefinition{floatingipCrd, poolCrd}
+	crds := []*extensionsv1.CustomResourceDefinition{floatingipCrd, poolCrd, floatingIPPoolCrd}
 	for i := range crds {
 		// try to create each crd and ignores already exist error
 		if _, err := crdClient.Create(context.TODO(), crds[i], metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
@@ -179,6 +406,38 @@ func EnsureCRDCreated(client apiextensionsclient.Interface) error {
 	return nil
 }
 
+// EnsureFloatingIPConversion serves the v1 version of floatingip crd and converts it from and to the v1alpha1
+// storage version by the conversion webhook of the given service and path
+func EnsureFloatingIPConversion(client apiextensionsclient.Interface, service *extensionsv1.ServiceReference,
+	caBundle []byte) error {
+	crdClient := client.ApiextensionsV1().CustomResourceDefinitions()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		crd, err := crdClient.Get(context.TODO(), floatingipCrd.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		var versions []extensionsv1.CustomResourceDefinitionVersion
+		for i := range crd.Spec.Versions {
+			if crd.Spec.Versions[i].Name != floatingipV1Version.Name {
+				versions = append(versions, crd.Spec.Versions[i])
+			}
+		}
+		crd.Spec.Versions = append(versions, floatingipV1Version)
+		crd.Spec.Conversion = &extensionsv1.CustomResourceConversion{
+			Strategy: extensionsv1.WebhookConverter,
+			Webhook: &extensionsv1.WebhookConversion{
+				ClientConfig:             &extensionsv1.WebhookClientConfig{Service: service, CABundle: caBundle},
+				ConversionReviewVersions: []string{"v1"},
+			},
+		}
+		if _, err := crdClient.Update(context.TODO(), crd, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		glog.Infof("FloatingIP v1 is served with conversion webhook %s/%s", service.Namespace, service.Name)
+		return nil
+	})
+}
+
 // GetGroupVersionResource from crd
 func GetGroupVersionResource(crd *extensionsv1.CustomResourceDefinition) schema.GroupVersionResource {
 	return schema.GroupVersionResource{
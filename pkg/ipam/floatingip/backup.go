@@ -0,0 +1,370 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// BackupVersion is the version of the backup format
+const BackupVersion = "galaxy.k8s.io/v1"
+
+// Backup is the exported ipam state
+type Backup struct {
+	Version   string       `json:"version"`
+	CreatedAt time.Time    `json:"createdAt"`
+	IPs       []BackupIP   `json:"ips"`
+	Pools     []BackupPool `json:"pools,omitempty"`
+}
+
+// BackupIP is an allocated ip with its key, attrs and labels
+type BackupIP struct {
+	IP        string            `json:"ip"`
+	Key       string            `json:"key"`
+	Policy    uint16            `json:"policy"`
+	NodeName  string            `json:"nodeName,omitempty"`
+	PodUid    string            `json:"podUid,omitempty"`
+	TTL       metav1.Duration   `json:"ttl,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Owner     string            `json:"owner,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+	// NodeSubnets are the node subnets of the ip, they are used to reallocate the ip if it's not within any pool
+	// when importing
+	NodeSubnets []string `json:"nodeSubnets,omitempty"`
+}
+
+// BackupPool is a pool and its size
+type BackupPool struct {
+	Name          string `json:"name"`
+	Size          int    `json:"size"`
+	PreAllocateIP bool   `json:"preAllocateIP"`
+}
+
+// Actions of ImportResult
+const (
+	// ImportCreate allocates the ip to the key
+	ImportCreate = "create"
+	// ImportUpdate updates attrs and labels of the ip which is already allocated to the key
+	ImportUpdate = "update"
+	// ImportUnchanged means the ip is already allocated to the key with the same attrs and labels, or the key holds
+	// an ip reallocated in the mapped node subnet
+	ImportUnchanged = "unchanged"
+	// ImportReallocate allocates a new ip in the mapped node subnet to the key, as the ip is not within any pool
+	ImportReallocate = "reallocate"
+	// ImportConflict means the ip is allocated to another key, it's skipped
+	ImportConflict = "conflict"
+	// ImportSkip means the ip is not within any pool and can't be reallocated
+	ImportSkip = "skip"
+)
+
+// ImportOptions are options of Import
+type ImportOptions struct {
+	// DryRun computes the results without changing anything
+	DryRun bool
+	// NodeSubnets maps node subnets of the backup to node subnets of this cluster. Ips which are not within any pool
+	// are reallocated in the mapped node subnet to the same key, with node name and pod uid cleared.
+	NodeSubnets map[string]string
+}
+
+// ImportResult is the result of importing a BackupIP
+type ImportResult struct {
+	Action string `json:"action"`
+	IP     string `json:"ip"`
+	// NewIP is the reallocated ip for ImportReallocate
+	NewIP   string `json:"newIP,omitempty"`
+	Key     string `json:"key"`
+	Message string `json:"message,omitempty"`
+	// Error is the error of applying the action
+	Error string `json:"error,omitempty"`
+}
+
+// Export returns all allocated ips sorted by ip
+func (ci *crdIpam) Export() *Backup {
+	ci.cacheLock.RLock()
+	defer ci.cacheLock.RUnlock()
+	backup := &Backup{Version: BackupVersion, CreatedAt: time.Now(), IPs: make([]BackupIP, 0, len(ci.allocatedFIPs))}
+	fips := make([]*FloatingIP, 0, len(ci.allocatedFIPs))
+	for _, fip := range ci.allocatedFIPs {
+		fips = append(fips, fip)
+	}
+	sort.Slice(fips, func(i, j int) bool {
+		return nets.CompareIP(fips[i].IP, fips[j].IP) < 0
+	})
+	for _, fip := range fips {
+		backupIP := BackupIP{IP: fip.IP.String(), Key: fip.Key, Policy: fip.Policy, NodeName: fip.NodeName,
+			PodUid: fip.PodUid, TTL: metav1.Duration{Duration: fip.TTL}, Reason: fip.Reason, Owner: fip.Owner,
+			Namespace: fip.Namespace, UpdatedAt: fip.UpdatedAt}
+		if len(fip.Labels) > 0 {
+			backupIP.Labels = make(map[string]string, len(fip.Labels))
+			for k, v := range fip.Labels {
+				backupIP.Labels[k] = v
+			}
+		}
+		if fip.pool != nil {
+			backupIP.NodeSubnets = fip.pool.nodeSubnets.List()
+		}
+		backup.IPs = append(backup.IPs, backupIP)
+	}
+	return backup
+}
+
+// importBatchSize is the max number of writes applied while holding cacheLock, so that a large restore doesn't block
+// allocating and releasing ips until it finishes
+const importBatchSize = 100
+
+// importWrite is a planned store write of Import
+type importWrite struct {
+	// index is the index of the result of the write
+	index  int
+	ip     string
+	key    string
+	attr   Attr
+	labels map[string]string
+	// update is true if the ip is allocated to the key already
+	update bool
+}
+
+// Import allocates the ips of the backup. Ips allocated to other keys are reported as conflicts and skipped. Update
+// time of the imported ips is set to now, so ttl release policy starts over. Pools of the backup are ignored.
+// Actions are planned under a single lock, then applied in batches of importBatchSize, each under its own lock. Each
+// ip is written independently and a failed write is reported in the Error of its result without rolling back the
+// others, so importing the same backup again retries the failed ones only. An ip allocated or released by others
+// between planning and applying is reported as an error as well.
+func (ci *crdIpam) Import(backup *Backup, opts ImportOptions) ([]ImportResult, error) {
+	if backup.Version != BackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %q, expect %q", backup.Version, BackupVersion)
+	}
+	results, writes := ci.planImport(backup, opts)
+	if !opts.DryRun {
+		ci.applyImport(results, writes)
+	}
+	return results, nil
+}
+
+func (ci *crdIpam) planImport(backup *Backup, opts ImportOptions) ([]ImportResult, []importWrite) {
+	ci.cacheLock.RLock()
+	defer ci.cacheLock.RUnlock()
+	// planned is the ips taken by previous results, to detect duplicate ips in backup
+	planned := map[string]string{}
+	results := make([]ImportResult, 0, len(backup.IPs))
+	var writes []importWrite
+	for i := range backup.IPs {
+		result, write := ci.importIP(&backup.IPs[i], opts, planned)
+		if write != nil {
+			write.index = len(results)
+			writes = append(writes, *write)
+		}
+		results = append(results, result)
+	}
+	return results, writes
+}
+
+func (ci *crdIpam) applyImport(results []ImportResult, writes []importWrite) {
+	for len(writes) > 0 {
+		n := importBatchSize
+		if n > len(writes) {
+			n = len(writes)
+		}
+		ci.applyImportBatch(results, writes[:n])
+		writes = writes[n:]
+	}
+}
+
+func (ci *crdIpam) applyImportBatch(results []ImportResult, writes []importWrite) {
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	for i := range writes {
+		w := &writes[i]
+		result := &results[w.index]
+		result.Error = errString(ci.applyImportWrite(w))
+		if result.Error == "" {
+			glog.Infof("imported ip %s key %s, action %s %s", result.IP, result.Key, result.Action, result.NewIP)
+		}
+	}
+}
+
+// applyImportWrite checks the ip against the latest cache before writing, as the cache may change after planning
+func (ci *crdIpam) applyImportWrite(w *importWrite) error {
+	if w.update {
+		fip, ok := ci.allocatedFIPs[w.ip]
+		if !ok || fip.Key != w.key {
+			return fmt.Errorf("ip is released or allocated to another key after planning")
+		}
+		if sameAttrAndLabels(fip, &w.attr, w.labels) {
+			return nil
+		}
+		return ci.importUpdate(fip, &w.attr, w.labels)
+	}
+	fip, ok := ci.unallocatedFIPs[w.ip]
+	if !ok {
+		return fmt.Errorf("ip is allocated or removed from pools after planning")
+	}
+	return ci.importCreate(fip, w.key, &w.attr, w.labels)
+}
+
+func (ci *crdIpam) importIP(backupIP *BackupIP, opts ImportOptions, planned map[string]string) (ImportResult,
+	*importWrite) {
+	result := ImportResult{IP: backupIP.IP, Key: backupIP.Key}
+	ip := net.ParseIP(backupIP.IP)
+	if ip == nil || backupIP.Key == "" {
+		result.Action, result.Message = ImportSkip, "invalid ip or empty key"
+		return result, nil
+	}
+	ipStr := ip.String()
+	if key, ok := planned[ipStr]; ok {
+		result.Action, result.Message = ImportConflict, fmt.Sprintf("ip is imported for %s already", key)
+		return result, nil
+	}
+	attr := Attr{Policy: constant.ReleasePolicy(backupIP.Policy), NodeName: backupIP.NodeName,
+		Uid: backupIP.PodUid, TTL: backupIP.TTL.Duration, Reason: backupIP.Reason, Owner: backupIP.Owner,
+		Namespace: backupIP.Namespace}
+	write := &importWrite{ip: ipStr, key: backupIP.Key, attr: attr, labels: backupIP.Labels}
+	if fip, ok := ci.allocatedFIPs[ipStr]; ok {
+		if fip.Key != backupIP.Key {
+			result.Action, result.Message = ImportConflict, fmt.Sprintf("ip is allocated to %s", fip.Key)
+			return result, nil
+		}
+		planned[ipStr] = backupIP.Key
+		if sameAttrAndLabels(fip, &attr, backupIP.Labels) {
+			result.Action = ImportUnchanged
+			return result, nil
+		}
+		result.Action, write.update = ImportUpdate, true
+		return result, write
+	}
+	if _, ok := ci.unallocatedFIPs[ipStr]; !ok {
+		return ci.importReallocate(backupIP, opts, planned, attr)
+	}
+	planned[ipStr] = backupIP.Key
+	result.Action = ImportCreate
+	return result, write
+}
+
+// importReallocate picks the lowest unallocated ip of the same family in the mapped node subnet, unless the key holds
+// one already
+func (ci *crdIpam) importReallocate(backupIP *BackupIP, opts ImportOptions, planned map[string]string,
+	attr Attr) (ImportResult, *importWrite) {
+	result := ImportResult{IP: backupIP.IP, Key: backupIP.Key, Action: ImportSkip}
+	if _, ok := backupIP.Labels[constant.ReserveFIPLabel]; ok {
+		result.Message = "reserved ip is not within any pool"
+		return result, nil
+	}
+	var nodeSubnet string
+	for _, subnet := range backupIP.NodeSubnets {
+		if nodeSubnet = opts.NodeSubnets[subnet]; nodeSubnet != "" {
+			break
+		}
+	}
+	if nodeSubnet == "" {
+		result.Message = "ip is not within any pool and its node subnets are not mapped"
+		return result, nil
+	}
+	family := nets.FamilyOf(net.ParseIP(backupIP.IP))
+	inNodeSubnet := func(fip *FloatingIP) bool {
+		_, taken := planned[fip.IP.String()]
+		return !taken && fip.pool.nodeSubnets.Has(nodeSubnet) && fip.pool.Family() == family
+	}
+	// an ip allocated to the key in the node subnet is reallocated by the previous import
+	for _, fip := range ci.allocatedFIPs {
+		if fip.Key == backupIP.Key && inNodeSubnet(fip) {
+			planned[fip.IP.String()] = backupIP.Key
+			result.Action, result.NewIP = ImportUnchanged, fip.IP.String()
+			result.Message = fmt.Sprintf("reallocated in node subnet %s already", nodeSubnet)
+			return result, nil
+		}
+	}
+	now := time.Now()
+	var picked *FloatingIP
+	for _, fip := range ci.unallocatedFIPs {
+		if !inNodeSubnet(fip) || fip.coolingDown(now) {
+			continue
+		}
+		if picked == nil || nets.CompareIP(fip.IP, picked.IP) < 0 {
+			picked = fip
+		}
+	}
+	if picked == nil {
+		result.Message = fmt.Sprintf("no enough ips in node subnet %s", nodeSubnet)
+		return result, nil
+	}
+	planned[picked.IP.String()] = backupIP.Key
+	result.Action, result.NewIP = ImportReallocate, picked.IP.String()
+	result.Message = fmt.Sprintf("reallocated in node subnet %s", nodeSubnet)
+	// the pod of the old cluster never runs in this cluster
+	attr.NodeName, attr.Uid = "", ""
+	return result, &importWrite{ip: picked.IP.String(), key: backupIP.Key, attr: attr, labels: backupIP.Labels}
+}
+
+func (ci *crdIpam) importCreate(unallocated *FloatingIP, key string, attr *Attr, labels map[string]string) error {
+	allocated := unallocated.CloneWith(key, attr, time.Now())
+	allocated.Labels = labels
+	if err := ci.store.Create(allocated); err != nil {
+		return err
+	}
+	ci.syncCacheAfterCreate(allocated)
+	return nil
+}
+
+func (ci *crdIpam) importUpdate(fip *FloatingIP, attr *Attr, labels map[string]string) error {
+	updated := fip.CloneWith(fip.Key, attr, time.Now())
+	if reflect.DeepEqual(nonNilLabels(fip.Labels), nonNilLabels(labels)) {
+		if err := ci.store.Update(updated); err != nil {
+			return err
+		}
+	} else {
+		// update attrs and labels in a single write, the ip keeps allocated with previous ones if it fails
+		updated.Labels = labels
+		if err := ci.store.UpdateWithLabels(updated); err != nil {
+			return err
+		}
+		fip.Labels = labels
+	}
+	fip.Assign(fip.Key, attr, updated.UpdatedAt)
+	ci.events.emit(EventUpdate, fip)
+	return nil
+}
+
+func sameAttrAndLabels(fip *FloatingIP, attr *Attr, labels map[string]string) bool {
+	return fip.Policy == uint16(attr.Policy) && fip.NodeName == attr.NodeName && fip.PodUid == attr.Uid &&
+		fip.TTL == attr.TTL && fip.Reason == attr.Reason && fip.Owner == attr.Owner &&
+		fip.Namespace == attr.Namespace && reflect.DeepEqual(nonNilLabels(fip.Labels), nonNilLabels(labels))
+}
+
+func nonNilLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return map[string]string{}
+	}
+	return labels
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,177 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+)
+
+func TestExportImport(t *testing.T) {
+	src := createTestCrdIPAM(t)
+	if err := src.AllocateSpecificIP("pod1", net.ParseIP("10.49.27.205"),
+		Attr{Policy: constant.ReleasePolicyNever, NodeName: "node1", Uid: "uid1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Reserve(net.ParseIP("10.49.27.216"), "", false, Attr{Reason: "gateway", Owner: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	backup := src.Export()
+	if backup.Version != BackupVersion || len(backup.IPs) != 2 {
+		t.Fatalf("%+v", backup)
+	}
+	expect := BackupIP{IP: "10.49.27.205", Key: "pod1", Policy: uint16(constant.ReleasePolicyNever),
+		NodeName: "node1", PodUid: "uid1", UpdatedAt: backup.IPs[0].UpdatedAt, NodeSubnets: []string{"10.49.27.0/24"}}
+	if !reflect.DeepEqual(backup.IPs[0], expect) {
+		t.Fatalf("expect %+v, real %+v", expect, backup.IPs[0])
+	}
+	if _, ok := backup.IPs[1].Labels[constant.ReserveFIPLabel]; !ok || backup.IPs[1].Reason != "gateway" {
+		t.Fatalf("%+v", backup.IPs[1])
+	}
+	backup.IPs = append(backup.IPs,
+		BackupIP{IP: "10.49.27.217", Key: "pod2"},
+		BackupIP{IP: "192.168.0.5", Key: "pod3", NodeName: "node2", NodeSubnets: []string{"172.16.0.0/24"}},
+		BackupIP{IP: "192.168.0.6", Key: "pod4", NodeSubnets: []string{"172.16.1.0/24"}})
+
+	dst := createTestCrdIPAM(t)
+	if err := dst.AllocateSpecificIP("pod5", net.ParseIP("10.49.27.217"), Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	opts := ImportOptions{DryRun: true, NodeSubnets: map[string]string{"172.16.0.0/24": "10.49.29.0/24"}}
+	actions := func(results []ImportResult) []string {
+		var s []string
+		for _, r := range results {
+			if r.Error != "" {
+				t.Fatalf("%+v", r)
+			}
+			s = append(s, r.Action+" "+r.NewIP)
+		}
+		return s
+	}
+	expectActions := []string{ImportCreate + " ", ImportCreate + " ", ImportConflict + " ",
+		ImportReallocate + " 10.0.80.2", ImportSkip + " "}
+	for _, dryRun := range []bool{true, false} {
+		opts.DryRun = dryRun
+		results, err := dst.Import(backup, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if real := actions(results); !reflect.DeepEqual(real, expectActions) {
+			t.Fatalf("dry run %v: expect %v, real %v", dryRun, expectActions, real)
+		}
+		if dryRun {
+			if err := checkIPKey(dst, "10.49.27.205", ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := checkIPKeyAttr(dst, "10.49.27.205", "pod1", &Attr{Policy: constant.ReleasePolicyNever,
+		NodeName: "node1", Uid: "uid1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKeyAttr(dst, "10.0.80.2", "pod3", &Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dst.allocatedFIPs["10.49.27.216"].Labels[constant.ReserveFIPLabel]; !ok {
+		t.Fatalf("expect reserve label, real %+v", dst.allocatedFIPs["10.49.27.216"])
+	}
+	// importing again changes nothing but attrs updated since the last import
+	if err := dst.UpdateAttr("pod1", net.ParseIP("10.49.27.205"), Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := dst.Import(backup, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectActions = []string{ImportUpdate + " ", ImportUnchanged + " ", ImportConflict + " ",
+		ImportUnchanged + " 10.0.80.2", ImportSkip + " "}
+	if real := actions(results); !reflect.DeepEqual(real, expectActions) {
+		t.Fatalf("expect %v, real %v", expectActions, real)
+	}
+	if err := checkIPKeyAttr(dst, "10.49.27.205", "pod1", &Attr{Policy: constant.ReleasePolicyNever,
+		NodeName: "node1", Uid: "uid1"}); err != nil {
+		t.Fatal(err)
+	}
+	backup.Version = "v0"
+	if _, err := dst.Import(backup, opts); err == nil {
+		t.Fatal("expect an error for unsupported version")
+	}
+}
+
+func TestImportUpdateLabels(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	ip := net.ParseIP("10.49.27.205")
+	if err := ipam.AllocateSpecificIP("pod1", ip, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	backup := &Backup{Version: BackupVersion, IPs: []BackupIP{{IP: ip.String(), Key: "pod1", NodeName: "node1",
+		Labels: map[string]string{"app": "demo"}}}}
+	results, err := ipam.Import(backup, ImportOptions{})
+	if err != nil || len(results) != 1 || results[0].Action != ImportUpdate || results[0].Error != "" {
+		t.Fatalf("%v %+v", err, results)
+	}
+	fips, err := ipam.store.List()
+	if err != nil || len(fips) != 1 || fips[0].Key != "pod1" || fips[0].NodeName != "node1" ||
+		fips[0].Labels["app"] != "demo" {
+		t.Fatalf("expect ip stored for pod1 with new attr and labels, got %+v, err %v", fips, err)
+	}
+	if fip := ipam.allocatedFIPs[ip.String()]; fip.Labels["app"] != "demo" || fip.NodeName != "node1" {
+		t.Fatalf("expect cache updated, got %+v", fip)
+	}
+	// the ip keeps allocated with previous attr and labels if the update fails
+	ipam.store = &failingUpdateStore{Store: ipam.store}
+	backup.IPs[0].NodeName, backup.IPs[0].Labels = "node2", map[string]string{"app": "other"}
+	results, err = ipam.Import(backup, ImportOptions{})
+	if err != nil || len(results) != 1 || results[0].Error == "" {
+		t.Fatalf("expect an import error, got %v %+v", err, results)
+	}
+	if err := checkIPKeyAttr(ipam, ip.String(), "pod1", &Attr{NodeName: "node1"}); err != nil {
+		t.Fatal(err)
+	}
+	if fip := ipam.allocatedFIPs[ip.String()]; fip.Labels["app"] != "demo" {
+		t.Fatalf("expect labels unchanged, got %+v", fip)
+	}
+	if fips, err := ipam.store.List(); err != nil || len(fips) != 1 || fips[0].Labels["app"] != "demo" {
+		t.Fatalf("expect ip stored with previous labels, got %+v, err %v", fips, err)
+	}
+}
+
+func TestImportChangedAfterPlanning(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	backup := &Backup{Version: BackupVersion, IPs: []BackupIP{{IP: "10.49.27.205", Key: "pod1"},
+		{IP: "10.49.27.216", Key: "pod2"}, {IP: "10.49.27.217", Key: "pod3"}}}
+	results, writes := ipam.planImport(backup, ImportOptions{})
+	if len(writes) != 3 {
+		t.Fatalf("expect 3 writes, real %+v", writes)
+	}
+	// the ip is allocated by others after planning
+	if err := ipam.AllocateSpecificIP("pod4", net.ParseIP("10.49.27.216"), Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	ipam.applyImport(results, writes)
+	if results[0].Error != "" || results[1].Error == "" || results[2].Error != "" {
+		t.Fatalf("expect only the second ip fails, real %+v", results)
+	}
+	for ip, key := range map[string]string{"10.49.27.205": "pod1", "10.49.27.216": "pod4", "10.49.27.217": "pod3"} {
+		if err := checkIPKey(ipam, ip, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// Types of inconsistencies between the store and the cache found by CheckStore
+const (
+	// InconsistencyOutOfPool is a stored ip which is not within any pool. It's fixed by deleting it from store.
+	InconsistencyOutOfPool = "outOfPool"
+	// InconsistencyNotCached is a stored ip which is unallocated in cache. It's fixed by allocating it in cache as if
+	// ipam restarts, and it will be released by resync if its pod is gone.
+	InconsistencyNotCached = "notCached"
+	// InconsistencyNotStored is an allocated ip in cache which is not stored. It's fixed by storing it.
+	InconsistencyNotStored = "notStored"
+	// InconsistencyStoreMismatch is a stored ip whose key or release policy differs from cache. It's fixed by
+	// updating store by cache.
+	InconsistencyStoreMismatch = "storeMismatch"
+)
+
+// StoreInconsistency is an inconsistency between the store and the cache
+type StoreInconsistency struct {
+	Type string
+	IP   net.IP
+	// Key is the key in store, or in cache for InconsistencyNotStored
+	Key     string
+	Message string
+	Fixed   bool
+	// FixError is the error of fixing it
+	FixError error
+}
+
+// CheckStore compares stored ips with the cache, and fixes the inconsistencies if fix is true. The result is sorted
+// by ip.
+func (ci *crdIpam) CheckStore(fix bool) ([]StoreInconsistency, error) {
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	stored, err := ci.store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list store: %v", err)
+	}
+	var result []StoreInconsistency
+	storedSet := map[string]bool{}
+	for _, fip := range stored {
+		ipStr := fip.IP.String()
+		storedSet[ipStr] = true
+		if cached, ok := ci.allocatedFIPs[ipStr]; ok {
+			if cached.Key == fip.Key && cached.Policy == fip.Policy {
+				continue
+			}
+			inc := StoreInconsistency{Type: InconsistencyStoreMismatch, IP: fip.IP, Key: fip.Key,
+				Message: fmt.Sprintf("stored key %s policy %d, cached key %s policy %d", fip.Key, fip.Policy,
+					cached.Key, cached.Policy)}
+			if fix {
+				inc.FixError = ci.store.Update(cached)
+			}
+			result = append(result, inc)
+			continue
+		}
+		unallocated, ok := ci.unallocatedFIPs[ipStr]
+		if !ok {
+			inc := StoreInconsistency{Type: InconsistencyOutOfPool, IP: fip.IP, Key: fip.Key,
+				Message: "not within any pool"}
+			if fix {
+				inc.FixError = ci.store.Delete(fip.IP)
+			}
+			result = append(result, inc)
+			continue
+		}
+		inc := StoreInconsistency{Type: InconsistencyNotCached, IP: fip.IP, Key: fip.Key,
+			Message: "stored but unallocated in cache"}
+		if fix {
+			fip.pool = unallocated.pool
+			ci.syncCacheAfterCreate(fip)
+		}
+		result = append(result, inc)
+	}
+	for ipStr, cached := range ci.allocatedFIPs {
+		if storedSet[ipStr] {
+			continue
+		}
+		inc := StoreInconsistency{Type: InconsistencyNotStored, IP: cached.IP, Key: cached.Key,
+			Message: "allocated in cache but not stored"}
+		if fix {
+			inc.FixError = ci.store.Create(cached)
+		}
+		result = append(result, inc)
+	}
+	for i := range result {
+		if !fix {
+			continue
+		}
+		if result[i].FixError != nil {
+			glog.Warningf("failed to fix %s ip %s key %s: %v", result[i].Type, result[i].IP.String(), result[i].Key,
+				result[i].FixError)
+			continue
+		}
+		result[i].Fixed = true
+		glog.Infof("fixed %s ip %s key %s", result[i].Type, result[i].IP.String(), result[i].Key)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return nets.CompareIP(result[i].IP, result[j].IP) < 0
+	})
+	return result, nil
+}
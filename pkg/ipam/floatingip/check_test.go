@@ -0,0 +1,78 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCheckStore(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	notStoredIP, mismatchIP := net.ParseIP("10.49.27.205"), net.ParseIP("10.49.27.216")
+	for _, ip := range []net.IP{notStoredIP, mismatchIP} {
+		if err := ipam.AllocateSpecificIP("pod1", ip, Attr{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ipam.store.Delete(notStoredIP); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.store.Update(&FloatingIP{IP: mismatchIP, Key: "pod2"}); err != nil {
+		t.Fatal(err)
+	}
+	outOfPoolIP, notCachedIP := net.ParseIP("172.16.0.1"), net.ParseIP("10.173.13.2")
+	for _, ip := range []net.IP{outOfPoolIP, notCachedIP} {
+		if err := ipam.store.Create(&FloatingIP{IP: ip, Key: "pod3"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := []struct {
+		typ string
+		ip  net.IP
+		key string
+	}{
+		{InconsistencyNotStored, notStoredIP, "pod1"},
+		{InconsistencyStoreMismatch, mismatchIP, "pod2"},
+		{InconsistencyNotCached, notCachedIP, "pod3"},
+		{InconsistencyOutOfPool, outOfPoolIP, "pod3"},
+	}
+	for _, fix := range []bool{false, true} {
+		result, err := ipam.CheckStore(fix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != len(expect) {
+			t.Fatalf("fix %v: expect %d inconsistencies, real %+v", fix, len(expect), result)
+		}
+		for i := range expect {
+			if result[i].Type != expect[i].typ || !result[i].IP.Equal(expect[i].ip) || result[i].Key != expect[i].key ||
+				result[i].Fixed != fix || result[i].FixError != nil {
+				t.Fatalf("fix %v: expect %+v, real %+v", fix, expect[i], result[i])
+			}
+		}
+	}
+	if result, err := ipam.CheckStore(false); err != nil || len(result) != 0 {
+		t.Fatalf("expect no inconsistencies after fix, real %+v, err %v", result, err)
+	}
+	if err := checkIPKey(ipam, notCachedIP.String(), "pod3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKey(ipam, mismatchIP.String(), "pod1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+)
+
+// EventType is the type of a floating ip change
+type EventType string
+
+const (
+	// EventAllocate is emitted when an ip is allocated
+	EventAllocate EventType = "allocate"
+	// EventRelease is emitted when an ip is released
+	EventRelease EventType = "release"
+	// EventReserve is emitted when an ip is reserved by Reserve or by a manually created FloatingIP
+	EventReserve EventType = "reserve"
+	// EventUpdate is emitted when the key or attrs of an allocated ip is updated
+	EventUpdate EventType = "update"
+)
+
+const (
+	// eventHistorySize is the number of recent events kept to resume watching from
+	eventHistorySize = 1024
+	// watchChanSize is the buffer size of each watcher, watchers which fall behind are stopped
+	watchChanSize = 128
+)
+
+// ErrResourceVersionTooOld is returned by Watch if events after the resource version are no longer kept
+var ErrResourceVersionTooOld = fmt.Errorf("resource version is too old")
+
+// Event is a change of a floating ip. ResourceVersion is "<epoch>-<n>", n increases by one for each event and epoch
+// changes each time the ipam starts, so that resource versions of a previous process are rejected as too old.
+type Event struct {
+	Type            EventType
+	ResourceVersion string
+	// FloatingIP is a copy of the ip after the change, or before the change for EventRelease
+	FloatingIP FloatingIP
+}
+
+// broadcaster keeps recent events and sends new events to watchers
+type broadcaster struct {
+	lock sync.Mutex
+	// epoch identifies the process which emits the events
+	epoch string
+	// resourceVersion is the sequence number of the latest event within the epoch
+	resourceVersion uint64
+	// history is a ring buffer of recent events
+	history  []Event
+	watchers map[*watcher]struct{}
+}
+
+type watcher struct {
+	ch      chan Event
+	stopped bool
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 10),
+		history:  make([]Event, 0, eventHistorySize),
+		watchers: map[*watcher]struct{}{},
+	}
+}
+
+// emit sends an event to all watchers without blocking. Watchers whose channel is full are stopped so that they
+// can resume from their last resource version.
+func (b *broadcaster) emit(typ EventType, fip *FloatingIP) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.resourceVersion++
+	event := Event{Type: typ, ResourceVersion: b.format(b.resourceVersion), FloatingIP: *fip}
+	if fip.Labels != nil {
+		event.FloatingIP.Labels = make(map[string]string, len(fip.Labels))
+		for k, v := range fip.Labels {
+			event.FloatingIP.Labels[k] = v
+		}
+	}
+	if len(b.history) < eventHistorySize {
+		b.history = append(b.history, event)
+	} else {
+		b.history[(b.resourceVersion-1)%eventHistorySize] = event
+	}
+	for w := range b.watchers {
+		select {
+		case w.ch <- event:
+		default:
+			b.stopLocked(w)
+		}
+	}
+}
+
+// watch returns a channel of events after resourceVersion. If resourceVersion is empty, only new events are sent.
+func (b *broadcaster) watch(resourceVersion string) (<-chan Event, func(), error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var missed []Event
+	if resourceVersion != "" {
+		epoch, n, err := parseResourceVersion(resourceVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		// resource versions of a previous process may be either older or newer than the current ones
+		if epoch != b.epoch {
+			return nil, nil, ErrResourceVersionTooOld
+		}
+		if n > b.resourceVersion {
+			return nil, nil, fmt.Errorf("resource version %s is newer than the latest %s", resourceVersion,
+				b.format(b.resourceVersion))
+		}
+		oldest := b.resourceVersion - uint64(len(b.history)) + 1
+		if n+1 < oldest {
+			return nil, nil, ErrResourceVersionTooOld
+		}
+		for rv := n + 1; rv <= b.resourceVersion; rv++ {
+			missed = append(missed, b.history[(rv-1)%eventHistorySize])
+		}
+	}
+	w := &watcher{ch: make(chan Event, len(missed)+watchChanSize)}
+	for _, event := range missed {
+		w.ch <- event
+	}
+	b.watchers[w] = struct{}{}
+	return w.ch, func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		b.stopLocked(w)
+	}, nil
+}
+
+func (b *broadcaster) stopLocked(w *watcher) {
+	if w.stopped {
+		return
+	}
+	w.stopped = true
+	delete(b.watchers, w)
+	close(w.ch)
+}
+
+func (b *broadcaster) latest() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.format(b.resourceVersion)
+}
+
+func (b *broadcaster) format(n uint64) string {
+	return fmt.Sprintf("%s-%d", b.epoch, n)
+}
+
+// parseResourceVersion splits a resource version into its epoch and sequence number
+func parseResourceVersion(resourceVersion string) (string, uint64, error) {
+	i := strings.LastIndex(resourceVersion, "-")
+	if i <= 0 {
+		return "", 0, fmt.Errorf("invalid resource version %s", resourceVersion)
+	}
+	if _, err := strconv.ParseInt(resourceVersion[:i], 10, 64); err != nil {
+		return "", 0, fmt.Errorf("invalid resource version %s", resourceVersion)
+	}
+	n, err := strconv.ParseUint(resourceVersion[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid resource version %s", resourceVersion)
+	}
+	return resourceVersion[:i], n, nil
+}
+
+// allocateEventType returns EventReserve for reserved ips and EventAllocate for others
+func allocateEventType(fip *FloatingIP) EventType {
+	if _, ok := fip.Labels[constant.ReserveFIPLabel]; ok {
+		return EventReserve
+	}
+	return EventAllocate
+}
@@ -19,6 +19,8 @@ package floatingip
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"net"
 	"sync"
 	"time"
@@ -37,7 +39,16 @@ type FloatingIP struct {
 	Policy    uint16
 	NodeName  string
 	PodUid    string
+	// TTL is how long to keep the ip after the pod is deleted for ttl release policy
+	TTL time.Duration
+	// Reason and Owner describe why and by whom the ip is reserved by Reserve
+	Reason string
+	Owner  string
+	// Namespace is the namespace owning the ip if its key has no namespace, e.g. an ip held by a pool
+	Namespace string
 	pool      *FloatingIPPool
+	// releasedAt is the last time the ip was released, it's persisted by Store.MarkReleased
+	releasedAt time.Time
 }
 
 func (f FloatingIP) String() string {
@@ -52,6 +63,56 @@ func New(pool *FloatingIPPool, ip net.IP, key string, attr *Attr, updateAt time.
 	return fip
 }
 
+// Draining returns true if the ip belongs to an ip range which is removed from config
+func (f *FloatingIP) Draining() bool {
+	return f.pool != nil && f.pool.draining
+}
+
+// drainingPoolData returns the persisted form of the draining pool of the ip, it's empty if the ip isn't draining
+func (f *FloatingIP) drainingPoolData() (string, error) {
+	if !f.Draining() {
+		return "", nil
+	}
+	data, err := json.Marshal(f.pool)
+	if err != nil {
+		return "", fmt.Errorf("marshal draining pool of %s: %v", f.IP.String(), err)
+	}
+	return string(data), nil
+}
+
+// restoreDrainingPool sets the pool of the ip to the draining pool persisted by drainingPoolData
+func (f *FloatingIP) restoreDrainingPool(data string) error {
+	if data == "" {
+		return nil
+	}
+	pool := &FloatingIPPool{}
+	if err := json.Unmarshal([]byte(data), pool); err != nil {
+		return fmt.Errorf("unmarshal draining pool of %s: %v", f.IP.String(), err)
+	}
+	pool.nodeSubnets = sets.NewString()
+	for i := range pool.NodeSubnets {
+		pool.nodeSubnets.Insert(pool.NodeSubnets[i].String())
+	}
+	f.pool = pool.drainingPool(pool.IPRanges)
+	return nil
+}
+
+// Subnet returns the subnet of the pool the ip belongs to, it returns nil if the ip isn't within any pool
+func (f *FloatingIP) Subnet() *net.IPNet {
+	if f.pool == nil {
+		return nil
+	}
+	return f.pool.IPNet()
+}
+
+// coolingDown returns true if the ip is released within the release cooldown of its pool
+func (f *FloatingIP) coolingDown(now time.Time) bool {
+	if f.pool == nil || f.pool.ReleaseCooldown <= 0 || f.releasedAt.IsZero() {
+		return false
+	}
+	return now.Before(f.releasedAt.Add(f.pool.ReleaseCooldown))
+}
+
 // Assign updates key, attr, updatedAt of FloatingIP
 func (f *FloatingIP) Assign(key string, attr *Attr, updateAt time.Time) *FloatingIP {
 	f.Key = key
@@ -59,6 +120,10 @@ func (f *FloatingIP) Assign(key string, attr *Attr, updateAt time.Time) *Floatin
 	f.UpdatedAt = updateAt
 	f.NodeName = attr.NodeName
 	f.PodUid = attr.Uid
+	f.TTL = attr.TTL
+	f.Reason = attr.Reason
+	f.Owner = attr.Owner
+	f.Namespace = attr.Namespace
 	return f
 }
 
@@ -75,9 +140,35 @@ func (f *FloatingIP) CloneWith(key string, attr *Attr, updateAt time.Time) *Floa
 type FloatingIPPool struct {
 	NodeSubnets []*net.IPNet // the node subnets
 	nets.SparseSubnet
+	// NamespaceQuotas caps the number of ips each namespace may hold in the pool. The AnyNamespace key applies to
+	// namespaces which are not listed. Namespaces without quota are unlimited.
+	NamespaceQuotas map[string]int
+	// ReleaseCooldown is how long a released ip stays unallocatable
+	ReleaseCooldown time.Duration
 	sync.RWMutex
 	nodeSubnets sets.String // the node subnets, string set format
 	index       int         // the index of []FloatingIPPool
+	draining    bool        // true if the ip ranges are removed from config but still have allocated ips
+}
+
+// Draining returns true if the pool is removed from config and waiting for its allocated ips to be released.
+// A draining pool allocates no new ips.
+func (fip *FloatingIPPool) Draining() bool {
+	return fip.draining
+}
+
+// drainingPool returns a draining copy of the pool with the given ip ranges
+func (fip *FloatingIPPool) drainingPool(ranges []nets.IPRange) *FloatingIPPool {
+	return &FloatingIPPool{
+		NodeSubnets: fip.NodeSubnets,
+		SparseSubnet: nets.SparseSubnet{IPRanges: ranges, Gateway: fip.Gateway, Mask: fip.Mask,
+			Vlan: fip.Vlan},
+		NamespaceQuotas: fip.NamespaceQuotas,
+		ReleaseCooldown: fip.ReleaseCooldown,
+		nodeSubnets:     fip.nodeSubnets,
+		index:           -1,
+		draining:        true,
+	}
 }
 
 // FloatingIPPoolConf is FloatingIP config structure.
@@ -89,6 +180,10 @@ type FloatingIPPoolConf struct {
 	Subnet         *nets.IPNet `json:"subnet"` // the vip subnet
 	Gateway        net.IP      `json:"gateway"`
 	Vlan           uint16      `json:"vlan,omitempty"`
+	// NamespaceQuotas maps namespace to the max number of ips it may hold in the pool, "*" matches any namespace
+	NamespaceQuotas map[string]int `json:"namespaceQuotas,omitempty"`
+	// ReleaseCooldown is a duration like 30s during which released ips are not allocatable
+	ReleaseCooldown string `json:"releaseCooldown,omitempty"`
 }
 
 // MarshalJSON can marshal FloatingIPPoolConf to byte slice.
@@ -100,6 +195,10 @@ func (fip *FloatingIPPool) MarshalJSON() ([]byte, error) {
 	conf.Subnet = nets.NetsIPNet(fip.IPNet())
 	conf.Gateway = fip.Gateway
 	conf.Vlan = fip.Vlan
+	conf.NamespaceQuotas = fip.NamespaceQuotas
+	if fip.ReleaseCooldown > 0 {
+		conf.ReleaseCooldown = fip.ReleaseCooldown.String()
+	}
 	conf.IPs = make([]string, 0)
 	for _, ipr := range fip.IPRanges {
 		conf.IPs = append(conf.IPs, ipr.String())
@@ -142,6 +241,20 @@ func (fip *FloatingIPPool) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("subnet is empty")
 	}
 	fip.Vlan = conf.Vlan
+	for ns, quota := range conf.NamespaceQuotas {
+		if quota < 0 {
+			return fmt.Errorf("invalid quota %d of namespace %s", quota, ns)
+		}
+	}
+	fip.NamespaceQuotas = conf.NamespaceQuotas
+	fip.ReleaseCooldown = 0
+	if conf.ReleaseCooldown != "" {
+		cooldown, err := time.ParseDuration(conf.ReleaseCooldown)
+		if err != nil || cooldown < 0 {
+			return fmt.Errorf("invalid release cooldown %s", conf.ReleaseCooldown)
+		}
+		fip.ReleaseCooldown = cooldown
+	}
 	fip.IPRanges = []nets.IPRange{}
 	for _, str := range conf.IPs {
 		ipr := nets.ParseIPRange(str)
@@ -154,6 +267,10 @@ func (fip *FloatingIPPool) UnmarshalJSON(data []byte) error {
 	return fipCheck(fip)
 }
 
+// MaxIPv6PoolSize is the max number of ips of an ipv6 pool. Since ipam caches every ip of each pool in memory,
+// ipv6 pools must specify limited ip ranges instead of the whole subnet.
+const MaxIPv6PoolSize = 1 << 20
+
 func fipCheck(fip *FloatingIPPool) error {
 	net := net.IPNet{IP: fip.Gateway, Mask: fip.Mask}
 	for i := range fip.IPRanges {
@@ -161,12 +278,16 @@ func fipCheck(fip *FloatingIPPool) error {
 			return fmt.Errorf("ip range %s not in subnet %s", fip.IPRanges[i].String(), net.String())
 		}
 		if i != 0 {
-			if nets.IPToInt(fip.IPRanges[i].First) <= nets.IPToInt(fip.IPRanges[i-1].Last)+1 {
+			if Minus(fip.IPRanges[i].First, fip.IPRanges[i-1].Last) <= 1 {
 				return fmt.Errorf("ip range %s and %s can be merge to one or has wrong order",
 					fip.IPRanges[i-1].String(), fip.IPRanges[i].String())
 			}
 		}
 	}
+	if fip.Family() == nets.IPv6Family && fip.Size() > MaxIPv6PoolSize {
+		return fmt.Errorf("ipv6 pool %s has %d ips which exceeds the max size %d", net.String(), fip.Size(),
+			MaxIPv6PoolSize)
+	}
 	return nil
 }
 
@@ -256,20 +377,19 @@ func (fip *FloatingIPPool) RemoveIP(ip net.IP) bool {
 	for i := range fip.IPRanges {
 		ipRange := fip.IPRanges[i]
 		if ipRange.Contains(ip) {
-			ipn := nets.IPToInt(ip)
 			switch {
 			case ipRange.First.Equal(ipRange.Last):
 				fip.IPRanges = append(fip.IPRanges[:i], fip.IPRanges[i+1:]...)
 			case ipRange.First.Equal(ip):
-				ipRange.First = nets.IntToIP(nets.IPToInt(ipRange.First) + 1)
+				ipRange.First = nets.NextIP(ipRange.First)
 				fip.IPRanges[i] = ipRange
 			case ipRange.Last.Equal(ip):
-				ipRange.Last = nets.IntToIP(nets.IPToInt(ipRange.Last) - 1)
+				ipRange.Last = nets.PrevIP(ipRange.Last)
 				fip.IPRanges[i] = ipRange
 			default:
 				fip.IPRanges = append(fip.IPRanges[:i+1], append([]nets.IPRange{ipRange}, fip.IPRanges[i+1:]...)...)
-				fip.IPRanges[i].Last = nets.IntToIP(ipn - 1)
-				fip.IPRanges[i+1].First = nets.IntToIP(ipn + 1)
+				fip.IPRanges[i].Last = nets.PrevIP(ip)
+				fip.IPRanges[i+1].First = nets.NextIP(ip)
 			}
 			return true
 		}
@@ -278,8 +398,16 @@ func (fip *FloatingIPPool) RemoveIP(ip net.IP) bool {
 }
 
 // Minus compute how many ips between two given ip.
+// The result is clamped to [math.MinInt64, math.MaxInt64] for ipv6 ips which are too far away.
 func Minus(a, b net.IP) int64 {
-	return int64(nets.IPToInt(a)) - int64(nets.IPToInt(b))
+	ret := new(big.Int).Sub(nets.IPToBigInt(a), nets.IPToBigInt(b))
+	if ret.IsInt64() {
+		return ret.Int64()
+	}
+	if ret.Sign() > 0 {
+		return math.MaxInt64
+	}
+	return math.MinInt64
 }
 
 type FloatingIPSlice []*FloatingIPPool
@@ -296,7 +424,7 @@ func (s FloatingIPSlice) Swap(i, j int) {
 
 // Less compares two given ip.
 func (s FloatingIPSlice) Less(i, j int) bool {
-	return nets.IPToInt(s[i].Gateway) < nets.IPToInt(s[j].Gateway)
+	return nets.CompareIP(s[i].Gateway, s[j].Gateway) < 0
 }
 
 // Attr stores attrs about this pod
@@ -308,6 +436,14 @@ type Attr struct {
 	Uid string
 	// Release policy
 	Policy constant.ReleasePolicy `json:"-"`
+	// TTL is how long to keep the ip after the pod is deleted for ttl release policy
+	TTL time.Duration `json:",omitempty"`
+	// Reason and Owner describe why and by whom the ip is reserved, they are set for reserved ips only
+	Reason string `json:",omitempty"`
+	Owner  string `json:",omitempty"`
+	// Namespace is the namespace owning an ip held by a pool whose key has no namespace. It is the namespace of the
+	// last pod using the ip, the ip counts against the quota of the namespace.
+	Namespace string `json:",omitempty"`
 }
 
 func (a Attr) String() string {
@@ -326,6 +462,10 @@ func (f *FloatingIP) unmarshalAttr(attrStr string) error {
 	} else {
 		f.NodeName = attr.NodeName
 		f.PodUid = attr.Uid
+		f.TTL = attr.TTL
+		f.Reason = attr.Reason
+		f.Owner = attr.Owner
+		f.Namespace = attr.Namespace
 	}
 	return nil
 }
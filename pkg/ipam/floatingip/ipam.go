@@ -31,6 +31,10 @@ var (
 	ErrNoEnoughIP = fmt.Errorf("no enough available ips left")
 )
 
+// ReservedKey is the key of ips reserved by Reserve. Keys with pool prefix but no pod are never allocated to or
+// released by pods.
+const ReservedKey = "pool__reserved-by-api_"
+
 // IPAM interface which implemented by kubernetes CRD
 type IPAM interface {
 	// ConfigurePool init floatingIP pool.
@@ -39,15 +43,18 @@ type IPAM interface {
 	// released and unreleased map are guaranteed to be none nil even if err is not nil
 	// unreleased map stores ip with its latest key if key changed
 	ReleaseIPs(map[string]string) (map[string]string, map[string]string, error)
-	// AllocateSpecificIP allocate pod a specific IP.
+	// AllocateSpecificIP allocate pod a specific IP. It ignores release cooldown since it records ips which are
+	// already used by pods.
 	AllocateSpecificIP(string, net.IP, Attr) error
-	// AllocateInSubnet allocate subnet of IPs.
-	AllocateInSubnet(string, *net.IPNet, Attr) (net.IP, error)
-	// AllocateInSubnetsAndIPRange allocates an ip for each ip range array of the input node subnet.
-	// It guarantees allocating all ips or no ips.
-	AllocateInSubnetsAndIPRange(string, *net.IPNet, [][]nets.IPRange, Attr) ([]net.IP, error)
-	// AllocateInSubnetWithKey allocate a floatingIP in given subnet and key.
-	AllocateInSubnetWithKey(oldK, newK, subnet string, attr Attr) error
+	// AllocateInSubnet allocates an ip of the given family in the node subnet.
+	AllocateInSubnet(string, *net.IPNet, nets.IPFamily, Attr) (net.IP, error)
+	// AllocateInSubnetsAndIPRange allocates an ip for each ip range array of the input node subnet. If ip range
+	// array is empty, it allocates an ip for each ip family instead, and ipv4 is the default if families is empty.
+	// It guarantees allocating all ips or no ips. Ips within the release cooldown of their pools are skipped and the
+	// least recently released ips are preferred.
+	AllocateInSubnetsAndIPRange(string, *net.IPNet, [][]nets.IPRange, []nets.IPFamily, Attr) ([]net.IP, error)
+	// AllocateInSubnetWithKey allocate a floatingIP in given subnet and key, one ip for each ip family.
+	AllocateInSubnetWithKey(oldK, newK, subnet string, families []nets.IPFamily, attr Attr) error
 	// ReserveIP can reserve a IP entitled by a terminated pod. Attributes **expect policy attr** will be updated.
 	// Returns true if key or attr updated.
 	ReserveIP(oldK, newK string, attr Attr) (bool, error)
@@ -55,6 +62,12 @@ type IPAM interface {
 	UpdateAttr(string, net.IP, Attr) error
 	// Release release a given IP.
 	Release(string, net.IP) error
+	// Reserve reserves an ip by ReservedKey with constant.ReserveFIPLabel, attr.Reason and attr.Owner are kept. An
+	// ip allocated to others is taken over, callers should check whether it's bound to a pod. Unless force is true,
+	// it fails if the key of the ip is no longer expectedKey, i.e. the key callers checked, "" for unallocated ips.
+	Reserve(ip net.IP, expectedKey string, force bool, attr Attr) error
+	// Unreserve releases an ip reserved by Reserve or by a manually created FloatingIP with constant.ReserveFIPLabel.
+	Unreserve(net.IP) error
 	// First returns the first matched IP by key.
 	First(string) (*FloatingIPInfo, error) // returns nil,nil if key is not found
 	// ByIP transform a given IP to FloatingIP struct.
@@ -70,9 +83,39 @@ type IPAM interface {
 	ByKeyAndIPRanges(string, [][]nets.IPRange) ([]*FloatingIPInfo, error)
 	// NodeSubnets returns node's subnet.
 	NodeSubnet(net.IP) *net.IPNet
-	// NodeSubnetsByIPRanges finds an unallocated ip for each []nets.IPRange, and returns their intersection
-	// node subnets.
-	NodeSubnetsByIPRanges(ipranges [][]nets.IPRange) (sets.String, error)
+	// NodeSubnetsByIPRanges finds an unallocated ip for each []nets.IPRange, or each ip family if ipranges is
+	// empty, and returns their intersection node subnets. If key is not empty, pools in which the namespace of key
+	// has exceeded its quota are excluded.
+	NodeSubnetsByIPRanges(key string, ipranges [][]nets.IPRange, families []nets.IPFamily) (sets.String, error)
+	// UnallocatedCountByNodeSubnet returns the number of unallocated ips of each node subnet. It counts the min
+	// number within each []nets.IPRange, or each ip family if ipranges is empty. Node subnets which have no ip left
+	// for any of them are not returned. If key is not empty, pools in which the namespace of key has exceeded its
+	// quota are excluded.
+	UnallocatedCountByNodeSubnet(key string, ipranges [][]nets.IPRange, families []nets.IPFamily) map[string]int
+	// PoolUsage returns the number of allocated ips and manually reserved ips of the given pool.
+	PoolUsage(*FloatingIPPool) (allocated, reserved int)
+	// CheckStore compares stored ips with the cache, and fixes the inconsistencies if fix is true.
+	CheckStore(fix bool) ([]StoreInconsistency, error)
+	// Export returns all allocated ips with their keys, attrs and labels.
+	Export() *Backup
+	// Import allocates the ips of the backup, ips allocated to other keys are skipped as conflicts. Ips which are not
+	// within any pool are reallocated in the node subnets mapped by opts.
+	Import(*Backup, ImportOptions) ([]ImportResult, error)
+	// SubnetUsages returns the ip usage of each configured pool followed by draining pools.
+	SubnetUsages() []SubnetUsage
+	// Pools returns the configured pools, draining pools are not included.
+	Pools() []*FloatingIPPool
+	// DrainingPools returns ip ranges which are removed from config but still have allocated ips. Draining pools
+	// allocate no new ips and are removed once all of their ips are released.
+	DrainingPools() []*FloatingIPPool
+	// Watch returns a channel of allocate, release, reserve and update events after the resource version and a
+	// function to stop watching. Only new events are sent if resource version is empty. ErrResourceVersionTooOld is
+	// returned if the events are no longer kept or the resource version is from a previous process. The channel is
+	// closed if the watcher falls behind.
+	Watch(resourceVersion string) (<-chan Event, func(), error)
+	// ResourceVersion returns the resource version of the latest event, listing ips after getting it and then
+	// watching from it misses no changes.
+	ResourceVersion() string
 	// implements metrics Collector interface
 	prometheus.Collector
 }
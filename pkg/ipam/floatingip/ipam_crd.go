@@ -18,7 +18,10 @@ package floatingip
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"net"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -26,6 +29,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
@@ -36,26 +40,28 @@ import (
 
 type crdIpam struct {
 	FloatingIPs []*FloatingIPPool `json:"floatingips,omitempty"`
-	client      crd_clientset.Interface
+	// drainingPools holds ip ranges removed from config which still have allocated ips
+	drainingPools []*FloatingIPPool
+	store         Store
 	//caches for FloatingIP crd, both stores allocated FloatingIPs and unallocated FloatingIPs
 	cacheLock *sync.RWMutex
 	// key is ip string
 	allocatedFIPs   map[string]*FloatingIP
 	unallocatedFIPs map[string]*FloatingIP
+	// events broadcasts changes of allocatedFIPs to watchers
+	events *broadcaster
 
-	ipCounterDesc *prometheus.Desc
+	ipCounterDesc       *prometheus.Desc
+	ipUsageDesc         *prometheus.Desc
+	subnetTotalDesc     *prometheus.Desc
+	subnetFreeDesc      *prometheus.Desc
+	exhaustionRatioDesc *prometheus.Desc
 }
 
-// NewCrdIPAM init IPAM struct.
-func NewCrdIPAM(fipClient crd_clientset.Interface, informer crdInformer.FloatingIPInformer) IPAM {
-	ipam := &crdIpam{
-		client:          fipClient,
-		cacheLock:       new(sync.RWMutex),
-		allocatedFIPs:   make(map[string]*FloatingIP),
-		unallocatedFIPs: make(map[string]*FloatingIP),
-		ipCounterDesc: prometheus.NewDesc("galaxy_ip_counter", "Galaxy floating ip counter",
-			[]string{"type", "subnet", "first_ip"}, nil),
-	}
+// NewCrdIPAM init IPAM struct. Release time of ips is recorded in a ConfigMap of the namespace.
+func NewCrdIPAM(fipClient crd_clientset.Interface, kubeClient kubernetes.Interface, namespace string,
+	informer crdInformer.FloatingIPInformer) IPAM {
+	ipam := newStoreIPAM(NewCrdStore(fipClient, kubeClient, namespace))
 	// manually creating and fip to reserve it
 	if informer != nil {
 		informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -74,7 +80,34 @@ func NewCrdIPAM(fipClient crd_clientset.Interface, informer crdInformer.Floating
 	return ipam
 }
 
-// AllocateSpecificIP allocate pod a specific IP.
+// NewStoreIPAM init IPAM struct which persists allocated ips in the given store.
+func NewStoreIPAM(store Store) IPAM {
+	return newStoreIPAM(store)
+}
+
+func newStoreIPAM(store Store) *crdIpam {
+	return &crdIpam{
+		store:           store,
+		cacheLock:       new(sync.RWMutex),
+		allocatedFIPs:   make(map[string]*FloatingIP),
+		unallocatedFIPs: make(map[string]*FloatingIP),
+		events:          newBroadcaster(),
+		ipCounterDesc: prometheus.NewDesc("galaxy_ip_counter", "Galaxy floating ip counter",
+			[]string{"type", "subnet", "first_ip"}, nil),
+		ipUsageDesc: prometheus.NewDesc("galaxy_ip_usage", "Galaxy allocated floating ips by state, "+
+			"state is one of allocated (bound to pods), reserved and held (bound to no pods)",
+			[]string{"subnet", "pool", "namespace", "policy", "state"}, nil),
+		subnetTotalDesc: prometheus.NewDesc("galaxy_subnet_total_ips", "Galaxy floating ips of the subnet",
+			[]string{"subnet"}, nil),
+		subnetFreeDesc: prometheus.NewDesc("galaxy_subnet_free_ips", "Galaxy unallocated floating ips of the subnet",
+			[]string{"subnet"}, nil),
+		exhaustionRatioDesc: prometheus.NewDesc("galaxy_subnet_exhaustion_ratio",
+			"Ratio of allocated floating ips to all floating ips of the subnet", []string{"subnet"}, nil),
+	}
+}
+
+// AllocateSpecificIP allocate pod a specific IP. It ignores release cooldown since it records ips which are already
+// used by pods.
 func (ci *crdIpam) AllocateSpecificIP(key string, ip net.IP, attr Attr) error {
 	ipStr := ip.String()
 	ci.cacheLock.RLock()
@@ -84,7 +117,7 @@ func (ci *crdIpam) AllocateSpecificIP(key string, ip net.IP, attr Attr) error {
 		return fmt.Errorf("failed to find floating ip by %s in cache", ipStr)
 	}
 	allocated := New(spec.pool, ip, key, &attr, time.Now())
-	if err := ci.createFloatingIP(allocated); err != nil {
+	if err := ci.store.Create(allocated); err != nil {
 		glog.Errorf("failed to create floatingIP %s: %v", ipStr, err)
 		return err
 	}
@@ -94,64 +127,65 @@ func (ci *crdIpam) AllocateSpecificIP(key string, ip net.IP, attr Attr) error {
 	return nil
 }
 
-// AllocateInSubnet allocate subnet of IPs.
-func (ci *crdIpam) AllocateInSubnet(key string, nodeSubnet *net.IPNet, attr Attr) (net.IP, error) {
-	if nodeSubnet == nil {
-		// this should never happen
-		return nil, fmt.Errorf("nil nodeSubnet")
-	}
-	var ipStr string
-	ci.cacheLock.Lock()
-	defer ci.cacheLock.Unlock()
-	nodeSubnetStr := nodeSubnet.String()
-	for k, v := range ci.unallocatedFIPs {
-		//find an unallocated fip, then use it
-		if v.pool.nodeSubnets.Has(nodeSubnetStr) {
-			ipStr = k
-			// we never updates ip or subnet object, it's ok to share these objs.
-			allocated := New(v.pool, v.IP, key, &attr, time.Now())
-			if err := ci.createFloatingIP(allocated); err != nil {
-				glog.Errorf("failed to create floatingIP %s: %v", ipStr, err)
-				return nil, err
-			}
-			//sync cache when crd create success
-			ci.syncCacheAfterCreate(allocated)
-			break
-		}
-	}
-	if ipStr == "" {
-		return nil, ErrNoEnoughIP
+// AllocateInSubnet allocates an ip of the given family in the node subnet.
+func (ci *crdIpam) AllocateInSubnet(key string, nodeSubnet *net.IPNet, family nets.IPFamily,
+	attr Attr) (net.IP, error) {
+	ips, err := ci.AllocateInSubnetsAndIPRange(key, nodeSubnet, nil, []nets.IPFamily{family}, attr)
+	if err != nil {
+		return nil, err
 	}
-	return net.ParseIP(ipStr), nil
+	return ips[0], nil
 }
 
 // AllocateInSubnetWithKey allocate a floatingIP in given subnet and key.
-func (ci *crdIpam) AllocateInSubnetWithKey(oldK, newK, subnet string, attr Attr) error {
+// It moves the latest updated ip of each family from oldK to newK.
+func (ci *crdIpam) AllocateInSubnetWithKey(oldK, newK, subnet string, families []nets.IPFamily, attr Attr) error {
+	families = nets.DefaultFamilies(families)
 	ci.cacheLock.Lock()
 	defer ci.cacheLock.Unlock()
-	var (
-		recordTs int64
-		latest   *FloatingIP
-	)
-	//find latest floatingIP by updateTime.
-	for _, v := range ci.allocatedFIPs {
-		if v.Key == oldK && v.pool.nodeSubnets.Has(subnet) {
-			if v.UpdatedAt.UnixNano() > recordTs {
-				latest = v
-				recordTs = v.UpdatedAt.UnixNano()
+	var latests []*FloatingIP
+	for _, family := range families {
+		var (
+			recordTs int64
+			latest   *FloatingIP
+		)
+		//find latest floatingIP by updateTime.
+		for _, v := range ci.allocatedFIPs {
+			if v.Key == oldK && v.pool.nodeSubnets.Has(subnet) && v.pool.Family() == family {
+				if v.UpdatedAt.UnixNano() > recordTs {
+					latest = v
+					recordTs = v.UpdatedAt.UnixNano()
+				}
 			}
 		}
+		if latest == nil {
+			return fmt.Errorf("failed to find %s floatIP by key %s", family, oldK)
+		}
+		latests = append(latests, latest)
 	}
-	if latest == nil {
-		return fmt.Errorf("failed to find floatIP by key %s", oldK)
+	// ips moved from a pool to a pod of another namespace count against the quota of the pod's namespace
+	if quota := ci.newQuotaTracker(newK); quota != nil {
+		for _, latest := range latests {
+			if latest.namespace() == quota.namespace {
+				continue
+			}
+			if quota.exceeded(latest.pool) {
+				return ErrQuotaExceeded
+			}
+			quota.add(latest.pool)
+		}
 	}
 	date := time.Now()
-	cloned := latest.CloneWith(newK, &attr, date)
-	if err := ci.updateFloatingIP(cloned); err != nil {
-		glog.Errorf("failed to update floatingIP %s: %v", cloned.IP.String(), err)
-		return err
+	for _, latest := range latests {
+		attr.Namespace = latest.ownerNamespace(newK)
+		cloned := latest.CloneWith(newK, &attr, date)
+		if err := ci.store.Update(cloned); err != nil {
+			glog.Errorf("failed to update floatingIP %s: %v", cloned.IP.String(), err)
+			return err
+		}
+		latest.Assign(newK, &attr, date)
+		ci.events.emit(EventUpdate, latest)
 	}
-	latest.Assign(newK, &attr, date)
 	return nil
 }
 
@@ -168,11 +202,14 @@ func (ci *crdIpam) ReserveIP(oldK, newK string, attr Attr) (bool, error) {
 				continue
 			}
 			attr.Policy = constant.ReleasePolicy(v.Policy)
-			if err := ci.updateFloatingIP(v.CloneWith(newK, &attr, date)); err != nil {
+			attr.TTL = v.TTL
+			attr.Namespace = v.ownerNamespace(newK)
+			if err := ci.store.Update(v.CloneWith(newK, &attr, date)); err != nil {
 				glog.Errorf("failed to update floatingIP %s: %v", k, err)
 				return false, err
 			}
 			v.Assign(newK, &attr, date)
+			ci.events.emit(EventUpdate, v)
 			reserved = true
 		}
 	}
@@ -192,11 +229,13 @@ func (ci *crdIpam) UpdateAttr(key string, ip net.IP, attr Attr) error {
 		return fmt.Errorf("key for %s is %s, not %s", ipStr, v.Key, key)
 	}
 	date := time.Now()
-	if err := ci.updateFloatingIP(v.CloneWith(v.Key, &attr, date)); err != nil {
+	attr.Namespace = v.ownerNamespace(v.Key)
+	if err := ci.store.Update(v.CloneWith(v.Key, &attr, date)); err != nil {
 		glog.Errorf("failed to update floatingIP %s: %v", ipStr, err)
 		return err
 	}
 	v.Assign(v.Key, &attr, date)
+	ci.events.emit(EventUpdate, v)
 	return nil
 }
 
@@ -212,13 +251,75 @@ func (ci *crdIpam) Release(key string, ip net.IP) error {
 	if v.Key != key {
 		return fmt.Errorf("key for %s is %s, not %s", ipStr, v.Key, key)
 	}
-	if err := ci.deleteFloatingIP(ipStr); err != nil {
+	if err := ci.deleteFromStore(v); err != nil {
 		return err
 	}
 	ci.syncCacheAfterDel(v)
 	return nil
 }
 
+// Reserve reserves an ip by ReservedKey with constant.ReserveFIPLabel. An ip allocated to others is taken over.
+func (ci *crdIpam) Reserve(ip net.IP, expectedKey string, force bool, attr Attr) error {
+	ipStr := ip.String()
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	fip, allocated := ci.allocatedFIPs[ipStr]
+	if !allocated {
+		var find bool
+		if fip, find = ci.unallocatedFIPs[ipStr]; !find {
+			return fmt.Errorf("failed to find floating ip by %s in cache", ipStr)
+		}
+	}
+	if !force && fip.Key != expectedKey {
+		return fmt.Errorf("%s is allocated to %q instead of %q, it may be allocated or released just now",
+			ipStr, fip.Key, expectedKey)
+	}
+	attr.Policy = constant.ReleasePolicyNever
+	reserved := fip.CloneWith(ReservedKey, &attr, time.Now())
+	reserved.Labels = map[string]string{constant.ReserveFIPLabel: ""}
+	if allocated {
+		if _, ok := fip.Labels[constant.ReserveFIPLabel]; ok {
+			// already reserved, update reason and owner only
+			reserved.Key = fip.Key
+			if err := ci.store.Update(reserved); err != nil {
+				return err
+			}
+			fip.Assign(reserved.Key, &attr, reserved.UpdatedAt)
+			ci.events.emit(EventUpdate, fip)
+			return nil
+		}
+		// take over the ip and add the reserve label in a single write, the ip keeps allocated if it fails
+		if err := ci.store.UpdateWithLabels(reserved); err != nil {
+			return err
+		}
+	} else if err := ci.store.Create(reserved); err != nil {
+		return err
+	}
+	ci.syncCacheAfterCreate(reserved)
+	glog.Infof("reserved ip %s, previous key %q, reason %q, owner %q", ipStr, fip.Key, attr.Reason, attr.Owner)
+	return nil
+}
+
+// Unreserve releases an ip reserved by Reserve or by a manually created FloatingIP with constant.ReserveFIPLabel.
+func (ci *crdIpam) Unreserve(ip net.IP) error {
+	ipStr := ip.String()
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	fip, find := ci.allocatedFIPs[ipStr]
+	if !find {
+		return fmt.Errorf("%s is not reserved", ipStr)
+	}
+	if _, ok := fip.Labels[constant.ReserveFIPLabel]; !ok {
+		return fmt.Errorf("%s is not reserved but allocated to %s", ipStr, fip.Key)
+	}
+	if err := ci.deleteFromStore(fip); err != nil {
+		return err
+	}
+	ci.syncCacheAfterDel(fip)
+	glog.Infof("unreserved ip %s", ipStr)
+	return nil
+}
+
 // First returns the first matched IP by key.
 func (ci *crdIpam) First(key string) (*FloatingIPInfo, error) {
 	ci.cacheLock.RLock()
@@ -278,7 +379,8 @@ func (ci *crdIpam) NodeSubnet(nodeIP net.IP) *net.IPNet {
 	return nil
 }
 
-func (ci *crdIpam) NodeSubnetsByIPRanges(ipranges [][]nets.IPRange) (sets.String, error) {
+func (ci *crdIpam) NodeSubnetsByIPRanges(key string, ipranges [][]nets.IPRange, families []nets.IPFamily) (
+	sets.String, error) {
 	subnetSet := sets.NewString()
 	insertSubnet := func(poolIndexSet sets.Int, subnetSet sets.String) {
 		for _, index := range poolIndexSet.UnsortedList() {
@@ -287,23 +389,39 @@ func (ci *crdIpam) NodeSubnetsByIPRanges(ipranges [][]nets.IPRange) (sets.String
 			}
 		}
 	}
+	intersect := func(poolIndexSet sets.Int) {
+		if subnetSet.Len() == 0 {
+			insertSubnet(poolIndexSet, subnetSet)
+		} else {
+			partset := sets.NewString()
+			insertSubnet(poolIndexSet, partset)
+			subnetSet = subnetSet.Intersection(partset)
+		}
+	}
 	ci.cacheLock.RLock()
 	defer ci.cacheLock.RUnlock()
+	quota := ci.newQuotaTracker(key)
+	now := time.Now()
 	if len(ipranges) == 0 {
-		poolIndexSet := sets.NewInt()
-		for _, val := range ci.unallocatedFIPs {
-			poolIndexSet.Insert(val.pool.index)
+		for _, family := range nets.DefaultFamilies(families) {
+			poolIndexSet := sets.NewInt()
+			for _, val := range ci.unallocatedFIPs {
+				if val.pool.Family() == family && !quota.exceeded(val.pool) && !val.coolingDown(now) {
+					poolIndexSet.Insert(val.pool.index)
+				}
+			}
+			if poolIndexSet.Len() == 0 {
+				glog.V(3).Infof("no enough %s ips", family)
+				return sets.NewString(), nil
+			}
+			intersect(poolIndexSet)
 		}
-		insertSubnet(poolIndexSet, subnetSet)
 		return subnetSet, nil
 	}
 	for _, ranges := range ipranges {
 		poolIndexSet := sets.NewInt()
-		walkIPRanges(ranges, func(ip net.IP) bool {
-			ipStr := ip.String()
-			if fip, ok := ci.unallocatedFIPs[ipStr]; !ok {
-				return false
-			} else {
+		walkCachedIPs(ci.unallocatedFIPs, ranges, func(fip *FloatingIP) bool {
+			if !quota.exceeded(fip.pool) && !fip.coolingDown(now) {
 				poolIndexSet.Insert(fip.pool.index)
 			}
 			return false
@@ -313,13 +431,7 @@ func (ci *crdIpam) NodeSubnetsByIPRanges(ipranges [][]nets.IPRange) (sets.String
 			glog.V(3).Infof("no enough ips for ip range %v", ranges)
 			return sets.NewString(), nil
 		}
-		if subnetSet.Len() == 0 {
-			insertSubnet(poolIndexSet, subnetSet)
-		} else {
-			partset := sets.NewString()
-			insertSubnet(poolIndexSet, partset)
-			subnetSet = subnetSet.Intersection(partset)
-		}
+		intersect(poolIndexSet)
 	}
 	// TODO try to allocate to check if each subnet has enough ips when [][]nets.IPRange has overlap ranges
 	// e.g. if [][]nets.IPRange = [["10.0.0.1","10.0.1.1~10.0.1.3"]["10.0.0.1","10.0.1.1~10.0.1.3"]], we should
@@ -327,8 +439,73 @@ func (ci *crdIpam) NodeSubnetsByIPRanges(ipranges [][]nets.IPRange) (sets.String
 	return subnetSet, nil
 }
 
+func (ci *crdIpam) UnallocatedCountByNodeSubnet(key string, ipranges [][]nets.IPRange,
+	families []nets.IPFamily) map[string]int {
+	var matchers []func(ip net.IP) bool
+	if len(ipranges) == 0 {
+		for _, family := range nets.DefaultFamilies(families) {
+			family := family
+			matchers = append(matchers, func(ip net.IP) bool {
+				return nets.FamilyOf(ip) == family
+			})
+		}
+	} else {
+		for _, ranges := range ipranges {
+			ranges := ranges
+			matchers = append(matchers, func(ip net.IP) bool {
+				for i := range ranges {
+					if ranges[i].Contains(ip) {
+						return true
+					}
+				}
+				return false
+			})
+		}
+	}
+	counts := make([]map[string]int, len(matchers))
+	for i := range counts {
+		counts[i] = map[string]int{}
+	}
+	ci.cacheLock.RLock()
+	quota := ci.newQuotaTracker(key)
+	now := time.Now()
+	for _, fip := range ci.unallocatedFIPs {
+		if quota.exceeded(fip.pool) || fip.coolingDown(now) {
+			continue
+		}
+		for i := range matchers {
+			if !matchers[i](fip.IP) {
+				continue
+			}
+			for subnet := range fip.pool.nodeSubnets {
+				counts[i][subnet]++
+			}
+		}
+	}
+	ci.cacheLock.RUnlock()
+	result := counts[0]
+	for i := 1; i < len(counts); i++ {
+		for subnet, count := range result {
+			if counts[i][subnet] < count {
+				result[subnet] = counts[i][subnet]
+			}
+		}
+	}
+	for subnet, count := range result {
+		if count == 0 {
+			delete(result, subnet)
+		}
+	}
+	return result
+}
+
 // Shutdown shutdowns IPAM.
 func (ci *crdIpam) Shutdown() {
+	if closer, ok := ci.store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			glog.Warningf("failed to close store: %v", err)
+		}
+	}
 }
 
 // ConfigurePool init floatingIP pool.
@@ -339,11 +516,16 @@ func (ci *crdIpam) ConfigurePool(floatIPs []*FloatingIPPool) error {
 			len(ci.unallocatedFIPs), len(ci.allocatedFIPs))
 	}()
 	sort.Sort(FloatingIPSlice(floatIPs))
-	ips, err := ci.listFloatingIPs()
+	ips, err := ci.store.List()
 	if err != nil {
 		glog.Errorf("fail to list floatIP %v", err)
 		return err
 	}
+	releasedAt, err := ci.store.ListReleased()
+	if err != nil {
+		glog.Errorf("fail to list released floatIP %v", err)
+		return err
+	}
 	glog.V(3).Infof("floating ip config %v", floatIPs)
 	for index, fipConf := range floatIPs {
 		subnetSet := sets.NewString()
@@ -353,36 +535,67 @@ func (ci *crdIpam) ConfigurePool(floatIPs []*FloatingIPPool) error {
 		fipConf.nodeSubnets = subnetSet
 		fipConf.index = index
 	}
-	var deletingIPs []string
+	var deletingIPs []net.IP
 	tmpCacheAllocated := make(map[string]*FloatingIP)
+	drainingCandidates := ci.drainingCandidates(floatIPs, ips)
+	drainingPools := map[*FloatingIPPool]bool{}
+	// ips whose persisted draining pool changes
+	var updatingIPs []*FloatingIP
 	//delete no longer available floating ips stored in etcd first
-	for _, ip := range ips.Items {
-		netIP := net.ParseIP(ip.Name)
+	for _, ip := range ips {
 		found := false
+		// pool of listed ips is the persisted draining pool, which survives restarts
+		persisted := ip.pool
+		ip.pool = nil
 		for _, fipConf := range floatIPs {
-			if fipConf.IPNet().Contains(netIP) && fipConf.Contains(netIP) {
+			if fipConf.IPNet().Contains(ip.IP) && fipConf.Contains(ip.IP) {
 				found = true
 				//ip in config, insert it into cache
-				tmpFip := New(fipConf, netIP, ip.Spec.Key, &Attr{Policy: ip.Spec.Policy}, ip.Spec.UpdateTime.Time)
-				if err := tmpFip.unmarshalAttr(ip.Spec.Attribute); err != nil {
-					glog.Error(err)
-				}
-				tmpFip.Labels = ip.Labels
-				tmpCacheAllocated[ip.Name] = tmpFip
+				ip.pool = fipConf
+				tmpCacheAllocated[ip.IP.String()] = ip
 				break
 			}
 		}
 		if !found {
-			deletingIPs = append(deletingIPs, ip.Name)
+			// ip of a removed ip range keeps allocated until released by its release policy
+			for _, pool := range drainingCandidates {
+				if pool.IPNet().Contains(ip.IP) && pool.Contains(ip.IP) {
+					found = true
+					ip.pool = pool
+					tmpCacheAllocated[ip.IP.String()] = ip
+					drainingPools[pool] = true
+					break
+				}
+			}
+		}
+		if !found {
+			deletingIPs = append(deletingIPs, ip.IP)
+		} else if changed, err := drainingPoolChanged(persisted, ip.pool); err != nil {
+			glog.Error(err)
+		} else if changed {
+			updatingIPs = append(updatingIPs, ip)
+		}
+	}
+	for _, ip := range updatingIPs {
+		// persist the draining pool so that ips of removed ip ranges are not deleted after restart
+		if err := ci.store.Update(ip); err != nil {
+			glog.Errorf("failed to update draining pool of ip %s: %v", ip.IP.String(), err)
 		}
 	}
 	ci.cacheLock.Lock()
 	defer ci.cacheLock.Unlock()
 	ci.FloatingIPs = floatIPs
 	ci.allocatedFIPs = tmpCacheAllocated
+	ci.drainingPools = nil
+	for _, pool := range drainingCandidates {
+		if drainingPools[pool] {
+			glog.Infof("draining ip ranges %v of subnet %s", pool.IPRanges, pool.IPNet().String())
+			ci.drainingPools = append(ci.drainingPools, pool)
+		}
+	}
 	if len(deletingIPs) > 0 {
 		for _, ip := range deletingIPs {
-			if err := ci.deleteFloatingIP(ip); err != nil {
+			if err := ci.store.Delete(ip); err != nil {
 				//if a FloatingIP crd in etcd can't be deleted, every freshCache will produce an error
 				//it won't return error when error happens in deletion
 				glog.Errorf("failed to delete ip %v: %v", ip, err)
@@ -398,21 +611,116 @@ func (ci *crdIpam) ConfigurePool(floatIPs []*FloatingIPPool) error {
 			ipStr := ip.String()
 			if _, contain := ci.allocatedFIPs[ipStr]; !contain {
 				tmpFip := New(fipConf, ip, "", &Attr{Policy: constant.ReleasePolicyPodDelete}, now)
+				if old, ok := ci.unallocatedFIPs[ipStr]; ok {
+					// keep release time for release cooldown
+					tmpFip.releasedAt = old.releasedAt
+				}
+				if t, ok := releasedAt[ipStr]; ok && t.After(tmpFip.releasedAt) {
+					// release time persisted before restart
+					tmpFip.releasedAt = t
+				}
 				tmpCacheUnallocated[ipStr] = tmpFip
 			}
 			return false
 		})
 	}
 	ci.unallocatedFIPs = tmpCacheUnallocated
+	var expired []net.IP
+	for ipStr := range releasedAt {
+		// released records are only needed during cooldown
+		if fip, ok := ci.unallocatedFIPs[ipStr]; ok && fip.coolingDown(now) {
+			continue
+		}
+		expired = append(expired, net.ParseIP(ipStr))
+	}
+	if len(expired) > 0 {
+		if err := ci.store.DeleteReleased(expired); err != nil {
+			glog.Errorf("failed to delete released ips %v: %v", expired, err)
+		}
+	}
 	return nil
 }
 
+// drainingCandidates returns the ip ranges of current pools, draining pools and draining pools persisted with ips
+// which are removed from the new config
+func (ci *crdIpam) drainingCandidates(floatIPs []*FloatingIPPool, ips []*FloatingIP) []*FloatingIPPool {
+	var newRanges []nets.IPRange
+	for _, pool := range floatIPs {
+		newRanges = append(newRanges, pool.IPRanges...)
+	}
+	ci.cacheLock.RLock()
+	oldPools := append(append([]*FloatingIPPool{}, ci.FloatingIPs...), ci.drainingPools...)
+	ci.cacheLock.RUnlock()
+	for _, ip := range ips {
+		if ip.pool != nil {
+			oldPools = appendDrainingCandidate(oldPools, ip.pool)
+		}
+	}
+	var candidates []*FloatingIPPool
+	for _, pool := range oldPools {
+		if ranges := nets.SubtractIPRanges(pool.IPRanges, newRanges); len(ranges) > 0 {
+			candidates = append(candidates, pool.drainingPool(ranges))
+		}
+	}
+	return candidates
+}
+
+// appendDrainingCandidate appends a persisted draining pool to pools unless an equal one exists, so that ips of the
+// same removed ip range share a pool
+func appendDrainingCandidate(pools []*FloatingIPPool, persisted *FloatingIPPool) []*FloatingIPPool {
+	for _, pool := range pools {
+		if pool.IPNet().String() == persisted.IPNet().String() &&
+			reflect.DeepEqual(pool.IPRanges, persisted.IPRanges) {
+			return pools
+		}
+	}
+	return append(pools, persisted)
+}
+
+// drainingPoolChanged returns true if the persisted draining pool of an ip differs from its current pool
+func drainingPoolChanged(persisted, current *FloatingIPPool) (bool, error) {
+	old, err := (&FloatingIP{pool: persisted}).drainingPoolData()
+	if err != nil {
+		return false, err
+	}
+	cur, err := (&FloatingIP{pool: current}).drainingPoolData()
+	if err != nil {
+		return false, err
+	}
+	return old != cur, nil
+}
+
+// Pools returns the configured pools
+func (ci *crdIpam) Pools() []*FloatingIPPool {
+	ci.cacheLock.RLock()
+	defer ci.cacheLock.RUnlock()
+	return append([]*FloatingIPPool{}, ci.FloatingIPs...)
+}
+
+// DrainingPools returns ip ranges which are removed from config but still have allocated ips
+func (ci *crdIpam) DrainingPools() []*FloatingIPPool {
+	ci.cacheLock.RLock()
+	defer ci.cacheLock.RUnlock()
+	return append([]*FloatingIPPool{}, ci.drainingPools...)
+}
+
+// Watch returns a channel of events after the resource version and a function to stop watching.
+func (ci *crdIpam) Watch(resourceVersion string) (<-chan Event, func(), error) {
+	return ci.events.watch(resourceVersion)
+}
+
+// ResourceVersion returns the resource version of the latest event.
+func (ci *crdIpam) ResourceVersion() string {
+	return ci.events.latest()
+}
+
 // cacheLock is used when the function called,
 // don't use lock inner function, otherwise deadlock will be caused
 func (ci *crdIpam) syncCacheAfterCreate(fip *FloatingIP) {
 	ipStr := fip.IP.String()
 	ci.allocatedFIPs[ipStr] = fip
 	delete(ci.unallocatedFIPs, ipStr)
+	ci.events.emit(allocateEventType(fip), fip)
 	return
 }
 
@@ -420,13 +728,46 @@ func (ci *crdIpam) syncCacheAfterCreate(fip *FloatingIP) {
 // don't use lock inner function, otherwise deadlock will be caused
 func (ci *crdIpam) syncCacheAfterDel(released *FloatingIP) {
 	ipStr := released.IP.String()
-	released.Assign("", &Attr{Policy: constant.ReleasePolicyPodDelete}, time.Now())
+	ci.events.emit(EventRelease, released)
+	now := time.Now()
+	released.Assign("", &Attr{Policy: constant.ReleasePolicyPodDelete}, now)
 	released.Labels = nil
+	released.releasedAt = now
 	delete(ci.allocatedFIPs, ipStr)
+	if released.pool != nil && released.pool.draining {
+		// released ip of a draining pool is no longer allocatable
+		ci.removeDrainedPool(released.pool)
+		return
+	}
 	ci.unallocatedFIPs[ipStr] = released
 	return
 }
 
+// deleteFromStore deletes a released ip from store. If the pool has release cooldown, a released record is kept
+// instead so that the cooldown survives restarts.
+func (ci *crdIpam) deleteFromStore(released *FloatingIP) error {
+	if released.pool == nil || released.pool.draining || released.pool.ReleaseCooldown <= 0 {
+		return ci.store.Delete(released.IP)
+	}
+	return ci.store.MarkReleased(released.IP, time.Now())
+}
+
+// removeDrainedPool removes the draining pool once all of its ips are released
+func (ci *crdIpam) removeDrainedPool(pool *FloatingIPPool) {
+	for _, fip := range ci.allocatedFIPs {
+		if fip.pool == pool {
+			return
+		}
+	}
+	for i := range ci.drainingPools {
+		if ci.drainingPools[i] == pool {
+			ci.drainingPools = append(ci.drainingPools[:i], ci.drainingPools[i+1:]...)
+			glog.Infof("ip ranges %v of subnet %s are drained", pool.IPRanges, pool.IPNet().String())
+			return
+		}
+	}
+}
+
 // ByKeyword returns floatingIP set by a given keyword.
 func (ci *crdIpam) ByKeyword(keyword string) ([]FloatingIP, error) {
 	//not implement
@@ -455,7 +796,7 @@ func (ci *crdIpam) ReleaseIPs(ipToKey map[string]string) (map[string]string, map
 	for ipStr, key := range ipToKey {
 		if v, find := ci.allocatedFIPs[ipStr]; find {
 			if v.Key == key {
-				if err := ci.deleteFloatingIP(ipStr); err != nil {
+				if err := ci.deleteFromStore(v); err != nil {
 					glog.Errorf("failed to delete %v", ipStr)
 					return deleted, undeleted, fmt.Errorf("failed to delete %v", ipStr)
 				}
@@ -477,6 +818,26 @@ func (ci *crdIpam) ReleaseIPs(ipToKey map[string]string) (map[string]string, map
 // Describe sends metrics description to ch
 func (ci *crdIpam) Describe(ch chan<- *prometheus.Desc) {
 	ch <- ci.ipCounterDesc
+	ch <- ci.ipUsageDesc
+	ch <- ci.subnetTotalDesc
+	ch <- ci.subnetFreeDesc
+	ch <- ci.exhaustionRatioDesc
+}
+
+// PoolUsage returns the number of allocated ips and manually reserved ips of the given pool.
+func (ci *crdIpam) PoolUsage(pool *FloatingIPPool) (allocated, reserved int) {
+	ci.cacheLock.RLock()
+	defer ci.cacheLock.RUnlock()
+	for _, fip := range ci.allocatedFIPs {
+		if !pool.IPNet().Contains(fip.IP) || !pool.Contains(fip.IP) {
+			continue
+		}
+		allocated++
+		if _, ok := fip.Labels[constant.ReserveFIPLabel]; ok {
+			reserved++
+		}
+	}
+	return
 }
 
 // Collect sends metrics to ch
@@ -493,6 +854,7 @@ func (ci *crdIpam) Collect(ch chan<- prometheus.Metric) {
 	for i := range ci.FloatingIPs {
 		pools[i] = ci.FloatingIPs[i]
 	}
+	pools = append(pools, ci.drainingPools...)
 	ci.cacheLock.RUnlock()
 	for _, pool := range pools {
 		subnetStr := pool.IPNet().String()
@@ -508,54 +870,103 @@ func (ci *crdIpam) Collect(ch chan<- prometheus.Metric) {
 			}
 			allocatedNum += 1
 		}
+		if pool.draining {
+			// draining pools only report allocated ips which are waiting to be released
+			ch <- prometheus.MustNewConstMetric(ci.ipCounterDesc, prometheus.GaugeValue, allocatedNum,
+				"draining", subnetStr, firstIP)
+			continue
+		}
 		// since subnetStr may be the same for different pools, add a first ip tag
 		ch <- prometheus.MustNewConstMetric(ci.ipCounterDesc, prometheus.GaugeValue, allocatedNum,
 			"allocated", subnetStr, firstIP)
 		ch <- prometheus.MustNewConstMetric(ci.ipCounterDesc, prometheus.GaugeValue, float64(pool.Size()),
 			"total", subnetStr, firstIP)
 	}
+	ci.collectUsage(ch)
 }
 
-// AllocateInSubnetsAndIPRange allocates an ip for each ip range array of the input node subnet.
-// It guarantees allocating all ips or no ips.
+// AllocateInSubnetsAndIPRange allocates an ip for each ip range array of the input node subnet. If ip range
+// array is empty, it allocates an ip for each ip family instead.
+// It guarantees allocating all ips or no ips. Ips within the release cooldown of their pools are skipped and the
+// least recently released ips are preferred.
 // TODO Fix allocation for [][]nets.IPRange [["10.0.0.1~10.0.0.2"]["10.0.0.1"]]
 func (ci *crdIpam) AllocateInSubnetsAndIPRange(key string, nodeSubnet *net.IPNet, ipranges [][]nets.IPRange,
-	attr Attr) ([]net.IP, error) {
+	families []nets.IPFamily, attr Attr) ([]net.IP, error) {
 	if nodeSubnet == nil {
 		// this should never happen
 		return nil, fmt.Errorf("nil nodeSubnet")
 	}
-	if len(ipranges) == 0 {
-		ip, err := ci.AllocateInSubnet(key, nodeSubnet, attr)
-		if err != nil {
-			return nil, err
-		}
-		return []net.IP{ip}, nil
-	}
+	nodeSubnetStr := nodeSubnet.String()
 	ci.cacheLock.Lock()
 	defer ci.cacheLock.Unlock()
-	// pick ips to allocate, one per []nets.IPRange
+	// pick ips to allocate, one per []nets.IPRange or one per ip family
 	var allocatedIPStrs []string
 	// allocatedIPSet is the allocated ips in the previous loop, to avoid count in duplicate ips
 	allocatedIPSet := sets.NewString()
+	quota := ci.newQuotaTracker(key)
+	// quotaLimited is true if any candidate ip is skipped because of namespace quota
+	var quotaLimited bool
+	noIPErr := func() error {
+		if quotaLimited {
+			return ErrQuotaExceeded
+		}
+		return ErrNoEnoughIP
+	}
+	now := time.Now()
+	// picked is the least recently released candidate, ips never released are picked first
+	var picked *FloatingIP
+	// pick checks a candidate and returns true if there is no better candidate
+	pick := func(v *FloatingIP) bool {
+		if v.coolingDown(now) {
+			return false
+		}
+		if quota.exceeded(v.pool) {
+			quotaLimited = true
+			return false
+		}
+		if picked == nil || v.releasedAt.Before(picked.releasedAt) {
+			picked = v
+		}
+		return picked.releasedAt.IsZero()
+	}
+	allocate := func() {
+		ipStr := picked.IP.String()
+		allocatedIPStrs = append(allocatedIPStrs, ipStr)
+		allocatedIPSet.Insert(ipStr)
+		quota.add(picked.pool)
+	}
+	if len(ipranges) == 0 {
+		for _, family := range nets.DefaultFamilies(families) {
+			picked = nil
+			for ipStr, v := range ci.unallocatedFIPs {
+				//find an unallocated fip, then use it
+				if v.pool.nodeSubnets.Has(nodeSubnetStr) && v.pool.Family() == family && !allocatedIPSet.Has(ipStr) {
+					if pick(v) {
+						break
+					}
+				}
+			}
+			if picked == nil {
+				glog.V(3).Infof("no enough %s ips to allocate for %s node subnet %s", family, key, nodeSubnetStr)
+				return nil, noIPErr()
+			}
+			allocate()
+		}
+	}
 	for _, ranges := range ipranges {
-		var allocated bool
-		walkIPRanges(ranges, func(ip net.IP) bool {
-			ipStr := ip.String()
-			if fip, ok := ci.unallocatedFIPs[ipStr]; !ok || !fip.pool.nodeSubnets.Has(nodeSubnet.String()) ||
-				allocatedIPSet.Has(ipStr) {
+		picked = nil
+		walkCachedIPs(ci.unallocatedFIPs, ranges, func(fip *FloatingIP) bool {
+			if !fip.pool.nodeSubnets.Has(nodeSubnetStr) || allocatedIPSet.Has(fip.IP.String()) {
 				return false
 			}
-			allocatedIPStrs = append(allocatedIPStrs, ipStr)
-			allocatedIPSet.Insert(ipStr)
-			allocated = true
-			return true
+			return pick(fip)
 		})
-		if !allocated {
+		if picked == nil {
 			glog.V(3).Infof("no enough ips to allocate for %s node subnet %s, ip range %v", key,
-				nodeSubnet.String(), ipranges)
-			return nil, ErrNoEnoughIP
+				nodeSubnetStr, ipranges)
+			return nil, noIPErr()
 		}
+		allocate()
 	}
 	var allocatedIPs []net.IP
 	var allocatedFips []*FloatingIP
@@ -564,14 +975,14 @@ func (ci *crdIpam) AllocateInSubnetsAndIPRange(key string, nodeSubnet *net.IPNet
 		v := ci.unallocatedFIPs[allocatedIPStr]
 		// we never updates ip or subnet object, it's ok to share these objs.
 		allocated := New(v.pool, v.IP, key, &attr, time.Now())
-		if err := ci.createFloatingIP(allocated); err != nil {
+		if err := ci.store.Create(allocated); err != nil {
 			glog.Errorf("failed to create floatingIP %s: %v", allocatedIPStr, err)
 			// rollback all allocated ips
 			for j := range allocatedIPStrs {
 				if j == i {
 					break
 				}
-				if err := ci.deleteFloatingIP(allocatedIPStrs[j]); err != nil {
+				if err := ci.store.Delete(ci.unallocatedFIPs[allocatedIPStrs[j]].IP); err != nil {
 					glog.Errorf("failed to delete floatingIP %s: %v", allocatedIPStrs[j], err)
 				}
 			}
@@ -598,10 +1009,8 @@ func (ci *crdIpam) ByKeyAndIPRanges(key string, ipranges [][]nets.IPRange) ([]*F
 	if len(ipranges) != 0 {
 		ipinfos = make([]*FloatingIPInfo, len(ipranges))
 		for i, ranges := range ipranges {
-			walkIPRanges(ranges, func(ip net.IP) bool {
-				ipStr := ip.String()
-				fip, ok := ci.allocatedFIPs[ipStr]
-				if !ok || fip.Key != key {
+			walkCachedIPs(ci.allocatedFIPs, ranges, func(fip *FloatingIP) bool {
+				if fip.Key != key {
 					return false
 				}
 				ipinfos[i] = ci.toFloatingIPInfo(fip)
@@ -638,13 +1047,49 @@ func (ci *crdIpam) toFloatingIPInfo(fip *FloatingIP) *FloatingIPInfo {
 // walkIPRanges walks all ips in the ranges, and calls f for each ip. If f returns true, walkIPRanges stops.
 func walkIPRanges(ranges []nets.IPRange, f func(ip net.IP) bool) {
 	for _, r := range ranges {
-		first := nets.IPToInt(r.First)
-		last := nets.IPToInt(r.Last)
-		for ; first <= last; first++ {
-			ip := nets.IntToIP(first)
+		for ip := r.First; ip != nil && nets.CompareIP(ip, r.Last) <= 0; ip = nets.NextIP(ip) {
 			if f(ip) {
 				return
 			}
 		}
 	}
 }
+
+// walkCachedIPs calls f for each cached ip within the ranges. If f returns true, walkCachedIPs stops.
+// Request ip ranges, e.g. ipv6 ones, may be much larger than pools, so it walks the ips of the ranges only if they are
+// fewer than the cached ips, otherwise it walks the cached ips in ascending order.
+func walkCachedIPs(cache map[string]*FloatingIP, ranges []nets.IPRange, f func(fip *FloatingIP) bool) {
+	var size uint64
+	for _, r := range ranges {
+		rangeSize := r.Size()
+		if size += rangeSize; size < rangeSize || size > uint64(len(cache)) {
+			// overflow or larger than the cache
+			size = math.MaxUint64
+			break
+		}
+	}
+	if size <= uint64(len(cache)) {
+		walkIPRanges(ranges, func(ip net.IP) bool {
+			fip, ok := cache[ip.String()]
+			return ok && f(fip)
+		})
+		return
+	}
+	var fips []*FloatingIP
+	for _, fip := range cache {
+		for _, r := range ranges {
+			if r.Contains(fip.IP) {
+				fips = append(fips, fip)
+				break
+			}
+		}
+	}
+	sort.Slice(fips, func(i, j int) bool {
+		return nets.CompareIP(fips[i].IP, fips[j].IP) < 0
+	})
+	for _, fip := range fips {
+		if f(fip) {
+			return
+		}
+	}
+}
@@ -21,7 +21,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,12 +31,13 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/utils"
 	"tkestack.io/galaxy/pkg/utils/nets"
 )
 
 const (
-	pod1CRD = `{"kind":"FloatingIP","apiVersion":"galaxy.k8s.io/v1alpha1","metadata":{"name":"10.49.27.205","creationTimestamp":null},"spec":{"key":"pod1","attribute":"{\"NodeName\":\"212\",\"Uid\":\"xx1\"}","policy":2,"updateTime":null}}`
-	pod2CRD = `{"kind":"FloatingIP","apiVersion":"galaxy.k8s.io/v1alpha1","metadata":{"name":"10.49.27.216","creationTimestamp":null},"spec":{"key":"pod2","attribute":"{\"NodeName\":\"333\",\"Uid\":\"xx2\"}","policy":1,"updateTime":null}}`
+	pod1CRD = `{"kind":"FloatingIP","apiVersion":"galaxy.k8s.io/v1alpha1","metadata":{"name":"10.49.27.205","creationTimestamp":null,"labels":{"galaxy.k8s.io/node":"212"}},"spec":{"key":"pod1","attribute":"{\"NodeName\":\"212\",\"Uid\":\"xx1\"}","policy":2,"updateTime":null}}`
+	pod2CRD = `{"kind":"FloatingIP","apiVersion":"galaxy.k8s.io/v1alpha1","metadata":{"name":"10.49.27.216","creationTimestamp":null,"labels":{"galaxy.k8s.io/node":"333"}},"spec":{"key":"pod2","attribute":"{\"NodeName\":\"333\",\"Uid\":\"xx2\"}","policy":1,"updateTime":null}}`
 
 	policy = constant.ReleasePolicyPodDelete
 )
@@ -143,7 +146,7 @@ func TestAllocateSpecificIP(t *testing.T) {
 }
 
 func checkFIP(ipam *crdIpam, expect ...string) error {
-	fips, err := ipam.client.GalaxyV1alpha1().FloatingIPs().List(context.Background(), v1.ListOptions{})
+	fips, err := ipam.store.(*crdStore).client.GalaxyV1alpha1().FloatingIPs().List(context.Background(), v1.ListOptions{})
 	if err != nil {
 		return err
 	}
@@ -183,8 +186,8 @@ func TestReserveIP(t *testing.T) {
 		}
 	}
 	if err := checkFIP(ipam,
-		`{"kind":"FloatingIP","apiVersion":"galaxy.k8s.io/v1alpha1","metadata":{"name":"10.49.27.205","creationTimestamp":null},"spec":{"key":"p1","attribute":"{\"NodeName\":\"node2\",\"Uid\":\"xx2\"}","policy":2,"updateTime":null}}`,
-		`{"kind":"FloatingIP","apiVersion":"galaxy.k8s.io/v1alpha1","metadata":{"name":"10.49.27.216","creationTimestamp":null},"spec":{"key":"p1","attribute":"{\"NodeName\":\"node2\",\"Uid\":\"xx2\"}","policy":2,"updateTime":null}}`); err != nil {
+		`{"kind":"FloatingIP","apiVersion":"galaxy.k8s.io/v1alpha1","metadata":{"name":"10.49.27.205","creationTimestamp":null,"labels":{"galaxy.k8s.io/node":"node2"}},"spec":{"key":"p1","attribute":"{\"NodeName\":\"node2\",\"Uid\":\"xx2\"}","policy":2,"updateTime":null}}`,
+		`{"kind":"FloatingIP","apiVersion":"galaxy.k8s.io/v1alpha1","metadata":{"name":"10.49.27.216","creationTimestamp":null,"labels":{"galaxy.k8s.io/node":"node2"}},"spec":{"key":"p1","attribute":"{\"NodeName\":\"node2\",\"Uid\":\"xx2\"}","policy":2,"updateTime":null}}`); err != nil {
 		t.Fatal(err)
 	}
 	// reserve again, should not succeed
@@ -395,7 +398,7 @@ func TestAllocateInSubnet(t *testing.T) {
 	}
 	for i := range testCases {
 		testCase := testCases[i]
-		allocatedIP, err := ipam.AllocateInSubnet("pod1", testCase.nodeIPNet, Attr{Policy: policy})
+		allocatedIP, err := ipam.AllocateInSubnet("pod1", testCase.nodeIPNet, nets.IPv4Family, Attr{Policy: policy})
 		if err != nil {
 			t.Fatalf("test case %d: %v", i, err)
 		}
@@ -405,18 +408,18 @@ func TestAllocateInSubnet(t *testing.T) {
 	}
 	// test can't find available ip
 	_, noConfigNode, _ := net.ParseCIDR("10.173.14.0/24")
-	if _, err := ipam.AllocateInSubnet("pod1-1", noConfigNode, Attr{Policy: policy}); err == nil || err != ErrNoEnoughIP {
+	if _, err := ipam.AllocateInSubnet("pod1-1", noConfigNode, nets.IPv4Family, Attr{Policy: policy}); err == nil || err != ErrNoEnoughIP {
 		t.Fatalf("should fail because of ErrNoEnoughIP: %v", err)
 	}
 }
 
 func TestAllocateInSubnetWithKey(t *testing.T) {
 	ipam := createTestCrdIPAM(t)
-	allocatedIP, err := ipam.AllocateInSubnet("pod2", node2IPNet, Attr{Policy: policy})
+	allocatedIP, err := ipam.AllocateInSubnet("pod2", node2IPNet, nets.IPv4Family, Attr{Policy: policy})
 	if err != nil {
 		t.Fatal(err)
 	}
-	if err := ipam.AllocateInSubnetWithKey("pod2", "pod3", node2IPNet.String(), Attr{Policy: policy}); err != nil {
+	if err := ipam.AllocateInSubnetWithKey("pod2", "pod3", node2IPNet.String(), nil, Attr{Policy: policy}); err != nil {
 		t.Fatal(err)
 	}
 	ipInfo, err := ipam.First("pod2")
@@ -471,7 +474,7 @@ func TestAllocateInMultipleSubnet(t *testing.T) {
 	ipam := createTestCrdIPAM(t)
 	nodeSubnets := sets.NewString()
 	for {
-		allocatedIP, err := ipam.AllocateInSubnet("pod1", node7IPNet, Attr{Policy: policy})
+		allocatedIP, err := ipam.AllocateInSubnet("pod1", node7IPNet, nets.IPv4Family, Attr{Policy: policy})
 		if err != nil {
 			if err == ErrNoEnoughIP {
 				break
@@ -523,7 +526,7 @@ func TestAllocateInSubnetsAndIPRange(t *testing.T) {
 				t.Fatalf("case %d: %v", i, err)
 			}
 		}
-		ips, err := ipam.AllocateInSubnetsAndIPRange("p1", testCase.nodeSubnet, ipranges, Attr{})
+		ips, err := ipam.AllocateInSubnetsAndIPRange("p1", testCase.nodeSubnet, ipranges, nil, Attr{})
 		if err != nil {
 			if testCase.expectError != nil && testCase.expectError == err && len(ips) == 0 {
 				continue
@@ -553,7 +556,7 @@ func TestAllocateInSubnetsAndIPRange2(t *testing.T) {
 	// check if AllocateInSubnetsAndIPRange allocates all ips or nothing
 	ipam := createTestCrdIPAM(t)
 	ipranges := [][]nets.IPRange{{*nets.ParseIPRange("10.49.27.216")}, {*nets.ParseIPRange("10.50.0.1")}}
-	ips, err := ipam.AllocateInSubnetsAndIPRange("p1", node1IPNet, ipranges, Attr{})
+	ips, err := ipam.AllocateInSubnetsAndIPRange("p1", node1IPNet, ipranges, nil, Attr{})
 	if err != ErrNoEnoughIP || len(ips) != 0 {
 		t.Fatalf("%v, %v", ips, err)
 	}
@@ -564,7 +567,7 @@ func TestAllocateInSubnetsAndIPRange2(t *testing.T) {
 	}
 	ipranges = [][]nets.IPRange{{*nets.ParseIPRange("10.49.27.216")}, {*nets.ParseIPRange("10.49.27.218")}}
 	// check if attr is correct
-	ips, err = ipam.AllocateInSubnetsAndIPRange("p1", node1IPNet, ipranges,
+	ips, err = ipam.AllocateInSubnetsAndIPRange("p1", node1IPNet, ipranges, nil,
 		Attr{Policy: constant.ReleasePolicyImmutable, NodeName: "node2", Uid: "xx1"})
 	if err != nil || len(ips) != 2 {
 		t.Fatalf("%v, %v", ips, err)
@@ -583,7 +586,7 @@ func TestAllocateInSubnetsAndIPRange2(t *testing.T) {
 func TestByKeyAndIPRanges(t *testing.T) {
 	ipam := createTestCrdIPAM(t)
 	ipranges := [][]nets.IPRange{{*nets.ParseIPRange("10.49.27.216")}, {*nets.ParseIPRange("10.49.27.218")}}
-	_, err := ipam.AllocateInSubnetsAndIPRange("p1", node1IPNet, ipranges, Attr{})
+	_, err := ipam.AllocateInSubnetsAndIPRange("p1", node1IPNet, ipranges, nil, Attr{})
 	if err != nil {
 		t.Fatal()
 	}
@@ -654,7 +657,7 @@ func TestNodeSubnetsByKeyAndIPRanges(t *testing.T) {
 				t.Fatalf("case %d: %v", i, err)
 			}
 		}
-		subnets, err := ipam.NodeSubnetsByIPRanges(ipranges)
+		subnets, err := ipam.NodeSubnetsByIPRanges("", ipranges, nil)
 		if err != nil {
 			t.Fatalf("case %d: %v", i, err)
 		}
@@ -704,3 +707,567 @@ func TestLabels(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestReserve(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	if err := ipam.AllocateSpecificIP("pod1", net.ParseIP("10.49.27.205"),
+		Attr{NodeName: "node1", Uid: "uid1"}); err != nil {
+		t.Fatal(err)
+	}
+	attr := Attr{Reason: "for gateway", Owner: "admin"}
+	for _, ipStr := range []string{"10.49.27.205", "10.49.27.216"} {
+		if err := ipam.Reserve(net.ParseIP(ipStr), "", true, attr); err != nil {
+			t.Fatal(err)
+		}
+		fip, err := ipam.ByIP(net.ParseIP(ipStr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := fip.Labels[constant.ReserveFIPLabel]; !ok || fip.Key != ReservedKey || fip.Reason != attr.Reason ||
+			fip.Owner != attr.Owner || fip.NodeName != "" || fip.PodUid != "" {
+			t.Fatalf("%s: %+v", ipStr, fip)
+		}
+	}
+	// reserved ips are persisted with their labels, reason and owner
+	fips, err := ipam.store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fips) != 2 {
+		t.Fatalf("expect 2 stored ips, got %v", fips)
+	}
+	for _, fip := range fips {
+		if _, ok := fip.Labels[constant.ReserveFIPLabel]; !ok || fip.Reason != attr.Reason || fip.Owner != attr.Owner {
+			t.Fatalf("%+v", fip)
+		}
+	}
+	// reserving again updates the reason
+	if err := ipam.Reserve(net.ParseIP("10.49.27.216"), ReservedKey, false, Attr{Reason: "changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if fip, err := ipam.ByIP(net.ParseIP("10.49.27.216")); err != nil || fip.Reason != "changed" {
+		t.Fatalf("%v %+v", err, fip)
+	}
+	if err := ipam.Unreserve(net.ParseIP("10.49.27.216")); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKey(ipam, "10.49.27.216", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Unreserve(net.ParseIP("10.49.27.216")); err == nil {
+		t.Fatal("expect an error unreserving an unallocated ip")
+	}
+	if err := ipam.AllocateSpecificIP("pod2", net.ParseIP("10.49.27.216"), Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Unreserve(net.ParseIP("10.49.27.216")); err == nil {
+		t.Fatal("expect an error unreserving an ip allocated to pods")
+	}
+	// reserving fails if the ip is allocated after callers checked it unless forced
+	if err := ipam.Reserve(net.ParseIP("10.49.27.216"), "", false, attr); err == nil {
+		t.Fatal("expect an error reserving an ip allocated to pod2 after check")
+	}
+	if err := checkIPKey(ipam, "10.49.27.216", "pod2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve(net.ParseIP("10.49.27.216"), "", true, attr); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve(net.ParseIP("172.16.1.1"), "", false, attr); err == nil {
+		t.Fatal("expect an error reserving an ip out of pools")
+	}
+}
+
+// failingUpdateStore is a Store whose UpdateWithLabels always fails
+type failingUpdateStore struct {
+	Store
+}
+
+func (s *failingUpdateStore) UpdateWithLabels(*FloatingIP) error {
+	return fmt.Errorf("update failed")
+}
+
+func TestReserveUpdateFailure(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	ip := net.ParseIP("10.49.27.205")
+	if err := ipam.AllocateSpecificIP("pod1", ip, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	ipam.store = &failingUpdateStore{Store: ipam.store}
+	if err := ipam.Reserve(ip, "pod1", false, Attr{Reason: "gateway"}); err == nil {
+		t.Fatal("expect reserve error")
+	}
+	// the ip keeps allocated in both cache and store
+	if err := checkIPKey(ipam, ip.String(), "pod1"); err != nil {
+		t.Fatal(err)
+	}
+	fips, err := ipam.store.List()
+	if err != nil || len(fips) != 1 || fips[0].Key != "pod1" {
+		t.Fatalf("expect ip stored for pod1, got %v, err %v", fips, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	events, stop, err := ipam.Watch("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	ip := net.ParseIP("10.49.27.205")
+	if err := ipam.AllocateSpecificIP("pod1", ip, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.UpdateAttr("pod1", ip, Attr{NodeName: "node1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Release("pod1", ip); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Reserve(ip, "", false, Attr{Reason: "gateway"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		typ      EventType
+		key      string
+		nodeName string
+	}{
+		{EventAllocate, "pod1", ""},
+		{EventUpdate, "pod1", "node1"},
+		{EventRelease, "pod1", "node1"},
+		{EventReserve, ReservedKey, ""},
+	}
+	for i, e := range expect {
+		event := <-events
+		if event.Type != e.typ || event.ResourceVersion != ipam.events.format(uint64(i+1)) || event.FloatingIP.Key != e.key ||
+			event.FloatingIP.NodeName != e.nodeName || !event.FloatingIP.IP.Equal(ip) {
+			t.Fatalf("event %d: expect %+v, got %+v", i, e, event)
+		}
+	}
+	if rv := ipam.ResourceVersion(); rv != ipam.events.format(4) {
+		t.Fatalf("expect resource version 4, got %s", rv)
+	}
+	// resume from resource version
+	resumed, stopResumed, err := ipam.Watch(ipam.events.format(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopResumed()
+	if event := <-resumed; event.Type != EventRelease || event.ResourceVersion != ipam.events.format(3) {
+		t.Fatalf("%+v", event)
+	}
+	if _, _, err := ipam.Watch(ipam.events.format(5)); err == nil || err == ErrResourceVersionTooOld {
+		t.Fatalf("expect an error watching from a future resource version, got %v", err)
+	}
+	for _, rv := range []string{"5", "x-5", ipam.events.epoch + "-x"} {
+		if _, _, err := ipam.Watch(rv); err == nil || err == ErrResourceVersionTooOld {
+			t.Fatalf("expect an error watching from invalid resource version %s, got %v", rv, err)
+		}
+	}
+	for i := 0; i < eventHistorySize; i++ {
+		ipam.events.emit(EventUpdate, &FloatingIP{IP: ip})
+	}
+	if _, _, err := ipam.Watch(ipam.events.format(2)); err != ErrResourceVersionTooOld {
+		t.Fatalf("expect ErrResourceVersionTooOld, got %v", err)
+	}
+	// watchers which fall behind are stopped
+	for range events {
+	}
+}
+
+func TestWatchAfterRestart(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	ip := net.ParseIP("10.49.27.205")
+	if err := ipam.AllocateSpecificIP("pod1", ip, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	rv := ipam.ResourceVersion()
+	// a restarted ipam starts counting again, resource versions of the previous process must not be resumed from
+	restarted := createTestCrdIPAM(t)
+	restarted.events.epoch = ipam.events.epoch + "0"
+	for _, key := range []string{"pod2", "pod3"} {
+		if err := restarted.AllocateSpecificIP(key, ip, Attr{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := restarted.Release(key, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := restarted.Watch(rv); err != ErrResourceVersionTooOld {
+		t.Fatalf("expect ErrResourceVersionTooOld, got %v", err)
+	}
+}
+
+func createDualStackIPAM(t *testing.T) *crdIpam {
+	ipam := createTestCrdIPAM(t)
+	var v6Pool FloatingIPPool
+	if err := json.Unmarshal([]byte(`{"nodeSubnets": ["10.49.27.0/24"], "ips": ["2001:db8::2~2001:db8::3"],
+		"subnet": "2001:db8::/64", "gateway": "2001:db8::1", "vlan": 2}`), &v6Pool); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.ConfigurePool(append(ipam.FloatingIPs, &v6Pool)); err != nil {
+		t.Fatal(err)
+	}
+	return ipam
+}
+
+func TestDualStackAllocate(t *testing.T) {
+	ipam := createDualStackIPAM(t)
+	families := []nets.IPFamily{nets.IPv4Family, nets.IPv6Family}
+	subnets, err := ipam.NodeSubnetsByIPRanges("", nil, families)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subnets.Len() != 1 || !subnets.Has(node1IPNet.String()) {
+		t.Fatalf("expect only %s has both ipv4 and ipv6 ips, got %v", node1IPNet, subnets.List())
+	}
+	ips, err := ipam.AllocateInSubnetsAndIPRange("pod1", node1IPNet, nil, families, Attr{Policy: policy})
+	if err != nil || len(ips) != 2 {
+		t.Fatalf("%v, %v", ips, err)
+	}
+	if !node1FIPSubnet.Contains(ips[0]) || nets.FamilyOf(ips[1]) != nets.IPv6Family {
+		t.Fatalf("expect an ipv4 and an ipv6 ip, got %v", ips)
+	}
+	fip, err := ipam.ByIP(ips[1])
+	if err != nil || fip.Key != "pod1" {
+		t.Fatalf("%v, %v", fip, err)
+	}
+	if _, err := ipam.AllocateInSubnet("pod2", node2IPNet, nets.IPv6Family, Attr{Policy: policy}); err != ErrNoEnoughIP {
+		t.Fatalf("expect ErrNoEnoughIP, got %v", err)
+	}
+	if err := ipam.AllocateInSubnetWithKey("pod1", "pod2", node1IPNet.String(), families,
+		Attr{Policy: policy}); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ipam.ByPrefix("pod2")
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("%v, %v", infos, err)
+	}
+	if err := ipam.Release("pod2", ips[1]); err != nil {
+		t.Fatal(err)
+	}
+	if fip, err := ipam.ByIP(ips[1]); err != nil || fip.Key != "" {
+		t.Fatalf("%v, %v", fip, err)
+	}
+}
+
+func TestLargeIPv6RequestRange(t *testing.T) {
+	ipam := createDualStackIPAM(t)
+	// walking the request range instead of the cached ips never finishes
+	ipranges := [][]nets.IPRange{{*nets.ParseIPRange("2001:db8::1~2001:db8::ffff:ffff:ffff:ffff")}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		subnets, err := ipam.NodeSubnetsByIPRanges("pod1", ipranges, nil)
+		if err != nil || subnets.Len() != 1 || !subnets.Has(node1IPNet.String()) {
+			t.Errorf("expect %s, got %v, %v", node1IPNet, subnets, err)
+			return
+		}
+		ips, err := ipam.AllocateInSubnetsAndIPRange("pod1", node1IPNet, ipranges, nil, Attr{Policy: policy})
+		if err != nil || len(ips) != 1 || ips[0].String() != "2001:db8::2" {
+			t.Errorf("expect 2001:db8::2, got %v, %v", ips, err)
+			return
+		}
+		infos, err := ipam.ByKeyAndIPRanges("pod1", ipranges)
+		if err != nil || len(infos) != 1 || infos[0] == nil || !infos[0].FloatingIP.IP.Equal(ips[0]) {
+			t.Errorf("expect %v, got %v, %v", ips[0], infos, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout walking a large ipv6 request range")
+	}
+}
+
+func TestFIPName(t *testing.T) {
+	for _, ipStr := range []string{"10.49.27.205", "2001:db8::2", "fe80::1:2"} {
+		ip := net.ParseIP(ipStr)
+		name := FIPName(ip)
+		if strings.Contains(name, ":") {
+			t.Fatalf("invalid object name %s", name)
+		}
+		if parsed := ParseFIPName(name); !parsed.Equal(ip) {
+			t.Fatalf("expect %s, got %s", ip, parsed)
+		}
+	}
+}
+
+func TestUnallocatedCountByNodeSubnet(t *testing.T) {
+	ipam := createDualStackIPAM(t)
+	counts := ipam.UnallocatedCountByNodeSubnet("", nil, nil)
+	if counts[node1IPNet.String()] != 4 || counts[node2IPNet.String()] != 6 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+	// node1 has 2 ipv6 ips, node2 has no ipv6 ip
+	counts = ipam.UnallocatedCountByNodeSubnet("", nil, []nets.IPFamily{nets.IPv4Family, nets.IPv6Family})
+	if len(counts) != 1 || counts[node1IPNet.String()] != 2 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+	counts = ipam.UnallocatedCountByNodeSubnet("", [][]nets.IPRange{{*nets.ParseIPRange("10.49.27.216~10.49.27.218")},
+		{*nets.ParseIPRange("10.49.27.205")}}, nil)
+	if len(counts) != 1 || counts[node1IPNet.String()] != 1 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+}
+
+func TestDrainingPool(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	drainingIP := net.ParseIP("10.49.27.217")
+	if err := ipam.AllocateSpecificIP("pod1", drainingIP, Attr{Policy: constant.ReleasePolicyNever}); err != nil {
+		t.Fatal(err)
+	}
+	var conf struct {
+		Floatingips []*FloatingIPPool `json:"floatingips"`
+	}
+	if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+		t.Fatal(err)
+	}
+	// remove 10.49.27.217~10.49.27.218 from config
+	for _, pool := range conf.Floatingips {
+		if pool.IPNet().String() == node1IPNet.String() {
+			pool.IPRanges = []nets.IPRange{*nets.ParseIPRange("10.49.27.205"), *nets.ParseIPRange("10.49.27.216")}
+		}
+	}
+	// configure twice to check draining pools are kept across config updates
+	for i := 0; i < 2; i++ {
+		if err := ipam.ConfigurePool(conf.Floatingips); err != nil {
+			t.Fatal(err)
+		}
+		if len(ipam.unallocatedFIPs) != 37 {
+			t.Fatalf("expect 37 unallocated ips, got %d", len(ipam.unallocatedFIPs))
+		}
+		pools := ipam.DrainingPools()
+		if len(pools) != 1 || fmt.Sprintf("%v", pools[0].IPRanges) != "[10.49.27.217~10.49.27.218]" {
+			t.Fatalf("unexpected draining pools %v", pools)
+		}
+		fip, err := ipam.ByIP(drainingIP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fip.Key != "pod1" || !fip.Draining() {
+			t.Fatalf("expect draining ip allocated to pod1, got %v", fip)
+		}
+	}
+	if err := ipam.AllocateSpecificIP("pod2", net.ParseIP("10.49.27.218"),
+		Attr{Policy: constant.ReleasePolicyNever}); err == nil {
+		t.Fatal("expect draining ip can't be allocated")
+	}
+	if err := ipam.Release("pod1", drainingIP); err != nil {
+		t.Fatal(err)
+	}
+	if pools := ipam.DrainingPools(); len(pools) != 0 {
+		t.Fatalf("expect no draining pools, got %v", pools)
+	}
+	if fip, err := ipam.ByIP(drainingIP); err != nil || fip.IP != nil {
+		t.Fatalf("expect released draining ip removed, got %v, err %v", fip, err)
+	}
+	if len(ipam.unallocatedFIPs) != 37 {
+		t.Fatalf("expect 37 unallocated ips, got %d", len(ipam.unallocatedFIPs))
+	}
+}
+
+func TestDrainingPoolAfterRestart(t *testing.T) {
+	// poolsWith returns the test config whose node1 pool has the given ip ranges
+	poolsWith := func(ranges ...string) []*FloatingIPPool {
+		var conf struct {
+			Floatingips []*FloatingIPPool `json:"floatingips"`
+		}
+		if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+			t.Fatal(err)
+		}
+		for _, pool := range conf.Floatingips {
+			if pool.IPNet().String() == node1IPNet.String() {
+				pool.IPRanges = nil
+				for _, r := range ranges {
+					pool.IPRanges = append(pool.IPRanges, *nets.ParseIPRange(r))
+				}
+			}
+		}
+		return conf.Floatingips
+	}
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "ipam.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.(*boltStore).Close()
+	drainingIP := net.ParseIP("10.49.27.217")
+	for _, store := range []Store{createTestCrdIPAM(t).store, bolt} {
+		ipam := newStoreIPAM(store)
+		if err := ipam.ConfigurePool(poolsWith("10.49.27.205", "10.49.27.216~10.49.27.218")); err != nil {
+			t.Fatal(err)
+		}
+		if err := ipam.AllocateSpecificIP("pod1", drainingIP, Attr{Policy: constant.ReleasePolicyNever}); err != nil {
+			t.Fatal(err)
+		}
+		// remove 10.49.27.217~10.49.27.218 from config
+		if err := ipam.ConfigurePool(poolsWith("10.49.27.205", "10.49.27.216")); err != nil {
+			t.Fatal(err)
+		}
+		// a restarted ipam configured without the removed range keeps its allocated ips draining
+		restarted := newStoreIPAM(store)
+		if err := restarted.ConfigurePool(poolsWith("10.49.27.205", "10.49.27.216")); err != nil {
+			t.Fatal(err)
+		}
+		pools := restarted.DrainingPools()
+		if len(pools) != 1 || fmt.Sprintf("%v", pools[0].IPRanges) != "[10.49.27.217~10.49.27.218]" ||
+			pools[0].Gateway.String() != "10.49.27.1" {
+			t.Fatalf("unexpected draining pools %v", pools)
+		}
+		fip, err := restarted.ByIP(drainingIP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fip.Key != "pod1" || !fip.Draining() {
+			t.Fatalf("expect draining ip allocated to pod1, got %v", fip)
+		}
+		// ips of the range added back to config are no longer draining after restart
+		if err := restarted.ConfigurePool(poolsWith("10.49.27.205", "10.49.27.216~10.49.27.218")); err != nil {
+			t.Fatal(err)
+		}
+		fips, err := store.List()
+		if err != nil || len(fips) != 1 || fips[0].pool != nil {
+			t.Fatalf("expect persisted draining pool removed, got %v, err %v", fips, err)
+		}
+		restarted = newStoreIPAM(store)
+		if err := restarted.ConfigurePool(poolsWith("10.49.27.205", "10.49.27.216~10.49.27.218")); err != nil {
+			t.Fatal(err)
+		}
+		if fip, err := restarted.ByIP(drainingIP); err != nil || fip.Key != "pod1" || fip.Draining() {
+			t.Fatalf("expect ip allocated to pod1 not draining, got %v, err %v", fip, err)
+		}
+		if pools := restarted.DrainingPools(); len(pools) != 0 {
+			t.Fatalf("expect no draining pools, got %v", pools)
+		}
+	}
+}
+
+func TestReleaseCooldown(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	var conf struct {
+		Floatingips []*FloatingIPPool `json:"floatingips"`
+	}
+	if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+		t.Fatal(err)
+	}
+	for _, pool := range conf.Floatingips {
+		if pool.IPNet().String() == node1IPNet.String() {
+			pool.ReleaseCooldown = time.Hour
+		}
+	}
+	if err := ipam.ConfigurePool(conf.Floatingips); err != nil {
+		t.Fatal(err)
+	}
+	// allocate all of 10.49.27.205, 10.49.27.216~10.49.27.218
+	for i := 0; i < 4; i++ {
+		if _, err := ipam.AllocateInSubnet(fmt.Sprintf("pod%d", i), node1IPNet, nets.IPv4Family, Attr{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ip := range []string{"10.49.27.216", "10.49.27.217"} {
+		fip, err := ipam.ByIP(net.ParseIP(ip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ipam.Release(fip.Key, fip.IP); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// released ips are kept cooling down across config updates
+	if err := ipam.ConfigurePool(conf.Floatingips); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.AllocateInSubnet("pod4", node1IPNet, nets.IPv4Family, Attr{}); err != ErrNoEnoughIP {
+		t.Fatalf("expect no enough ip error during cooldown, got %v", err)
+	}
+	subnets, err := ipam.NodeSubnetsByIPRanges("", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subnets.Has(node1IPNet.String()) {
+		t.Fatalf("expect %s excluded from %v during cooldown", node1IPNet, subnets)
+	}
+	if count := ipam.UnallocatedCountByNodeSubnet("", nil, nil)[node1IPNet.String()]; count != 0 {
+		t.Fatalf("expect no allocatable ips of %s during cooldown, got %d", node1IPNet, count)
+	}
+	// the least recently released ip is preferred once cooldown expires
+	ipam.unallocatedFIPs["10.49.27.216"].releasedAt = time.Now().Add(-2 * time.Hour)
+	ipam.unallocatedFIPs["10.49.27.217"].releasedAt = time.Now().Add(-3 * time.Hour)
+	ip, err := ipam.AllocateInSubnet("pod4", node1IPNet, nets.IPv4Family, Attr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.String() != "10.49.27.217" {
+		t.Fatalf("expect the least recently released ip 10.49.27.217, got %s", ip)
+	}
+}
+
+func TestReleaseCooldownAfterRestart(t *testing.T) {
+	// poolsWith returns the test config whose node1 pool has the given release cooldown
+	poolsWith := func(cooldown time.Duration) []*FloatingIPPool {
+		var conf struct {
+			Floatingips []*FloatingIPPool `json:"floatingips"`
+		}
+		if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+			t.Fatal(err)
+		}
+		for _, pool := range conf.Floatingips {
+			if pool.IPNet().String() == node1IPNet.String() {
+				pool.ReleaseCooldown = cooldown
+			}
+		}
+		return conf.Floatingips
+	}
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "ipam.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bolt.(*boltStore).Close()
+	releasedIP := net.ParseIP("10.49.27.216")
+	for _, store := range []Store{createTestCrdIPAM(t).store, bolt} {
+		ipam := newStoreIPAM(store)
+		if err := ipam.ConfigurePool(poolsWith(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := ipam.AllocateSpecificIP("pod1", releasedIP, Attr{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ipam.Release("pod1", releasedIP); err != nil {
+			t.Fatal(err)
+		}
+		// a restarted ipam keeps the released ip cooling down
+		restarted := newStoreIPAM(store)
+		if err := restarted.ConfigurePool(poolsWith(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if fips, err := store.List(); err != nil || len(fips) != 0 {
+			t.Fatalf("expect released record not listed, got %v, err %v", fips, err)
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := restarted.AllocateInSubnet(fmt.Sprintf("pod%d", i+2), node1IPNet, nets.IPv4Family,
+				Attr{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := restarted.AllocateInSubnet("pod5", node1IPNet, nets.IPv4Family, Attr{}); err != ErrNoEnoughIP {
+			t.Fatalf("expect no enough ip error during cooldown, got %v", err)
+		}
+		// AllocateSpecificIP records an ip used by a pod regardless of cooldown
+		if err := restarted.AllocateSpecificIP("pod1", releasedIP, Attr{}); err != nil {
+			t.Fatal(err)
+		}
+		// released records are deleted once the cooldown is gone
+		if err := restarted.Release("pod1", releasedIP); err != nil {
+			t.Fatal(err)
+		}
+		if released, err := store.ListReleased(); err != nil || len(released) != 1 {
+			t.Fatalf("expect a released record, got %v, err %v", released, err)
+		}
+		if err := restarted.ConfigurePool(poolsWith(0)); err != nil {
+			t.Fatal(err)
+		}
+		if released, err := store.ListReleased(); err != nil || len(released) != 0 {
+			t.Fatalf("expect released record deleted, got %v, err %v", released, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"fmt"
+
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+// ErrQuotaExceeded is error when the namespace already holds as many ips as its quota in each available pool
+var ErrQuotaExceeded = fmt.Errorf("namespace floating ip quota exceeded")
+
+// AnyNamespace is the NamespaceQuotas key which applies to namespaces not listed
+const AnyNamespace = "*"
+
+// quota returns the max number of ips the namespace may hold in the pool, or -1 if it is unlimited.
+func (fip *FloatingIPPool) quota(namespace string) int {
+	if quota, ok := fip.NamespaceQuotas[namespace]; ok {
+		return quota
+	}
+	if quota, ok := fip.NamespaceQuotas[AnyNamespace]; ok {
+		return quota
+	}
+	return -1
+}
+
+// quotaTracker counts ips held by a namespace in each pool. A nil quotaTracker is unlimited.
+type quotaTracker struct {
+	namespace string
+	used      map[*FloatingIPPool]int
+}
+
+// newQuotaTracker counts ips held by the namespace of the key. It returns nil if the key has no namespace or no
+// pool has quotas. Allocated ips count against quota no matter what their release policy is, so ips reserved by
+// never or immutable release policy occupy quota until they are released. Ips held by a pool count against the
+// namespace which used them last.
+// Caller must hold cacheLock.
+func (ci *crdIpam) newQuotaTracker(key string) *quotaTracker {
+	if key == "" {
+		return nil
+	}
+	namespace := util.ParseKey(key).Namespace
+	if namespace == "" {
+		return nil
+	}
+	var limited bool
+	for _, pool := range ci.FloatingIPs {
+		if pool.quota(namespace) >= 0 {
+			limited = true
+			break
+		}
+	}
+	if !limited {
+		return nil
+	}
+	t := &quotaTracker{namespace: namespace, used: map[*FloatingIPPool]int{}}
+	for _, fip := range ci.allocatedFIPs {
+		if fip.namespace() == namespace {
+			t.used[fip.pool]++
+		}
+	}
+	return t
+}
+
+// namespace returns the namespace of the key, or the namespace owning the ip if the key has no namespace
+func (f *FloatingIP) namespace() string {
+	if namespace := util.ParseKey(f.Key).Namespace; namespace != "" {
+		return namespace
+	}
+	return f.Namespace
+}
+
+// ownerNamespace returns the namespace owning the ip after it's moved to newK, which is the namespace of the
+// previous key if newK has no namespace, e.g. an ip reserved by a pool after its pod is deleted.
+func (f *FloatingIP) ownerNamespace(newK string) string {
+	if util.ParseKey(newK).Namespace != "" {
+		return ""
+	}
+	return f.namespace()
+}
+
+// exceeded returns true if the namespace can't hold any more ip of the pool
+func (t *quotaTracker) exceeded(pool *FloatingIPPool) bool {
+	if t == nil {
+		return false
+	}
+	quota := pool.quota(t.namespace)
+	return quota >= 0 && t.used[pool] >= quota
+}
+
+// add counts an ip of the pool which is going to be allocated
+func (t *quotaTracker) add(pool *FloatingIPPool) {
+	if t != nil {
+		t.used[pool]++
+	}
+}
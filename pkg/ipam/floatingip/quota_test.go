@@ -0,0 +1,165 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+)
+
+func TestNamespaceQuota(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	for _, pool := range ipam.FloatingIPs {
+		if pool.IPNet().String() == node1IPNet.String() {
+			pool.NamespaceQuotas = map[string]int{"ns1": 2, AnyNamespace: 0}
+		}
+	}
+	// ips reserved by never release policy count against quota
+	if err := ipam.AllocateSpecificIP("sts_ns1_app_app-0", net.ParseIP("10.49.27.205"),
+		Attr{Policy: constant.ReleasePolicyNever}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.AllocateInSubnetsAndIPRange("sts_ns1_app_app-1", node1IPNet, nil, nil, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"sts_ns1_app_app-2", "sts_ns2_app_app-0"} {
+		if _, err := ipam.AllocateInSubnetsAndIPRange(key, node1IPNet, nil, nil, Attr{}); err != ErrQuotaExceeded {
+			t.Fatalf("expect quota exceeded error for %s, got %v", key, err)
+		}
+		subnets, err := ipam.NodeSubnetsByIPRanges(key, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subnets.Has(node1IPNet.String()) {
+			t.Fatalf("expect %s excluded from %v for %s", node1IPNet, subnets, key)
+		}
+		if count, ok := ipam.UnallocatedCountByNodeSubnet(key, nil, nil)[node1IPNet.String()]; ok {
+			t.Fatalf("expect no unallocated ips of %s for %s, got %d", node1IPNet, key, count)
+		}
+	}
+	subnets, err := ipam.NodeSubnetsByIPRanges("", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !subnets.Has(node1IPNet.String()) {
+		t.Fatalf("expect %s in %v if ignoring quota", node1IPNet, subnets)
+	}
+	// keys without namespace are not limited
+	if _, err := ipam.AllocateInSubnetsAndIPRange("pool__pool1_", node1IPNet, nil, nil, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Release("sts_ns1_app_app-0", net.ParseIP("10.49.27.205")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.AllocateInSubnetsAndIPRange("sts_ns1_app_app-2", node1IPNet, nil, nil, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNamespaceQuotaPool(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	for _, pool := range ipam.FloatingIPs {
+		if pool.IPNet().String() == node1IPNet.String() {
+			pool.NamespaceQuotas = map[string]int{AnyNamespace: 1}
+		}
+	}
+	if _, err := ipam.AllocateInSubnetsAndIPRange("sts_ns2_app_app-0", node1IPNet, nil, nil, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	poolKey, ns1Key := "pool__pool1_", "pool__pool1_dp_ns1_app_app-0"
+	if _, err := ipam.AllocateInSubnetsAndIPRange(ns1Key, node1IPNet, nil, nil, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	// the ip held by the pool after the pod is deleted still counts against the quota of ns1
+	if _, err := ipam.ReserveIP(ns1Key, poolKey, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	fips, err := ipam.store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fip := range fips {
+		if fip.Key == poolKey && fip.Namespace != "ns1" {
+			t.Fatalf("expect pool ip owned by ns1, got %v", fip.Namespace)
+		}
+	}
+	if _, err := ipam.AllocateInSubnetsAndIPRange("sts_ns1_app_app-0", node1IPNet, nil, nil,
+		Attr{}); err != ErrQuotaExceeded {
+		t.Fatalf("expect quota exceeded error, got %v", err)
+	}
+	// moving the pool ip to a pod of ns2 is limited by the quota of ns2
+	if err := ipam.AllocateInSubnetWithKey(poolKey, "pool__pool1_dp_ns2_app_app-0", node1IPNet.String(), nil,
+		Attr{}); err != ErrQuotaExceeded {
+		t.Fatalf("expect quota exceeded error, got %v", err)
+	}
+	if err := ipam.AllocateInSubnetWithKey(poolKey, "pool__pool1_dp_ns1_app_app-1", node1IPNet.String(), nil,
+		Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	ns2IP, err := ipam.First("sts_ns2_app_app-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.Release("sts_ns2_app_app-0", ns2IP.IP); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.ReserveIP("pool__pool1_dp_ns1_app_app-1", poolKey, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.AllocateInSubnetWithKey(poolKey, "pool__pool1_dp_ns2_app_app-0", node1IPNet.String(), nil,
+		Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	fip, err := ipam.First("pool__pool1_dp_ns2_app_app-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fip.Namespace != "" {
+		t.Fatalf("expect no owner namespace for a pod key, got %s", fip.Namespace)
+	}
+}
+
+func TestNamespaceQuotaConf(t *testing.T) {
+	var pool FloatingIPPool
+	conf := `{"routableSubnet":"10.49.27.0/24","ips":["10.49.27.205"],"subnet":"10.49.27.0/24",` +
+		`"gateway":"10.49.27.1","namespaceQuotas":{"ns1":2,"*":1}}`
+	if err := json.Unmarshal([]byte(conf), &pool); err != nil {
+		t.Fatal(err)
+	}
+	if pool.quota("ns1") != 2 || pool.quota("ns2") != 1 {
+		t.Fatalf("unexpected quotas %v", pool.NamespaceQuotas)
+	}
+	data, err := json.Marshal(&pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pool2 FloatingIPPool
+	if err := json.Unmarshal(data, &pool2); err != nil {
+		t.Fatal(err)
+	}
+	if pool2.quota("ns1") != 2 || pool2.quota("ns2") != 1 {
+		t.Fatalf("unexpected quotas %v", pool2.NamespaceQuotas)
+	}
+	conf = `{"routableSubnet":"10.49.27.0/24","ips":["10.49.27.205"],"subnet":"10.49.27.0/24",` +
+		`"gateway":"10.49.27.1","namespaceQuotas":{"ns1":-1}}`
+	if err := json.Unmarshal([]byte(conf), &pool); err == nil {
+		t.Fatal("expect error for negative quota")
+	}
+}
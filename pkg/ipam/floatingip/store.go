@@ -0,0 +1,119 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	glog "k8s.io/klog"
+)
+
+// Store persists allocated floating ips. Unallocated ips are never stored, they are computed from pool config.
+type Store interface {
+	// List returns all allocated floating ips, pool of the returned FloatingIP is only set for ips whose ip range is
+	// removed from config and is draining.
+	List() ([]*FloatingIP, error)
+	// Create stores an allocated floating ip with its labels and draining pool, it returns an error if the ip
+	// already exists unless it's a released record.
+	Create(*FloatingIP) error
+	// Update updates key, attr and draining pool of an allocated floating ip, labels are kept.
+	Update(*FloatingIP) error
+	// UpdateWithLabels updates key, attr and labels of an allocated floating ip in a single write, existing labels
+	// are replaced by the given ones.
+	UpdateWithLabels(*FloatingIP) error
+	// Delete deletes an allocated floating ip or a released record.
+	Delete(net.IP) error
+	// MarkReleased replaces an allocated floating ip with a released record of the release time, which keeps the
+	// release cooldown across restarts. Released records are not returned by List.
+	MarkReleased(ip net.IP, releasedAt time.Time) error
+	// ListReleased returns the release time of ips marked by MarkReleased, keyed by ip string. It may include ips
+	// which are allocated again since a store may keep released records until DeleteReleased.
+	ListReleased() (map[string]time.Time, error)
+	// DeleteReleased deletes released records of the ips, allocated ips are kept.
+	DeleteReleased(ips []net.IP) error
+}
+
+const (
+	// CrdStoreDriver stores each allocated ip as a FloatingIP crd
+	CrdStoreDriver = "crd"
+	// BoltStoreDriver stores allocated ips in a local bbolt file
+	BoltStoreDriver = "bolt"
+)
+
+// Migrate copies all allocated ips and released records from one store to another. Ips already existing in the
+// destination store are overwritten including their labels. Ips which only exist in the destination store are returned
+// as extra, they are deleted if prune is true. It returns the number of migrated ips.
+func Migrate(from, to Store, prune bool) (int, []*FloatingIP, error) {
+	fips, err := from.List()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to list source store: %v", err)
+	}
+	existing, err := to.List()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to list destination store: %v", err)
+	}
+	existSet := sets.NewString()
+	for i := range existing {
+		existSet.Insert(existing[i].IP.String())
+	}
+	sourceSet := sets.NewString()
+	for i, fip := range fips {
+		sourceSet.Insert(fip.IP.String())
+		if existSet.Has(fip.IP.String()) {
+			err = to.UpdateWithLabels(fip)
+		} else {
+			err = to.Create(fip)
+		}
+		if err != nil {
+			return i, nil, fmt.Errorf("failed to migrate %s: %v", fip.IP.String(), err)
+		}
+		glog.V(3).Infof("migrated %v", *fip)
+	}
+	// released records keep release cooldown of ips
+	released, err := from.ListReleased()
+	if err != nil {
+		return len(fips), nil, fmt.Errorf("failed to list released ips of source store: %v", err)
+	}
+	for ipStr, releasedAt := range released {
+		if sourceSet.Has(ipStr) || existSet.Has(ipStr) {
+			// allocated again or allocated in the destination store
+			continue
+		}
+		if err := to.MarkReleased(net.ParseIP(ipStr), releasedAt); err != nil {
+			return len(fips), nil, fmt.Errorf("failed to migrate released ip %s: %v", ipStr, err)
+		}
+		glog.V(3).Infof("migrated released ip %s at %v", ipStr, releasedAt)
+	}
+	var extra []*FloatingIP
+	for _, fip := range existing {
+		if sourceSet.Has(fip.IP.String()) {
+			continue
+		}
+		extra = append(extra, fip)
+		if !prune {
+			continue
+		}
+		if err := to.Delete(fip.IP); err != nil {
+			return len(fips), extra, fmt.Errorf("failed to prune %s: %v", fip.IP.String(), err)
+		}
+		glog.V(3).Infof("pruned %v", *fip)
+	}
+	return len(fips), extra, nil
+}
@@ -0,0 +1,213 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	glog "k8s.io/klog"
+)
+
+var fipBucket = []byte("floatingips")
+
+// boltStore stores allocated ips in a local bbolt file. It is suitable for single replica or test deployments.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// boltFIP is the persisted value of an allocated ip, the bucket key is the ip string
+type boltFIP struct {
+	Key        string            `json:"key"`
+	Policy     uint16            `json:"policy"`
+	NodeName   string            `json:"nodeName,omitempty"`
+	Uid        string            `json:"uid,omitempty"`
+	TTL        time.Duration     `json:"ttl,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Owner      string            `json:"owner,omitempty"`
+	Namespace  string            `json:"namespace,omitempty"`
+	UpdateTime time.Time         `json:"updateTime"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// DrainingPool is the draining pool of the ip whose ip range is removed from config
+	DrainingPool string `json:"drainingPool,omitempty"`
+	// Released is true for a released record whose UpdateTime is the release time
+	Released bool `json:"released,omitempty"`
+}
+
+// NewBoltStore opens or creates a bbolt file at path and returns a Store based on it
+func NewBoltStore(path string) (Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt db %s: %v", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(fipBucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) List() ([]*FloatingIP, error) {
+	var result []*FloatingIP
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(fipBucket).ForEach(func(k, v []byte) error {
+			ip := net.ParseIP(string(k))
+			if ip == nil {
+				glog.Warningf("invalid floating ip %s in bolt db", string(k))
+				return nil
+			}
+			var value boltFIP
+			if err := json.Unmarshal(v, &value); err != nil {
+				return fmt.Errorf("unmarshal %s: %v", string(k), err)
+			}
+			if value.Released {
+				return nil
+			}
+			fip := &FloatingIP{IP: ip, Key: value.Key, Policy: value.Policy, NodeName: value.NodeName,
+				PodUid: value.Uid, TTL: value.TTL, UpdatedAt: value.UpdateTime, Reason: value.Reason,
+				Owner: value.Owner, Namespace: value.Namespace, Labels: value.Labels}
+			if err := fip.restoreDrainingPool(value.DrainingPool); err != nil {
+				glog.Error(err)
+			}
+			result = append(result, fip)
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (s *boltStore) ListReleased() (map[string]time.Time, error) {
+	result := map[string]time.Time{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(fipBucket).ForEach(func(k, v []byte) error {
+			var value boltFIP
+			if err := json.Unmarshal(v, &value); err != nil {
+				return fmt.Errorf("unmarshal %s: %v", string(k), err)
+			}
+			if value.Released {
+				result[string(k)] = value.UpdateTime
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// MarkReleased replaces the ip with a released record
+func (s *boltStore) MarkReleased(ip net.IP, releasedAt time.Time) error {
+	glog.V(4).Infof("mark floatingIP %s released at %v", ip.String(), releasedAt)
+	data, err := json.Marshal(boltFIP{UpdateTime: releasedAt, Released: true})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(fipBucket).Put([]byte(ip.String()), data)
+	})
+}
+
+func (s *boltStore) DeleteReleased(ips []net.IP) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(fipBucket)
+		for _, ip := range ips {
+			key := []byte(ip.String())
+			v := bucket.Get(key)
+			if v == nil {
+				continue
+			}
+			var value boltFIP
+			if err := json.Unmarshal(v, &value); err != nil {
+				return fmt.Errorf("unmarshal %s: %v", ip.String(), err)
+			}
+			if !value.Released {
+				continue
+			}
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Create(fip *FloatingIP) error {
+	glog.V(4).Infof("create floatingIP %v", *fip)
+	return s.put(fip, false, false)
+}
+
+func (s *boltStore) Update(fip *FloatingIP) error {
+	glog.V(4).Infof("update floatingIP %v", *fip)
+	return s.put(fip, true, true)
+}
+
+func (s *boltStore) UpdateWithLabels(fip *FloatingIP) error {
+	glog.V(4).Infof("update floatingIP with labels %v", *fip)
+	return s.put(fip, true, false)
+}
+
+func (s *boltStore) put(fip *FloatingIP, update, keepLabels bool) error {
+	value := boltFIP{Key: fip.Key, Policy: fip.Policy, NodeName: fip.NodeName, Uid: fip.PodUid, TTL: fip.TTL,
+		Reason: fip.Reason, Owner: fip.Owner, Namespace: fip.Namespace, UpdateTime: fip.UpdatedAt, Labels: fip.Labels}
+	var err error
+	if value.DrainingPool, err = fip.drainingPoolData(); err != nil {
+		return err
+	}
+	key := []byte(fip.IP.String())
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(fipBucket)
+		existing := bucket.Get(key)
+		var old boltFIP
+		if existing != nil {
+			if err := json.Unmarshal(existing, &old); err != nil {
+				return fmt.Errorf("unmarshal %s: %v", fip.IP.String(), err)
+			}
+		}
+		if update {
+			if existing == nil {
+				return fmt.Errorf("floatingIP %s not found", fip.IP.String())
+			}
+			if keepLabels {
+				// labels are kept on update as the crd store does
+				value.Labels = old.Labels
+			}
+		} else if existing != nil && !old.Released {
+			return fmt.Errorf("floatingIP %s already exists", fip.IP.String())
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, data)
+	})
+}
+
+func (s *boltStore) Delete(ip net.IP) error {
+	glog.V(4).Infof("delete floatingIP %s", ip.String())
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(fipBucket).Delete([]byte(ip.String()))
+	})
+}
+
+// Close closes the bolt db
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
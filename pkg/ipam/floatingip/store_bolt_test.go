@@ -0,0 +1,184 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/utils"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+func createTestBoltIPAM(t *testing.T, path string) *crdIpam {
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipam := NewStoreIPAM(store).(*crdIpam)
+	var conf struct {
+		Floatingips []*FloatingIPPool `json:"floatingips"`
+	}
+	if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.ConfigurePool(conf.Floatingips); err != nil {
+		t.Fatal(err)
+	}
+	return ipam
+}
+
+func TestBoltStore(t *testing.T) {
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "ipam.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.(*boltStore).Close()
+	fip := &FloatingIP{IP: net.ParseIP("10.49.27.205"), Key: "pod1", Policy: 1, NodeName: "node1", PodUid: "uid1",
+		UpdatedAt: time.Now().Truncate(time.Second), Labels: map[string]string{constant.ReserveFIPLabel: ""}}
+	if err := store.Update(fip); err == nil {
+		t.Fatal("expect an error updating a not existing ip")
+	}
+	if err := store.Create(fip); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(fip); err == nil {
+		t.Fatal("expect an error creating an existing ip")
+	}
+	if err := store.Update(fip.CloneWith("pod2", &Attr{NodeName: "node2"}, fip.UpdatedAt)); err != nil {
+		t.Fatal(err)
+	}
+	fips, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fips) != 1 {
+		t.Fatalf("expect 1 ip, got %v", fips)
+	}
+	if fips[0].String() != "FloatingIP{ip:10.49.27.205 key:pod2 policy:0 nodeName:node2 podUid:}" ||
+		!fips[0].UpdatedAt.Equal(fip.UpdatedAt) {
+		t.Fatalf("unexpected ip %v", fips[0])
+	}
+	if _, ok := fips[0].Labels[constant.ReserveFIPLabel]; !ok {
+		t.Fatalf("expect labels are kept on update, got %v", fips[0].Labels)
+	}
+	if err := store.Delete(fip.IP); err != nil {
+		t.Fatal(err)
+	}
+	if fips, err := store.List(); err != nil || len(fips) != 0 {
+		t.Fatalf("expect no ip, got %v, err %v", fips, err)
+	}
+}
+
+func TestBoltIPAMPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipam.db")
+	ipam := createTestBoltIPAM(t, path)
+	ip, err := ipam.AllocateInSubnet("pod1", node1IPNet, nets.IPv4Family, Attr{Policy: constant.ReleasePolicyNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipam.Shutdown()
+
+	ipam = createTestBoltIPAM(t, path)
+	defer ipam.Shutdown()
+	fip, err := ipam.ByIP(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fip.Key != "pod1" || fip.Policy != uint16(constant.ReleasePolicyNever) {
+		t.Fatalf("unexpected ip %v", fip)
+	}
+	if err := ipam.Release("pod1", ip); err != nil {
+		t.Fatal(err)
+	}
+	if fips, err := ipam.store.List(); err != nil || len(fips) != 0 {
+		t.Fatalf("expect no ip, got %v, err %v", fips, err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	crdIPAM, _ := CreateTestIPAM(t)
+	ip, err := crdIPAM.AllocateInSubnet("pod1", node1IPNet, nets.IPv4Family, Attr{Policy: constant.ReleasePolicyNever,
+		NodeName: "node1", Uid: "uid1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "ipam.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.(*boltStore).Close()
+	extraIP := net.ParseIP("10.0.0.1")
+	if err := store.Create(&FloatingIP{IP: extraIP, Key: "pod2"}); err != nil {
+		t.Fatal(err)
+	}
+	// migrating twice should overwrite existing ips
+	for i := 0; i < 2; i++ {
+		n, extra, err := Migrate(crdIPAM.store, store, false)
+		if err != nil || n != 1 {
+			t.Fatalf("expect 1 ip migrated, got %d, err %v", n, err)
+		}
+		if len(extra) != 1 || !extra[0].IP.Equal(extraIP) {
+			t.Fatalf("expect extra ip %s, got %v", extraIP, extra)
+		}
+	}
+	fips, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fips) != 2 {
+		t.Fatalf("expect extra ip kept, got %v", fips)
+	}
+	// labels of existing ips are overwritten and extra ips are pruned
+	if err := crdIPAM.Reserve(ip, "pod1", false, Attr{Reason: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Migrate(crdIPAM.store, store, true); err != nil {
+		t.Fatal(err)
+	}
+	if fips, err = store.List(); err != nil {
+		t.Fatal(err)
+	}
+	if len(fips) != 1 || !fips[0].IP.Equal(ip) || fips[0].Key != ReservedKey || fips[0].Reason != "test" {
+		t.Fatalf("unexpected migrated ips %v", fips)
+	}
+	if _, ok := fips[0].Labels[constant.ReserveFIPLabel]; !ok {
+		t.Fatalf("expect reserve label migrated, got %v", fips[0].Labels)
+	}
+	// released records are migrated to keep release cooldown
+	releasedIP, releasedAt := net.ParseIP("10.49.27.205"), time.Now()
+	if releasedIP.Equal(ip) {
+		releasedIP = net.ParseIP("10.49.27.216")
+	}
+	if err := crdIPAM.store.MarkReleased(releasedIP, releasedAt); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Migrate(crdIPAM.store, store, false); err != nil {
+		t.Fatal(err)
+	}
+	released, err := store.ListReleased()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 1 || !released[releasedIP.String()].Equal(releasedAt) {
+		t.Fatalf("expect released ip %s at %v, got %v", releasedIP, releasedAt, released)
+	}
+}
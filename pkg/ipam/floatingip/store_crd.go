@@ -18,70 +18,289 @@ package floatingip
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
+	"reflect"
+	"strings"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 	glog "k8s.io/klog"
 
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	galaxyv1 "tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1"
 	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	crd_clientset "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned"
 )
 
-func (ci *crdIpam) listFloatingIPs() (*v1alpha1.FloatingIPList, error) {
-	fips, err := ci.client.GalaxyV1alpha1().FloatingIPs().List(context.TODO(), metav1.ListOptions{})
+const (
+	// drainingPoolAnnotation persists the draining pool of an ip whose ip range is removed from config
+	drainingPoolAnnotation = "galaxy.k8s.io/draining-pool"
+	// ReleasedConfigMapName is the ConfigMap recording release time of ips, keyed by FIPName
+	ReleasedConfigMapName = "floatingip-released"
+)
+
+// crdStore stores each allocated ip as a FloatingIP crd named by FIPName. Release time of released ips is kept in
+// ReleasedConfigMapName of the namespace, so that released ips don't show up as FloatingIPs.
+type crdStore struct {
+	client     crd_clientset.Interface
+	kubeClient kubernetes.Interface
+	namespace  string
+}
+
+// NewCrdStore creates a Store based on FloatingIP crd which records release time of ips in a ConfigMap of the
+// namespace
+func NewCrdStore(client crd_clientset.Interface, kubeClient kubernetes.Interface, namespace string) Store {
+	return &crdStore{client: client, kubeClient: kubeClient, namespace: namespace}
+}
+
+func (s *crdStore) List() ([]*FloatingIP, error) {
+	fips, err := s.client.GalaxyV1alpha1().FloatingIPs().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
-	return fips, nil
+	var result []*FloatingIP
+	for i := range fips.Items {
+		ip := ParseFIPName(fips.Items[i].Name)
+		if ip == nil {
+			glog.Warningf("invalid FloatingIP crd name %s", fips.Items[i].Name)
+			continue
+		}
+		result = append(result, fromFIPCrd(ip, &fips.Items[i]))
+	}
+	return result, nil
+}
+
+func (s *crdStore) ListReleased() (map[string]time.Time, error) {
+	result := map[string]time.Time{}
+	cm, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), ReleasedConfigMapName,
+		metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for name, value := range cm.Data {
+		ip := ParseFIPName(name)
+		if ip == nil {
+			glog.Warningf("invalid ip %s in ConfigMap %s", name, ReleasedConfigMapName)
+			continue
+		}
+		releasedAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			glog.Warningf("invalid release time %s of %s: %v", value, name, err)
+			continue
+		}
+		result[ip.String()] = releasedAt
+	}
+	return result, nil
+}
+
+// updateReleased updates ReleasedConfigMapName with the given function, it creates the ConfigMap if it doesn't exist
+func (s *crdStore) updateReleased(update func(data map[string]string)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.kubeClient.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), ReleasedConfigMapName,
+			metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ReleasedConfigMapName, Namespace: s.namespace}}
+			update(ensureData(cm))
+			_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// retry with the created one
+				return apierrors.NewConflict(corev1.Resource("configmaps"), ReleasedConfigMapName, err)
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+		update(ensureData(cm))
+		_, err = s.kubeClient.CoreV1().ConfigMaps(s.namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func ensureData(cm *corev1.ConfigMap) map[string]string {
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	return cm.Data
 }
 
-func (ci *crdIpam) createFloatingIP(allocated *FloatingIP) error {
+func (s *crdStore) Create(allocated *FloatingIP) error {
 	glog.V(4).Infof("create floatingIP %v", *allocated)
-	fip := ci.newFIPCrd(allocated.IP.String())
+	fip := newFIPCrd(FIPName(allocated.IP))
 	if err := assign(fip, allocated); err != nil {
 		return err
 	}
-	if _, err := ci.client.GalaxyV1alpha1().FloatingIPs().Create(context.TODO(), fip, metav1.CreateOptions{}); err != nil {
-		return err
+	for k, v := range allocated.Labels {
+		fip.Labels[k] = v
 	}
-	return nil
+	setSelectionLabels(fip, allocated)
+	_, err := s.client.GalaxyV1alpha1().FloatingIPs().Create(context.TODO(), fip, metav1.CreateOptions{})
+	return err
 }
 
-func (ci *crdIpam) deleteFloatingIP(name string) error {
+// Delete deletes the FloatingIP crd of the given ip
+func (s *crdStore) Delete(ip net.IP) error {
+	name := FIPName(ip)
 	glog.V(4).Infof("delete floatingIP name %s", name)
-	return ci.client.GalaxyV1alpha1().FloatingIPs().Delete(context.TODO(), name, metav1.DeleteOptions{})
+	return s.client.GalaxyV1alpha1().FloatingIPs().Delete(context.TODO(), name, metav1.DeleteOptions{})
+}
+
+// MarkReleased records the release time of the ip in ReleasedConfigMapName, then deletes its FloatingIP crd
+func (s *crdStore) MarkReleased(ip net.IP, releasedAt time.Time) error {
+	glog.V(4).Infof("mark floatingIP %s released at %v", ip.String(), releasedAt)
+	if err := s.updateReleased(func(data map[string]string) {
+		data[FIPName(ip)] = releasedAt.Format(time.RFC3339Nano)
+	}); err != nil {
+		return err
+	}
+	err := s.client.GalaxyV1alpha1().FloatingIPs().Delete(context.TODO(), FIPName(ip), metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// DeleteReleased deletes release time of the ips from ReleasedConfigMapName
+func (s *crdStore) DeleteReleased(ips []net.IP) error {
+	if len(ips) == 0 {
+		return nil
+	}
+	return s.updateReleased(func(data map[string]string) {
+		for _, ip := range ips {
+			delete(data, FIPName(ip))
+		}
+	})
 }
 
-func (ci *crdIpam) updateFloatingIP(toUpdate *FloatingIP) error {
+func (s *crdStore) Update(toUpdate *FloatingIP) error {
 	glog.V(4).Infof("update floatingIP %v", *toUpdate)
-	fip, err := ci.client.GalaxyV1alpha1().FloatingIPs().Get(context.TODO(), toUpdate.IP.String(), metav1.GetOptions{})
+	return s.update(toUpdate, true)
+}
+
+func (s *crdStore) UpdateWithLabels(toUpdate *FloatingIP) error {
+	glog.V(4).Infof("update floatingIP with labels %v", *toUpdate)
+	return s.update(toUpdate, false)
+}
+
+func (s *crdStore) update(toUpdate *FloatingIP, keepLabels bool) error {
+	fip, err := s.client.GalaxyV1alpha1().FloatingIPs().Get(context.TODO(), FIPName(toUpdate.IP), metav1.GetOptions{})
 	if err != nil {
 		return err
 	}
 	if err := assign(fip, toUpdate); err != nil {
 		return err
 	}
-	_, err = ci.client.GalaxyV1alpha1().FloatingIPs().Update(context.TODO(), fip, metav1.UpdateOptions{})
+	if !keepLabels {
+		fip.Labels = map[string]string{}
+		for k, v := range toUpdate.Labels {
+			fip.Labels[k] = v
+		}
+	}
+	setSelectionLabels(fip, toUpdate)
+	_, err = s.client.GalaxyV1alpha1().FloatingIPs().Update(context.TODO(), fip, metav1.UpdateOptions{})
 	return err
 }
 
+// fromFIPCrd converts a FloatingIP crd to FloatingIP, selection labels are dropped since they are resolved from key
+// and attr
+func fromFIPCrd(ip net.IP, crd *v1alpha1.FloatingIP) *FloatingIP {
+	fip := &FloatingIP{IP: ip, Key: crd.Spec.Key, Policy: uint16(crd.Spec.Policy), UpdatedAt: crd.Spec.UpdateTime.Time}
+	for k, v := range crd.Labels {
+		if galaxyv1.IsSelectionLabel(k) {
+			continue
+		}
+		if fip.Labels == nil {
+			fip.Labels = map[string]string{}
+		}
+		fip.Labels[k] = v
+	}
+	if err := fip.unmarshalAttr(crd.Spec.Attribute); err != nil {
+		glog.Error(err)
+	}
+	if err := fip.restoreDrainingPool(crd.Annotations[drainingPoolAnnotation]); err != nil {
+		glog.Error(err)
+	}
+	return fip
+}
+
 func assign(spec *v1alpha1.FloatingIP, f *FloatingIP) error {
 	spec.Spec.Key = f.Key
 	spec.Spec.Policy = constant.ReleasePolicy(f.Policy)
 	data, err := json.Marshal(Attr{
-		NodeName: f.NodeName,
-		Uid:      f.PodUid,
+		NodeName:  f.NodeName,
+		Uid:       f.PodUid,
+		TTL:       f.TTL,
+		Reason:    f.Reason,
+		Owner:     f.Owner,
+		Namespace: f.Namespace,
 	})
 	if err != nil {
 		return err
 	}
 	spec.Spec.Attribute = string(data)
 	spec.Spec.UpdateTime = metav1.NewTime(f.UpdatedAt)
+	pool, err := f.drainingPoolData()
+	if err != nil {
+		return err
+	}
+	if pool == "" {
+		delete(spec.Annotations, drainingPoolAnnotation)
+	} else {
+		if spec.Annotations == nil {
+			spec.Annotations = map[string]string{}
+		}
+		spec.Annotations[drainingPoolAnnotation] = pool
+	}
 	return nil
 }
 
+// setSelectionLabels sets labels of the pool, workload and node of f on the FloatingIP crd
+func setSelectionLabels(crd *v1alpha1.FloatingIP, f *FloatingIP) {
+	spec := galaxyv1.FloatingIPSpec{Node: f.NodeName}
+	galaxyv1.ResolveKey(f.Key, &spec)
+	if spec.Namespace == "" {
+		spec.Namespace = f.Namespace
+	}
+	galaxyv1.SetSelectionLabels(&crd.ObjectMeta, &spec)
+}
+
+// EnsureSelectionLabels sets selection labels on FloatingIP crds written before galaxy-ipam labels them and returns
+// the number of relabeled ones. FloatingIPs changed concurrently are skipped since writing them sets the labels.
+func EnsureSelectionLabels(client crd_clientset.Interface) (int, error) {
+	fips, err := client.GalaxyV1alpha1().FloatingIPs().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	var relabeled int
+	for i := range fips.Items {
+		ip := ParseFIPName(fips.Items[i].Name)
+		if ip == nil {
+			continue
+		}
+		labeled := fips.Items[i].DeepCopy()
+		setSelectionLabels(labeled, fromFIPCrd(ip, &fips.Items[i]))
+		if reflect.DeepEqual(nonNilLabels(labeled.Labels), nonNilLabels(fips.Items[i].Labels)) {
+			continue
+		}
+		_, err := client.GalaxyV1alpha1().FloatingIPs().Update(context.TODO(), labeled, metav1.UpdateOptions{})
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return relabeled, err
+		}
+		relabeled++
+	}
+	return relabeled, nil
+}
+
 // handleFIPAssign handles add event for manually created reserved ips
 func (ci *crdIpam) handleFIPAssign(obj interface{}) error {
 	fip, err := checkForReserved(obj)
@@ -91,10 +310,14 @@ func (ci *crdIpam) handleFIPAssign(obj interface{}) error {
 	if fip == nil {
 		return nil
 	}
-	ipStr := fip.Name
+	ipStr := ParseFIPName(fip.Name).String()
 	ci.cacheLock.Lock()
 	defer ci.cacheLock.Unlock()
 	if val, ok := ci.allocatedFIPs[ipStr]; ok {
+		if val.Key == fip.Spec.Key {
+			// reserved by Reserve which has synced the cache
+			return nil
+		}
 		return fmt.Errorf("%s already been allocated to %s", ipStr, val.Key)
 	}
 	unallocated, ok := ci.unallocatedFIPs[ipStr]
@@ -102,6 +325,9 @@ func (ci *crdIpam) handleFIPAssign(obj interface{}) error {
 		return fmt.Errorf("there is no ip %s in unallocated map", ipStr)
 	}
 	unallocated.Assign(fip.Spec.Key, &Attr{Policy: fip.Spec.Policy}, time.Now())
+	if err := unallocated.unmarshalAttr(fip.Spec.Attribute); err != nil {
+		glog.Warning(err)
+	}
 	unallocated.Labels = map[string]string{constant.ReserveFIPLabel: ""}
 	ci.syncCacheAfterCreate(unallocated)
 	glog.Infof("reserved ip %s", ipStr)
@@ -117,12 +343,14 @@ func (ci *crdIpam) handleFIPUnassign(obj interface{}) error {
 	if fip == nil {
 		return nil
 	}
-	ipStr := fip.Name
+	ipStr := ParseFIPName(fip.Name).String()
 	ci.cacheLock.Lock()
 	defer ci.cacheLock.Unlock()
 	allocated, ok := ci.allocatedFIPs[ipStr]
-	if !ok {
-		return fmt.Errorf("%s already been released", ipStr)
+	if !ok || allocated.Key != fip.Spec.Key {
+		// released by Unreserve which has synced the cache, and may have been allocated again
+		glog.V(3).Infof("%s already been released", ipStr)
+		return nil
 	}
 	ci.syncCacheAfterDel(allocated)
 	glog.Infof("released reserved ip %s", ipStr)
@@ -140,13 +368,31 @@ func checkForReserved(obj interface{}) (*v1alpha1.FloatingIP, error) {
 	return fip, nil
 }
 
-func (ci *crdIpam) newFIPCrd(name string) *v1alpha1.FloatingIP {
-	return newFIPCrd(name)
-}
-
 func newFIPCrd(name string) *v1alpha1.FloatingIP {
 	return &v1alpha1.FloatingIP{
 		TypeMeta:   metav1.TypeMeta{Kind: constant.ResourceKind, APIVersion: constant.ApiVersion},
 		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
 	}
 }
+
+// FIPName returns the FloatingIP crd name of an ip. Since colons are not allowed in object names, an ipv6 is
+// formatted as 8 groups of 4 hex digits separated by dashes, e.g. 2001-0db8-0000-0000-0000-0000-0000-0001
+func FIPName(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.String()
+	}
+	ip = ip.To16()
+	if ip == nil {
+		return ""
+	}
+	groups := make([]string, 0, net.IPv6len/2)
+	for i := 0; i < net.IPv6len; i += 2 {
+		groups = append(groups, hex.EncodeToString(ip[i:i+2]))
+	}
+	return strings.Join(groups, "-")
+}
+
+// ParseFIPName parses an ip from the FloatingIP crd name, returns nil if it's invalid
+func ParseFIPName(name string) net.IP {
+	return net.ParseIP(strings.Replace(name, "-", ":", -1))
+}
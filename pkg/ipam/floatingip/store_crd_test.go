@@ -26,7 +26,10 @@ import (
 
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	galaxyv1 "tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1"
+	fakeGalaxyCli "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned/fake"
 )
 
 func TestAddFloatingIPEventByUser(t *testing.T) {
@@ -40,12 +43,12 @@ func TestAddFloatingIPEventByUser(t *testing.T) {
 		Policy:    0,
 		UpdatedAt: time.Now(),
 	}
-	fipCrd := ipam.newFIPCrd(fip.IP.String())
+	fipCrd := newFIPCrd(fip.IP.String())
 	fipCrd.Labels[constant.ReserveFIPLabel] = ""
 	if err := assign(fipCrd, fip); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := ipam.client.GalaxyV1alpha1().FloatingIPs().Create(context.Background(), fipCrd, v1.CreateOptions{}); err != nil {
+	if _, err := ipam.store.(*crdStore).client.GalaxyV1alpha1().FloatingIPs().Create(context.Background(), fipCrd, v1.CreateOptions{}); err != nil {
 		t.Fatal(err)
 	}
 	if err := waitFor(ipam, fip.IP, fip.Key, true, node1IPNet.String()); err != nil {
@@ -53,7 +56,7 @@ func TestAddFloatingIPEventByUser(t *testing.T) {
 	}
 
 	// test if an ip is not in within test config range
-	fipCrd = ipam.newFIPCrd("172.16.1.145")
+	fipCrd = newFIPCrd("172.16.1.145")
 	fipCrd.Labels[constant.ReserveFIPLabel] = ""
 	if err := ipam.handleFIPAssign(fipCrd); err == nil || err.Error() !=
 		fmt.Sprintf("there is no ip %s in unallocated map", fipCrd.Name) {
@@ -87,7 +90,7 @@ func waitFor(ipam *crdIpam, ip net.IP, key string, expectReserveLabel bool, expe
 
 func TestAddFloatingIPEventByIPAM(t *testing.T) {
 	ipam := createTestCrdIPAM(t)
-	fipCrd := ipam.newFIPCrd("10.49.27.205")
+	fipCrd := newFIPCrd("10.49.27.205")
 	fipCrd.Spec.Key = "pool__reserved-for-pod_"
 	if err := ipam.handleFIPAssign(fipCrd); err != nil {
 		t.Fatal(err)
@@ -104,11 +107,11 @@ func TestDeleteFloatingIPEvent(t *testing.T) {
 	go informerFactory.Start(stop)
 	defer func() { close(stop) }()
 
-	fipCrd := ipam.newFIPCrd("10.49.27.205")
+	fipCrd := newFIPCrd("10.49.27.205")
 	ip := net.ParseIP(fipCrd.Name)
 	fipCrd.Labels[constant.ReserveFIPLabel] = ""
 	fipCrd.Spec.Key = "pool__reserved-for-node_"
-	if _, err := ipam.client.GalaxyV1alpha1().FloatingIPs().Create(context.Background(), fipCrd, v1.CreateOptions{}); err != nil {
+	if _, err := ipam.store.(*crdStore).client.GalaxyV1alpha1().FloatingIPs().Create(context.Background(), fipCrd, v1.CreateOptions{}); err != nil {
 		t.Fatal(err)
 	}
 	if err := waitFor(ipam, ip, fipCrd.Spec.Key, true, node1IPNet.String()); err != nil {
@@ -125,10 +128,82 @@ func TestDeleteFloatingIPEvent(t *testing.T) {
 
 	// test if an event is created by user, deleteFloatingIPEvent should handle it
 	fipCrd.Labels[constant.ReserveFIPLabel] = ""
-	if err := ipam.client.GalaxyV1alpha1().FloatingIPs().Delete(context.Background(), fipCrd.Name, v1.DeleteOptions{}); err != nil {
+	if err := ipam.store.(*crdStore).client.GalaxyV1alpha1().FloatingIPs().Delete(context.Background(), fipCrd.Name, v1.DeleteOptions{}); err != nil {
 		t.Fatal(err)
 	}
 	if err := waitFor(ipam, ip, "", false, node1IPNet.String()); err != nil {
 		t.Fatal(err)
 	}
 }
+
+func TestEnsureSelectionLabels(t *testing.T) {
+	// FloatingIPs written before selection labels are introduced
+	unlabeled := newFIPCrd("10.49.27.205")
+	if err := assign(unlabeled, &FloatingIP{IP: net.ParseIP(unlabeled.Name), Key: "dp_ns1_dp1_dp1-xx-xx",
+		NodeName: "node1"}); err != nil {
+		t.Fatal(err)
+	}
+	unlabeled.Labels[constant.ReserveFIPLabel] = ""
+	client := fakeGalaxyCli.NewSimpleClientset(unlabeled)
+	for _, expect := range []int{1, 0} {
+		relabeled, err := EnsureSelectionLabels(client)
+		if err != nil || relabeled != expect {
+			t.Fatalf("expect %d relabeled, got %d, err %v", expect, relabeled, err)
+		}
+	}
+	fip, err := client.GalaxyV1alpha1().FloatingIPs().Get(context.Background(), unlabeled.Name, v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{galaxyv1.LabelWorkloadKind: galaxyv1.KindDeployment,
+		galaxyv1.LabelNamespace: "ns1", galaxyv1.LabelWorkload: "dp1", galaxyv1.LabelNode: "node1",
+		constant.ReserveFIPLabel: ""} {
+		if value, ok := fip.Labels[k]; !ok || value != v {
+			t.Fatalf("expect label %s=%s, got %v", k, v, fip.Labels)
+		}
+	}
+}
+
+func TestCrdStoreReleased(t *testing.T) {
+	ip, releasedAt := net.ParseIP("10.49.27.205"), time.Now()
+	kubeClient := fake.NewSimpleClientset()
+	store := NewCrdStore(fakeGalaxyCli.NewSimpleClientset(), kubeClient, "kube-system")
+	if err := store.Create(&FloatingIP{IP: ip, Key: "pod1"}); err != nil {
+		t.Fatal(err)
+	}
+	// a released ip is no longer a FloatingIP
+	if err := store.MarkReleased(ip, releasedAt); err != nil {
+		t.Fatal(err)
+	}
+	if fips, err := store.List(); err != nil || len(fips) != 0 {
+		t.Fatalf("expect no FloatingIP, got %v, err %v", fips, err)
+	}
+	cm, err := kubeClient.CoreV1().ConfigMaps("kube-system").Get(context.Background(), ReleasedConfigMapName,
+		v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cm.Data) != 1 {
+		t.Fatalf("expect release time recorded, got %v", cm.Data)
+	}
+	released, err := store.ListReleased()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(released) != 1 || !released[ip.String()].Equal(releasedAt) {
+		t.Fatalf("expect %s released at %v, got %v", ip, releasedAt, released)
+	}
+	// allocating the ip again keeps its released record until it's deleted
+	if err := store.Create(&FloatingIP{IP: ip, Key: "pod2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteReleased([]net.IP{ip}); err != nil {
+		t.Fatal(err)
+	}
+	if released, err := store.ListReleased(); err != nil || len(released) != 0 {
+		t.Fatalf("expect released record deleted, got %v, err %v", released, err)
+	}
+	if fips, err := store.List(); err != nil || len(fips) != 1 || fips[0].Key != "pod2" {
+		t.Fatalf("expect allocated ip kept, got %v, err %v", fips, err)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
 	fakeGalaxyCli "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned/fake"
 	crdInformer "tkestack.io/galaxy/pkg/ipam/client/informers/externalversions"
 	"tkestack.io/galaxy/pkg/ipam/utils"
@@ -31,7 +32,7 @@ func CreateTestIPAM(t *testing.T, objs ...runtime.Object) (*crdIpam, crdInformer
 	galaxyCli := fakeGalaxyCli.NewSimpleClientset(objs...)
 	crdInformerFactory := crdInformer.NewSharedInformerFactory(galaxyCli, 0)
 	fipInformer := crdInformerFactory.Galaxy().V1alpha1().FloatingIPs()
-	crdIPAM := NewCrdIPAM(galaxyCli, fipInformer).(*crdIpam)
+	crdIPAM := NewCrdIPAM(galaxyCli, fake.NewSimpleClientset(), "kube-system", fipInformer).(*crdIpam)
 	var conf struct {
 		Floatingips []*FloatingIPPool `json:"floatingips"`
 	}
@@ -0,0 +1,170 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"math"
+	"net"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// States of allocated ips, each allocated ip is in one of them
+const (
+	// StateAllocated is the state of ips bound to pods
+	StateAllocated = "allocated"
+	// StateReserved is the state of ips with constant.ReserveFIPLabel
+	StateReserved = "reserved"
+	// StateHeld is the state of ips bound to no pods, e.g. kept by release policy after pods are deleted or
+	// pre-allocated by pools
+	StateHeld = "held"
+)
+
+// State returns the state of an allocated ip
+func (f *FloatingIP) State() string {
+	if _, ok := f.Labels[constant.ReserveFIPLabel]; ok {
+		return StateReserved
+	}
+	if f.PodUid == "" {
+		return StateHeld
+	}
+	return StateAllocated
+}
+
+// SubnetUsage is the ip usage of a FloatingIPPool
+type SubnetUsage struct {
+	Subnet      *net.IPNet
+	IPRanges    []nets.IPRange
+	NodeSubnets []*net.IPNet
+	Draining    bool
+	// Total is the number of ips in IPRanges, it's 0 for draining pools. It is math.MaxUint64 if there are more ips,
+	// e.g. an ipv6 range of a /64 subnet.
+	Total uint64
+	// Allocated, Reserved and Held are the number of allocated ips in each state
+	Allocated int
+	Reserved  int
+	Held      int
+	// Free is the number of unallocated ips, it's 0 for draining pools
+	Free uint64
+}
+
+// Used returns the number of allocated ips in any state
+func (u *SubnetUsage) Used() int {
+	return u.Allocated + u.Reserved + u.Held
+}
+
+// SubnetUsages returns the ip usage of each configured pool followed by draining pools.
+func (ci *crdIpam) SubnetUsages() []SubnetUsage {
+	ci.cacheLock.RLock()
+	defer ci.cacheLock.RUnlock()
+	pools := append(append([]*FloatingIPPool{}, ci.FloatingIPs...), ci.drainingPools...)
+	usages := make([]SubnetUsage, len(pools))
+	index := make(map[*FloatingIPPool]*SubnetUsage, len(pools))
+	for i, pool := range pools {
+		usages[i] = SubnetUsage{Subnet: pool.IPNet(), IPRanges: pool.IPRanges, NodeSubnets: pool.NodeSubnets,
+			Draining: pool.draining}
+		if !pool.draining {
+			usages[i].Total = pool.Size()
+		}
+		index[pool] = &usages[i]
+	}
+	for _, fip := range ci.allocatedFIPs {
+		u, ok := index[fip.pool]
+		if !ok {
+			continue
+		}
+		switch fip.State() {
+		case StateReserved:
+			u.Reserved++
+		case StateHeld:
+			u.Held++
+		default:
+			u.Allocated++
+		}
+	}
+	for i := range usages {
+		if used := uint64(usages[i].Used()); !usages[i].Draining && usages[i].Total > used {
+			usages[i].Free = usages[i].Total - used
+		}
+	}
+	return usages
+}
+
+// usageLabels are the labels of allocated ips counted by ipUsageDesc
+type usageLabels struct {
+	subnet, pool, namespace, policy, state string
+}
+
+// policyLabel returns the name of the release policy
+func policyLabel(policy uint16) string {
+	switch constant.ReleasePolicy(policy) {
+	case constant.ReleasePolicyImmutable, constant.ReleasePolicyNever, constant.ReleasePolicyTTL:
+		return constant.PolicyStr(constant.ReleasePolicy(policy))
+	default:
+		return "podDelete"
+	}
+}
+
+// collectUsage sends the number of allocated ips by subnet, pool, namespace, release policy and state, and the
+// total, free and exhaustion ratio of each subnet to ch. Pools sharing the same subnet are summed up.
+func (ci *crdIpam) collectUsage(ch chan<- prometheus.Metric) {
+	counts := map[usageLabels]int{}
+	ci.cacheLock.RLock()
+	for _, fip := range ci.allocatedFIPs {
+		subnet := fip.Subnet()
+		if subnet == nil {
+			continue
+		}
+		keyObj := util.ParseKey(fip.Key)
+		counts[usageLabels{subnet: subnet.String(), pool: keyObj.PoolName, namespace: keyObj.Namespace,
+			policy: policyLabel(fip.Policy), state: fip.State()}]++
+	}
+	ci.cacheLock.RUnlock()
+	for l, count := range counts {
+		ch <- prometheus.MustNewConstMetric(ci.ipUsageDesc, prometheus.GaugeValue, float64(count), l.subnet, l.pool,
+			l.namespace, l.policy, l.state)
+	}
+	total, free := map[string]uint64{}, map[string]uint64{}
+	for _, u := range ci.SubnetUsages() {
+		if u.Draining {
+			continue
+		}
+		total[u.Subnet.String()] = addUint64(total[u.Subnet.String()], u.Total)
+		free[u.Subnet.String()] = addUint64(free[u.Subnet.String()], u.Free)
+	}
+	for subnet := range total {
+		ch <- prometheus.MustNewConstMetric(ci.subnetTotalDesc, prometheus.GaugeValue, float64(total[subnet]), subnet)
+		ch <- prometheus.MustNewConstMetric(ci.subnetFreeDesc, prometheus.GaugeValue, float64(free[subnet]), subnet)
+		var ratio float64
+		if total[subnet] > free[subnet] {
+			ratio = float64(total[subnet]-free[subnet]) / float64(total[subnet])
+		}
+		ch <- prometheus.MustNewConstMetric(ci.exhaustionRatioDesc, prometheus.GaugeValue, math.Min(ratio, 1),
+			subnet)
+	}
+}
+
+// addUint64 returns a+b, or math.MaxUint64 if it overflows
+func addUint64(a, b uint64) uint64 {
+	if a+b < a {
+		return math.MaxUint64
+	}
+	return a + b
+}
@@ -0,0 +1,129 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package floatingip
+
+import (
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+func TestSubnetUsages(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	for _, c := range []struct {
+		key  string
+		ip   string
+		attr Attr
+	}{
+		{"dp_ns1_app_app-xx-xx", "10.180.154.2", Attr{Uid: "uid1", Policy: constant.ReleasePolicyImmutable}},
+		{"pool__p1_dp_ns1_app_", "10.180.154.7", Attr{Policy: constant.ReleasePolicyNever}},
+	} {
+		if err := ipam.AllocateSpecificIP(c.key, net.ParseIP(c.ip), c.attr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ipam.Reserve(net.ParseIP("10.180.154.8"), "", false, Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	var found int
+	for _, u := range ipam.SubnetUsages() {
+		if u.Subnet.String() != "10.180.154.0/24" {
+			if u.Used() != 0 || u.Free != u.Total {
+				t.Fatalf("%+v", u)
+			}
+			continue
+		}
+		found++
+		switch u.IPRanges[0].First.String() {
+		case "10.180.154.2":
+			if u.Total != 2 || u.Allocated != 1 || u.Held != 0 || u.Reserved != 0 || u.Free != 1 {
+				t.Fatalf("%+v", u)
+			}
+		case "10.180.154.7":
+			if u.Total != 2 || u.Allocated != 0 || u.Held != 1 || u.Reserved != 1 || u.Free != 0 {
+				t.Fatalf("%+v", u)
+			}
+		}
+	}
+	if found != 2 {
+		t.Fatalf("expect 2 usages of 10.180.154.0/24, found %d", found)
+	}
+	expect := `
+# HELP galaxy_ip_usage Galaxy allocated floating ips by state, state is one of allocated (bound to pods), reserved and held (bound to no pods)
+# TYPE galaxy_ip_usage gauge
+galaxy_ip_usage{namespace="",policy="never",pool="reserved-by-api",state="reserved",subnet="10.180.154.0/24"} 1
+galaxy_ip_usage{namespace="ns1",policy="immutable",pool="",state="allocated",subnet="10.180.154.0/24"} 1
+galaxy_ip_usage{namespace="ns1",policy="never",pool="p1",state="held",subnet="10.180.154.0/24"} 1
+# HELP galaxy_subnet_exhaustion_ratio Ratio of allocated floating ips to all floating ips of the subnet
+# TYPE galaxy_subnet_exhaustion_ratio gauge
+galaxy_subnet_exhaustion_ratio{subnet="10.0.70.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="10.0.80.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="10.0.81.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="10.173.13.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="10.180.154.0/24"} 0.75
+galaxy_subnet_exhaustion_ratio{subnet="10.49.27.0/24"} 0
+`
+	if err := testutil.CollectAndCompare(ipam, strings.NewReader(expect), "galaxy_ip_usage",
+		"galaxy_subnet_exhaustion_ratio"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubnetUsagesIPv6(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	// a pool of a whole /64 subnet has more ips than uint64 can hold. Such a pool is rejected by config validation
+	// since ipam caches all of its ips, so add it to the cache directly.
+	_, subnet, _ := net.ParseCIDR("2001:db8::/64")
+	v6Pool := FloatingIPPool{SparseSubnet: nets.SparseSubnet{Gateway: net.ParseIP("2001:db8::1"), Mask: subnet.Mask,
+		IPRanges: []nets.IPRange{*nets.ParseIPRange("2001:db8::~2001:db8::ffff:ffff:ffff:ffff")}}}
+	ipam.FloatingIPs = append(ipam.FloatingIPs, &v6Pool)
+	ip := net.ParseIP("2001:db8::2")
+	ipam.allocatedFIPs[ip.String()] = New(&v6Pool, ip, "dp_ns1_app_app-xx-xx", &Attr{Uid: "uid1"}, time.Now())
+	var found bool
+	for _, u := range ipam.SubnetUsages() {
+		if u.Subnet.String() != "2001:db8::/64" {
+			continue
+		}
+		found = true
+		if u.Total != math.MaxUint64 || u.Allocated != 1 || u.Free != math.MaxUint64-1 {
+			t.Fatalf("%+v", u)
+		}
+	}
+	if !found {
+		t.Fatal("expect usage of 2001:db8::/64")
+	}
+	expect := `
+# HELP galaxy_subnet_exhaustion_ratio Ratio of allocated floating ips to all floating ips of the subnet
+# TYPE galaxy_subnet_exhaustion_ratio gauge
+galaxy_subnet_exhaustion_ratio{subnet="10.0.70.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="10.0.80.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="10.0.81.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="10.173.13.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="10.180.154.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="10.49.27.0/24"} 0
+galaxy_subnet_exhaustion_ratio{subnet="2001:db8::/64"} 5.421010862427522e-20
+`
+	if err := testutil.CollectAndCompare(ipam, strings.NewReader(expect), "galaxy_subnet_exhaustion_ratio"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxyctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+	"tkestack.io/galaxy/pkg/ipam/api"
+	"tkestack.io/galaxy/pkg/ipam/api/client"
+)
+
+func newBackupCommand(o *options) *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Export allocated ips and pools to a json or yaml file",
+		Example: "  galaxyctl backup -f ipam-backup.json\n" +
+			"  galaxyctl backup -o yaml > ipam-backup.yaml",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			backup, err := c.Backup(cmd.Context())
+			if err != nil {
+				return err
+			}
+			var data []byte
+			if o.outputFormat == formatYAML {
+				data, err = yaml.Marshal(backup)
+			} else {
+				data, err = json.MarshalIndent(backup, "", "  ")
+				data = append(data, '\n')
+			}
+			if err != nil {
+				return err
+			}
+			if file == "" {
+				_, err = o.out.Write(data)
+				return err
+			}
+			if err := os.WriteFile(file, data, 0600); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(o.out, "exported %d ips and %d pools to %s\n", len(backup.IPs), len(backup.Pools),
+				file)
+			return err
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "Write to the file instead of stdout, yaml if -o yaml")
+	return cmd
+}
+
+func newRestoreCommand(o *options) *cobra.Command {
+	var (
+		file string
+		req  api.RestoreReq
+	)
+	cmd := &cobra.Command{
+		Use:   "restore -f FILE",
+		Short: "Restore allocated ips and pools from a backup file, --dry-run shows the changes only",
+		Long: "Restore allocated ips and pools from a json or yaml backup file. Ips allocated to other keys are " +
+			"conflicts and skipped. Ips which are not within any pool are reallocated in the node subnet mapped by " +
+			"--node-subnet, or skipped.",
+		Example: "  galaxyctl restore -f ipam-backup.json --dry-run\n" +
+			"  galaxyctl restore -f ipam-backup.yaml --node-subnet 10.1.0.0/24=10.2.0.0/24",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			// yaml is a superset of json
+			if err := yaml.Unmarshal(data, &req.Backup); err != nil {
+				return fmt.Errorf("failed to parse %s: %v", file, err)
+			}
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			resp, restoreErr := c.Restore(cmd.Context(), &req)
+			if resp == nil {
+				return restoreErr
+			}
+			rows := make([][]string, 0, len(resp.Pools)+len(resp.IPs))
+			for _, r := range resp.Pools {
+				rows = append(rows, []string{"pool", r.Name, r.Action, "<none>", "<none>", "<none>", orNone(r.Error)})
+			}
+			for _, r := range resp.IPs {
+				rows = append(rows, []string{"ip", r.IP, r.Action, orNone(r.NewIP), r.Key, orNone(r.Message),
+					orNone(r.Error)})
+			}
+			if err := o.print(resp, []string{"KIND", "NAME", "ACTION", "NEWIP", "KEY", "MESSAGE", "ERROR"},
+				rows); err != nil {
+				return err
+			}
+			if o.outputFormat == formatTable {
+				fmt.Fprintln(o.out, resp.Message) // nolint: errcheck
+			}
+			if partialErr, ok := restoreErr.(*client.PartialError); ok {
+				return fmt.Errorf("%d ips or pools are not restored", len(partialErr.Failed))
+			}
+			return restoreErr
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "The backup file")
+	cmd.Flags().BoolVar(&req.DryRun, "dry-run", false, "Show what would be restored without changing anything")
+	cmd.Flags().StringToStringVar(&req.NodeSubnets, "node-subnet", nil,
+		"Map a node subnet of the backup to a node subnet of this cluster, e.g. 10.1.0.0/24=10.2.0.0/24")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
@@ -0,0 +1,69 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxyctl
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func newCheckCommand(o *options) *cobra.Command {
+	var fix bool
+	cmd := &cobra.Command{
+		Use: "check",
+		Short: "Check consistency of stored ips, pools, pods and their annotations, and cloud provider " +
+			"assignments, --fix fixes the inconsistencies",
+		Long: "Check consistency of stored ips, pools, pods and their annotations, and cloud provider assignments. " +
+			"It exits with an error if any inconsistency is found and not fixed.",
+		Example: "  galaxyctl check\n  galaxyctl check --fix",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			incs, err := c.Check(cmd.Context(), fix)
+			if err != nil {
+				return err
+			}
+			var unfixed int
+			rows := make([][]string, 0, len(incs))
+			for _, inc := range incs {
+				if !inc.Fixed {
+					unfixed++
+				}
+				rows = append(rows, []string{inc.Type, orNone(inc.IP), orNone(inc.Key), orNone(inc.Pod),
+					inc.Message, strconv.FormatBool(inc.Fixed), orNone(inc.FixError)})
+			}
+			if err := o.print(incs, []string{"TYPE", "IP", "KEY", "POD", "MESSAGE", "FIXED", "FIXERROR"},
+				rows); err != nil {
+				return err
+			}
+			if unfixed == 0 {
+				return nil
+			}
+			if !fix {
+				return fmt.Errorf("found %d inconsistencies, run with --fix to fix them", unfixed)
+			}
+			return fmt.Errorf("%d inconsistencies are not fixed", unfixed)
+		},
+	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "Fix the inconsistencies which can be fixed")
+	return cmd
+}
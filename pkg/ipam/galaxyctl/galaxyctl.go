@@ -0,0 +1,117 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+// Package galaxyctl implements galaxyctl, a command line client of the galaxy-ipam REST API.
+package galaxyctl
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"tkestack.io/galaxy/pkg/ipam/api/client"
+)
+
+// options are the global flags of galaxyctl
+type options struct {
+	server       string
+	token        string
+	caFile       string
+	insecure     bool
+	kubeconfig   string
+	context      string
+	ipamNs       string
+	ipamService  string
+	ipamPort     int
+	outputFormat string
+	out          io.Writer
+}
+
+// NewCommand creates the galaxyctl root command
+func NewCommand() *cobra.Command {
+	return newCommand(os.Stdout)
+}
+
+func newCommand(out io.Writer) *cobra.Command {
+	o := &options{out: out}
+	cmd := &cobra.Command{
+		Use:   "galaxyctl",
+		Short: "galaxyctl controls floating ips and pools of galaxy-ipam",
+		Long: "galaxyctl controls floating ips and pools of galaxy-ipam. It talks to galaxy-ipam API at --server, or " +
+			"through the apiserver service proxy of --ipam-service by kubeconfig if --server is empty.",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	o.addFlags(cmd.PersistentFlags())
+	cmd.AddCommand(newIPCommand(o), newPoolCommand(o), newUsageCommand(o), newCheckCommand(o),
+		newBackupCommand(o), newRestoreCommand(o))
+	return cmd
+}
+
+// NewCheckCommand creates a standalone check command with the global flags, it's served as galaxy-ipam check
+func NewCheckCommand() *cobra.Command {
+	o := &options{out: os.Stdout}
+	cmd := newCheckCommand(o)
+	cmd.Use = "galaxy-ipam check"
+	cmd.Example = "  galaxy-ipam check\n  galaxy-ipam check --server http://127.0.0.1:9041 --fix"
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	o.addFlags(cmd.PersistentFlags())
+	return cmd
+}
+
+// addFlags adds the global flags
+func (o *options) addFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.server, "server", "s", "", "galaxy-ipam API address, e.g. http://127.0.0.1:9041")
+	fs.StringVar(&o.token, "token", "", "Bearer token of --server, needed if galaxy-ipam runs with --api-auth")
+	fs.StringVar(&o.caFile, "certificate-authority", "", "CA certificate file of --server if it's https")
+	fs.BoolVar(&o.insecure, "insecure-skip-tls-verify", false, "Don't verify the certificate of --server")
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "The kube config file location, used if --server is empty")
+	fs.StringVar(&o.context, "context", "", "The kube config context, used if --server is empty")
+	fs.StringVar(&o.ipamNs, "ipam-namespace", "kube-system", "The namespace of galaxy-ipam service")
+	fs.StringVar(&o.ipamService, "ipam-service", "galaxy-ipam", "The name of galaxy-ipam service")
+	fs.IntVar(&o.ipamPort, "ipam-port", 9041, "The API port of galaxy-ipam service")
+	fs.StringVarP(&o.outputFormat, "output", "o", formatTable, "Output format, table, json or yaml")
+}
+
+// client creates an API client by flags
+func (o *options) client() (*client.Client, error) {
+	if o.server != "" {
+		httpClient, err := rest.HTTPClientFor(&rest.Config{Host: o.server, BearerToken: o.token,
+			TLSClientConfig: rest.TLSClientConfig{CAFile: o.caFile, Insecure: o.insecure}})
+		if err != nil {
+			return nil, err
+		}
+		return client.New(o.server, httpClient), nil
+	}
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: o.context}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error building kubeconfig: %v", err)
+	}
+	return client.NewForServiceProxy(config, o.ipamNs, o.ipamService, o.ipamPort)
+}
+
+// print prints obj in json or yaml format, or the table in table format
+func (o *options) print(obj interface{}, headers []string, rows [][]string) error {
+	return printObj(o.out, o.outputFormat, obj, headers, rows)
+}
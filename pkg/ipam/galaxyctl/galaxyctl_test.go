@@ -0,0 +1,205 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxyctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"tkestack.io/galaxy/pkg/ipam/api"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+	pageutil "tkestack.io/galaxy/pkg/utils/page"
+)
+
+var testIPs = []api.FloatingIP{
+	{IP: "10.0.0.2", Namespace: "demo", AppName: "sts", PodName: "sts-0", AppType: "statefulset", Policy: 2,
+		Status: "Running", Subnet: "10.0.0.0/24"},
+	{IP: "10.0.0.3", Namespace: "demo", AppName: "sts", PodName: "sts-1", AppType: "statefulset", Policy: 2,
+		Status: "Deleted", Releasable: true, Subnet: "10.0.0.0/24"},
+	{IP: "10.0.1.2", PoolName: "reserved-by-api", Reserved: true, Reason: "gateway", Subnet: "10.0.1.0/24"},
+}
+
+var testSubnets = []api.SubnetUsage{{Subnet: "10.0.0.0/24", IPRanges: []string{"10.0.0.2~10.0.0.9"},
+	NodeSubnets: []string{"10.1.0.0/24"}, Total: 8, Allocated: 1, Reserved: 1, Held: 1, Free: 5}}
+
+// fakeServer serves ListIPs with testIPs, ListSubnets with testSubnets and records the requests
+type fakeServer struct {
+	released    []api.FloatingIP
+	restored    *api.RestoreReq
+	subnetQuery string
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/ip":
+		json.NewEncoder(w).Encode(api.ListIPResp{ // nolint: errcheck
+			Page:    pageutil.Page{Last: true, First: true, TotalElements: len(testIPs), TotalPages: 1},
+			Content: testIPs})
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/subnet":
+		s.subnetQuery = r.URL.RawQuery
+		json.NewEncoder(w).Encode(api.ListSubnetResp{Resp: httputil.NewResp(http.StatusOK, ""), // nolint: errcheck
+			Subnets: testSubnets})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/ip":
+		var req api.ReleaseIPReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.released = req.IPs
+		json.NewEncoder(w).Encode(api.ReleaseIPResp{Resp: httputil.NewResp(http.StatusOK, "")}) // nolint: errcheck
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/backup/restore":
+		s.restored = &api.RestoreReq{}
+		if err := json.NewDecoder(r.Body).Decode(s.restored); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(api.RestoreResp{Resp: httputil.NewResp(http.StatusAccepted, ""), // nolint: errcheck
+			IPs: []floatingip.ImportResult{{Action: floatingip.ImportConflict, IP: "10.0.0.2", Key: "pod1",
+				Message: "ip is allocated to pod2"}}})
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/pool/notfound":
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(httputil.NewResp(http.StatusNotFound, "not found: pool notfound")) // nolint: errcheck
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func run(s *fakeServer, args ...string) (string, error) {
+	server := httptest.NewServer(s)
+	defer server.Close()
+	var out bytes.Buffer
+	cmd := newCommand(&out)
+	cmd.SetArgs(append(args, "--server", server.URL))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestIPList(t *testing.T) {
+	out, err := run(&fakeServer{}, "ip", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "IP ") || !strings.Contains(lines[2], "Deleted") {
+		t.Fatal(out)
+	}
+	out, err = run(&fakeServer{}, "ip", "list", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fips []api.FloatingIP
+	if err := json.Unmarshal([]byte(out), &fips); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fips, testIPs) {
+		t.Fatalf("expect %v, got %v", testIPs, fips)
+	}
+	if out, err = run(&fakeServer{}, "ip", "list", "-o", "yaml"); err != nil || !strings.Contains(out,
+		"ip: 10.0.0.2") {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if _, err = run(&fakeServer{}, "ip", "list", "-o", "xml"); err == nil {
+		t.Fatal("expect an error for unknown format")
+	}
+}
+
+func TestIPRelease(t *testing.T) {
+	s := &fakeServer{}
+	if _, err := run(s, "ip", "release", "10.0.0.3"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s.released, testIPs[1:2]) {
+		t.Fatalf("expect %v, got %v", testIPs[1:2], s.released)
+	}
+	if _, err := run(s, "ip", "release", "10.0.0.9"); err == nil || err.Error() != "10.0.0.9 is not allocated" {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolNotFound(t *testing.T) {
+	if _, err := run(&fakeServer{}, "pool", "get", "notfound"); err == nil ||
+		!strings.Contains(err.Error(), "not found: pool notfound") {
+		t.Fatal(err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	s := &fakeServer{}
+	out, err := run(s, "usage", "--subnet", "10.0.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.subnetQuery != "subnet=10.0.0.0%2F24" {
+		t.Fatalf("expect subnet query, got %s", s.subnetQuery)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || strings.Join(strings.Fields(lines[1]), " ") !=
+		"10.0.0.0/24 10.0.0.2~10.0.0.9 8 1 1 1 5 false" {
+		t.Fatal(out)
+	}
+	out, err = run(s, "usage", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var usages []api.SubnetUsage
+	if err := json.Unmarshal([]byte(out), &usages); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(usages, testSubnets) {
+		t.Fatalf("expect %v, got %v", testSubnets, usages)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "backup.yaml")
+	if err := os.WriteFile(file, []byte(`version: galaxy.k8s.io/v1
+ips:
+- ip: 10.0.0.2
+  key: pod1
+  policy: 2
+  ttl: 1h0m0s
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{}
+	out, err := run(s, "restore", "-f", file, "--dry-run", "--node-subnet", "10.1.0.0/24=10.2.0.0/24")
+	if err == nil || err.Error() != "1 ips or pools are not restored" {
+		t.Fatalf("expect a restore error, real %v", err)
+	}
+	if !strings.Contains(out, "ip is allocated to pod2") {
+		t.Fatal(out)
+	}
+	expect := &api.RestoreReq{Backup: floatingip.Backup{Version: floatingip.BackupVersion,
+		IPs: []floatingip.BackupIP{{IP: "10.0.0.2", Key: "pod1", Policy: 2,
+			TTL: metav1.Duration{Duration: time.Hour}}}},
+		DryRun: true, NodeSubnets: map[string]string{"10.1.0.0/24": "10.2.0.0/24"}}
+	if !reflect.DeepEqual(s.restored, expect) {
+		t.Fatalf("expect %+v, real %+v", expect, s.restored)
+	}
+}
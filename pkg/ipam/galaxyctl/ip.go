@@ -0,0 +1,171 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxyctl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/api"
+	"tkestack.io/galaxy/pkg/ipam/api/client"
+)
+
+func newIPCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ip",
+		Short: "List or release floating ips",
+	}
+	cmd.AddCommand(newIPListCommand(o), newIPReleaseCommand(o))
+	return cmd
+}
+
+func newIPListCommand(o *options) *cobra.Command {
+	opts := client.ListIPOptions{Size: client.MaxPageSize}
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List floating ips by keyword or filters",
+		Example: "  galaxyctl ip list --app-type deployment -n default --app nginx\n" +
+			"  galaxyctl ip list --keyword nginx -o yaml",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("page") {
+				fips, err := c.ListAllIPs(cmd.Context(), opts)
+				if err != nil {
+					return err
+				}
+				return o.printIPs(fips)
+			}
+			resp, err := c.ListIPs(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+			return o.printIPs(resp.Content)
+		},
+	}
+	fs := cmd.Flags()
+	fs.StringVar(&opts.Keyword, "keyword", "", "Fuzzy query by keyword, other filters are ignored if it's set")
+	fs.StringVar(&opts.PoolName, "pool", "", "Pool name")
+	fs.StringVar(&opts.AppName, "app", "", "App name")
+	fs.StringVar(&opts.PodName, "pod", "", "Pod name")
+	fs.StringVarP(&opts.Namespace, "namespace", "n", "", "Namespace")
+	fs.StringVar(&opts.AppType, "app-type", "", "App type, deployment, statefulset or tapp, default statefulset")
+	fs.StringVar(&opts.Sort, "sort", "", "Sort by ip/namespace/podname/policy asc/desc, default ip asc")
+	fs.IntVar(&opts.Page, "page", 0, "Page number starting from 0, all pages are listed if it's not set")
+	fs.IntVar(&opts.Size, "size", client.MaxPageSize, "Page size")
+	return cmd
+}
+
+func (o *options) printIPs(fips []api.FloatingIP) error {
+	rows := make([][]string, 0, len(fips))
+	for _, fip := range fips {
+		rows = append(rows, []string{fip.IP, orNone(fip.Namespace), orNone(fip.AppType), orNone(fip.AppName),
+			orNone(fip.PodName), orNone(fip.PoolName), orNone(policyName(fip.Policy)), orNone(fip.Status),
+			strconv.FormatBool(fip.Releasable), fip.UpdateTime.Format(time.RFC3339)})
+	}
+	return o.print(fips, []string{"IP", "NAMESPACE", "APPTYPE", "APP", "POD", "POOL", "POLICY", "STATUS",
+		"RELEASABLE", "UPDATED"}, rows)
+}
+
+func policyName(policy uint16) string {
+	if policy > uint16(constant.ReleasePolicyTTL) {
+		return strconv.Itoa(int(policy))
+	}
+	return constant.PolicyStr(constant.ReleasePolicy(policy))
+}
+
+func newIPReleaseCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:     "release IP...",
+		Short:   "Release floating ips which are not used by any pods",
+		Example: "  galaxyctl ip release 10.0.0.2 10.0.0.3",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			fips, err := findIPs(cmd.Context(), c, args)
+			if err != nil {
+				return err
+			}
+			resp, releaseErr := c.ReleaseIPs(cmd.Context(), fips)
+			if resp == nil {
+				return releaseErr
+			}
+			if o.outputFormat != formatTable && o.outputFormat != "" {
+				if err := o.print(resp, nil, nil); err != nil {
+					return err
+				}
+				return releaseErr
+			}
+			unreleased := map[string]string{}
+			for i, ip := range resp.Unreleased {
+				if i < len(resp.Reason) {
+					unreleased[ip] = resp.Reason[i]
+				}
+			}
+			var rows [][]string
+			for _, fip := range fips {
+				if reason, ok := unreleased[fip.IP]; ok {
+					rows = append(rows, []string{fip.IP, "false", reason})
+				} else {
+					rows = append(rows, []string{fip.IP, "true", ""})
+				}
+			}
+			if err := o.print(resp, []string{"IP", "RELEASED", "REASON"}, rows); err != nil {
+				return err
+			}
+			return releaseErr
+		},
+	}
+}
+
+// findIPs looks up allocated floating ips by ip which are needed by ReleaseIPs API
+func findIPs(ctx context.Context, c *client.Client, ips []string) ([]api.FloatingIP, error) {
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("%q is not a valid ip", ip)
+		}
+	}
+	all, err := c.ListAllIPs(ctx, client.ListIPOptions{})
+	if err != nil {
+		return nil, err
+	}
+	allocated := map[string]api.FloatingIP{}
+	for _, fip := range all {
+		allocated[net.ParseIP(fip.IP).String()] = fip
+	}
+	var fips []api.FloatingIP
+	for _, ip := range ips {
+		fip, ok := allocated[net.ParseIP(ip).String()]
+		if !ok {
+			return nil, fmt.Errorf("%s is not allocated", ip)
+		}
+		fips = append(fips, fip)
+	}
+	return fips, nil
+}
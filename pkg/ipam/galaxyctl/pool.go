@@ -0,0 +1,108 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxyctl
+
+import (
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"tkestack.io/galaxy/pkg/ipam/api"
+)
+
+func newPoolCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pool",
+		Short: "Get, create, update or delete pools",
+	}
+	cmd.AddCommand(newPoolGetCommand(o), newPoolApplyCommand(o, "create", "Create a pool"),
+		newPoolApplyCommand(o, "update", "Update size of a pool"), newPoolDeleteCommand(o))
+	return cmd
+}
+
+func newPoolGetCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get NAME",
+		Short: "Get a pool by name",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			pool, err := c.GetPool(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return o.print(pool, []string{"NAME", "SIZE", "PREALLOCATEIP"},
+				[][]string{{pool.Name, strconv.Itoa(pool.Size), strconv.FormatBool(pool.PreAllocateIP)}})
+		},
+	}
+}
+
+// newPoolApplyCommand creates the create or update command, both of them call CreateOrUpdate API
+func newPoolApplyCommand(o *options, verb, short string) *cobra.Command {
+	var pool api.Pool
+	cmd := &cobra.Command{
+		Use:     verb + " NAME --size SIZE",
+		Short:   short + ", --preallocate allocates ips to the pool at once",
+		Example: "  galaxyctl pool " + verb + " sample-pool --size 4 --preallocate",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			pool.Name = args[0]
+			resp, applyErr := c.CreateOrUpdatePool(cmd.Context(), &pool)
+			if resp == nil {
+				return applyErr
+			}
+			row := []string{pool.Name, strconv.Itoa(pool.Size), strconv.FormatBool(pool.PreAllocateIP), ""}
+			if pool.PreAllocateIP {
+				row[3] = strconv.Itoa(resp.RealPoolSize)
+			}
+			if err := o.print(resp, []string{"NAME", "SIZE", "PREALLOCATEIP", "ALLOCATED"},
+				[][]string{row}); err != nil {
+				return err
+			}
+			return applyErr
+		},
+	}
+	cmd.Flags().IntVar(&pool.Size, "size", 0, "Pool size")
+	cmd.Flags().BoolVar(&pool.PreAllocateIP, "preallocate", false, "Allocate ips when creating or updating pool")
+	_ = cmd.MarkFlagRequired("size")
+	return cmd
+}
+
+func newPoolDeleteCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete NAME",
+		Short: "Delete a pool by name",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			if err := c.DeletePool(cmd.Context(), args[0]); err != nil {
+				return err
+			}
+			_, err = o.out.Write([]byte("pool " + args[0] + " deleted\n"))
+			return err
+		},
+	}
+}
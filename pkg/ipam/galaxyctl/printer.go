@@ -0,0 +1,70 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxyctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// printObj prints obj in json or yaml format, or the rows as a table with headers in table format
+func printObj(w io.Writer, format string, obj interface{}, headers []string, rows [][]string) error {
+	switch format {
+	case formatJSON:
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case formatYAML:
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case formatTable, "":
+		tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(headers, "\t")) // nolint: errcheck
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t")) // nolint: errcheck
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, supports table, json and yaml", format)
+	}
+}
+
+// orNone returns <none> for an empty table cell
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
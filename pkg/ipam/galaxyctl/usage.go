@@ -0,0 +1,55 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxyctl
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// newUsageCommand shows ip usage by the subnet API, so that it reports the same numbers as the API
+func newUsageCommand(o *options) *cobra.Command {
+	var subnet, nodeSubnet string
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Show ip usage of each subnet",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := o.client()
+			if err != nil {
+				return err
+			}
+			usages, err := c.ListSubnets(cmd.Context(), subnet, nodeSubnet)
+			if err != nil {
+				return err
+			}
+			rows := make([][]string, 0, len(usages))
+			for _, u := range usages {
+				rows = append(rows, []string{u.Subnet, orNone(strings.Join(u.IPRanges, ",")),
+					strconv.FormatUint(u.Total, 10), strconv.Itoa(u.Allocated), strconv.Itoa(u.Reserved),
+					strconv.Itoa(u.Held), strconv.FormatUint(u.Free, 10), strconv.FormatBool(u.Draining)})
+			}
+			return o.print(usages, []string{"SUBNET", "IPRANGES", "TOTAL", "ALLOCATED", "RESERVED", "HELD", "FREE",
+				"DRAINING"}, rows)
+		},
+	}
+	cmd.Flags().StringVar(&subnet, "subnet", "", "Show the subnet only, e.g. 10.0.0.0/24")
+	cmd.Flags().StringVar(&nodeSubnet, "node-subnet", "", "Show subnets whose ips can be used by the node subnet")
+	return cmd
+}
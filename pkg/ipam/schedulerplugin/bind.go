@@ -56,6 +56,7 @@ func (p *FloatingIPPlugin) Bind(args *schedulerapi.ExtenderBindingArgs) error {
 	}
 	cniArgs, err := p.allocateIP(keyObj.KeyInDB, args.Node, pod)
 	if err != nil {
+		p.recordPodError(pod, err, ReasonBindFailed)
 		return err
 	}
 	data, err := json.Marshal(cniArgs)
@@ -90,25 +91,36 @@ func (p *FloatingIPPlugin) Bind(args *schedulerapi.ExtenderBindingArgs) error {
 			p.unreleased <- &releaseEvent{pod: pod}
 		}
 		// If fails to update, depending on resync to update
-		return fmt.Errorf("update pod %s: %w", keyObj.KeyInDB, err1)
+		err1 = fmt.Errorf("update pod %s: %w", keyObj.KeyInDB, err1)
+		p.recordPodError(pod, err1, ReasonBindFailed)
+		return err1
 	}
 	metrics.ScheduleLatency.WithLabelValues("bind").Observe(time.Since(start).Seconds())
 	return nil
 }
 
 func (p *FloatingIPPlugin) allocateIP(key string, nodeName string, pod *corev1.Pod) (*constant.CniArgs, error) {
+	cniArgs, _, err := p.allocateAndAssignIP(key, nodeName, pod)
+	return cniArgs, err
+}
+
+// allocateAndAssignIP allocates ips for the pod and assigns them to the node via cloud provider. It returns the ips
+// assigned by cloud provider even if it fails so that callers are able to unassign them.
+func (p *FloatingIPPlugin) allocateAndAssignIP(key string, nodeName string,
+	pod *corev1.Pod) (*constant.CniArgs, []string, error) {
 	cniArgs, err := getPodCniArgs(pod)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	ipranges := cniArgs.RequestIPRange
 	ipInfos, err := p.ipam.ByKeyAndIPRanges(key, ipranges)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query floating ip by key %s: %v", key, err)
+		return nil, nil, fmt.Errorf("failed to query floating ip by key %s: %v", key, err)
 	}
-	if len(ipranges) == 0 && len(ipInfos) > 0 {
-		// reuse only one if requesting only one ip
-		ipInfos = ipInfos[:1]
+	var unallocatedFamilies []nets.IPFamily
+	if len(ipranges) == 0 {
+		// reuse only one ip of each requested family
+		ipInfos, unallocatedFamilies = pickIPsByFamily(ipInfos, cniArgs.RequestIPFamily)
 	}
 	var unallocatedIPRange [][]nets.IPRange // those does not have allocated ips
 	reservedIPs := sets.NewString()
@@ -120,27 +132,34 @@ func (p *FloatingIPPlugin) allocateIP(key string, nodeName string, pod *corev1.P
 		}
 	}
 	policy := parseReleasePolicy(&pod.ObjectMeta)
-	attr := floatingip.Attr{Policy: policy, NodeName: nodeName, Uid: string(pod.UID)}
+	attr := floatingip.Attr{Policy: policy, NodeName: nodeName, Uid: string(pod.UID),
+		TTL: parseReleaseTTL(&pod.ObjectMeta)}
 	for _, ipInfo := range ipInfos {
 		// check if uid missmatch, if we delete a statfulset/tapp and creates a same name statfulset/tapp immediately,
 		// galaxy-ipam may receive bind event for new pod early than deleting event for old pod
 		if ipInfo != nil && ipInfo.PodUid != "" && ipInfo.PodUid != string(pod.GetUID()) {
-			return nil, fmt.Errorf("waiting for delete event of %s before reuse this ip", key)
+			return nil, nil, &ipReservedError{
+				err: fmt.Errorf("waiting for delete event of %s before reuse this ip", key)}
 		}
 	}
-	if len(unallocatedIPRange) > 0 || len(ipInfos) == 0 {
+	if len(unallocatedIPRange) > 0 || len(unallocatedFamilies) > 0 {
 		subnet, err := p.queryNodeSubnet(nodeName)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		if _, err := p.ipam.AllocateInSubnetsAndIPRange(key, subnet, unallocatedIPRange, attr); err != nil {
-			return nil, err
+		if _, err := p.ipam.AllocateInSubnetsAndIPRange(key, subnet, unallocatedIPRange, unallocatedFamilies,
+			attr); err != nil {
+			return nil, nil, err
 		}
 		ipInfos, err = p.ipam.ByKeyAndIPRanges(key, ipranges)
 		if err != nil {
-			return nil, fmt.Errorf("failed to query floating ip by key %s: %v", key, err)
+			return nil, nil, fmt.Errorf("failed to query floating ip by key %s: %v", key, err)
+		}
+		if len(ipranges) == 0 {
+			ipInfos, _ = pickIPsByFamily(ipInfos, cniArgs.RequestIPFamily)
 		}
 	}
+	var assignedIPs []string
 	for _, ipInfo := range ipInfos {
 		glog.Infof("AssignIP nodeName %s, ip %s, key %s", nodeName, ipInfo.IPInfo.IP.IP.String(), key)
 		if err := p.cloudProviderAssignIP(&rpc.AssignIPRequest{
@@ -148,12 +167,16 @@ func (p *FloatingIPPlugin) allocateIP(key string, nodeName string, pod *corev1.P
 			IPAddress: ipInfo.IPInfo.IP.IP.String(),
 		}); err != nil {
 			// do not rollback allocated ip
-			return nil, fmt.Errorf("failed to assign ip %s to %s: %v", ipInfo.IPInfo.IP.IP.String(), key, err)
+			return nil, assignedIPs, &cloudProviderError{err: fmt.Errorf("failed to assign ip %s to %s: %v",
+				ipInfo.IPInfo.IP.IP.String(), key, err)}
+		}
+		if p.cloudProvider != nil {
+			assignedIPs = append(assignedIPs, ipInfo.IPInfo.IP.IP.String())
 		}
 		if reservedIPs.Has(ipInfo.IP.String()) {
 			glog.Infof("%s reused %s, updating attr to %v", key, ipInfo.IPInfo.IP.String(), attr)
 			if err := p.ipam.UpdateAttr(key, ipInfo.IPInfo.IP.IP, attr); err != nil {
-				return nil, fmt.Errorf("failed to update floating ip release policy: %v", err)
+				return nil, assignedIPs, fmt.Errorf("failed to update floating ip release policy: %v", err)
 			}
 		}
 	}
@@ -167,7 +190,7 @@ func (p *FloatingIPPlugin) allocateIP(key string, nodeName string, pod *corev1.P
 	}
 	glog.Infof("%s reused ips %v, allocated ips %v, attr %v", key, reservedIPs.List(), allocatedIPs, attr)
 	cniArgs.Common.IPInfos = ret
-	return &cniArgs, nil
+	return &cniArgs, assignedIPs, nil
 }
 
 // unbind release ip from pod
@@ -191,7 +214,8 @@ func (p *FloatingIPPlugin) unbind(pod *corev1.Pod) error {
 				NodeName:  ipInfo.NodeName,
 				IPAddress: ipStr,
 			}); err != nil {
-				return fmt.Errorf("failed to unassign ip %s from %s: %v", ipStr, key, err)
+				return &cloudProviderError{unassign: true,
+					err: fmt.Errorf("failed to unassign ip %s from %s: %v", ipStr, key, err)}
 			}
 		}
 	}
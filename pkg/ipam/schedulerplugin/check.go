@@ -0,0 +1,294 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+// Types of inconsistencies found by Check besides those of floatingip.CheckStore
+const (
+	// InconsistencyOrphan is an ip of a pod which is not running, and whose release policy requires releasing it.
+	// It's fixed by releasing the ip.
+	InconsistencyOrphan = "orphan"
+	// InconsistencyDuplicateKey is an ip allocated to a running pod but not in its annotation. It's fixed by
+	// releasing the ip.
+	InconsistencyDuplicateKey = "duplicateKey"
+	// InconsistencyAnnotationMismatch is an ip in the annotation of a running pod which is not allocated to the pod.
+	// It's fixed by allocating the ip to the pod if the ip is unallocated.
+	InconsistencyAnnotationMismatch = "annotationMismatch"
+	// InconsistencyPolicyMismatch is an ip whose release policy differs from the annotation of its running pod. It's
+	// fixed by updating the release policy.
+	InconsistencyPolicyMismatch = "policyMismatch"
+	// InconsistencyNodeMismatch is an ip assigned by cloud provider to a node other than the one its pod runs on,
+	// or still assigned after its pod is gone. It's fixed by assigning the ip to the right node or unassigning it.
+	InconsistencyNodeMismatch = "nodeMismatch"
+)
+
+// errCantFix is the fix error of inconsistencies which need manual fixes
+var errCantFix = fmt.Errorf("can't be fixed automatically")
+
+// Inconsistency is an inconsistency found by Check
+type Inconsistency struct {
+	Type string `json:"type"`
+	IP   string `json:"ip,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// Pod is namespace/name of the pod
+	Pod      string `json:"pod,omitempty"`
+	Message  string `json:"message"`
+	Fixed    bool   `json:"fixed,omitempty"`
+	FixError string `json:"fixError,omitempty"`
+}
+
+// Check cross checks stored ips, the ipam cache and pools, pods and their annotations, and cloud provider
+// assignments. If fix is true, it fixes the inconsistencies which can be fixed.
+func (p *FloatingIPPlugin) Check(fix bool) ([]Inconsistency, error) {
+	storeIncs, err := p.ipam.CheckStore(fix)
+	if err != nil {
+		return nil, err
+	}
+	var result []Inconsistency
+	for _, inc := range storeIncs {
+		converted := Inconsistency{Type: inc.Type, IP: inc.IP.String(), Key: inc.Key, Message: inc.Message,
+			Fixed: inc.Fixed}
+		if inc.FixError != nil {
+			converted.FixError = inc.FixError.Error()
+		}
+		result = append(result, converted)
+	}
+	pods, err := p.listWantedPods()
+	if err != nil {
+		return nil, err
+	}
+	runningKeys := sets.NewString()
+	for _, pod := range pods {
+		if finished(pod) || pod.Spec.NodeName == "" {
+			continue
+		}
+		keyObj, err := util.FormatKey(pod)
+		if err != nil {
+			continue
+		}
+		runningKeys.Insert(keyObj.KeyInDB)
+		result = append(result, p.checkPod(keyObj.KeyInDB, pod, fix)...)
+	}
+	fips, err := p.ipam.ByPrefix("")
+	if err != nil {
+		return nil, err
+	}
+	checked := sets.NewString()
+	for _, fip := range fips {
+		if fip.Key == "" || runningKeys.Has(fip.Key) || checked.Has(fip.Key) {
+			continue
+		}
+		keyObj := util.ParseKey(fip.Key)
+		if keyObj.PodName == "" || keyObj.Namespace == "" {
+			continue
+		}
+		checked.Insert(fip.Key)
+		result = append(result, p.checkDeletedPod(keyObj, fix)...)
+	}
+	return result, nil
+}
+
+// checkPod checks ips of a running pod against its annotation
+func (p *FloatingIPPlugin) checkPod(key string, pod *corev1.Pod, fix bool) []Inconsistency {
+	cniArgs, err := getPodCniArgs(pod)
+	if err != nil || len(cniArgs.Common.IPInfos) == 0 {
+		// not bound yet
+		return nil
+	}
+	defer p.lockPod(pod.Name, pod.Namespace)()
+	var result []Inconsistency
+	annotated := sets.NewString()
+	for _, ipInfo := range cniArgs.Common.IPInfos {
+		if ipInfo.IP == nil || ipInfo.IP.IP == nil {
+			continue
+		}
+		ip := ipInfo.IP.IP
+		annotated.Insert(ip.String())
+		fip, err := p.ipam.ByIP(ip)
+		if err != nil || fip.Key == key {
+			continue
+		}
+		msg, fixFunc := fmt.Sprintf("annotation ip is allocated to %s", fip.Key), func() error { return errCantFix }
+		if fip.IP == nil {
+			msg = "annotation ip is not within any pool"
+		} else if fip.Key == "" {
+			msg = "annotation ip is unallocated"
+			fixFunc = func() error { return p.syncIP(key, ip, pod) }
+		}
+		var fixErr error
+		if fix {
+			fixErr = fixFunc()
+		}
+		result = append(result, newInconsistency(InconsistencyAnnotationMismatch, ip, key, pod, msg, fix,
+			fixErr))
+	}
+	ipInfos, err := p.ipam.ByKeyAndIPRanges(key, nil)
+	if err != nil {
+		glog.Warningf("failed to query ips of %s: %v", key, err)
+		return result
+	}
+	policy := parseReleasePolicy(&pod.ObjectMeta)
+	for _, ipInfo := range ipInfos {
+		ip := ipInfo.IP
+		if !annotated.Has(ip.String()) {
+			var fixErr error
+			if fix {
+				fixErr = p.releaseCheckedIP(key, &ipInfo.FloatingIP)
+			}
+			result = append(result, newInconsistency(InconsistencyDuplicateKey, ip, key, pod,
+				"ip is allocated to the pod but not in its annotation", fix, fixErr))
+			continue
+		}
+		if ipInfo.Policy != uint16(policy) {
+			var fixErr error
+			if fix {
+				fixErr = p.ipam.UpdateAttr(key, ip, floatingip.Attr{Policy: policy, NodeName: ipInfo.NodeName,
+					Uid: ipInfo.PodUid, TTL: parseReleaseTTL(&pod.ObjectMeta)})
+			}
+			result = append(result, newInconsistency(InconsistencyPolicyMismatch, ip, key, pod,
+				fmt.Sprintf("release policy is %d, pod annotation wants %d", ipInfo.Policy, policy), fix, fixErr))
+		}
+		if p.cloudProvider != nil && ipInfo.NodeName != pod.Spec.NodeName {
+			var fixErr error
+			if fix {
+				fixErr = p.reassignIP(key, ip, ipInfo.NodeName, pod)
+			}
+			result = append(result, newInconsistency(InconsistencyNodeMismatch, ip, key, pod,
+				fmt.Sprintf("ip is assigned to node %q, pod runs on %s", ipInfo.NodeName, pod.Spec.NodeName), fix,
+				fixErr))
+		}
+	}
+	return result
+}
+
+// checkDeletedPod checks ips of a pod which is not running
+func (p *FloatingIPPlugin) checkDeletedPod(keyObj *util.KeyObj, fix bool) []Inconsistency {
+	defer p.lockPod(keyObj.PodName, keyObj.Namespace)()
+	key := keyObj.KeyInDB
+	ipInfos, err := p.ipam.ByKeyAndIPRanges(key, nil)
+	if err != nil {
+		glog.Warningf("failed to query ips of %s: %v", key, err)
+		return nil
+	}
+	if len(ipInfos) == 0 {
+		return nil
+	}
+	if running, _ := p.podRunning(keyObj.PodName, keyObj.Namespace, ipInfos[0].PodUid); running {
+		return nil
+	}
+	var result []Inconsistency
+	for _, ipInfo := range ipInfos {
+		fip := ipInfo.FloatingIP
+		policy := constant.ReleasePolicy(fip.Policy)
+		var msg string
+		if policy == constant.ReleasePolicyPodDelete {
+			msg = "pod is not running and release policy is podDelete"
+		} else if policy == constant.ReleasePolicyTTL && fip.PodUid == "" && fip.NodeName == "" &&
+			time.Now().After(fip.UpdatedAt.Add(fip.TTL)) {
+			msg = fmt.Sprintf("pod is not running and release ttl %s expired", fip.TTL)
+		}
+		if msg != "" {
+			var fixErr error
+			if fix {
+				fixErr = p.releaseCheckedIP(key, &fip)
+			}
+			result = append(result, newInconsistency(InconsistencyOrphan, fip.IP, key, nil, msg, fix, fixErr))
+			continue
+		}
+		if p.cloudProvider != nil && fip.NodeName != "" {
+			var fixErr error
+			if fix {
+				fixErr = p.reassignIP(key, fip.IP, fip.NodeName, nil)
+			}
+			result = append(result, newInconsistency(InconsistencyNodeMismatch, fip.IP, key, nil,
+				fmt.Sprintf("pod is not running but ip is still assigned to node %s", fip.NodeName), fix, fixErr))
+		}
+	}
+	return result
+}
+
+// releaseCheckedIP unassigns the ip from its node and releases it
+func (p *FloatingIPPlugin) releaseCheckedIP(key string, fip *floatingip.FloatingIP) error {
+	if fip.NodeName != "" {
+		if err := p.cloudProviderUnAssignIP(&rpc.UnAssignIPRequest{NodeName: fip.NodeName,
+			IPAddress: fip.IP.String()}); err != nil {
+			return err
+		}
+	}
+	_, unreleased, err := p.ipam.ReleaseIPs(map[string]string{fip.IP.String(): key})
+	if err != nil {
+		return err
+	}
+	if len(unreleased) > 0 {
+		return fmt.Errorf("ip is reallocated to %s", unreleased[fip.IP.String()])
+	}
+	return nil
+}
+
+// reassignIP unassigns the ip from the old node and assigns it to the node of the pod. If pod is nil, it only
+// unassigns the ip and clears the node and uid of it.
+func (p *FloatingIPPlugin) reassignIP(key string, ip net.IP, oldNode string, pod *corev1.Pod) error {
+	if oldNode != "" {
+		if err := p.cloudProviderUnAssignIP(&rpc.UnAssignIPRequest{NodeName: oldNode,
+			IPAddress: ip.String()}); err != nil {
+			return err
+		}
+	}
+	if pod == nil {
+		_, err := p.ipam.ReserveIP(key, key, floatingip.Attr{})
+		return err
+	}
+	if err := p.cloudProviderAssignIP(&rpc.AssignIPRequest{NodeName: pod.Spec.NodeName,
+		IPAddress: ip.String()}); err != nil {
+		return err
+	}
+	return p.ipam.UpdateAttr(key, ip, floatingip.Attr{Policy: parseReleasePolicy(&pod.ObjectMeta),
+		NodeName: pod.Spec.NodeName, Uid: string(pod.UID), TTL: parseReleaseTTL(&pod.ObjectMeta)})
+}
+
+func newInconsistency(typ string, ip net.IP, key string, pod *corev1.Pod, msg string, fix bool,
+	fixErr error) Inconsistency {
+	inc := Inconsistency{Type: typ, Key: key, Message: msg}
+	if ip != nil {
+		inc.IP = ip.String()
+	}
+	if pod != nil {
+		inc.Pod = pod.Namespace + "/" + pod.Name
+	}
+	if fixErr != nil {
+		inc.FixError = fixErr.Error()
+	} else {
+		inc.Fixed = fix
+	}
+	if fix {
+		glog.Infof("check %s ip %s key %s: %s, fixed %v %s", typ, inc.IP, key, msg, inc.Fixed, inc.FixError)
+	}
+	return inc
+}
@@ -0,0 +1,86 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+func TestCheck(t *testing.T) {
+	runningPod := CreateDeploymentPod("dp-xxx-yyy", "ns1", map[string]string{})
+	runningPod.Spec.NodeName = node3
+	var ipInfo constant.IPInfo
+	if err := json.Unmarshal([]byte(`{"ip":"10.49.27.205/24","vlan":2,"gateway":"10.49.27.1"}`),
+		&ipInfo); err != nil {
+		t.Fatal(err)
+	}
+	str, err := constant.MarshalCniArgs([]constant.IPInfo{ipInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runningPod.Annotations[constant.ExtendedCNIArgsAnnotation] = str
+	deletedPod := CreateDeploymentPod("dp2-aaa-bbb", "ns2", nil)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, runningPod)
+	defer func() { stopChan <- struct{}{} }()
+	runningKey, _ := util.FormatKey(runningPod)
+	deletedKey, _ := util.FormatKey(deletedPod)
+	// 10.49.27.216 is allocated to the running pod but not in its annotation
+	if err := fipPlugin.ipam.AllocateSpecificIP(runningKey.KeyInDB, net.ParseIP("10.49.27.216"),
+		floatingip.Attr{Policy: constant.ReleasePolicyPodDelete}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.ipam.AllocateSpecificIP(deletedKey.KeyInDB, net.ParseIP("10.173.13.2"),
+		floatingip.Attr{Policy: constant.ReleasePolicyPodDelete}); err != nil {
+		t.Fatal(err)
+	}
+	expect := []Inconsistency{
+		{Type: InconsistencyAnnotationMismatch, IP: "10.49.27.205", Key: runningKey.KeyInDB, Pod: "ns1/dp-xxx-yyy"},
+		{Type: InconsistencyDuplicateKey, IP: "10.49.27.216", Key: runningKey.KeyInDB, Pod: "ns1/dp-xxx-yyy"},
+		{Type: InconsistencyOrphan, IP: "10.173.13.2", Key: deletedKey.KeyInDB},
+	}
+	for _, fix := range []bool{false, true} {
+		result, err := fipPlugin.Check(fix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result) != len(expect) {
+			t.Fatalf("fix %v: expect %d inconsistencies, real %+v", fix, len(expect), result)
+		}
+		for i := range expect {
+			if result[i].Type != expect[i].Type || result[i].IP != expect[i].IP || result[i].Key != expect[i].Key ||
+				result[i].Pod != expect[i].Pod || result[i].Fixed != fix || result[i].FixError != "" {
+				t.Fatalf("fix %v: expect %+v, real %+v", fix, expect[i], result[i])
+			}
+		}
+	}
+	if result, err := fipPlugin.Check(false); err != nil || len(result) != 0 {
+		t.Fatalf("expect no inconsistencies after fix, real %+v, err %v", result, err)
+	}
+	for ip, key := range map[string]string{"10.49.27.205": runningKey.KeyInDB, "10.49.27.216": "",
+		"10.173.13.2": ""} {
+		if err := checkIPKey(fipPlugin.ipam, ip, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
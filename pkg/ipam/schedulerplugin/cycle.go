@@ -0,0 +1,189 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+// CycleState is the floating ip state of a pod's scheduling cycle. Scheduling framework plugins, which split a
+// scheduling cycle into PreFilter, Filter, Score, Reserve, Unreserve and PreBind, keep it between these phases.
+type CycleState struct {
+	// Skip is true if the pod doesn't want floating ip
+	Skip   bool
+	KeyObj *util.KeyObj
+	// Subnets are the node subnets having available ips for the pod
+	Subnets sets.String
+	// Counts is the number of unallocated ips the pod can use of each node subnet
+	Counts map[string]int
+	// ReservedSubnets are the node subnets having ips reserved for the pod
+	ReservedSubnets sets.String
+	// AllocatedIPs are the ips allocated to the pod's key before the cycle
+	AllocatedIPs sets.String
+	// CniArgs is the allocated result of ReserveCycle, it's replaced rather than modified
+	CniArgs *constant.CniArgs
+	// AssignedIPs are the ips assigned to the node via cloud provider in ReserveCycle
+	AssignedIPs []string
+}
+
+// Clone returns a copy of the state, changing either of them doesn't affect the other
+func (s *CycleState) Clone() *CycleState {
+	c := *s
+	if s.KeyObj != nil {
+		keyObj := *s.KeyObj
+		c.KeyObj = &keyObj
+	}
+	c.Subnets = cloneSet(s.Subnets)
+	c.ReservedSubnets = cloneSet(s.ReservedSubnets)
+	c.AllocatedIPs = cloneSet(s.AllocatedIPs)
+	if s.Counts != nil {
+		c.Counts = make(map[string]int, len(s.Counts))
+		for k, v := range s.Counts {
+			c.Counts[k] = v
+		}
+	}
+	c.AssignedIPs = append([]string(nil), s.AssignedIPs...)
+	return &c
+}
+
+func cloneSet(s sets.String) sets.String {
+	if s == nil {
+		return nil
+	}
+	return sets.NewString(s.UnsortedList()...)
+}
+
+// WantsFloatingIP returns true if the pod requests floating ips
+func (p *FloatingIPPlugin) WantsFloatingIP(pod *corev1.Pod) bool {
+	return p.hasResourceName(&pod.Spec)
+}
+
+// PrepareCycle computes the node subnets having available ips for the pod, it may allocate ips for deployment pods
+// the same as the scheduler extender filter does. The state is returned even if it fails, callers should treat the
+// pod unschedulable if the state has no Subnets.
+func (p *FloatingIPPlugin) PrepareCycle(pod *corev1.Pod) (*CycleState, error) {
+	start := time.Now()
+	if !p.hasResourceName(&pod.Spec) {
+		return &CycleState{Skip: true}, nil
+	}
+	defer p.lockPod(pod.Name, pod.Namespace)()
+	keyObj, err := util.FormatKey(pod)
+	if err != nil {
+		return &CycleState{Skip: true}, err
+	}
+	allocated, err := p.ipam.ByKeyAndIPRanges(keyObj.KeyInDB, nil)
+	if err != nil {
+		return &CycleState{Skip: true}, fmt.Errorf("failed to query by key %s: %v", keyObj.KeyInDB, err)
+	}
+	s := &CycleState{KeyObj: keyObj, AllocatedIPs: sets.NewString()}
+	for i := range allocated {
+		s.AllocatedIPs.Insert(allocated[i].IP.String())
+	}
+	if s.Subnets, err = p.getSubnet(pod); err != nil {
+		return s, err
+	}
+	if s.Subnets.Len() == 0 {
+		return s, nil
+	}
+	if s.Counts, s.ReservedSubnets, err = p.countSubnets(pod); err != nil {
+		return s, err
+	}
+	metrics.ScheduleLatency.WithLabelValues("prefilter").Observe(time.Since(start).Seconds())
+	return s, nil
+}
+
+// NodeSubnet returns the node subnet of the node
+func (p *FloatingIPPlugin) NodeSubnet(node *corev1.Node) (*net.IPNet, error) {
+	return p.getNodeSubnet(node)
+}
+
+// QueryNodeSubnet returns the node subnet of the node by name
+func (p *FloatingIPPlugin) QueryNodeSubnet(nodeName string) (*net.IPNet, error) {
+	return p.queryNodeSubnet(nodeName)
+}
+
+// ReserveCycle allocates ips for the pod on the node and assigns them to the node via cloud provider
+func (p *FloatingIPPlugin) ReserveCycle(s *CycleState, pod *corev1.Pod, nodeName string) error {
+	if s.Skip {
+		return nil
+	}
+	defer p.lockPod(pod.Name, pod.Namespace)()
+	var err error
+	s.CniArgs, s.AssignedIPs, err = p.allocateAndAssignIP(s.KeyObj.KeyInDB, nodeName, pod)
+	return err
+}
+
+// UnreserveCycle unassigns ips assigned to the node in ReserveCycle and releases ips which are allocated in
+// PrepareCycle or ReserveCycle
+func (p *FloatingIPPlugin) UnreserveCycle(s *CycleState, pod *corev1.Pod, nodeName string) {
+	if s.Skip {
+		return
+	}
+	defer p.lockPod(pod.Name, pod.Namespace)()
+	s.CniArgs = nil
+	key := s.KeyObj.KeyInDB
+	// keep ips which are failed to unassign allocated, the cloud provider may still route them to the node
+	unassignFailed := sets.NewString()
+	for _, ip := range s.AssignedIPs {
+		glog.Infof("UnAssignIP nodeName %s, ip %s, key %s during unreserve", nodeName, ip, key)
+		if err := p.cloudProviderUnAssignIP(&rpc.UnAssignIPRequest{
+			NodeName:  nodeName,
+			IPAddress: ip,
+		}); err != nil {
+			glog.Warningf("failed to unassign ip %s from %s during unreserve: %v", ip, key, err)
+			unassignFailed.Insert(ip)
+		}
+	}
+	s.AssignedIPs = nil
+	ipInfos, err := p.ipam.ByKeyAndIPRanges(key, nil)
+	if err != nil {
+		glog.Warningf("failed to query by key %s: %v", key, err)
+		return
+	}
+	toRelease := map[string]string{}
+	for i := range ipInfos {
+		if ipStr := ipInfos[i].IP.String(); !s.AllocatedIPs.Has(ipStr) && !unassignFailed.Has(ipStr) {
+			toRelease[ipStr] = key
+		}
+	}
+	if len(toRelease) == 0 {
+		return
+	}
+	if s.AllocatedIPs.Len() == 0 && s.KeyObj.Deployment() {
+		// ips may come from the pool of the deployment, put them back
+		if err := p.unbindDpPod(s.KeyObj, parseReleasePolicy(&pod.ObjectMeta), "during unreserve"); err != nil {
+			glog.Warningf("failed to unreserve %s: %v", key, err)
+		}
+		return
+	}
+	released, unreleased, err := p.ipam.ReleaseIPs(toRelease)
+	if err != nil {
+		glog.Warningf("released %v, unreleased %v of %s during unreserve: %v", released, unreleased, key, err)
+		return
+	}
+	glog.Infof("released floating ip %v from %s during unreserve", released, key)
+}
@@ -0,0 +1,84 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	. "tkestack.io/galaxy/pkg/ipam/cloudprovider/testing"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	schedulerplugin_util "tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+func TestSchedulingCycle(t *testing.T) {
+	pod := CreateStatefulSetPod("pod1-0", "ns1", nil)
+	podKey, _ := schedulerplugin_util.FormatKey(pod)
+	node4Subnet := &net.IPNet{IP: net.ParseIP("10.173.13.0"), Mask: net.IPv4Mask(255, 255, 255, 0)}
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	cloudProvider := NewFakeCloudProvider()
+	fipPlugin.cloudProvider = cloudProvider
+
+	// pod has no floating ip resource name
+	noFIPPod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "pod2", Namespace: "ns1"}}
+	if s, err := fipPlugin.PrepareCycle(noFIPPod); err != nil || !s.Skip {
+		t.Fatalf("expect skipped, got %+v, err %v", s, err)
+	}
+
+	s, err := fipPlugin.PrepareCycle(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// node4 has 6 ips left and node3 has 4 ips left
+	if !s.Subnets.HasAll("10.49.27.0/24", "10.173.13.0/24") || s.Counts["10.49.27.0/24"] != 4 ||
+		s.Counts["10.173.13.0/24"] != 6 || s.ReservedSubnets.Len() != 0 {
+		t.Fatalf("unexpected state %+v", s)
+	}
+
+	// unreserve unassigns and releases the ip allocated by reserve
+	if err := fipPlugin.ReserveCycle(s, pod, node3); err != nil {
+		t.Fatal(err)
+	}
+	ipInfos, err := fipPlugin.ipam.ByKeyAndIPRanges(podKey.KeyInDB, nil)
+	if err != nil || len(ipInfos) != 1 || s.CniArgs == nil || len(s.AssignedIPs) != 1 {
+		t.Fatalf("expect an ip allocated and assigned, got %v, %+v, %v", ipInfos, s, err)
+	}
+	// a clone is not affected by unreserve
+	clone := s.Clone()
+	fipPlugin.UnreserveCycle(s, pod, node3)
+	if err := checkIPKey(fipPlugin.ipam, ipInfos[0].IP.String(), ""); err != nil {
+		t.Fatal(err)
+	}
+	ipStr := ipInfos[0].IP.String()
+	if err := checkFakeCloudProviderState(cloudProvider, map[string]string{ipStr: node3},
+		map[string]string{ipStr: node3}); err != nil {
+		t.Fatal(err)
+	}
+	if s.CniArgs != nil || len(s.AssignedIPs) != 0 || clone.CniArgs == nil || len(clone.AssignedIPs) != 1 {
+		t.Fatalf("expect unreserve to reset the state but not its clone, got %+v, %+v", s, clone)
+	}
+
+	if err := fipPlugin.ReserveCycle(s, pod, node4); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.CniArgs.Common.IPInfos) != 1 || !node4Subnet.Contains(s.CniArgs.Common.IPInfos[0].IP.IP) {
+		t.Fatalf("unexpected cni args %v", s.CniArgs)
+	}
+}
@@ -41,7 +41,8 @@ func (p *FloatingIPPlugin) getReplicasOfDeployment(keyObj *util.KeyObj) (int, er
 // unbindDpPod unbind deployment pod
 func (p *FloatingIPPlugin) unbindDpPod(keyObj *util.KeyObj, policy constant.ReleasePolicy, when string) error {
 	key, prefixKey := keyObj.KeyInDB, keyObj.PoolPrefix()
-	if policy == constant.ReleasePolicyPodDelete {
+	if policy == constant.ReleasePolicyPodDelete || policy == constant.ReleasePolicyTTL {
+		// ttl release policy is not supported for deployment pods
 		return p.releaseIP(key, fmt.Sprintf("%s %s", deletedAndIPMutablePod, when))
 	} else if policy == constant.ReleasePolicyNever {
 		if key != prefixKey {
@@ -68,11 +69,11 @@ func (p *FloatingIPPlugin) unbindDpPod(keyObj *util.KeyObj, policy constant.Rele
 		return err
 	}
 	// if num of fips is large than replicas, release exceeded part
-	if len(fips) > replicas {
+	if allocated := countByFamily(fips); allocated > replicas {
 		return p.releaseIP(key, fmt.Sprintf("%s %s", deletedAndScaledDownDpPod, when))
 	} else {
 		if key != prefixKey {
-			return p.reserveIP(key, prefixKey, fmt.Sprintf("allocated %d <= replicas %d %s", len(fips), replicas, when))
+			return p.reserveIP(key, prefixKey, fmt.Sprintf("allocated %d <= replicas %d %s", allocated, replicas, when))
 		}
 	}
 	return nil
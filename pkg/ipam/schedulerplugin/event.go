@@ -77,6 +77,7 @@ func (p *FloatingIPPlugin) loop(stop chan struct{}) {
 						// leave it to resync to protect chan from explosion
 						glog.Errorf("abort unbind for pod %s, retried %d times: %v", util.PodName(event.pod),
 							event.retryTimes, err)
+						p.recordPodError(event.pod, err, ReasonReleaseFailed)
 					} else {
 						glog.Warningf("unbind pod %s failed for %d times: %v", util.PodName(event.pod),
 							event.retryTimes, err)
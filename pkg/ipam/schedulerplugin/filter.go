@@ -45,8 +45,11 @@ func (p *FloatingIPPlugin) Filter(pod *corev1.Pod, nodes []corev1.Node) ([]corev
 	defer p.lockPod(pod.Name, pod.Namespace)()
 	subnetSet, err := p.getSubnet(pod)
 	if err != nil {
+		p.recordPodError(pod, err, ReasonFilterFailed)
 		return filteredNodes, failedNodesMap, err
 	}
+	// quotaExceededSubnets is lazily computed for nodes not in subnetSet
+	var quotaExceededSubnets sets.String
 	for i := range nodes {
 		nodeName := nodes[i].Name
 		subnet, err := p.getNodeSubnet(&nodes[i])
@@ -56,10 +59,20 @@ func (p *FloatingIPPlugin) Filter(pod *corev1.Pod, nodes []corev1.Node) ([]corev
 		}
 		if subnetSet.Has(subnet.String()) {
 			filteredNodes = append(filteredNodes, nodes[i])
+			continue
+		}
+		if quotaExceededSubnets == nil {
+			quotaExceededSubnets = p.quotaExceededSubnets(pod)
+		}
+		if quotaExceededSubnets.Has(subnet.String()) {
+			failedNodesMap[nodeName] = "FloatingIPPlugin:QuotaExceeded"
 		} else {
 			failedNodesMap[nodeName] = "FloatingIPPlugin:NoFIPLeft"
 		}
 	}
+	if len(filteredNodes) == 0 {
+		p.recordNoFIPLeft(pod, failedNodesMap)
+	}
 	if glog.V(5) {
 		nodeNames := make([]string, len(filteredNodes))
 		for i := range filteredNodes {
@@ -72,6 +85,49 @@ func (p *FloatingIPPlugin) Filter(pod *corev1.Pod, nodes []corev1.Node) ([]corev
 	return filteredNodes, failedNodesMap, nil
 }
 
+// recordNoFIPLeft records a warning event on the pod if none of the nodes has floating ips left for it
+func (p *FloatingIPPlugin) recordNoFIPLeft(pod *corev1.Pod, failedNodesMap schedulerapi.FailedNodesMap) {
+	var noFIPLeft, quotaExceeded int
+	for _, reason := range failedNodesMap {
+		switch reason {
+		case "FloatingIPPlugin:NoFIPLeft":
+			noFIPLeft++
+		case "FloatingIPPlugin:QuotaExceeded":
+			quotaExceeded++
+		}
+	}
+	if noFIPLeft > 0 {
+		p.Recorder.Eventf(pod, corev1.EventTypeWarning, ReasonNoFloatingIPInSubnet,
+			"no floating ips left in subnets of %d nodes, quota exceeded in subnets of %d nodes", noFIPLeft,
+			quotaExceeded)
+	} else if quotaExceeded > 0 {
+		p.Recorder.Eventf(pod, corev1.EventTypeWarning, ReasonQuotaExceeded,
+			"namespace %s exceeded its floating ip quota in subnets of %d nodes", pod.Namespace, quotaExceeded)
+	}
+}
+
+// quotaExceededSubnets returns node subnets which have ips left for the pod but can't be allocated because the
+// pod's namespace has exceeded its quota
+func (p *FloatingIPPlugin) quotaExceededSubnets(pod *corev1.Pod) sets.String {
+	keyObj, err := util.FormatKey(pod)
+	if err != nil {
+		return sets.NewString()
+	}
+	cniArgs, err := getPodCniArgs(pod)
+	if err != nil {
+		return sets.NewString()
+	}
+	all, err := p.ipam.NodeSubnetsByIPRanges("", cniArgs.RequestIPRange, cniArgs.RequestIPFamily)
+	if err != nil {
+		return sets.NewString()
+	}
+	withinQuota, err := p.ipam.NodeSubnetsByIPRanges(keyObj.KeyInDB, cniArgs.RequestIPRange, cniArgs.RequestIPFamily)
+	if err != nil {
+		return sets.NewString()
+	}
+	return all.Difference(withinQuota)
+}
+
 // #lizard forgives
 func (p *FloatingIPPlugin) getSubnet(pod *corev1.Pod) (sets.String, error) {
 	keyObj, err := util.FormatKey(pod)
@@ -83,6 +139,7 @@ func (p *FloatingIPPlugin) getSubnet(pod *corev1.Pod) (sets.String, error) {
 		return nil, err
 	}
 	ipranges := cniArgs.RequestIPRange
+	families := cniArgs.RequestIPFamily
 	// first check if exists an already allocated ip for this pod
 	ipInfos, err := p.ipam.ByKeyAndIPRanges(keyObj.KeyInDB, ipranges)
 	if err != nil {
@@ -90,10 +147,25 @@ func (p *FloatingIPPlugin) getSubnet(pod *corev1.Pod) (sets.String, error) {
 	}
 	allocatedSubnets := sets.NewString()
 	if len(ipranges) == 0 {
-		if len(ipInfos) > 0 {
-			glog.V(3).Infof("%s already have an allocated ip %s in subnets %v", keyObj.KeyInDB,
-				ipInfos[0].IP.String(), ipInfos[0].NodeSubnets)
-			return ipInfos[0].NodeSubnets, nil
+		var picked []*floatingip.FloatingIPInfo
+		picked, families = pickIPsByFamily(ipInfos, families)
+		var ips []string
+		for i := range picked {
+			ips = append(ips, picked[i].IP.String())
+			if i == 0 {
+				allocatedSubnets.Insert(picked[i].NodeSubnets.UnsortedList()...)
+			} else {
+				allocatedSubnets = allocatedSubnets.Intersection(picked[i].NodeSubnets)
+			}
+		}
+		if len(picked) > 0 && len(families) == 0 {
+			glog.V(3).Infof("%s already have allocated ips %v in subnets %v", keyObj.KeyInDB, ips,
+				allocatedSubnets)
+			return allocatedSubnets, nil
+		}
+		if len(picked) > 0 {
+			glog.V(3).Infof("%s have allocated ips %v with intersection subnets %v, but also unallocated "+
+				"ip families %v", keyObj.KeyInDB, ips, allocatedSubnets, families)
 		}
 	} else {
 		var unallocatedIPRange [][]nets.IPRange // those does not have allocated ips
@@ -136,7 +208,7 @@ func (p *FloatingIPPlugin) getSubnet(pod *corev1.Pod) (sets.String, error) {
 		// Lock to make checking available subnets and allocating reserved ip atomic
 		defer p.LockDpPool(keyObj.PoolPrefix())()
 	}
-	subnetSet, reserve, err := p.getAvailableSubnet(keyObj, policy, replicas, isPoolSizeDefined, ipranges)
+	subnetSet, reserve, err := p.getAvailableSubnet(keyObj, policy, replicas, isPoolSizeDefined, ipranges, families)
 	if err != nil {
 		return nil, err
 	}
@@ -149,7 +221,7 @@ func (p *FloatingIPPlugin) getSubnet(pod *corev1.Pod) (sets.String, error) {
 		// So we'd better do the allocate in filter for reserve situation.
 		reserveSubnet := subnetSet.List()[0]
 		subnetSet = sets.NewString(reserveSubnet)
-		if err := p.allocateDuringFilter(keyObj, reserve, isPoolSizeDefined, reserveSubnet, policy,
+		if err := p.allocateDuringFilter(keyObj, reserve, isPoolSizeDefined, reserveSubnet, families, policy,
 			string(pod.UID)); err != nil {
 			return nil, err
 		}
@@ -158,11 +230,11 @@ func (p *FloatingIPPlugin) getSubnet(pod *corev1.Pod) (sets.String, error) {
 }
 
 func (p *FloatingIPPlugin) allocateDuringFilter(keyObj *util.KeyObj, reserve, isPoolSizeDefined bool,
-	reserveSubnet string, policy constant.ReleasePolicy, uid string) error {
+	reserveSubnet string, families []nets.IPFamily, policy constant.ReleasePolicy, uid string) error {
 	// we can't get nodename during filter, update attr on bind
 	attr := floatingip.Attr{Policy: policy, NodeName: "", Uid: uid}
 	if reserve {
-		if err := p.allocateInSubnetWithKey(keyObj.PoolPrefix(), keyObj.KeyInDB, reserveSubnet, attr,
+		if err := p.allocateInSubnetWithKey(keyObj.PoolPrefix(), keyObj.KeyInDB, reserveSubnet, families, attr,
 			"filter"); err != nil {
 			return err
 		}
@@ -172,7 +244,7 @@ func (p *FloatingIPPlugin) allocateDuringFilter(keyObj *util.KeyObj, reserve, is
 		if err != nil {
 			return err
 		}
-		if err := p.allocateInSubnet(keyObj.KeyInDB, ipNet, attr, "filter"); err != nil {
+		if err := p.allocateInSubnet(keyObj.KeyInDB, ipNet, families, attr, "filter"); err != nil {
 			return err
 		}
 	}
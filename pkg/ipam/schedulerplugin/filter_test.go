@@ -17,6 +17,7 @@
 package schedulerplugin
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"reflect"
@@ -32,6 +33,7 @@ import (
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
 	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
 	schedulerplugin_util "tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+	"tkestack.io/galaxy/pkg/ipam/utils"
 	. "tkestack.io/galaxy/pkg/utils/test"
 )
 
@@ -75,6 +77,56 @@ func TestFilter(t *testing.T) {
 	}
 }
 
+func TestFilterNamespaceQuota(t *testing.T) {
+	fipPlugin, stopChan, nodes := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	var conf Conf
+	if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+		t.Fatal(err)
+	}
+	// node3 can allocate 10.49.27.0/24 only
+	for _, pool := range conf.FloatingIPs {
+		if pool.IPNet().String() == "10.49.27.0/24" {
+			pool.NamespaceQuotas = map[string]int{"ns2": 1, floatingip.AnyNamespace: 0}
+		}
+	}
+	if err := fipPlugin.ipam.ConfigurePool(conf.FloatingIPs); err != nil {
+		t.Fatal(err)
+	}
+	filtered, failed, err := fipPlugin.Filter(pod, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFilterResult(filtered, failed, []string{node4}, []string{drainedNode, nodeHasNoIP, node3}); err != nil {
+		t.Fatal(err)
+	}
+	if failed[node3] != "FloatingIPPlugin:QuotaExceeded" || failed[drainedNode] != "FloatingIPPlugin:NoFIPLeft" {
+		t.Fatalf("unexpected failed reasons %v", failed)
+	}
+	// ns2 is able to allocate one ip in 10.49.27.0/24
+	pod2 := CreateStatefulSetPod("pod2-0", "ns2", nil)
+	if filtered, failed, err = fipPlugin.Filter(pod2, nodes); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFilterResult(filtered, failed, []string{node3, node4}, []string{drainedNode, nodeHasNoIP}); err != nil {
+		t.Fatal(err)
+	}
+	// ips reserved by never release policy count against quota
+	if err := fipPlugin.ipam.AllocateSpecificIP("sts_ns2_pod2_pod2-1", net.ParseIP("10.49.27.205"),
+		floatingip.Attr{Policy: constant.ReleasePolicyNever}); err != nil {
+		t.Fatal(err)
+	}
+	if filtered, failed, err = fipPlugin.Filter(pod2, nodes); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFilterResult(filtered, failed, []string{node4}, []string{drainedNode, nodeHasNoIP, node3}); err != nil {
+		t.Fatal(err)
+	}
+	if failed[node3] != "FloatingIPPlugin:QuotaExceeded" {
+		t.Fatalf("unexpected failed reasons %v", failed)
+	}
+}
+
 func TestFilterForPodWithoutRef(t *testing.T) {
 	fipPlugin, stopChan, nodes := createPluginTestNodes(t)
 	defer func() { stopChan <- struct{}{} }()
@@ -22,17 +22,18 @@ import (
 	"net"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	glog "k8s.io/klog"
 	"k8s.io/utils/keymutex"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant/utils"
-	"tkestack.io/galaxy/pkg/api/k8s/schedulerapi"
 	"tkestack.io/galaxy/pkg/ipam/cloudprovider"
 	"tkestack.io/galaxy/pkg/ipam/context"
 	"tkestack.io/galaxy/pkg/ipam/crd"
@@ -47,7 +48,9 @@ type FloatingIPPlugin struct {
 	nodeSubnet     map[string]*net.IPNet
 	nodeSubnetLock sync.Mutex
 	*context.IPAMContext
-	lastIPConf    string
+	lastIPConf string
+	// notified when FloatingIPPool crds change
+	poolUpdated   chan struct{}
 	conf          *Conf
 	unreleased    chan *releaseEvent
 	cloudProvider cloudprovider.CloudProvider
@@ -57,26 +60,52 @@ type FloatingIPPlugin struct {
 	podLockPool keymutex.KeyMutex
 	crdCache    crd.CrdCache
 	crdKey      CrdKey
+	// initialized is set once Init configures ipam
+	initialized int32
+	// configPools caches pools read from config for webhooks before the plugin is initialized
+	configPools     []*floatingip.FloatingIPPool
+	configPoolsTime time.Time
+	configPoolsLock sync.Mutex
 }
 
 // NewFloatingIPPlugin creates FloatingIPPlugin
 func NewFloatingIPPlugin(conf Conf, ctx *context.IPAMContext) (*FloatingIPPlugin, error) {
 	conf.validate()
 	glog.Infof("floating ip config: %v", conf)
+	if ctx.Recorder == nil {
+		// drop events if no recorder is given
+		ctx.Recorder = &record.FakeRecorder{}
+	}
 	plugin := &FloatingIPPlugin{
 		nodeSubnet:  make(map[string]*net.IPNet),
 		IPAMContext: ctx,
 		conf:        &conf,
 		unreleased:  make(chan *releaseEvent, 50000),
+		poolUpdated: make(chan struct{}, 1),
 		dpLockPool:  keymutex.NewHashed(500000),
 		podLockPool: keymutex.NewHashed(500000),
 		crdKey:      NewCrdKey(ctx.ExtensionLister),
 		crdCache:    crd.NewCrdCache(ctx.DynamicClient, ctx.ExtensionLister, 0),
 	}
-	plugin.ipam = floatingip.NewCrdIPAM(ctx.GalaxyClient, plugin.FIPInformer)
+	switch conf.StorageDriver {
+	case floatingip.CrdStoreDriver:
+		plugin.ipam = floatingip.NewCrdIPAM(ctx.GalaxyClient, ctx.Client, conf.ConfigMapNamespace,
+			plugin.FIPInformer)
+	case floatingip.BoltStoreDriver:
+		store, err := floatingip.NewBoltStore(conf.BoltDBPath)
+		if err != nil {
+			return nil, err
+		}
+		plugin.ipam = floatingip.NewStoreIPAM(store)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %s", conf.StorageDriver)
+	}
 	if conf.CloudProviderGRPCAddr != "" {
 		plugin.cloudProvider = cloudprovider.NewGRPCCloudProvider(conf.CloudProviderGRPCAddr)
 	}
+	if len(conf.FloatingIPs) == 0 {
+		plugin.addFIPPoolEventHandler()
+	}
 	return plugin, nil
 }
 
@@ -87,17 +116,18 @@ func (p *FloatingIPPlugin) Init() error {
 			return err
 		}
 	} else {
-		glog.Infof("empty floatingips from config, fetching from configmap")
+		glog.Infof("empty floatingips from config, fetching from FloatingIPPool or configmap")
 		if err := wait.PollInfinite(time.Second, func() (done bool, err error) {
-			updated, err := p.updateConfigMap()
+			updated, err := p.updatePoolConfig()
 			if err != nil {
 				glog.Warning(err)
 			}
 			return updated, nil
 		}); err != nil {
-			return fmt.Errorf("failed to get floatingip config from configmap: %v", err)
+			return fmt.Errorf("failed to get floatingip config from FloatingIPPool or configmap: %v", err)
 		}
 	}
+	atomic.StoreInt32(&p.initialized, 1)
 	glog.Infof("plugin init done")
 	return nil
 }
@@ -105,11 +135,7 @@ func (p *FloatingIPPlugin) Init() error {
 // Run starts resyncing pod routine
 func (p *FloatingIPPlugin) Run(stop chan struct{}) {
 	if len(p.conf.FloatingIPs) == 0 {
-		go wait.Until(func() {
-			if _, err := p.updateConfigMap(); err != nil {
-				glog.Warning(err)
-			}
-		}, time.Minute, stop)
+		go p.loopUpdatePoolConfig(stop)
 	}
 	go wait.Until(func() {
 		if err := p.resyncPod(); err != nil {
@@ -122,18 +148,29 @@ func (p *FloatingIPPlugin) Run(stop chan struct{}) {
 	}
 }
 
+// loopUpdatePoolConfig updates pool config every minute or once FloatingIPPool crds change
+func (p *FloatingIPPlugin) loopUpdatePoolConfig(stop chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-p.poolUpdated:
+		}
+		if _, err := p.updatePoolConfig(); err != nil {
+			glog.Warning(err)
+		}
+	}
+}
+
 // updateConfigMap fetches the newest floatingips configmap and syncs in memory/db config,
 // returns true if successfully gets floatingip config.
 func (p *FloatingIPPlugin) updateConfigMap() (bool, error) {
-	cm, err := p.Client.CoreV1().ConfigMaps(p.conf.ConfigMapNamespace).Get(gocontext.TODO(), p.conf.ConfigMapName, v1.GetOptions{})
+	val, err := p.getConfigMapConf()
 	if err != nil {
-		return false, fmt.Errorf("failed to get floatingip configmap %s_%s: %v", p.conf.ConfigMapName,
-			p.conf.ConfigMapNamespace, err)
-	}
-	val, ok := cm.Data[p.conf.FloatingIPKey]
-	if !ok {
-		return false, fmt.Errorf("configmap %s_%s doesn't have a key floatingips", p.conf.ConfigMapName,
-			p.conf.ConfigMapNamespace)
+		return false, err
 	}
 	var updated bool
 	if updated, err = p.ensureIPAMConf(&p.lastIPConf, val); err != nil {
@@ -151,14 +188,19 @@ func (p *FloatingIPPlugin) updateConfigMap() (bool, error) {
 	return true, nil
 }
 
-// Prioritize can score each node, currently it does nothing
-func (p *FloatingIPPlugin) Prioritize(pod *corev1.Pod, nodes []corev1.Node) (*schedulerapi.HostPriorityList, error) {
-	list := &schedulerapi.HostPriorityList{}
-	if !p.hasResourceName(&pod.Spec) {
-		return list, nil
-	}
-	//TODO
-	return list, nil
+// getConfigMapConf returns the floatingip config of the configmap
+func (p *FloatingIPPlugin) getConfigMapConf() (string, error) {
+	cm, err := p.Client.CoreV1().ConfigMaps(p.conf.ConfigMapNamespace).Get(gocontext.TODO(), p.conf.ConfigMapName, v1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get floatingip configmap %s_%s: %v", p.conf.ConfigMapName,
+			p.conf.ConfigMapNamespace, err)
+	}
+	val, ok := cm.Data[p.conf.FloatingIPKey]
+	if !ok {
+		return "", fmt.Errorf("configmap %s_%s doesn't have a key floatingips", p.conf.ConfigMapName,
+			p.conf.ConfigMapNamespace)
+	}
+	return val, nil
 }
 
 // hasResourceName checks if the podspec has floatingip resource name
@@ -226,6 +268,25 @@ func parseReleasePolicy(meta *v1.ObjectMeta) constant.ReleasePolicy {
 	return constant.ConvertReleasePolicy(meta.Annotations[constant.ReleasePolicyAnnotation])
 }
 
+// parseReleaseTTL returns how long to keep the ip after the pod is deleted if its release policy is ttl, otherwise
+// returns 0
+func parseReleaseTTL(meta *v1.ObjectMeta) time.Duration {
+	if parseReleasePolicy(meta) != constant.ReleasePolicyTTL {
+		return 0
+	}
+	str := meta.Annotations[constant.ReleaseTTLAnnotation]
+	if str == "" {
+		return constant.DefaultReleaseTTL
+	}
+	ttl, err := time.ParseDuration(str)
+	if err != nil || ttl <= 0 {
+		glog.Warningf("invalid %s annotation %q of pod %s_%s, use default %v", constant.ReleaseTTLAnnotation, str,
+			meta.Namespace, meta.Name, constant.DefaultReleaseTTL)
+		return constant.DefaultReleaseTTL
+	}
+	return ttl
+}
+
 func (p *FloatingIPPlugin) GetIpam() floatingip.IPAM {
 	return p.ipam
 }
@@ -262,6 +323,9 @@ func getPodCniArgs(pod *corev1.Pod) (constant.CniArgs, error) {
 
 // supportReserveIPPolicy checks if reserveIP release policy is supported for a given keyObj
 func (p *FloatingIPPlugin) supportReserveIPPolicy(obj *util.KeyObj, policy constant.ReleasePolicy) error {
+	if obj.Deployment() && policy == constant.ReleasePolicyTTL {
+		return TTLForDeployment
+	}
 	if obj.Deployment() || obj.StatefulSet() {
 		return nil
 	}
@@ -269,7 +333,7 @@ func (p *FloatingIPPlugin) supportReserveIPPolicy(obj *util.KeyObj, policy const
 	if err != nil {
 		return NotStatefulWorkload
 	}
-	if policy == constant.ReleasePolicyNever {
+	if policy == constant.ReleasePolicyNever || policy == constant.ReleasePolicyTTL {
 		return nil
 	}
 	gvr := p.crdKey.GetGroupVersionResource(obj.AppTypePrefix)
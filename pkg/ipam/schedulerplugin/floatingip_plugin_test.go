@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -32,6 +33,7 @@ import (
 	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
 	schedulerplugin_util "tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 	"tkestack.io/galaxy/pkg/ipam/utils"
+	"tkestack.io/galaxy/pkg/utils/nets"
 )
 
 const (
@@ -197,6 +199,10 @@ func TestParseReleasePolicy(t *testing.T) {
 			meta:   &v1.ObjectMeta{Labels: map[string]string{}, Annotations: map[string]string{constant.IPPoolAnnotation: ""}},
 			expect: constant.ReleasePolicyPodDelete,
 		},
+		{
+			meta:   &v1.ObjectMeta{Labels: map[string]string{}, Annotations: ttlAnnotation("")},
+			expect: constant.ReleasePolicyTTL,
+		},
 	}
 	for i := range testCases {
 		testCase := testCases[i]
@@ -207,9 +213,35 @@ func TestParseReleasePolicy(t *testing.T) {
 	}
 }
 
+func ttlAnnotation(ttl string) map[string]string {
+	m := map[string]string{constant.ReleasePolicyAnnotation: constant.TTL}
+	if ttl != "" {
+		m[constant.ReleaseTTLAnnotation] = ttl
+	}
+	return m
+}
+
+func TestParseReleaseTTL(t *testing.T) {
+	for i, testCase := range []struct {
+		annotations map[string]string
+		expect      time.Duration
+	}{
+		{annotations: nil, expect: 0},
+		{annotations: neverAnnotation, expect: 0},
+		{annotations: ttlAnnotation(""), expect: constant.DefaultReleaseTTL},
+		{annotations: ttlAnnotation("10m"), expect: 10 * time.Minute},
+		{annotations: ttlAnnotation("xx"), expect: constant.DefaultReleaseTTL},
+		{annotations: ttlAnnotation("-1m"), expect: constant.DefaultReleaseTTL},
+	} {
+		if got := parseReleaseTTL(&v1.ObjectMeta{Annotations: testCase.annotations}); got != testCase.expect {
+			t.Errorf("case %d, expect %v, got %v", i, testCase.expect, got)
+		}
+	}
+}
+
 func drainNode(fipPlugin *FloatingIPPlugin, subnet *net.IPNet, except net.IP) error {
 	for {
-		if _, err := fipPlugin.ipam.AllocateInSubnet("ns_notexistpod", subnet,
+		if _, err := fipPlugin.ipam.AllocateInSubnet("ns_notexistpod", subnet, nets.IPv4Family,
 			floatingip.Attr{Policy: constant.ReleasePolicyPodDelete}); err != nil {
 			if err == floatingip.ErrNoEnoughIP {
 				break
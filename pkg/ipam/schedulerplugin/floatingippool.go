@@ -0,0 +1,177 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// addFIPPoolEventHandler triggers updating pool config when FloatingIPPool crds change
+func (p *FloatingIPPlugin) addFIPPoolEventHandler() {
+	if p.FIPPoolInformer == nil {
+		return
+	}
+	trigger := func() {
+		select {
+		case p.poolUpdated <- struct{}{}:
+		default:
+		}
+	}
+	p.FIPPoolInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { trigger() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			old, ok1 := oldObj.(*v1alpha1.FloatingIPPool)
+			cur, ok2 := newObj.(*v1alpha1.FloatingIPPool)
+			// ignore status updates made by ourselves
+			if ok1 && ok2 && equalFIPPoolSpec(&old.Spec, &cur.Spec) {
+				return
+			}
+			trigger()
+		},
+		DeleteFunc: func(obj interface{}) { trigger() },
+	})
+}
+
+// updatePoolConfig applies pools of FloatingIPPool crds if there are any, otherwise it falls back to floatingip-config
+// ConfigMap. It returns true if successfully gets pool config.
+func (p *FloatingIPPlugin) updatePoolConfig() (bool, error) {
+	if p.FIPPoolLister == nil {
+		return p.updateConfigMap()
+	}
+	pools, err := p.FIPPoolLister.List(labels.Everything())
+	if err != nil {
+		return false, fmt.Errorf("failed to list FloatingIPPool: %v", err)
+	}
+	if len(pools) == 0 {
+		return p.updateConfigMap()
+	}
+	return p.updateFIPPools(pools)
+}
+
+// updateFIPPools validates FloatingIPPool crds and configures ipam with them. If any of them is invalid, ipam keeps
+// the last config to avoid releasing allocated ips of the invalid pool.
+func (p *FloatingIPPlugin) updateFIPPools(pools []*v1alpha1.FloatingIPPool) (bool, error) {
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Name < pools[j].Name
+	})
+	confs := make([]*floatingip.FloatingIPPool, len(pools))
+	messages := make([]string, len(pools))
+	var invalid []string
+	for i := range pools {
+		conf, err := validateFIPPool(pools[i], pools[:i], confs[:i])
+		if err != nil {
+			messages[i] = err.Error()
+			invalid = append(invalid, pools[i].Name)
+			continue
+		}
+		confs[i] = conf
+	}
+	defer func() {
+		for i := range pools {
+			p.updateFIPPoolStatus(pools[i], confs[i], messages[i])
+		}
+	}()
+	if len(invalid) > 0 {
+		return false, fmt.Errorf("invalid FloatingIPPool %s, keep the last pool config",
+			strings.Join(invalid, ","))
+	}
+	data, err := json.Marshal(confs)
+	if err != nil {
+		return false, err
+	}
+	newConf := string(data)
+	if newConf == p.lastIPConf {
+		glog.V(4).Infof("FloatingIPPool unchanged")
+		return true, nil
+	}
+	if err := p.ipam.ConfigurePool(confs); err != nil {
+		return false, fmt.Errorf("failed to configure pool: %v", err)
+	}
+	glog.Infof("updated floatingip conf from (%s) to (%s)", p.lastIPConf, newConf)
+	p.lastIPConf = newConf
+	// If floatingip configuration changes, node's subnet may change either
+	p.nodeSubnetLock.Lock()
+	defer p.nodeSubnetLock.Unlock()
+	p.nodeSubnet = map[string]*net.IPNet{}
+	return true, nil
+}
+
+// validateFIPPool converts a FloatingIPPool crd to ipam pool config and checks if its ips overlap with other pools
+func validateFIPPool(pool *v1alpha1.FloatingIPPool, others []*v1alpha1.FloatingIPPool,
+	otherConfs []*floatingip.FloatingIPPool) (*floatingip.FloatingIPPool, error) {
+	data, err := json.Marshal(pool.Spec)
+	if err != nil {
+		return nil, err
+	}
+	var conf floatingip.FloatingIPPool
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, err
+	}
+	for i := range otherConfs {
+		if otherConfs[i] == nil {
+			continue
+		}
+		for _, ipr := range conf.IPRanges {
+			for _, other := range otherConfs[i].IPRanges {
+				if nets.CompareIP(ipr.First, other.Last) <= 0 && nets.CompareIP(other.First, ipr.Last) <= 0 {
+					return nil, fmt.Errorf("ip range %s overlaps with %s of FloatingIPPool %s", ipr.String(),
+						other.String(), others[i].Name)
+				}
+			}
+		}
+	}
+	return &conf, nil
+}
+
+// updateFIPPoolStatus updates ip usage of a FloatingIPPool crd, conf is nil if the pool is invalid
+func (p *FloatingIPPlugin) updateFIPPoolStatus(pool *v1alpha1.FloatingIPPool, conf *floatingip.FloatingIPPool,
+	message string) {
+	status := v1alpha1.FloatingIPPoolStatus{Message: message}
+	if conf != nil {
+		status.Total = int(conf.Size())
+		status.Allocated, status.Reserved = p.ipam.PoolUsage(conf)
+		status.Free = status.Total - status.Allocated
+	}
+	if pool.Status == status {
+		return
+	}
+	cloned := pool.DeepCopy()
+	cloned.Status = status
+	if _, err := p.GalaxyClient.GalaxyV1alpha1().FloatingIPPools().UpdateStatus(gocontext.TODO(), cloned,
+		v1.UpdateOptions{}); err != nil {
+		glog.Warningf("failed to update status of FloatingIPPool %s: %v", pool.Name, err)
+	}
+}
+
+func equalFIPPoolSpec(a, b *v1alpha1.FloatingIPPoolSpec) bool {
+	dataA, _ := json.Marshal(a)
+	dataB, _ := json.Marshal(b)
+	return string(dataA) == string(dataB)
+}
@@ -0,0 +1,123 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/utils"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+func createTestFIPPool(name string, ips ...string) *v1alpha1.FloatingIPPool {
+	return &v1alpha1.FloatingIPPool{
+		ObjectMeta: v1.ObjectMeta{Name: name},
+		Spec: v1alpha1.FloatingIPPoolSpec{
+			NodeSubnets: []string{"10.49.27.0/24"},
+			Subnet:      "10.49.27.0/24",
+			IPs:         ips,
+			Gateway:     "10.49.27.1",
+			Vlan:        2,
+		},
+	}
+}
+
+func TestUpdateFIPPools(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: "testConf", Namespace: "demo"},
+		Data: map[string]string{
+			"key": `[{"routableSubnet":"10.49.27.0/24","ips":["10.49.27.216~10.49.27.218"],"subnet":"10.49.27.0/24","gateway":"10.49.27.1","vlan":2}]`,
+		},
+	}
+	var conf Conf
+	if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+		t.Fatal(err)
+	}
+	conf.FloatingIPs = nil
+	conf.ConfigMapName = cm.Name
+	conf.ConfigMapNamespace = cm.Namespace
+	conf.FloatingIPKey = "key"
+	fipPlugin, stopChan := newPlugin(t, conf, []runtime.Object{cm}, nil, nil)
+	defer func() { stopChan <- struct{}{} }()
+	client := fipPlugin.GalaxyClient.GalaxyV1alpha1().FloatingIPPools()
+	pools := []*v1alpha1.FloatingIPPool{
+		createTestFIPPool("pool-b", "10.49.27.218~10.49.27.220"),
+		createTestFIPPool("pool-a", "10.49.27.216~10.49.27.218"),
+	}
+	for i := range pools {
+		if _, err := client.Create(gocontext.TODO(), pools[i], v1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	getStatus := func(name string) v1alpha1.FloatingIPPoolStatus {
+		pool, err := client.Get(gocontext.TODO(), name, v1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pool.Status
+	}
+	// overlapped pools are not applied
+	lastConf := fipPlugin.lastIPConf
+	if _, err := fipPlugin.updateFIPPools(pools); err == nil {
+		t.Fatal("expect an error for overlapped pools")
+	}
+	if fipPlugin.lastIPConf != lastConf {
+		t.Fatalf("expect pool config unchanged, got %s", fipPlugin.lastIPConf)
+	}
+	if status := getStatus("pool-a"); status != (v1alpha1.FloatingIPPoolStatus{Total: 3, Free: 3}) {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if status := getStatus("pool-b"); !strings.Contains(status.Message, "overlaps with") || status.Total != 0 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	pools = []*v1alpha1.FloatingIPPool{
+		createTestFIPPool("pool-a", "10.49.27.216~10.49.27.218"),
+		createTestFIPPool("pool-b", "10.49.27.220"),
+	}
+	if _, err := fipPlugin.updateFIPPools(pools); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.220", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fipPlugin.ipam.AllocateInSubnet("pod1", node3Subnet, nets.IPv4Family,
+		floatingip.Attr{Policy: constant.ReleasePolicyPodDelete}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fipPlugin.updateFIPPools(pools); err != nil {
+		t.Fatal(err)
+	}
+	statusA, statusB := getStatus("pool-a"), getStatus("pool-b")
+	if statusA.Total+statusB.Total != 4 || statusA.Allocated+statusB.Allocated != 1 ||
+		statusA.Free+statusB.Free != 3 || statusB.Message != "" {
+		t.Fatalf("unexpected status %+v %+v", statusA, statusB)
+	}
+	if fipPlugin.ipam.NodeSubnet(net.ParseIP("10.49.27.3")) == nil {
+		t.Fatal("expect node subnet 10.49.27.0/24 configured")
+	}
+}
@@ -0,0 +1,334 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+// Package framework packages the floating ip plugin as a kube-scheduler framework plugin. It's kept apart from
+// package schedulerplugin so that galaxy-ipam and the api client don't depend on k8s.io/kubernetes.
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionClient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	glog "k8s.io/klog"
+	schedframework "k8s.io/kubernetes/pkg/scheduler/framework"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/api/k8s/eventhandler"
+	"tkestack.io/galaxy/pkg/ipam/client/clientset/versioned"
+	ipamcontext "tkestack.io/galaxy/pkg/ipam/context"
+	"tkestack.io/galaxy/pkg/ipam/crd"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin"
+)
+
+const (
+	// Name is the name of the plugin in kube-scheduler configuration
+	Name     = "FloatingIP"
+	stateKey = schedframework.StateKey("galaxy.k8s.io/" + Name)
+	// reservedScore is the raw score of nodes whose subnet holds reserved ips, NormalizeScore converts it to
+	// MaxNodeScore
+	reservedScore = -1
+)
+
+// Plugin packages FloatingIPPlugin as a kube-scheduler framework plugin. Allocating ips during filter for deployment
+// pods and binding ips to pods follow the same logic as the scheduler extender.
+type Plugin struct {
+	fipPlugin *schedulerplugin.FloatingIPPlugin
+	client    kubernetes.Interface
+	// start initializes and runs fipPlugin. kube-scheduler creates plugins before leader election, so it's called
+	// when the first pod wanting floating ip is scheduled, i.e. only by the leader.
+	start     func()
+	startOnce sync.Once
+	// ready is closed once fipPlugin is running
+	ready chan struct{}
+}
+
+var _ schedframework.PreFilterPlugin = &Plugin{}
+var _ schedframework.FilterPlugin = &Plugin{}
+var _ schedframework.ScorePlugin = &Plugin{}
+var _ schedframework.ReservePlugin = &Plugin{}
+var _ schedframework.PreBindPlugin = &Plugin{}
+
+// New creates the plugin from its args in kube-scheduler configuration, which is the json config of
+// schedulerplugin.Conf. It shares the informers and client of the scheduler.
+func New(args runtime.Object, handle schedframework.Handle) (schedframework.Plugin, error) {
+	var conf schedulerplugin.Conf
+	if args != nil {
+		if err := frameworkruntime.DecodeInto(args, &conf); err != nil {
+			return nil, fmt.Errorf("decode %s args: %v", Name, err)
+		}
+	}
+	cfg := handle.KubeConfig()
+	galaxyClient, err := versioned.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build float ip clientset: %v", err)
+	}
+	extClient, err := extensionClient.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build extension clientset: %v", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build dynamic clientset: %v", err)
+	}
+	ctx := ipamcontext.NewIPAMContextWithInformerFactory(handle.ClientSet(), handle.SharedInformerFactory(),
+		galaxyClient, extClient, dynamicClient)
+	ctx.Recorder = newRecorder(handle.ClientSet())
+	fipPlugin, err := schedulerplugin.NewFloatingIPPlugin(conf, ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx.PodInformer.Informer().AddEventHandler(eventhandler.NewPodEventHandler(fipPlugin))
+	p := &Plugin{fipPlugin: fipPlugin, client: handle.ClientSet(), ready: make(chan struct{})}
+	p.start = func() {
+		stop := make(chan struct{})
+		_ = wait.PollImmediateInfinite(time.Second, func() (bool, error) {
+			if err := crd.EnsureCRDCreated(extClient); err != nil {
+				glog.Warningf("ensure crd created: %v", err)
+				return false, nil
+			}
+			return true, nil
+		})
+		ctx.StartInformers(stop)
+		_ = wait.PollImmediateInfinite(time.Second, func() (bool, error) {
+			if err := fipPlugin.Init(); err != nil {
+				glog.Warningf("init floating ip plugin: %v", err)
+				return false, nil
+			}
+			return true, nil
+		})
+		fipPlugin.Run(stop)
+		close(p.ready)
+	}
+	return p, nil
+}
+
+// newPlugin creates the plugin of a running FloatingIPPlugin
+func newPlugin(fipPlugin *schedulerplugin.FloatingIPPlugin, client kubernetes.Interface) *Plugin {
+	p := &Plugin{fipPlugin: fipPlugin, client: client, start: func() {}, ready: make(chan struct{})}
+	close(p.ready)
+	return p
+}
+
+func newRecorder(client kubernetes.Interface) record.EventRecorder {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "galaxy-scheduler"})
+}
+
+// cycleState wraps schedulerplugin.CycleState as the framework state data
+type cycleState struct {
+	*schedulerplugin.CycleState
+}
+
+// Clone returns a copy of the state, the preemption dry run of a cloned state doesn't affect the original one
+func (s *cycleState) Clone() schedframework.StateData {
+	return &cycleState{CycleState: s.CycleState.Clone()}
+}
+
+func getCycleState(state *schedframework.CycleState) (*schedulerplugin.CycleState, error) {
+	data, err := state.Read(stateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from cycle state: %v", stateKey, err)
+	}
+	s, ok := data.(*cycleState)
+	if !ok {
+		return nil, fmt.Errorf("%+v convert to cycleState error", data)
+	}
+	return s.CycleState, nil
+}
+
+// Name returns the plugin name
+func (p *Plugin) Name() string {
+	return Name
+}
+
+// PreFilter computes the node subnets having available ips for the pod, it may allocate ips for deployment pods
+// the same as the scheduler extender filter does.
+func (p *Plugin) PreFilter(ctx context.Context, state *schedframework.CycleState,
+	pod *corev1.Pod) (*schedframework.PreFilterResult, *schedframework.Status) {
+	if !p.fipPlugin.WantsFloatingIP(pod) {
+		state.Write(stateKey, &cycleState{CycleState: &schedulerplugin.CycleState{Skip: true}})
+		return nil, nil
+	}
+	p.startOnce.Do(func() {
+		go p.start()
+	})
+	select {
+	case <-p.ready:
+	default:
+		// retry after backoff rather than waiting for the next cluster event
+		return nil, schedframework.NewStatus(schedframework.Error, "FloatingIPPlugin:Initializing")
+	}
+	s, err := p.fipPlugin.PrepareCycle(pod)
+	state.Write(stateKey, &cycleState{CycleState: s})
+	if err != nil {
+		return nil, schedframework.AsStatus(err)
+	}
+	if s.Subnets.Len() == 0 {
+		return nil, schedframework.NewStatus(schedframework.UnschedulableAndUnresolvable,
+			"FloatingIPPlugin:NoFIPLeft")
+	}
+	return nil, nil
+}
+
+// PreFilterExtensions returns nil as the subnets are not affected by other pods
+func (p *Plugin) PreFilterExtensions() schedframework.PreFilterExtensions {
+	return nil
+}
+
+// Filter marks nodes whose subnet has no available ips unschedulable
+func (p *Plugin) Filter(ctx context.Context, state *schedframework.CycleState, pod *corev1.Pod,
+	nodeInfo *schedframework.NodeInfo) *schedframework.Status {
+	s, err := getCycleState(state)
+	if err != nil {
+		return schedframework.AsStatus(err)
+	}
+	if s.Skip {
+		return nil
+	}
+	node := nodeInfo.Node()
+	if node == nil {
+		return schedframework.NewStatus(schedframework.Error, "node not found")
+	}
+	subnet, err := p.fipPlugin.NodeSubnet(node)
+	if err != nil {
+		return schedframework.NewStatus(schedframework.UnschedulableAndUnresolvable, err.Error())
+	}
+	if !s.Subnets.Has(subnet.String()) {
+		return schedframework.NewStatus(schedframework.Unschedulable, "FloatingIPPlugin:NoFIPLeft")
+	}
+	return nil
+}
+
+// Score returns the number of unallocated ips which the pod can use in the node subnet
+func (p *Plugin) Score(ctx context.Context, state *schedframework.CycleState, pod *corev1.Pod,
+	nodeName string) (int64, *schedframework.Status) {
+	s, err := getCycleState(state)
+	if err != nil {
+		return 0, schedframework.AsStatus(err)
+	}
+	if s.Skip {
+		return 0, nil
+	}
+	subnet, err := p.fipPlugin.QueryNodeSubnet(nodeName)
+	if err != nil {
+		return 0, nil
+	}
+	if s.ReservedSubnets.Has(subnet.String()) {
+		return reservedScore, nil
+	}
+	return int64(s.Counts[subnet.String()]), nil
+}
+
+// ScoreExtensions returns the plugin itself to normalize scores
+func (p *Plugin) ScoreExtensions() schedframework.ScoreExtensions {
+	return p
+}
+
+// NormalizeScore scores nodes having reserved ips MaxNodeScore, others in proportion to their free ips
+func (p *Plugin) NormalizeScore(ctx context.Context, state *schedframework.CycleState, pod *corev1.Pod,
+	scores schedframework.NodeScoreList) *schedframework.Status {
+	var maxCount int64
+	for i := range scores {
+		if scores[i].Score > maxCount {
+			maxCount = scores[i].Score
+		}
+	}
+	for i := range scores {
+		if scores[i].Score == reservedScore {
+			scores[i].Score = schedframework.MaxNodeScore
+		} else if maxCount > 0 {
+			// leave MaxNodeScore for nodes having reserved ips
+			scores[i].Score = scores[i].Score * (schedframework.MaxNodeScore - 1) / maxCount
+		}
+	}
+	return nil
+}
+
+// Reserve allocates ips for the pod on the node
+func (p *Plugin) Reserve(ctx context.Context, state *schedframework.CycleState, pod *corev1.Pod,
+	nodeName string) *schedframework.Status {
+	s, err := getCycleState(state)
+	if err != nil {
+		return schedframework.AsStatus(err)
+	}
+	if err := p.fipPlugin.ReserveCycle(s, pod, nodeName); err != nil {
+		return schedframework.AsStatus(err)
+	}
+	return nil
+}
+
+// Unreserve unassigns ips assigned to the node in Reserve and releases ips which are allocated in PreFilter or
+// Reserve of this scheduling cycle
+func (p *Plugin) Unreserve(ctx context.Context, state *schedframework.CycleState, pod *corev1.Pod,
+	nodeName string) {
+	s, err := getCycleState(state)
+	if err != nil {
+		return
+	}
+	p.fipPlugin.UnreserveCycle(s, pod, nodeName)
+}
+
+// PreBind writes the allocated ips into the pod annotation
+func (p *Plugin) PreBind(ctx context.Context, state *schedframework.CycleState, pod *corev1.Pod,
+	nodeName string) *schedframework.Status {
+	start := time.Now()
+	s, err := getCycleState(state)
+	if err != nil {
+		return schedframework.AsStatus(err)
+	}
+	if s.Skip {
+		return nil
+	}
+	if s.CniArgs == nil {
+		return schedframework.NewStatus(schedframework.Error, fmt.Sprintf("no ip reserved for %s",
+			s.KeyObj.KeyInDB))
+	}
+	data, err := json.Marshal(s.CniArgs)
+	if err != nil {
+		return schedframework.AsStatus(fmt.Errorf("marshal cni args %v: %v", *s.CniArgs, err))
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{constant.ExtendedCNIArgsAnnotation: string(data)},
+		},
+	})
+	if err != nil {
+		return schedframework.AsStatus(err)
+	}
+	if _, err := p.client.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch,
+		v1.PatchOptions{}); err != nil {
+		return schedframework.AsStatus(fmt.Errorf("update pod %s: %w", s.KeyObj.KeyInDB, err))
+	}
+	glog.Infof("prebind pod %s to %s with %s", s.KeyObj.KeyInDB, nodeName, string(data))
+	metrics.ScheduleLatency.WithLabelValues("prebind").Observe(time.Since(start).Seconds())
+	return nil
+}
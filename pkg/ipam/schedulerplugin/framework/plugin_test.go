@@ -0,0 +1,166 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	schedframework "k8s.io/kubernetes/pkg/scheduler/framework"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	ipamcontext "tkestack.io/galaxy/pkg/ipam/context"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	"tkestack.io/galaxy/pkg/ipam/utils"
+)
+
+const (
+	nodeHasNoIP, node3, node4 = "node2", "node3", "node4"
+)
+
+func createPlugin(t *testing.T, objs ...runtime.Object) (*Plugin, chan struct{}, []corev1.Node) {
+	nodes := []corev1.Node{
+		CreateNode(nodeHasNoIP, nil, "10.48.28.2"), // no floating ip configured for this node
+		CreateNode(node3, nil, "10.49.27.3"),
+		CreateNode(node4, nil, "10.173.13.4"),
+	}
+	objs = append(objs, &nodes[0], &nodes[1], &nodes[2])
+	var conf schedulerplugin.Conf
+	if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+		t.Fatal(err)
+	}
+	ctx, stopChan := ipamcontext.CreateTestIPAMContext(objs, nil, nil)
+	fipPlugin, err := schedulerplugin.NewFloatingIPPlugin(conf, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return newPlugin(fipPlugin, ctx.Client), stopChan, nodes
+}
+
+// #lizard forgives
+func TestPlugin(t *testing.T) {
+	pod := CreateStatefulSetPod("pod1-0", "ns1", nil)
+	node4Subnet := &net.IPNet{IP: net.ParseIP("10.173.13.0"), Mask: net.IPv4Mask(255, 255, 255, 0)}
+	plugin, stopChan, nodes := createPlugin(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	ctx := context.Background()
+
+	// pod has no floating ip resource name, all nodes pass
+	state := schedframework.NewCycleState()
+	noFIPPod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "pod2", Namespace: "ns1"}}
+	if _, status := plugin.PreFilter(ctx, state, noFIPPod); !status.IsSuccess() {
+		t.Fatal(status.Message())
+	}
+	for i := range nodes {
+		if status := plugin.Filter(ctx, state, noFIPPod, newNodeInfo(&nodes[i])); !status.IsSuccess() {
+			t.Fatal(status.Message())
+		}
+	}
+
+	state = schedframework.NewCycleState()
+	if _, status := plugin.PreFilter(ctx, state, pod); !status.IsSuccess() {
+		t.Fatal(status.Message())
+	}
+	expectCodes := map[string]schedframework.Code{nodeHasNoIP: schedframework.UnschedulableAndUnresolvable,
+		node3: schedframework.Success, node4: schedframework.Success}
+	for i := range nodes {
+		status := plugin.Filter(ctx, state, pod, newNodeInfo(&nodes[i]))
+		if status.Code() != expectCodes[nodes[i].Name] {
+			t.Fatalf("node %s: expect code %v, got %v", nodes[i].Name, expectCodes[nodes[i].Name], status.Code())
+		}
+	}
+	// node4 has 6 ips left and node3 has 4 ips left
+	scores := schedframework.NodeScoreList{}
+	for _, nodeName := range []string{node3, node4} {
+		score, status := plugin.Score(ctx, state, pod, nodeName)
+		if !status.IsSuccess() {
+			t.Fatal(status.Message())
+		}
+		scores = append(scores, schedframework.NodeScore{Name: nodeName, Score: score})
+	}
+	if status := plugin.ScoreExtensions().NormalizeScore(ctx, state, pod, scores); !status.IsSuccess() {
+		t.Fatal(status.Message())
+	}
+	if scores[0].Score != 66 || scores[1].Score != schedframework.MaxNodeScore-1 {
+		t.Fatalf("unexpected scores %v", scores)
+	}
+
+	// reserving on a cloned state, e.g. preemption dry run, doesn't affect the original one
+	cloned := state.Clone()
+	if status := plugin.Reserve(ctx, cloned, pod, node3); !status.IsSuccess() {
+		t.Fatal(status.Message())
+	}
+	plugin.Unreserve(ctx, cloned, pod, node3)
+	if s, err := getCycleState(state); err != nil || s.CniArgs != nil {
+		t.Fatalf("expect original state unchanged, got %+v, %v", s, err)
+	}
+
+	// prebind writes allocated ips into pod annotation
+	if status := plugin.PreBind(ctx, state, pod, node4); status.IsSuccess() {
+		t.Fatal("expect prebind to fail without reserve")
+	}
+	if status := plugin.Reserve(ctx, state, pod, node4); !status.IsSuccess() {
+		t.Fatal(status.Message())
+	}
+	if status := plugin.PreBind(ctx, state, pod, node4); !status.IsSuccess() {
+		t.Fatal(status.Message())
+	}
+	updated, err := plugin.client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cniArgs, err := constant.UnmarshalCniArgs(updated.Annotations[constant.ExtendedCNIArgsAnnotation])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cniArgs.Common.IPInfos) != 1 || !node4Subnet.Contains(cniArgs.Common.IPInfos[0].IP.IP) {
+		t.Fatalf("unexpected cni args %v", cniArgs)
+	}
+}
+
+func TestPreFilterBeforeReady(t *testing.T) {
+	plugin, stopChan, _ := createPlugin(t)
+	defer func() { stopChan <- struct{}{} }()
+	started := make(chan struct{})
+	plugin.ready = make(chan struct{})
+	plugin.start = func() { close(started) }
+	pod := CreateStatefulSetPod("pod1-0", "ns1", nil)
+	// the plugin starts on the first pod wanting floating ip and keeps the pod retrying until it's ready
+	if _, status := plugin.PreFilter(context.Background(), schedframework.NewCycleState(), pod); status.Code() !=
+		schedframework.Error {
+		t.Fatalf("expect an error status, got %v", status)
+	}
+	<-started
+	close(plugin.ready)
+	if _, status := plugin.PreFilter(context.Background(), schedframework.NewCycleState(), pod); !status.IsSuccess() {
+		t.Fatal(status.Message())
+	}
+}
+
+func newNodeInfo(node *corev1.Node) *schedframework.NodeInfo {
+	nodeInfo := schedframework.NewNodeInfo()
+	nodeInfo.SetNode(node)
+	return nodeInfo
+}
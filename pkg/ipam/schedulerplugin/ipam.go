@@ -49,17 +49,19 @@ func (p *FloatingIPPlugin) ensureIPAMConf(lastConf *string, newConf string) (boo
 	return true, nil
 }
 
-func (p *FloatingIPPlugin) allocateInSubnet(key string, subnet *net.IPNet, attr floatingip.Attr, when string) error {
-	ip, err := p.ipam.AllocateInSubnet(key, subnet, attr)
+func (p *FloatingIPPlugin) allocateInSubnet(key string, subnet *net.IPNet, families []nets.IPFamily,
+	attr floatingip.Attr, when string) error {
+	ips, err := p.ipam.AllocateInSubnetsAndIPRange(key, subnet, nil, families, attr)
 	if err != nil {
 		return err
 	}
-	glog.Infof("allocated ip %s to pod %s during %s", ip.String(), key, when)
+	glog.Infof("allocated ips %v to pod %s during %s", ips, key, when)
 	return nil
 }
 
-func (p *FloatingIPPlugin) allocateInSubnetWithKey(oldK, newK, subnet string, attr floatingip.Attr, when string) error {
-	if err := p.ipam.AllocateInSubnetWithKey(oldK, newK, subnet, attr); err != nil {
+func (p *FloatingIPPlugin) allocateInSubnetWithKey(oldK, newK, subnet string, families []nets.IPFamily,
+	attr floatingip.Attr, when string) error {
+	if err := p.ipam.AllocateInSubnetWithKey(oldK, newK, subnet, families, attr); err != nil {
 		return err
 	}
 	fip, err := p.ipam.First(newK)
@@ -70,9 +72,49 @@ func (p *FloatingIPPlugin) allocateInSubnetWithKey(oldK, newK, subnet string, at
 	return nil
 }
 
+// pickIPsByFamily picks the first ip of each family from ipInfos, and returns the picked ips in the order of
+// families and the families which have no ip in ipInfos. Families default to ipv4 if it is empty.
+func pickIPsByFamily(ipInfos []*floatingip.FloatingIPInfo, families []nets.IPFamily) (
+	[]*floatingip.FloatingIPInfo, []nets.IPFamily) {
+	var (
+		picked  []*floatingip.FloatingIPInfo
+		missing []nets.IPFamily
+	)
+	for _, family := range nets.DefaultFamilies(families) {
+		var found bool
+		for i := range ipInfos {
+			if ipInfos[i] != nil && nets.FamilyOf(ipInfos[i].IP) == family {
+				picked = append(picked, ipInfos[i])
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, family)
+		}
+	}
+	return picked, missing
+}
+
+// countByFamily returns the max number of ips of a single ip family. Since a dual stack pod allocates an ip for
+// each family, it equals to the number of pods holding these ips.
+func countByFamily(ipInfos []*floatingip.FloatingIPInfo) int {
+	counts := map[nets.IPFamily]int{}
+	var max int
+	for i := range ipInfos {
+		family := nets.FamilyOf(ipInfos[i].IP)
+		counts[family]++
+		if counts[family] > max {
+			max = counts[family]
+		}
+	}
+	return max
+}
+
 // #lizard forgives
 func (p *FloatingIPPlugin) getAvailableSubnet(keyObj *util.KeyObj, policy constant.ReleasePolicy, replicas int,
-	isPoolSizeDefined bool, ipranges [][]nets.IPRange) (subnets sets.String, reserve bool, err error) {
+	isPoolSizeDefined bool, ipranges [][]nets.IPRange, families []nets.IPFamily) (subnets sets.String, reserve bool,
+	err error) {
 	if keyObj.Deployment() && policy != constant.ReleasePolicyPodDelete {
 		if len(ipranges) > 0 {
 			// this introduce lots of complexity, don't support it for now
@@ -87,20 +129,37 @@ func (p *FloatingIPPlugin) getAvailableSubnet(keyObj *util.KeyObj, policy consta
 			err = fmt.Errorf("failed query prefix %s: %s", poolPrefix, err)
 			return
 		}
-		usedCount := 0
-		unusedSubnetSet := sets.NewString()
+		var used []*floatingip.FloatingIPInfo
+		unusedSubnets := map[nets.IPFamily]sets.String{}
 		for _, ip := range ips {
 			if ip.Key != poolPrefix {
 				if isPoolSizeDefined || keyObj.PoolName == "" {
-					usedCount++
+					used = append(used, ip)
 				} else {
 					if strings.HasPrefix(ip.Key, poolAppPrefix) {
 						// Don't counting in other deployments' used ip if sharing pool
-						usedCount++
+						used = append(used, ip)
 					}
 				}
 			} else {
-				unusedSubnetSet.Insert(ip.NodeSubnets.UnsortedList()...)
+				family := nets.FamilyOf(ip.IP)
+				if _, ok := unusedSubnets[family]; !ok {
+					unusedSubnets[family] = sets.NewString()
+				}
+				unusedSubnets[family].Insert(ip.NodeSubnets.UnsortedList()...)
+			}
+		}
+		usedCount := countByFamily(used)
+		// reserved ips of all requested families should be in the same subnet
+		unusedSubnetSet := sets.NewString()
+		for i, family := range nets.DefaultFamilies(families) {
+			if i == 0 {
+				unusedSubnetSet = unusedSubnets[family]
+			} else {
+				unusedSubnetSet = unusedSubnetSet.Intersection(unusedSubnets[family])
+			}
+			if unusedSubnetSet == nil {
+				unusedSubnetSet = sets.NewString()
 			}
 		}
 		glog.V(4).Infof("keyObj %v, unusedSubnetSet %v, usedCount %d, replicas %d, isPoolSizeDefined %v", keyObj,
@@ -108,7 +167,7 @@ func (p *FloatingIPPlugin) getAvailableSubnet(keyObj *util.KeyObj, policy consta
 		// check usedCount >= replicas to ensure upgrading a deployment won't change its ips
 		if usedCount >= replicas {
 			if isPoolSizeDefined {
-				return nil, false, fmt.Errorf("reached pool %s size limit of %d", keyObj.PoolName, replicas)
+				return nil, false, &poolSizeExceededError{pool: keyObj.PoolName, size: replicas}
 			}
 			return nil, false, fmt.Errorf("deployment %s has allocated %d ips with replicas of %d, wait for releasing",
 				keyObj.AppName, usedCount, replicas)
@@ -117,7 +176,7 @@ func (p *FloatingIPPlugin) getAvailableSubnet(keyObj *util.KeyObj, policy consta
 			return unusedSubnetSet, true, nil
 		}
 	}
-	if subnets, err = p.ipam.NodeSubnetsByIPRanges(ipranges); err != nil {
+	if subnets, err = p.ipam.NodeSubnetsByIPRanges(keyObj.KeyInDB, ipranges, families); err != nil {
 		err = fmt.Errorf("failed to query allocatable subnet: %v", err)
 		return
 	}
@@ -140,6 +199,7 @@ func (p *FloatingIPPlugin) releaseIP(key string, reason string) error {
 			reason, err)
 	}
 	glog.Infof("released floating ip %v from %s because of %s", released, key, reason)
+	p.recordAppRelease(key, released, reason)
 	return nil
 }
 
@@ -0,0 +1,161 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/api/k8s/schedulerapi"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// maxPriority is the max score a scheduler extender can give to a node
+const maxPriority = 10
+
+// Prioritize scores each node by the free floating ips of its subnet. Nodes whose subnet holds a reserved ip for
+// the pod score maxPriority, others score in proportion to the number of unallocated ips which the pod can use.
+func (p *FloatingIPPlugin) Prioritize(pod *corev1.Pod, nodes []corev1.Node) (*schedulerapi.HostPriorityList, error) {
+	start := time.Now()
+	list := &schedulerapi.HostPriorityList{}
+	if !p.hasResourceName(&pod.Spec) {
+		return list, nil
+	}
+	counts, reservedSubnets, err := p.countSubnets(pod)
+	if err != nil {
+		return list, err
+	}
+	nodeCounts := make([]int, len(nodes))
+	var maxCount int
+	for i := range nodes {
+		subnet, err := p.getNodeSubnet(&nodes[i])
+		if err != nil {
+			continue
+		}
+		if reservedSubnets.Has(subnet.String()) {
+			nodeCounts[i] = -1
+			continue
+		}
+		nodeCounts[i] = counts[subnet.String()]
+		if nodeCounts[i] > maxCount {
+			maxCount = nodeCounts[i]
+		}
+	}
+	for i := range nodes {
+		var score int
+		if nodeCounts[i] < 0 {
+			score = maxPriority
+		} else if maxCount > 0 {
+			// leave maxPriority for nodes having reserved ips
+			score = nodeCounts[i] * (maxPriority - 1) / maxCount
+		}
+		*list = append(*list, schedulerapi.HostPriority{Host: nodes[i].Name, Score: score})
+	}
+	glog.V(5).Infof("prioritize nodes %v for %s_%s", *list, pod.Namespace, pod.Name)
+	metrics.ScheduleLatency.WithLabelValues("prioritize").Observe(time.Since(start).Seconds())
+	return list, nil
+}
+
+// countSubnets returns the number of unallocated ips the pod can use of each node subnet and the node subnets
+// having reserved ips for the pod
+func (p *FloatingIPPlugin) countSubnets(pod *corev1.Pod) (map[string]int, sets.String, error) {
+	keyObj, err := util.FormatKey(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	cniArgs, err := getPodCniArgs(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	reservedSubnets, err := p.reservedSubnets(keyObj, parseReleasePolicy(&pod.ObjectMeta), &cniArgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.ipam.UnallocatedCountByNodeSubnet(keyObj.KeyInDB, cniArgs.RequestIPRange, cniArgs.RequestIPFamily),
+		reservedSubnets, nil
+}
+
+// reservedSubnets returns node subnets of ips which are already allocated to the pod's key, or reserved for the
+// pod's deployment or pool if the release policy is not ReleasePolicyPodDelete.
+func (p *FloatingIPPlugin) reservedSubnets(keyObj *util.KeyObj, policy constant.ReleasePolicy,
+	cniArgs *constant.CniArgs) (sets.String, error) {
+	ipInfos, err := p.ipam.ByKeyAndIPRanges(keyObj.KeyInDB, cniArgs.RequestIPRange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query by key %s: %v", keyObj.KeyInDB, err)
+	}
+	if len(cniArgs.RequestIPRange) == 0 {
+		ipInfos, _ = pickIPsByFamily(ipInfos, cniArgs.RequestIPFamily)
+	}
+	subnets := intersectNodeSubnets(ipInfos)
+	if subnets.Len() > 0 || !keyObj.Deployment() || policy == constant.ReleasePolicyPodDelete {
+		return subnets, nil
+	}
+	poolPrefix := keyObj.PoolPrefix()
+	ips, err := p.ipam.ByPrefix(poolPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed query prefix %s: %s", poolPrefix, err)
+	}
+	var reserved []*floatingip.FloatingIPInfo
+	for i := range ips {
+		if ips[i].Key == poolPrefix {
+			reserved = append(reserved, ips[i])
+		}
+	}
+	// reserved ips of all requested families should be in the same subnet
+	for _, family := range nets.DefaultFamilies(cniArgs.RequestIPFamily) {
+		familySubnets := sets.NewString()
+		for i := range reserved {
+			if nets.FamilyOf(reserved[i].IP) == family {
+				familySubnets.Insert(reserved[i].NodeSubnets.UnsortedList()...)
+			}
+		}
+		if subnets.Len() == 0 {
+			subnets = familySubnets
+		} else {
+			subnets = subnets.Intersection(familySubnets)
+		}
+		if subnets.Len() == 0 {
+			break
+		}
+	}
+	return subnets, nil
+}
+
+// intersectNodeSubnets returns the node subnets which contain all the given ips, nil ips are ignored
+func intersectNodeSubnets(ipInfos []*floatingip.FloatingIPInfo) sets.String {
+	subnets := sets.NewString()
+	var found bool
+	for i := range ipInfos {
+		if ipInfos[i] == nil {
+			continue
+		}
+		if !found {
+			subnets.Insert(ipInfos[i].NodeSubnets.UnsortedList()...)
+			found = true
+		} else {
+			subnets = subnets.Intersection(ipInfos[i].NodeSubnets)
+		}
+	}
+	return subnets
+}
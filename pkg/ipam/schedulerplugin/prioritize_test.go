@@ -0,0 +1,85 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/api/k8s/schedulerapi"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+)
+
+func TestPrioritize(t *testing.T) {
+	fipPlugin, stopChan, nodes := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	// pod has no floating ip resource name, prioritize should return an empty list
+	list, err := fipPlugin.Prioritize(&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "pod1", Namespace: "ns1"}}, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*list) != 0 {
+		t.Fatalf("expect empty list, got %v", *list)
+	}
+	// node4 has 6 ips left and node3 has 4 ips left
+	if err := checkPrioritizeResult(fipPlugin, pod, nodes, map[string]int{
+		drainedNode: 0, nodeHasNoIP: 0, node3: 6, node4: maxPriority - 1}); err != nil {
+		t.Fatal(err)
+	}
+	// node3 has a reserved ip for this pod
+	if err := fipPlugin.ipam.AllocateSpecificIP(podKey.KeyInDB, net.ParseIP("10.49.27.205"),
+		floatingip.Attr{Policy: constant.ReleasePolicyImmutable}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPrioritizeResult(fipPlugin, pod, nodes, map[string]int{
+		drainedNode: 0, nodeHasNoIP: 0, node3: maxPriority, node4: maxPriority - 1}); err != nil {
+		t.Fatal(err)
+	}
+	// request ip range which only node3 has
+	pod2 := CreateStatefulSetPod("pod2-0", "ns1", map[string]string{
+		constant.ExtendedCNIArgsAnnotation: `{"request_ip_range":[["10.49.27.216~10.49.27.218"]]}`})
+	if err := checkPrioritizeResult(fipPlugin, pod2, nodes, map[string]int{
+		drainedNode: 0, nodeHasNoIP: 0, node3: maxPriority - 1, node4: 0}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkPrioritizeResult(fipPlugin *FloatingIPPlugin, pod *corev1.Pod, nodes []corev1.Node,
+	expect map[string]int) error {
+	list, err := fipPlugin.Prioritize(pod, nodes)
+	if err != nil {
+		return err
+	}
+	got := map[string]int{}
+	for _, hp := range *list {
+		got[hp.Host] = hp.Score
+	}
+	if len(got) != len(expect) {
+		return fmt.Errorf("expect %v, got %v", expect, got)
+	}
+	for host, score := range expect {
+		if got[host] != score {
+			return fmt.Errorf("expect %v, got %v", expect, schedulerapi.HostPriorityList(*list))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+// Reasons of the warning events recorded on pods
+const (
+	// ReasonNoFloatingIPInSubnet means no node subnet has floating ips left for the pod
+	ReasonNoFloatingIPInSubnet = "NoFloatingIPInSubnet"
+	// ReasonQuotaExceeded means the namespace of the pod holds as many ips as its quota
+	ReasonQuotaExceeded = "FloatingIPQuotaExceeded"
+	// ReasonPoolSizeExceeded means the pool of the pod has allocated as many ips as its size
+	ReasonPoolSizeExceeded = "PoolSizeExceeded"
+	// ReasonCloudProviderAssignFailed means cloud provider failed to assign the ip to the node
+	ReasonCloudProviderAssignFailed = "CloudProviderAssignFailed"
+	// ReasonCloudProviderUnAssignFailed means cloud provider failed to unassign the ip from the node
+	ReasonCloudProviderUnAssignFailed = "CloudProviderUnAssignFailed"
+	// ReasonIPReservedForAnotherKey means the ip in the pod annotation is allocated to another pod or pool
+	ReasonIPReservedForAnotherKey = "IPReservedForAnotherKey"
+	// ReasonFilterFailed is the reason of other filter errors
+	ReasonFilterFailed = "FloatingIPFilterFailed"
+	// ReasonBindFailed is the reason of other bind errors
+	ReasonBindFailed = "FloatingIPBindFailed"
+	// ReasonReleaseFailed is the reason of other unbind errors
+	ReasonReleaseFailed = "FloatingIPReleaseFailed"
+)
+
+// ReasonFloatingIPReleased is the reason of the normal events recorded on deployments and statefulsets when ips of
+// their deleted pods are released because of scaling down or ttl expiring
+const ReasonFloatingIPReleased = "FloatingIPReleased"
+
+// poolSizeExceededError is returned by filter if a pool has allocated as many ips as its size
+type poolSizeExceededError struct {
+	pool string
+	size int
+}
+
+func (e *poolSizeExceededError) Error() string {
+	return fmt.Sprintf("reached pool %s size limit of %d", e.pool, e.size)
+}
+
+// cloudProviderError is an error of assigning or unassigning ips by cloud provider
+type cloudProviderError struct {
+	unassign bool
+	err      error
+}
+
+func (e *cloudProviderError) Error() string {
+	return e.err.Error()
+}
+
+func (e *cloudProviderError) Unwrap() error {
+	return e.err
+}
+
+// ipReservedError is returned if an ip requested by a pod is held by another key or another pod of the same key
+type ipReservedError struct {
+	err error
+}
+
+func (e *ipReservedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ipReservedError) Unwrap() error {
+	return e.err
+}
+
+// podEventReason returns the reason of err, or defaultReason if err is not a known one
+func podEventReason(err error, defaultReason string) string {
+	var (
+		poolErr     *poolSizeExceededError
+		cloudErr    *cloudProviderError
+		reservedErr *ipReservedError
+	)
+	switch {
+	case errors.Is(err, floatingip.ErrNoEnoughIP):
+		return ReasonNoFloatingIPInSubnet
+	case errors.Is(err, floatingip.ErrQuotaExceeded):
+		return ReasonQuotaExceeded
+	case errors.As(err, &poolErr):
+		return ReasonPoolSizeExceeded
+	case errors.As(err, &cloudErr):
+		if cloudErr.unassign {
+			return ReasonCloudProviderUnAssignFailed
+		}
+		return ReasonCloudProviderAssignFailed
+	case errors.As(err, &reservedErr):
+		return ReasonIPReservedForAnotherKey
+	}
+	return defaultReason
+}
+
+// recordPodError records a warning event of err on the pod
+func (p *FloatingIPPlugin) recordPodError(pod *corev1.Pod, err error, defaultReason string) {
+	p.Recorder.Event(pod, corev1.EventTypeWarning, podEventReason(err, defaultReason), err.Error())
+}
+
+// releasedReasons are the release reasons recorded on apps and their messages
+var releasedReasons = map[string]string{
+	deletedAndScaledDownAppPod: "its index is not less than replicas after scaling down",
+	deletedAndScaledDownDpPod:  "the deployment holds more ips than replicas after scaling down",
+	deletedAndTTLExpiredPod:    "its release ttl expired",
+}
+
+// recordAppRelease records a normal event on the deployment or statefulset of the key if ips are released because
+// of scaling down or ttl expiring. The reason starts with one of the release reason constants.
+func (p *FloatingIPPlugin) recordAppRelease(key string, released map[string]string, reason string) {
+	var msg string
+	for r, m := range releasedReasons {
+		if strings.HasPrefix(reason, r) {
+			msg = m
+			break
+		}
+	}
+	keyObj := util.ParseKey(key)
+	if msg == "" || keyObj.PodName == "" {
+		return
+	}
+	ref := &corev1.ObjectReference{APIVersion: "apps/v1", Namespace: keyObj.Namespace, Name: keyObj.AppName}
+	if keyObj.Deployment() {
+		ref.Kind = "Deployment"
+	} else if keyObj.StatefulSet() {
+		ref.Kind = "StatefulSet"
+	} else {
+		return
+	}
+	ips := make([]string, 0, len(released))
+	for ip := range released {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	p.Recorder.Eventf(ref, corev1.EventTypeNormal, ReasonFloatingIPReleased, "released ips %v of pod %s because %s",
+		ips, keyObj.PodName, msg)
+}
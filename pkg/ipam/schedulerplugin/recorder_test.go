@@ -0,0 +1,140 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/api/k8s/schedulerapi"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+func TestPodEventReason(t *testing.T) {
+	for i, testCase := range []struct {
+		err    error
+		expect string
+	}{
+		{err: fmt.Errorf("allocate: %w", floatingip.ErrNoEnoughIP), expect: ReasonNoFloatingIPInSubnet},
+		{err: floatingip.ErrQuotaExceeded, expect: ReasonQuotaExceeded},
+		{err: fmt.Errorf("filter: %w", &poolSizeExceededError{pool: "pool1", size: 1}), expect: ReasonPoolSizeExceeded},
+		{err: &cloudProviderError{err: fmt.Errorf("timeout")}, expect: ReasonCloudProviderAssignFailed},
+		{err: &cloudProviderError{unassign: true, err: fmt.Errorf("timeout")},
+			expect: ReasonCloudProviderUnAssignFailed},
+		{err: &ipReservedError{err: fmt.Errorf("conflict")}, expect: ReasonIPReservedForAnotherKey},
+		{err: fmt.Errorf("unknown"), expect: ReasonBindFailed},
+	} {
+		if reason := podEventReason(testCase.err, ReasonBindFailed); reason != testCase.expect {
+			t.Errorf("case %d: expect %s, real %s", i, testCase.expect, reason)
+		}
+	}
+	if msg := (&poolSizeExceededError{pool: "pool1", size: 1}).Error(); msg != "reached pool pool1 size limit of 1" {
+		t.Errorf("unexpected message %s", msg)
+	}
+}
+
+// #lizard forgives
+func TestRecordPodEvents(t *testing.T) {
+	pod := CreateStatefulSetPod("sts-xxx-0", "ns1", immutableAnnotation)
+	keyObj, _ := util.FormatKey(pod)
+	fipPlugin, stopChan, nodes := createPluginTestNodes(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	// no floating ips left on drainedNode and no floating ips configured for nodeHasNoIP
+	if _, _, err := fipPlugin.Filter(pod, nodes[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkEvents(fipPlugin, "Warning NoFloatingIPInSubnet no floating ips left in subnets of 1 nodes, "+
+		"quota exceeded in subnets of 0 nodes"); err != nil {
+		t.Fatal(err)
+	}
+	// ip of the key is still used by a former pod with the same name
+	if err := fipPlugin.ipam.AllocateSpecificIP(keyObj.KeyInDB, net.ParseIP("10.49.27.205"),
+		floatingip.Attr{Policy: constant.ReleasePolicyImmutable, NodeName: node3, Uid: "former-uid"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.Bind(&schedulerapi.ExtenderBindingArgs{
+		PodName: pod.Name, PodNamespace: pod.Namespace, Node: node3}); err == nil {
+		t.Fatal("expect an error")
+	}
+	if err := checkEvents(fipPlugin, fmt.Sprintf("Warning IPReservedForAnotherKey waiting for delete event of "+
+		"%s before reuse this ip", keyObj.KeyInDB)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordAppRelease(t *testing.T) {
+	for i, testCase := range []struct {
+		annotations map[string]string
+		replicas    int32
+		expect      string
+	}{
+		{annotations: immutableAnnotation, replicas: 0, expect: "Normal FloatingIPReleased released ips [%s] of pod " +
+			"sts-xxx-0 because its index is not less than replicas after scaling down"},
+		// the ip is kept for the pod
+		{annotations: immutableAnnotation, replicas: 1},
+		// ips released because of pod delete policy are not recorded
+		{annotations: nil, replicas: 1},
+	} {
+		pod := CreateStatefulSetPod("sts-xxx-0", "ns1", testCase.annotations)
+		keyObj, _ := util.FormatKey(pod)
+		sts := CreateStatefulSet(pod.ObjectMeta, testCase.replicas)
+		func() {
+			fipPlugin, stopChan, _ := createPluginTestNodes(t, pod, sts)
+			defer func() { stopChan <- struct{}{} }()
+			fip, err := checkBind(fipPlugin, pod, node3, keyObj.KeyInDB, node3Subnet)
+			if err != nil {
+				t.Fatalf("case %d: %v", i, err)
+			}
+			if err := fipPlugin.unbind(pod); err != nil {
+				t.Fatalf("case %d: %v", i, err)
+			}
+			var expect []string
+			if testCase.expect != "" {
+				expect = append(expect, fmt.Sprintf(testCase.expect, fip.IP.String()))
+			}
+			if err := checkEvents(fipPlugin, expect...); err != nil {
+				t.Fatalf("case %d: %v", i, err)
+			}
+		}()
+	}
+}
+
+// checkEvents drains events recorded by the fake recorder and compares them with expect
+func checkEvents(fipPlugin *FloatingIPPlugin, expect ...string) error {
+	recorder := fipPlugin.Recorder.(*record.FakeRecorder)
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+			continue
+		default:
+		}
+		break
+	}
+	if len(events) != len(expect) || (len(expect) > 0 && !reflect.DeepEqual(events, expect)) {
+		return fmt.Errorf("expect events %s, real %s", strings.Join(expect, "; "), strings.Join(events, "; "))
+	}
+	return nil
+}
@@ -18,10 +18,12 @@ package schedulerplugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metaErrs "k8s.io/apimachinery/pkg/api/errors"
@@ -45,6 +47,7 @@ type resyncObj struct {
 // 3. deleted pods whose parent deployment no need so many ips
 // 4. deleted pods whose parent statefulset/tapp exist but pod index > .spec.replica
 // 5. existing pods but its status is evicted
+// 6. deleted pods with ttl release policy whose ttl has expired
 func (p *FloatingIPPlugin) resyncPod() error {
 	glog.V(4).Infof("resync pods+")
 	defer glog.V(4).Infof("resync pods-")
@@ -128,6 +131,18 @@ func (p *FloatingIPPlugin) resyncAllocatedIPs(meta *resyncMeta) {
 				}
 			}
 			releasePolicy := constant.ReleasePolicy(obj.fip.Policy)
+			if releasePolicy == constant.ReleasePolicyTTL && obj.fip.PodUid == "" && obj.fip.NodeName == "" {
+				// the ip has been kept since the pod was deleted
+				if expire := obj.fip.UpdatedAt.Add(obj.fip.TTL); time.Now().Before(expire) {
+					glog.V(4).Infof("keep ip %s for %s until %s", obj.fip.IP.String(), key,
+						expire.Format(time.RFC3339))
+					return
+				}
+				if err := p.releaseIP(key, fmt.Sprintf("%s during resync", deletedAndTTLExpiredPod)); err != nil {
+					glog.Error(err)
+				}
+				return
+			}
 			if !obj.keyObj.Deployment() {
 				if err := p.unbindNoneDpPod(obj.keyObj, releasePolicy, "during resync"); err != nil {
 					glog.Error(err)
@@ -238,6 +253,10 @@ func (p *FloatingIPPlugin) syncPodIP(pod *corev1.Pod) error {
 		}
 		if err := p.syncIP(keyObj.KeyInDB, ipInfos[i].IP.IP, pod); err != nil {
 			glog.Warningf("sync pod %s ip %s: %v", keyObj.KeyInDB, ipInfos[i].IP.IP.String(), err)
+			var reservedErr *ipReservedError
+			if errors.As(err, &reservedErr) {
+				p.recordPodError(pod, err, ReasonIPReservedForAnotherKey)
+			}
 		}
 	}
 	return nil
@@ -251,11 +270,12 @@ func (p *FloatingIPPlugin) syncIP(key string, ip net.IP, pod *corev1.Pod) error
 	storedKey := fip.Key
 	if storedKey != "" {
 		if storedKey != key {
-			return fmt.Errorf("conflict ip %s found for both %s and %s", ip.String(), key, storedKey)
+			return &ipReservedError{err: fmt.Errorf("conflict ip %s found for both %s and %s", ip.String(), key,
+				storedKey)}
 		}
 	} else {
-		attr := floatingip.Attr{
-			Policy: parseReleasePolicy(&pod.ObjectMeta), NodeName: pod.Spec.NodeName, Uid: string(pod.UID)}
+		attr := floatingip.Attr{Policy: parseReleasePolicy(&pod.ObjectMeta), NodeName: pod.Spec.NodeName,
+			Uid: string(pod.UID), TTL: parseReleaseTTL(&pod.ObjectMeta)}
 		if err := p.ipam.AllocateSpecificIP(key, ip, attr); err != nil {
 			return err
 		}
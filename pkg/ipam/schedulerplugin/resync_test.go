@@ -19,12 +19,14 @@ package schedulerplugin
 import (
 	"net"
 	"testing"
+	"time"
 
 	appv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
 	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
@@ -178,3 +180,40 @@ func TestResyncPodUidChanged(t *testing.T) {
 		t.Fatal(fip.NodeName)
 	}
 }
+
+func TestResyncTTLPod(t *testing.T) {
+	pod := CreateStatefulSetPod("sts-xxx-0", "ns1", ttlAnnotation("1h"))
+	ip := net.ParseIP("10.49.27.205")
+	fipPlugin, stopChan, _ := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	podKey, _ := util.FormatKey(pod)
+	attr := floatingip.Attr{Policy: parseReleasePolicy(&pod.ObjectMeta), NodeName: "node-1", Uid: "uid-1",
+		TTL: parseReleaseTTL(&pod.ObjectMeta)}
+	if err := fipPlugin.ipam.AllocateSpecificIP(podKey.KeyInDB, ip, attr); err != nil {
+		t.Fatal(err)
+	}
+	// pod is deleted, ip is kept under pod key until ttl expires
+	for i := 0; i < 2; i++ {
+		if err := fipPlugin.resyncPod(); err != nil {
+			t.Fatal(err)
+		}
+		fip, err := fipPlugin.ipam.ByIP(ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fip.Key != podKey.KeyInDB || fip.PodUid != "" || fip.NodeName != "" || fip.TTL != time.Hour {
+			t.Fatalf("expect ip kept for %s with ttl 1h, got %v ttl %v", podKey.KeyInDB, fip, fip.TTL)
+		}
+	}
+	if err := fipPlugin.ipam.UpdateAttr(podKey.KeyInDB, ip, floatingip.Attr{Policy: constant.ReleasePolicyTTL,
+		TTL: time.Nanosecond}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := fipPlugin.resyncPod(); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKey(fipPlugin.ipam, ip.String(), ""); err != nil {
+		t.Fatal(err)
+	}
+}
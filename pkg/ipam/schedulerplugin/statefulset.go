@@ -30,6 +30,9 @@ func (p *FloatingIPPlugin) unbindNoneDpPod(keyObj *util.KeyObj, policy constant.
 		return p.releaseIP(key, fmt.Sprintf("%s %s", deletedAndIPMutablePod, when))
 	} else if policy == constant.ReleasePolicyNever {
 		return p.reserveIP(key, key, fmt.Sprintf("never release policy %s", when))
+	} else if policy == constant.ReleasePolicyTTL {
+		// resync releases it once ttl expires
+		return p.reserveIP(key, key, fmt.Sprintf("ttl release policy %s", when))
 	} else if policy == constant.ReleasePolicyImmutable {
 		appExist, replicas, err := p.checkAppAndReplicas(keyObj)
 		if err != nil {
@@ -31,12 +31,15 @@ const (
 	deletedAndParentAppNotExistPod = "deletedAndParentAppNotExistPod"
 	deletedAndScaledDownAppPod     = "deletedAndScaledDownAppPod"
 	deletedAndScaledDownDpPod      = "deletedAndScaledDownDpPod"
+	deletedAndTTLExpiredPod        = "deletedAndTTLExpiredPod"
 )
 
 var (
 	NoReplicas          = NotSupportedReleasePolicyError(errors.New("parent workload has no replicas"))
 	NotStatefulWorkload = NotSupportedReleasePolicyError(
 		errors.New("pod name doesn't match '.*-[0-9]*$', assume its parent is not a stateful workload"))
+	TTLForDeployment = NotSupportedReleasePolicyError(
+		errors.New("deployment pods get new names when rescheduled, they can't get back ips kept under pod names"))
 )
 
 type Conf struct {
@@ -46,6 +49,8 @@ type Conf struct {
 	ConfigMapNamespace    string                       `json:"configMapNamespace"`
 	FloatingIPKey         string                       `json:"floatingipKey"` // configmap floatingip data key
 	CloudProviderGRPCAddr string                       `json:"cloudProviderGrpcAddr"`
+	StorageDriver         string                       `json:"storageDriver"` // crd or bolt
+	BoltDBPath            string                       `json:"boltDBPath"`    // bolt file path of bolt driver
 }
 
 func (conf *Conf) validate() {
@@ -61,6 +66,12 @@ func (conf *Conf) validate() {
 	if conf.FloatingIPKey == "" {
 		conf.FloatingIPKey = "floatingips"
 	}
+	if conf.StorageDriver == "" {
+		conf.StorageDriver = floatingip.CrdStoreDriver
+	}
+	if conf.BoltDBPath == "" {
+		conf.BoltDBPath = "/var/lib/galaxy-ipam/ipam.db"
+	}
 }
 
 type ReleaseRequest struct {
@@ -0,0 +1,209 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/api/k8s"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+	"tkestack.io/galaxy/pkg/utils/nets"
+)
+
+// ValidatePod checks galaxy annotations of a pod to be created, so that bad values are rejected before the pod is
+// scheduled
+// #lizard forgives
+func (p *FloatingIPPlugin) ValidatePod(pod *corev1.Pod) error {
+	annotations := pod.GetAnnotations()
+	policyStr, ok := annotations[constant.ReleasePolicyAnnotation]
+	if ok && policyStr != "" && policyStr != constant.Immutable && policyStr != constant.Never &&
+		policyStr != constant.TTL {
+		return fmt.Errorf("invalid %s annotation %q, expect one of %q, %q, %q or empty", constant.ReleasePolicyAnnotation,
+			policyStr, constant.Immutable, constant.Never, constant.TTL)
+	}
+	if ttlStr := annotations[constant.ReleaseTTLAnnotation]; ttlStr != "" {
+		if ttl, err := time.ParseDuration(ttlStr); err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid %s annotation %q, expect a positive duration like 30m",
+				constant.ReleaseTTLAnnotation, ttlStr)
+		}
+	}
+	cniArgs, err := constant.UnmarshalCniArgs(annotations[constant.ExtendedCNIArgsAnnotation])
+	if err != nil {
+		return fmt.Errorf("invalid %s annotation: %v", constant.ExtendedCNIArgsAnnotation, err)
+	}
+	if pool := constant.GetPool(annotations); pool != "" {
+		if errs := validation.IsDNS1123Subdomain(pool); len(errs) > 0 {
+			return fmt.Errorf("invalid %s annotation %q: %v", constant.IPPoolAnnotation, pool, errs)
+		}
+	}
+	if networks := annotations[constant.MultusCNIAnnotation]; networks != "" {
+		if _, err := k8s.ParsePodNetworkAnnotation(networks); err != nil {
+			return fmt.Errorf("invalid %s annotation: %v", constant.MultusCNIAnnotation, err)
+		}
+	}
+	if !p.hasResourceName(&pod.Spec) {
+		return nil
+	}
+	if cniArgs != nil {
+		if err := p.validateIPRanges(cniArgs.RequestIPRange); err != nil {
+			return err
+		}
+	}
+	policy := parseReleasePolicy(&pod.ObjectMeta)
+	if policy == constant.ReleasePolicyPodDelete {
+		return nil
+	}
+	if pod.Name == "" {
+		// pod name is generated by apiserver after admission, validate its prefix
+		pod = pod.DeepCopy()
+		pod.Name = pod.GenerateName
+	}
+	keyObj, err := util.FormatKey(pod)
+	if err != nil {
+		return fmt.Errorf("release policy %s is not supported for pod %s: %v", constant.PolicyStr(policy),
+			pod.Name, err)
+	}
+	if err := p.supportReserveIPPolicy(keyObj, policy); err != nil {
+		return fmt.Errorf("release policy %s is not supported for pod %s: %w", constant.PolicyStr(policy),
+			pod.Name, err)
+	}
+	return nil
+}
+
+// validateIPRanges checks each requested []nets.IPRange has ips in configured pools
+func (p *FloatingIPPlugin) validateIPRanges(ipranges [][]nets.IPRange) error {
+	if len(ipranges) == 0 {
+		return nil
+	}
+	pools, err := p.webhookPools()
+	if err != nil {
+		return fmt.Errorf("failed to get pools: %v", err)
+	}
+	var poolRanges []nets.IPRange
+	for _, pool := range pools {
+		poolRanges = append(poolRanges, pool.IPRanges...)
+	}
+	for _, ranges := range ipranges {
+		if len(ranges) == 0 {
+			return fmt.Errorf("invalid %s annotation: empty request_ip_range element",
+				constant.ExtendedCNIArgsAnnotation)
+		}
+		if sizeOf(nets.SubtractIPRanges(ranges, poolRanges)) == sizeOf(ranges) {
+			return fmt.Errorf("request ip range %v is outside of any configured pool", ranges)
+		}
+	}
+	return nil
+}
+
+func sizeOf(ranges []nets.IPRange) uint64 {
+	var size uint64
+	for i := range ranges {
+		size += ranges[i].Size()
+	}
+	return size
+}
+
+// configPoolsTTL is how long pools read from config are cached for webhooks
+const configPoolsTTL = time.Minute
+
+// SubnetOf returns the subnet of the pool which the ip belongs to, or nil if it's not within any pool. It's used by
+// the conversion webhook.
+func (p *FloatingIPPlugin) SubnetOf(ip net.IP) *net.IPNet {
+	if atomic.LoadInt32(&p.initialized) == 1 {
+		// ipam knows subnets of draining pools as well
+		fip, err := p.ipam.ByIP(ip)
+		if err != nil {
+			return nil
+		}
+		return fip.Subnet()
+	}
+	pools, err := p.webhookPools()
+	if err != nil {
+		glog.Warningf("failed to get pools: %v", err)
+		return nil
+	}
+	for _, pool := range pools {
+		if pool.IPNet().Contains(ip) && pool.Contains(ip) {
+			return pool.IPNet()
+		}
+	}
+	return nil
+}
+
+// webhookPools returns pools for webhooks. Webhooks are served on every replica while Init only runs on the leader,
+// so pools are read from config without configuring ipam until the plugin is initialized.
+func (p *FloatingIPPlugin) webhookPools() ([]*floatingip.FloatingIPPool, error) {
+	if atomic.LoadInt32(&p.initialized) == 1 {
+		return p.ipam.Pools(), nil
+	}
+	p.configPoolsLock.Lock()
+	defer p.configPoolsLock.Unlock()
+	if !p.configPoolsTime.IsZero() && time.Since(p.configPoolsTime) < configPoolsTTL {
+		return p.configPools, nil
+	}
+	pools, err := p.readConfigPools()
+	if err != nil {
+		return nil, err
+	}
+	p.configPools, p.configPoolsTime = pools, time.Now()
+	return pools, nil
+}
+
+// readConfigPools reads pools from json config, FloatingIPPool crds or the configmap in the same order as Init
+func (p *FloatingIPPlugin) readConfigPools() ([]*floatingip.FloatingIPPool, error) {
+	if len(p.conf.FloatingIPs) > 0 {
+		return append([]*floatingip.FloatingIPPool{}, p.conf.FloatingIPs...), nil
+	}
+	if p.FIPPoolLister != nil {
+		pools, err := p.FIPPoolLister.List(labels.Everything())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list FloatingIPPool: %v", err)
+		}
+		if len(pools) > 0 {
+			sort.Slice(pools, func(i, j int) bool {
+				return pools[i].Name < pools[j].Name
+			})
+			confs := make([]*floatingip.FloatingIPPool, len(pools))
+			for i := range pools {
+				if confs[i], err = validateFIPPool(pools[i], pools[:i], confs[:i]); err != nil {
+					return nil, fmt.Errorf("invalid FloatingIPPool %s: %v", pools[i].Name, err)
+				}
+			}
+			return confs, nil
+		}
+	}
+	val, err := p.getConfigMapConf()
+	if err != nil {
+		return nil, err
+	}
+	var confs []*floatingip.FloatingIPPool
+	if err := json.Unmarshal([]byte(val), &confs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configmap val %s to floatingip config: %v", val, err)
+	}
+	return confs, nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/context"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	"tkestack.io/galaxy/pkg/ipam/utils"
+)
+
+func TestValidatePod(t *testing.T) {
+	fipPlugin, stopChan, _ := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	noResourcePod := CreateSimplePod("pod1", "ns1", neverAnnotation)
+	noResourcePod.Spec.Containers[0].Resources = corev1.ResourceRequirements{}
+	generatedNamePod := CreateSimplePod("", "ns1", neverAnnotation)
+	generatedNamePod.GenerateName = "pod-"
+	for i, testCase := range []struct {
+		pod       *corev1.Pod
+		expectErr bool
+	}{
+		{pod: CreateStatefulSetPod("sts-0", "ns1", nil)},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", neverAnnotation)},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", ttlAnnotation("10m"))},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", map[string]string{constant.ReleasePolicyAnnotation: "forever"}),
+			expectErr: true},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", ttlAnnotation("10")), expectErr: true},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", map[string]string{
+			constant.ExtendedCNIArgsAnnotation: `{"request_ip_range":[["10.49.27.216~10.49.27.218"]]}`})},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", map[string]string{
+			constant.ExtendedCNIArgsAnnotation: `{"request_ip_range":[["10.49.27.216~10.49.27.2"]]}`}),
+			expectErr: true},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", map[string]string{
+			constant.ExtendedCNIArgsAnnotation: `{"request_ip_range":[["10.49.26.2~10.49.26.10"]]}`}),
+			expectErr: true},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", map[string]string{
+			constant.ExtendedCNIArgsAnnotation: `{"request_ip_family":["ipv5"]}`}), expectErr: true},
+		{pod: CreateDeploymentPod("dp-xxx-yyy", "ns1", poolAnnotation("pool1"))},
+		{pod: CreateDeploymentPod("dp-xxx-yyy", "ns1", poolAnnotation("pool_1")), expectErr: true},
+		{pod: CreateDeploymentPod("dp-xxx-yyy", "ns1", ttlAnnotation("")), expectErr: true},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", map[string]string{constant.MultusCNIAnnotation: "galaxy-k8s-vlan"})},
+		{pod: CreateStatefulSetPod("sts-0", "ns1", map[string]string{constant.MultusCNIAnnotation: "a/b/c"}),
+			expectErr: true},
+		// never release policy is not supported for pods whose names don't match '.*-[0-9]*$'
+		{pod: CreateSimplePod("pod1", "ns1", neverAnnotation), expectErr: true},
+		{pod: generatedNamePod, expectErr: true},
+		// release policy is not checked for pods not requesting floating ip
+		{pod: noResourcePod},
+	} {
+		err := fipPlugin.ValidatePod(testCase.pod)
+		if (err != nil) != testCase.expectErr {
+			t.Errorf("case %d: expect error %v, got %v", i, testCase.expectErr, err)
+		}
+	}
+}
+
+// TestWebhookBeforeInit checks webhooks work on replicas which are not the leader, i.e. the plugin is not initialized
+func TestWebhookBeforeInit(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Name: "testConf", Namespace: "demo"},
+		Data: map[string]string{
+			"key": `[{"routableSubnet":"10.49.27.0/24","ips":["10.49.27.216~10.49.27.218"],"subnet":"10.49.27.0/24","gateway":"10.49.27.1","vlan":2}]`,
+		},
+	}
+	var jsonConf Conf
+	if err := json.Unmarshal([]byte(utils.TestConfig), &jsonConf); err != nil {
+		t.Fatal(err)
+	}
+	cmConf := jsonConf
+	cmConf.FloatingIPs = nil
+	cmConf.ConfigMapName, cmConf.ConfigMapNamespace, cmConf.FloatingIPKey = cm.Name, cm.Namespace, "key"
+	for i, conf := range []Conf{jsonConf, cmConf} {
+		ctx, stopChan := context.CreateTestIPAMContext([]runtime.Object{cm}, nil, nil)
+		fipPlugin, err := NewFloatingIPPlugin(conf, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inPool := CreateStatefulSetPod("sts-0", "ns1", map[string]string{
+			constant.ExtendedCNIArgsAnnotation: `{"request_ip_range":[["10.49.27.216~10.49.27.218"]]}`})
+		if err := fipPlugin.ValidatePod(inPool); err != nil {
+			t.Errorf("case %d: %v", i, err)
+		}
+		outOfPool := CreateStatefulSetPod("sts-0", "ns1", map[string]string{
+			constant.ExtendedCNIArgsAnnotation: `{"request_ip_range":[["10.49.26.2~10.49.26.10"]]}`})
+		if err := fipPlugin.ValidatePod(outOfPool); err == nil {
+			t.Errorf("case %d: expect an error for ips out of pools", i)
+		}
+		if subnet := fipPlugin.SubnetOf(net.ParseIP("10.49.27.216")); subnet == nil ||
+			subnet.String() != "10.49.27.0/24" {
+			t.Errorf("case %d: expect subnet 10.49.27.0/24, real %v", i, subnet)
+		}
+		if subnet := fipPlugin.SubnetOf(net.ParseIP("10.49.26.2")); subnet != nil {
+			t.Errorf("case %d: expect no subnet, real %v", i, subnet)
+		}
+		close(stopChan)
+	}
+}
@@ -18,6 +18,7 @@ package options
 
 import (
 	"flag"
+	"time"
 
 	"github.com/spf13/pflag"
 )
@@ -32,6 +33,20 @@ type ServerRunOptions struct {
 	KubeConf       string
 	Swagger        bool
 	LeaderElection LeaderElectionConfiguration
+	// WebhookPort serves the pod validating admission webhook if WebhookCertFile and WebhookKeyFile are set
+	WebhookPort     int
+	WebhookCertFile string
+	WebhookKeyFile  string
+	// ConversionWebhookService is the namespace/name of the service routing to WebhookPort, FloatingIP v1 is served
+	// with the conversion webhook if it's set together with WebhookCAFile
+	ConversionWebhookService string
+	WebhookCAFile            string
+	// APICertFile and APIKeyFile serve the API over https if set
+	APICertFile string
+	APIKeyFile  string
+	// APIAuth authenticates API requests by TokenReview and authorizes them by SubjectAccessReview
+	APIAuth         bool
+	APIAuthCacheTTL time.Duration
 }
 
 var (
@@ -45,12 +60,14 @@ func init() {
 
 func NewServerRunOptions() *ServerRunOptions {
 	opt := &ServerRunOptions{
-		Profiling:      true,
-		Bind:           "0.0.0.0",
-		Port:           9040,
-		APIPort:        9041,
-		Swagger:        false,
-		LeaderElection: DefaultLeaderElectionConfiguration(),
+		Profiling:       true,
+		Bind:            "0.0.0.0",
+		Port:            9040,
+		APIPort:         9041,
+		Swagger:         false,
+		LeaderElection:  DefaultLeaderElectionConfiguration(),
+		WebhookPort:     9443,
+		APIAuthCacheTTL: 10 * time.Second,
 	}
 	opt.LeaderElection.LeaderElect = true
 	return opt
@@ -65,5 +82,23 @@ func (s *ServerRunOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.Master, "master", s.Master, "The address and port of the Kubernetes API server")
 	fs.StringVar(&s.KubeConf, "kubeconfig", s.KubeConf, "The kube config file location of APISwitch, used to support TLS")
 	fs.BoolVar(&s.Swagger, "swagger", s.Swagger, "Enable swagger via API web interface host:api-port/apidocs.json/")
+	fs.IntVar(&s.WebhookPort, "webhook-port", s.WebhookPort, "The https port on which to serve the pod validating "+
+		"admission webhook")
+	fs.StringVar(&s.WebhookCertFile, "webhook-cert-file", s.WebhookCertFile, "The tls certificate file of the "+
+		"admission webhook, the webhook is disabled if it's empty")
+	fs.StringVar(&s.WebhookKeyFile, "webhook-key-file", s.WebhookKeyFile, "The tls private key file of the "+
+		"admission webhook")
+	fs.StringVar(&s.ConversionWebhookService, "conversion-webhook-service", s.ConversionWebhookService, "The "+
+		"namespace/name of the service routing to webhook-port, FloatingIP v1 is served with the conversion webhook "+
+		"of this service if it's set together with webhook-ca-file")
+	fs.StringVar(&s.WebhookCAFile, "webhook-ca-file", s.WebhookCAFile, "The ca file which signs webhook-cert-file, "+
+		"it's used as the ca bundle of the conversion webhook")
+	fs.StringVar(&s.APICertFile, "api-tls-cert-file", s.APICertFile, "The tls certificate file of the API, the API is "+
+		"served over http if it's empty")
+	fs.StringVar(&s.APIKeyFile, "api-tls-key-file", s.APIKeyFile, "The tls private key file of the API")
+	fs.BoolVar(&s.APIAuth, "api-auth", s.APIAuth, "Authenticate bearer tokens of API requests by TokenReview and "+
+		"authorize them by SubjectAccessReview against resources of ipam.galaxy.k8s.io")
+	fs.DurationVar(&s.APIAuthCacheTTL, "api-auth-cache-ttl", s.APIAuthCacheTTL, "How long to cache TokenReview and "+
+		"SubjectAccessReview results")
 	BindFlags(&s.LeaderElection, fs)
 }
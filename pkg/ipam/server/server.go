@@ -30,6 +30,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	corev1 "k8s.io/api/core/v1"
+	extensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	extensionClient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/client-go/dynamic"
@@ -37,6 +38,7 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
@@ -48,9 +50,11 @@ import (
 	"tkestack.io/galaxy/pkg/ipam/client/clientset/versioned"
 	ipamcontext "tkestack.io/galaxy/pkg/ipam/context"
 	"tkestack.io/galaxy/pkg/ipam/crd"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
 	"tkestack.io/galaxy/pkg/ipam/metrics"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin"
 	"tkestack.io/galaxy/pkg/ipam/server/options"
+	"tkestack.io/galaxy/pkg/ipam/webhook"
 	"tkestack.io/galaxy/pkg/utils/httputil"
 	pageutil "tkestack.io/galaxy/pkg/utils/page"
 )
@@ -102,6 +106,10 @@ func (s *Server) Start() error {
 		return fmt.Errorf("init server: %v", err)
 	}
 	s.StartInformers(s.stopChan)
+	// webhooks are read only, serve them on every replica so that they keep working while the leader is changing
+	if s.WebhookCertFile != "" && s.WebhookKeyFile != "" {
+		go s.startWebhookServer()
+	}
 	if s.LeaderElection.LeaderElect && s.leaderElectionConfig != nil {
 		leaderelection.RunOrDie(context.Background(), *s.leaderElectionConfig)
 		return nil
@@ -150,6 +158,16 @@ func (s *Server) initk8sClient() {
 	if err := crd.EnsureCRDCreated(extClient); err != nil {
 		glog.Fatalf("Ensure crd created: %v", err)
 	}
+	if s.ConversionWebhookService != "" && s.WebhookCAFile != "" && s.WebhookCertFile != "" && s.WebhookKeyFile != "" {
+		if err := s.ensureFloatingIPConversion(extClient); err != nil {
+			glog.Fatalf("Ensure FloatingIP conversion: %v", err)
+		}
+	}
+	if relabeled, err := floatingip.EnsureSelectionLabels(galaxyClient); err != nil {
+		glog.Fatalf("Ensure FloatingIP selection labels: %v", err)
+	} else if relabeled > 0 {
+		glog.Infof("added selection labels to %d FloatingIPs", relabeled)
+	}
 
 	// Identity used to distinguish between multiple cloud controller manager instances
 	id, err := os.Hostname()
@@ -163,6 +181,7 @@ func (s *Server) initk8sClient() {
 	if err != nil {
 		glog.Fatalf("failed init event recorder: %v", err)
 	}
+	s.IPAMContext.Recorder = recorder
 	if s.LeaderElection.LeaderElect {
 		leaderElectionClient := kubernetes.NewForConfigOrDie(restclient.AddUserAgent(cfg, "leader-election"))
 		rl, err := resourcelock.New(s.LeaderElection.ResourceLock,
@@ -196,6 +215,20 @@ func (s *Server) initk8sClient() {
 	}
 }
 
+func (s *Server) ensureFloatingIPConversion(extClient extensionClient.Interface) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(s.ConversionWebhookService)
+	if err != nil || namespace == "" || name == "" {
+		return fmt.Errorf("invalid conversion webhook service %q, expect namespace/name", s.ConversionWebhookService)
+	}
+	caBundle, err := ioutil.ReadFile(s.WebhookCAFile)
+	if err != nil {
+		return err
+	}
+	path := webhook.ConvertPath
+	return crd.EnsureFloatingIPConversion(extClient, &extensionsv1.ServiceReference{Namespace: namespace, Name: name,
+		Path: &path}, caBundle)
+}
+
 func newRecoder(kubeCfg *restclient.Config) (record.EventRecorder, error) {
 	glog.V(4).Info("Creating event broadcaster")
 	eventBroadcaster := record.NewBroadcaster()
@@ -231,14 +264,31 @@ func (s *Server) startServer() {
 	}
 }
 
+func (s *Server) startWebhookServer() {
+	mux := http.NewServeMux()
+	mux.Handle(webhook.ValidatePath, webhook.NewHandler(s.plugin.ValidatePod))
+	mux.Handle(webhook.ConvertPath, webhook.NewConversionHandler(webhook.SubnetByIP(s.plugin.SubnetOf)))
+	glog.Infof("serving admission webhook on %s:%d", s.Bind, s.WebhookPort)
+	if err := http.ListenAndServeTLS(fmt.Sprintf("%s:%d", s.Bind, s.WebhookPort), s.WebhookCertFile,
+		s.WebhookKeyFile, mux); err != nil {
+		glog.Fatalf("unable to listen: %v.", err)
+	}
+}
+
 func (s *Server) startAPIServer() {
 	ws := new(restful.WebService)
 	ws.
 		Path("/v1").
 		Consumes(restful.MIME_JSON).
 		Produces(restful.MIME_JSON)
+	var auth *api.Auth
+	if s.APIAuth {
+		auth = api.NewAuth(s.Client, s.APIAuthCacheTTL)
+	}
+	ws.Filter(auth.Authenticate)
 	c := api.NewController(s.plugin.GetIpam(), s.PodLister, s.plugin.Release)
 	ws.Route(ws.GET("/ip").To(c.ListIPs).
+		Filter(auth.Authorize("list", api.ResourceIPs, "")).
 		Doc("List ips by keyword or params").
 		Param(ws.QueryParameter("keyword", "keyword").DataType("string")).
 		Param(ws.QueryParameter("poolName", "pool name").DataType("string")).
@@ -262,7 +312,23 @@ func (s *Server) startAPIServer() {
 			}}).
 		Writes(api.ListIPResp{}))
 
+	ws.Route(ws.GET("/ip/watch").To(c.WatchIPs).
+		Filter(auth.Authorize("watch", api.ResourceIPs, "")).
+		Doc("Watch ip changes, it streams an event per line, resume by the resource version of the last event").
+		Param(ws.QueryParameter("resourceVersion", "watch changes after it, only new changes if empty").
+			DataType("integer")).
+		Param(ws.QueryParameter("poolName", "pool name").DataType("string")).
+		Param(ws.QueryParameter("appName", "app name").DataType("string")).
+		Param(ws.QueryParameter("namespace", "namespace").DataType("string")).
+		Param(ws.QueryParameter("appType", "app type, deployment, statefulset or tapp").DataType("string")).
+		Param(ws.QueryParameter("timeoutSeconds", "stop watching after it").DataType("integer")).
+		Returns(http.StatusBadRequest, "invalid resourceVersion", nil).
+		Returns(http.StatusGone, "resource version is too old, list ips and watch again", nil).
+		Returns(http.StatusOK, "request succeed", api.IPEvent{}).
+		Writes(api.IPEvent{}))
+
 	ws.Route(ws.POST("/ip").To(c.ReleaseIPs).
+		Filter(auth.Authorize("release", api.ResourceIPs, "")).
 		Doc("Release ips").
 		Reads(api.ReleaseIPReq{}).
 		Returns(http.StatusBadRequest, "10.0.0 is not a valid ip", nil).
@@ -273,9 +339,40 @@ func (s *Server) startAPIServer() {
 		Returns(http.StatusOK, "request succeed", api.ReleaseIPResp{Resp: httputil.Resp{Code: http.StatusOK}}).
 		Writes(api.ReleaseIPResp{Resp: httputil.Resp{Code: http.StatusOK}}))
 
+	ws.Route(ws.POST("/ip/reserve").To(c.ReserveIPs).
+		Filter(auth.Authorize("reserve", api.ResourceIPs, "")).
+		Doc("Reserve ips with reason and owner, ips bound to existing pods are rejected unless forced").
+		Reads(api.ReserveIPReq{}).
+		Returns(http.StatusBadRequest, "10.0.0 is not a valid ip", nil).
+		Returns(http.StatusAccepted, "Failed ips are bound to pods or are not within valid range",
+			api.ReserveIPResp{Failed: []string{"10.0.70.32"}}).
+		Returns(http.StatusOK, "request succeed", api.ReserveIPResp{Resp: httputil.Resp{Code: http.StatusOK}}).
+		Writes(api.ReserveIPResp{Resp: httputil.Resp{Code: http.StatusOK}}))
+
+	ws.Route(ws.DELETE("/ip/reserve").To(c.UnreserveIPs).
+		Filter(auth.Authorize("unreserve", api.ResourceIPs, "")).
+		Doc("Unreserve ips").
+		Reads(api.ReserveIPReq{}).
+		Returns(http.StatusBadRequest, "10.0.0 is not a valid ip", nil).
+		Returns(http.StatusAccepted, "Failed ips are not reserved", api.ReserveIPResp{Failed: []string{"10.0.70.32"}}).
+		Returns(http.StatusOK, "request succeed", api.ReserveIPResp{Resp: httputil.Resp{Code: http.StatusOK}}).
+		Writes(api.ReserveIPResp{Resp: httputil.Resp{Code: http.StatusOK}}))
+
+	ws.Route(ws.GET("/subnet").To(c.ListSubnets).
+		Filter(auth.Authorize("list", api.ResourceSubnets, "")).
+		Doc("List ip usage of each subnet").
+		Param(ws.QueryParameter("subnet", "subnet, e.g. 10.0.0.0/24").DataType("string")).
+		Param(ws.QueryParameter("nodeSubnet", "node subnet, e.g. 10.1.0.0/24").DataType("string")).
+		Returns(http.StatusBadRequest, "invalid subnet", nil).
+		Returns(http.StatusOK, "request succeed", api.ListSubnetResp{Resp: httputil.NewResp(http.StatusOK, ""),
+			Subnets: []api.SubnetUsage{{Subnet: "10.0.0.0/24", IPRanges: []string{"10.0.0.2~10.0.0.201"},
+				NodeSubnets: []string{"10.1.0.0/24"}, Total: 200, Allocated: 10, Reserved: 2, Held: 3, Free: 185}}}).
+		Writes(api.ListSubnetResp{}))
+
 	poolController := api.PoolController{PoolLister: s.PoolLister, Client: s.GalaxyClient,
 		LockPoolFunc: s.plugin.LockDpPool, IPAM: s.plugin.GetIpam()}
 	ws.Route(ws.GET("/pool/{name}").To(poolController.Get).
+		Filter(auth.Authorize("get", api.ResourcePools, "name")).
 		Doc("Get pool by name").
 		Param(ws.PathParameter("name", "pool name").DataType("string").Required(true)).
 		Returns(http.StatusNotFound, "pool not found", nil).
@@ -285,7 +382,20 @@ func (s *Server) startAPIServer() {
 			Pool: api.Pool{Name: "sample-pool", Size: 4}}).
 		Writes(api.GetPoolResp{}))
 
+	ws.Route(ws.GET("/pool/{name}/usage").To(poolController.Usage).
+		Filter(auth.Authorize("get", api.ResourcePools, "name")).
+		Doc("Get ip usage of pool by name").
+		Param(ws.PathParameter("name", "pool name").DataType("string").Required(true)).
+		Returns(http.StatusNotFound, "pool not found", nil).
+		Returns(http.StatusBadRequest, "pool name is empty", nil).
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", api.GetPoolUsageResp{Resp: httputil.NewResp(http.StatusOK, ""),
+			Usage: api.PoolUsage{Name: "sample-pool", Size: 4, IPs: 4, Allocated: 3, Held: 1,
+				Subnets: map[string]int{"10.0.0.0/24": 4}}}).
+		Writes(api.GetPoolUsageResp{}))
+
 	ws.Route(ws.POST("/pool").To(poolController.CreateOrUpdate).
+		Filter(auth.Authorize("update", api.ResourcePools, "")).
 		Doc("Create or update pool").
 		Reads(api.Pool{Name: "sample-pool"}).
 		Returns(http.StatusBadRequest, "pool name is empty", nil).
@@ -297,6 +407,7 @@ func (s *Server) startAPIServer() {
 		Writes(httputil.Resp{Code: http.StatusOK}))
 
 	ws.Route(ws.DELETE("/pool/{name}").To(poolController.Delete).
+		Filter(auth.Authorize("delete", api.ResourcePools, "name")).
 		Doc("Delete pool by name").
 		Param(ws.PathParameter("name", "pool name").DataType("string").Required(true)).
 		Returns(http.StatusNotFound, "pool not found", nil).
@@ -305,13 +416,70 @@ func (s *Server) startAPIServer() {
 		Returns(http.StatusOK, "request succeed", httputil.Resp{Code: http.StatusOK}).
 		Writes(httputil.Resp{Code: http.StatusOK}))
 
+	checkController := api.CheckController{CheckFunc: s.plugin.Check}
+	ws.Route(ws.GET("/check").To(checkController.Check).
+		Filter(auth.Authorize("get", api.ResourceChecks, "")).
+		Doc("Check consistency of stored ips, pools, pods and their annotations, and cloud provider assignments").
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", api.CheckResp{Resp: httputil.NewResp(http.StatusOK,
+			"found 1 inconsistencies"), Inconsistencies: []schedulerplugin.Inconsistency{{
+			Type: schedulerplugin.InconsistencyOrphan, IP: "10.0.0.2", Key: "sts_default_sts_sts-0",
+			Message: "pod is not running and release policy is podDelete"}}}).
+		Writes(api.CheckResp{}))
+
+	ws.Route(ws.POST("/check").To(checkController.Fix).
+		Filter(auth.Authorize("fix", api.ResourceChecks, "")).
+		Doc("Check consistency and fix the inconsistencies").
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", api.CheckResp{Resp: httputil.NewResp(http.StatusOK,
+			"found 1 inconsistencies, fixed 1"), Inconsistencies: []schedulerplugin.Inconsistency{{
+			Type: schedulerplugin.InconsistencyOrphan, IP: "10.0.0.2", Key: "sts_default_sts_sts-0",
+			Message: "pod is not running and release policy is podDelete", Fixed: true}}}).
+		Writes(api.CheckResp{}))
+
+	backupController := api.BackupController{Client: s.GalaxyClient, IPAM: s.plugin.GetIpam()}
+	ws.Route(ws.GET("/backup").To(backupController.Backup).
+		Filter(auth.Authorize("get", api.ResourceBackups, "")).
+		Doc("Export all allocated ips and pools").
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", floatingip.Backup{Version: floatingip.BackupVersion,
+			IPs: []floatingip.BackupIP{{IP: "10.0.0.2", Key: "sts_default_sts_sts-0", Policy: 2,
+				NodeSubnets: []string{"10.1.0.0/24"}}},
+			Pools: []floatingip.BackupPool{{Name: "sample-pool", Size: 4}}}).
+		Writes(floatingip.Backup{}))
+
+	ws.Route(ws.POST("/backup/restore").To(backupController.Restore).
+		Filter(auth.Authorize("restore", api.ResourceBackups, "")).
+		Doc("Restore pools and allocated ips of a backup").
+		Reads(api.RestoreReq{}).
+		Returns(http.StatusBadRequest, "invalid backup version or node subnet mapping", nil).
+		Returns(http.StatusAccepted, "some ips are conflicts, skipped or failed", api.RestoreResp{
+			Resp: httputil.NewResp(http.StatusAccepted, "0 created, 0 updated, 0 reallocated, 0 unchanged, "+
+				"1 conflicts, 0 skipped, 0 failed"),
+			IPs: []floatingip.ImportResult{{Action: floatingip.ImportConflict, IP: "10.0.0.2",
+				Key: "sts_default_sts_sts-0", Message: "ip is allocated to sts_default_sts2_sts2-0"}}}).
+		Returns(http.StatusOK, "request succeed", api.RestoreResp{
+			Resp: httputil.NewResp(http.StatusOK, "1 created, 0 updated, 0 reallocated, 0 unchanged, "+
+				"0 conflicts, 0 skipped, 0 failed"),
+			IPs: []floatingip.ImportResult{{Action: floatingip.ImportCreate, IP: "10.0.0.2",
+				Key: "sts_default_sts_sts-0"}},
+			Pools: []api.PoolRestoreResult{{Action: floatingip.ImportCreate, Name: "sample-pool"}}}).
+		Writes(api.RestoreResp{}))
+
 	restful.Add(ws)
 	// register prometheus metrics
 	prometheus.MustRegister(s.plugin.GetIpam())
 	metrics.MustRegister()
 	restful.DefaultContainer.Handle("/metrics", promhttp.Handler())
 	addSwaggerUISupport(restful.DefaultContainer)
-	if err := http.ListenAndServe(fmt.Sprintf("%s:%d", s.Bind, s.APIPort), nil); err != nil {
+	addr := fmt.Sprintf("%s:%d", s.Bind, s.APIPort)
+	var err error
+	if s.APICertFile != "" && s.APIKeyFile != "" {
+		err = http.ListenAndServeTLS(addr, s.APICertFile, s.APIKeyFile, nil)
+	} else {
+		err = http.ListenAndServe(addr, nil)
+	}
+	if err != nil {
 		glog.Fatalf("unable to listen: %v.", err)
 	}
 }
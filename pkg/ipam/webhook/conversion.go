@@ -0,0 +1,141 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	galaxyv1 "tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+)
+
+// ConvertPath is the url path of the FloatingIP conversion webhook
+const ConvertPath = "/v1/convert-floatingip"
+
+// SubnetFunc returns the subnet cidr of the pool which the ip of a FloatingIP name belongs to, or an empty string if
+// it's unknown
+type SubnetFunc func(name string) string
+
+// NewConversionHandler returns a http handler serving apiextensions.k8s.io/v1 ConversionReview requests which
+// convert FloatingIPs between v1alpha1 and v1
+func NewConversionHandler(subnetOf SubnetFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read body: %v", err), http.StatusBadRequest)
+			return
+		}
+		var review apiextensionsv1.ConversionReview
+		if err := json.Unmarshal(data, &review); err != nil || review.Request == nil {
+			http.Error(w, fmt.Sprintf("bad conversion review: %v", err), http.StatusBadRequest)
+			return
+		}
+		review.Response = convert(review.Request, subnetOf)
+		review.Request = nil
+		resp, err := json.Marshal(&review)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("marshal conversion review: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(resp)
+	})
+}
+
+func convert(req *apiextensionsv1.ConversionRequest, subnetOf SubnetFunc) *apiextensionsv1.ConversionResponse {
+	resp := &apiextensionsv1.ConversionResponse{UID: req.UID,
+		Result: metav1.Status{Status: metav1.StatusSuccess}}
+	for i := range req.Objects {
+		converted, err := convertFloatingIP(req.Objects[i].Raw, req.DesiredAPIVersion, subnetOf)
+		if err != nil {
+			glog.Warningf("failed to convert FloatingIP to %s: %v", req.DesiredAPIVersion, err)
+			resp.ConvertedObjects = nil
+			resp.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+			return resp
+		}
+		resp.ConvertedObjects = append(resp.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+	return resp
+}
+
+func convertFloatingIP(raw []byte, desiredAPIVersion string, subnetOf SubnetFunc) ([]byte, error) {
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return nil, err
+	}
+	if typeMeta.Kind != constant.ResourceKind {
+		return nil, fmt.Errorf("unexpected kind %s", typeMeta.Kind)
+	}
+	if typeMeta.APIVersion == desiredAPIVersion {
+		return raw, nil
+	}
+	var fip galaxyv1.FloatingIP
+	switch typeMeta.APIVersion {
+	case v1alpha1.SchemeGroupVersion.String():
+		var in v1alpha1.FloatingIP
+		if err := json.Unmarshal(raw, &in); err != nil {
+			return nil, err
+		}
+		if err := galaxyv1.ConvertFromV1alpha1(&in, &fip); err != nil {
+			return nil, err
+		}
+		if subnetOf != nil {
+			fip.Spec.Subnet = subnetOf(fip.Name)
+		}
+	case galaxyv1.SchemeGroupVersion.String():
+		if err := json.Unmarshal(raw, &fip); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unexpected api version %s", typeMeta.APIVersion)
+	}
+	switch desiredAPIVersion {
+	case galaxyv1.SchemeGroupVersion.String():
+		return json.Marshal(&fip)
+	case v1alpha1.SchemeGroupVersion.String():
+		var out v1alpha1.FloatingIP
+		if err := galaxyv1.ConvertToV1alpha1(&fip, &out); err != nil {
+			return nil, err
+		}
+		return json.Marshal(&out)
+	}
+	return nil, fmt.Errorf("unexpected desired api version %s", desiredAPIVersion)
+}
+
+// SubnetByIP returns a SubnetFunc which looks up the subnet of the ip of FloatingIP names by subnetOf
+func SubnetByIP(subnetOf func(net.IP) *net.IPNet) SubnetFunc {
+	return func(name string) string {
+		ip := floatingip.ParseFIPName(name)
+		if ip == nil {
+			return ""
+		}
+		if subnet := subnetOf(ip); subnet != nil {
+			return subnet.String()
+		}
+		return ""
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	galaxyv1 "tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+)
+
+// #lizard forgives
+func TestConversionHandler(t *testing.T) {
+	handler := NewConversionHandler(func(name string) string {
+		if name == "10.0.0.2" {
+			return "10.0.0.0/24"
+		}
+		return ""
+	})
+	alpha := &v1alpha1.FloatingIP{
+		TypeMeta:   metav1.TypeMeta{Kind: constant.ResourceKind, APIVersion: constant.ApiVersion},
+		ObjectMeta: metav1.ObjectMeta{Name: "10.0.0.2"},
+		Spec: v1alpha1.FloatingIPSpec{Key: "sts_ns1_sts1_sts1-0", Attribute: `{"NodeName":"node1","Uid":"uid1"}`,
+			Policy: constant.ReleasePolicyImmutable},
+	}
+	review := doConversion(t, handler, galaxyv1.SchemeGroupVersion.String(), alpha)
+	if review.Response.Result.Status != metav1.StatusSuccess || len(review.Response.ConvertedObjects) != 1 {
+		t.Fatalf("unexpected response %+v", review.Response)
+	}
+	var fip galaxyv1.FloatingIP
+	if err := json.Unmarshal(review.Response.ConvertedObjects[0].Raw, &fip); err != nil {
+		t.Fatal(err)
+	}
+	if fip.APIVersion != "galaxy.k8s.io/v1" || fip.Spec.Subnet != "10.0.0.0/24" || fip.Spec.Pod != "sts1-0" ||
+		fip.Spec.WorkloadKind != galaxyv1.KindStatefulSet || fip.Spec.Node != "node1" ||
+		fip.Labels[galaxyv1.LabelWorkload] != "sts1" {
+		t.Fatalf("unexpected FloatingIP %+v", fip)
+	}
+	// convert back to v1alpha1
+	review = doConversion(t, handler, constant.ApiVersion, &fip)
+	if review.Response.Result.Status != metav1.StatusSuccess || len(review.Response.ConvertedObjects) != 1 {
+		t.Fatalf("unexpected response %+v", review.Response)
+	}
+	var converted v1alpha1.FloatingIP
+	if err := json.Unmarshal(review.Response.ConvertedObjects[0].Raw, &converted); err != nil {
+		t.Fatal(err)
+	}
+	if converted.APIVersion != constant.ApiVersion || converted.Spec != alpha.Spec {
+		t.Fatalf("expect %+v, real %+v", alpha.Spec, converted.Spec)
+	}
+	// bad attribute fails the whole review
+	alpha.Spec.Attribute = "bad"
+	review = doConversion(t, handler, galaxyv1.SchemeGroupVersion.String(), alpha)
+	if review.Response.Result.Status != metav1.StatusFailure || len(review.Response.ConvertedObjects) != 0 {
+		t.Fatalf("unexpected response %+v", review.Response)
+	}
+}
+
+func doConversion(t *testing.T, handler http.Handler, desiredAPIVersion string,
+	obj interface{}) *apiextensionsv1.ConversionReview {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(&apiextensionsv1.ConversionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apiextensions.k8s.io/v1", Kind: "ConversionReview"},
+		Request: &apiextensionsv1.ConversionRequest{UID: types.UID("uid"), DesiredAPIVersion: desiredAPIVersion,
+			Objects: []runtime.RawExtension{{Raw: raw}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, ConvertPath, bytes.NewReader(data)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d %s", rr.Code, rr.Body.String())
+	}
+	var review apiextensionsv1.ConversionReview
+	if err := json.Unmarshal(rr.Body.Bytes(), &review); err != nil {
+		t.Fatal(err)
+	}
+	if review.Response == nil || review.Response.UID != "uid" {
+		t.Fatalf("unexpected response %+v", review.Response)
+	}
+	return &review
+}
@@ -0,0 +1,84 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	glog "k8s.io/klog"
+)
+
+// ValidatePath is the url path of the pod validating webhook
+const ValidatePath = "/v1/validate-pod"
+
+// PodValidator validates a pod to be created and returns an error to reject it
+type PodValidator func(pod *corev1.Pod) error
+
+// NewHandler returns a http handler serving admission.k8s.io/v1 AdmissionReview requests of pods
+func NewHandler(validate PodValidator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read body: %v", err), http.StatusBadRequest)
+			return
+		}
+		var review admissionv1.AdmissionReview
+		if err := json.Unmarshal(data, &review); err != nil || review.Request == nil {
+			http.Error(w, fmt.Sprintf("bad admission review: %v", err), http.StatusBadRequest)
+			return
+		}
+		review.Response = admit(review.Request, validate)
+		review.Request = nil
+		resp, err := json.Marshal(&review)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("marshal admission review: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(resp)
+	})
+}
+
+func admit(req *admissionv1.AdmissionRequest, validate PodValidator) *admissionv1.AdmissionResponse {
+	resp := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	if req.Kind.Kind != "Pod" || req.Operation != admissionv1.Create {
+		return resp
+	}
+	var pod corev1.Pod
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		resp.Allowed = false
+		resp.Result = &metav1.Status{Status: metav1.StatusFailure, Code: http.StatusBadRequest,
+			Message: fmt.Sprintf("decode pod: %v", err)}
+		return resp
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = req.Namespace
+	}
+	if err := validate(&pod); err != nil {
+		glog.V(3).Infof("rejected pod %s_%s%s: %v", pod.Namespace, pod.Name, pod.GenerateName, err)
+		resp.Allowed = false
+		resp.Result = &metav1.Status{Status: metav1.StatusFailure, Code: http.StatusForbidden,
+			Reason: metav1.StatusReasonForbidden, Message: err.Error()}
+	}
+	return resp
+}
@@ -0,0 +1,83 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestHandler(t *testing.T) {
+	handler := NewHandler(func(pod *corev1.Pod) error {
+		if pod.Namespace != "ns1" {
+			return fmt.Errorf("unexpected namespace %s", pod.Namespace)
+		}
+		if pod.Name == "bad" {
+			return fmt.Errorf("bad pod")
+		}
+		return nil
+	})
+	for i, testCase := range []struct {
+		name      string
+		operation admissionv1.Operation
+		allowed   bool
+	}{
+		{name: "good", operation: admissionv1.Create, allowed: true},
+		{name: "bad", operation: admissionv1.Create, allowed: false},
+		{name: "bad", operation: admissionv1.Update, allowed: true},
+	} {
+		raw, err := json.Marshal(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: testCase.name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		review := admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request: &admissionv1.AdmissionRequest{UID: types.UID("uid"), Namespace: "ns1",
+				Kind: metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}, Operation: testCase.operation,
+				Object: runtime.RawExtension{Raw: raw}},
+		}
+		data, err := json.Marshal(&review)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, ValidatePath, bytes.NewReader(data)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("case %d: expect 200, got %d %s", i, rr.Code, rr.Body.String())
+		}
+		var got admissionv1.AdmissionReview
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Response == nil || got.Response.UID != "uid" || got.Response.Allowed != testCase.allowed {
+			t.Fatalf("case %d: unexpected response %+v", i, got.Response)
+		}
+		if !testCase.allowed && (got.Response.Result == nil || got.Response.Result.Message != "bad pod") {
+			t.Fatalf("case %d: unexpected result %+v", i, got.Response.Result)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package utils
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+)
+
+// CheckContainerIfaces checks that interfaces of the result in the netns are up and have their addresses, and that
+// routes of the result exist in the netns. Addresses which are not assigned to any interface are checked on ifName.
+// It returns the checked interfaces by name so that callers can check their types or parents.
+func CheckContainerIfaces(netnsPath, ifName string, result *current.Result) (map[string]netlink.Link, error) {
+	ifaceIPs := map[string][]*current.IPConfig{ifName: nil}
+	for _, iface := range result.Interfaces {
+		if iface.Sandbox != "" {
+			ifaceIPs[iface.Name] = nil
+		}
+	}
+	for _, ipc := range result.IPs {
+		if ipc.Interface == nil {
+			ifaceIPs[ifName] = append(ifaceIPs[ifName], ipc)
+		} else if idx := *ipc.Interface; idx >= 0 && idx < len(result.Interfaces) &&
+			result.Interfaces[idx].Sandbox != "" {
+			ifaceIPs[result.Interfaces[idx].Name] = append(ifaceIPs[result.Interfaces[idx].Name], ipc)
+		}
+	}
+	netns, err := ns.GetNS(netnsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netns %q: %v", netnsPath, err)
+	}
+	defer netns.Close() // nolint: errcheck
+	links := map[string]netlink.Link{}
+	err = netns.Do(func(_ ns.NetNS) error {
+		for name, ips := range ifaceIPs {
+			link, err := netlink.LinkByName(name)
+			if err != nil {
+				return fmt.Errorf("failed to lookup %q: %v", name, err)
+			}
+			if link.Attrs().Flags&net.FlagUp == 0 {
+				return fmt.Errorf("interface %q is down", name)
+			}
+			addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+			if err != nil {
+				return fmt.Errorf("failed to list addresses of %q: %v", name, err)
+			}
+			for _, ipc := range ips {
+				if !hasAddr(addrs, &ipc.Address) {
+					return fmt.Errorf("interface %q has no address %s", name, ipc.Address.String())
+				}
+			}
+			links[name] = link
+		}
+		for _, route := range result.Routes {
+			routes, err := netlink.RouteList(nil, familyOf(route.Dst.IP))
+			if err != nil {
+				return fmt.Errorf("failed to list routes: %v", err)
+			}
+			if !hasRoute(routes, route) {
+				return fmt.Errorf("route %s not found", route.String())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// CheckHostVeths checks host side veth devices of the result which are created by VethConnectsHostWithContainer.
+// Each host veth device is followed by its peer in interfaces of the result.
+func CheckHostVeths(result *current.Result, requireBridge bool) error {
+	for i, iface := range result.Interfaces {
+		if iface.Sandbox != "" {
+			continue
+		}
+		var ips []*current.IPConfig
+		for _, ipc := range result.IPs {
+			if ipc.Interface != nil && *ipc.Interface == i+1 {
+				ips = append(ips, ipc)
+			}
+		}
+		if err := CheckHostVeth(iface.Name, requireBridge, ips); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckHostVeth checks that the host side veth device is up. If the device is attached to a bridge, the bridge must
+// be up, otherwise there must be host routes to the container ips. requireBridge fails the check if the device is
+// not attached to any bridge.
+func CheckHostVeth(name string, requireBridge bool, ips []*current.IPConfig) error {
+	host, err := netlink.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to lookup host veth %q: %v", name, err)
+	}
+	if host.Attrs().Flags&net.FlagUp == 0 {
+		return fmt.Errorf("host veth %q is down", name)
+	}
+	if host.Attrs().MasterIndex > 0 {
+		bridge, err := netlink.LinkByIndex(host.Attrs().MasterIndex)
+		if err != nil {
+			return fmt.Errorf("failed to lookup master of host veth %q: %v", name, err)
+		}
+		if bridge.Type() != "bridge" {
+			return fmt.Errorf("master %q of host veth %q is not a bridge", bridge.Attrs().Name, name)
+		}
+		if bridge.Attrs().Flags&net.FlagUp == 0 {
+			return fmt.Errorf("bridge %q is down", bridge.Attrs().Name)
+		}
+		return nil
+	}
+	if requireBridge {
+		return fmt.Errorf("host veth %q is not attached to any bridge", name)
+	}
+	for _, ipc := range ips {
+		if err := CheckHostRoute(host, ipc.Address.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckHostRoute checks that there is a route to the container ip via the host device
+func CheckHostRoute(host netlink.Link, ip net.IP) error {
+	routes, err := netlink.RouteList(host, familyOf(ip))
+	if err != nil {
+		return fmt.Errorf("failed to list routes of %q: %v", host.Attrs().Name, err)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		bits = 8 * net.IPv4len
+	}
+	dst := types.Route{Dst: net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}}
+	if !hasRoute(routes, &dst) {
+		return fmt.Errorf("no host route %s dev %s", dst.Dst.String(), host.Attrs().Name)
+	}
+	return nil
+}
+
+func familyOf(ip net.IP) int {
+	if ip.To4() == nil {
+		return netlink.FAMILY_V6
+	}
+	return netlink.FAMILY_V4
+}
+
+func hasAddr(addrs []netlink.Addr, ipNet *net.IPNet) bool {
+	for i := range addrs {
+		if addrs[i].IPNet != nil && addrs[i].IPNet.String() == ipNet.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRoute returns true if there is a route to the destination of expect. The gateway is compared only if expect
+// has one, as the gateway of the ip config may be used instead.
+func hasRoute(routes []netlink.Route, expect *types.Route) bool {
+	dst := net.IPNet{IP: expect.Dst.IP.Mask(expect.Dst.Mask), Mask: expect.Dst.Mask}
+	ones, _ := dst.Mask.Size()
+	for i := range routes {
+		if routes[i].Dst == nil {
+			if ones != 0 {
+				continue
+			}
+		} else if routes[i].Dst.String() != dst.String() {
+			continue
+		}
+		if expect.GW != nil && !expect.GW.Equal(routes[i].Gw) {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package utils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/types"
+	"github.com/vishvananda/netlink"
+)
+
+func TestHasRoute(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/24")
+	gw := net.ParseIP("10.0.0.1")
+	routes := []netlink.Route{{Dst: subnet}, {Dst: nil, Gw: gw}}
+	for i, c := range []struct {
+		route  string
+		gw     net.IP
+		expect bool
+	}{
+		{route: "10.0.0.2/24", expect: true},
+		{route: "10.0.1.0/24", expect: false},
+		{route: "0.0.0.0/0", expect: true},
+		{route: "0.0.0.0/0", gw: gw, expect: true},
+		{route: "0.0.0.0/0", gw: net.ParseIP("10.0.0.254"), expect: false},
+		{route: "::/0", expect: true},
+	} {
+		ip, dst, err := net.ParseCIDR(c.route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// keep the ip unmasked as routes of a cni result may be
+		dst.IP = ip
+		if got := hasRoute(routes, &types.Route{Dst: *dst, GW: c.gw}); got != c.expect {
+			t.Errorf("case %d: expect %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestHasAddr(t *testing.T) {
+	ip, ipNet, _ := net.ParseCIDR("10.0.0.2/24")
+	addrs := []netlink.Addr{{IPNet: &net.IPNet{IP: ip, Mask: ipNet.Mask}}}
+	if !hasAddr(addrs, &net.IPNet{IP: ip, Mask: ipNet.Mask}) {
+		t.Fatal("expect address found")
+	}
+	if hasAddr(addrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}) {
+		t.Fatal("expect address with a different mask not found")
+	}
+}
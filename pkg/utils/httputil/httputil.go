@@ -51,3 +51,18 @@ func ItemNotFound(resp *restful.Response, err error) {
 	resp.WriteHeaderAndEntity(http.StatusNotFound, NewResp(http.StatusNotFound,
 		fmt.Sprintf("not found: %v", err))) // nolint: errcheck
 }
+
+func Unauthorized(resp *restful.Response, err error) {
+	resp.WriteHeaderAndEntity(http.StatusUnauthorized, NewResp(http.StatusUnauthorized,
+		fmt.Sprintf("unauthorized: %v", err))) // nolint: errcheck
+}
+
+func Forbidden(resp *restful.Response, err error) {
+	resp.WriteHeaderAndEntity(http.StatusForbidden, NewResp(http.StatusForbidden,
+		fmt.Sprintf("forbidden: %v", err))) // nolint: errcheck
+}
+
+func Gone(resp *restful.Response, err error) {
+	resp.WriteHeaderAndEntity(http.StatusGone, NewResp(http.StatusGone,
+		fmt.Sprintf("gone: %v", err))) // nolint: errcheck
+}
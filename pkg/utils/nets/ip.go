@@ -17,15 +17,53 @@
 package nets
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
 	"net"
 	"strings"
 )
 
 const IPRangeSeparator string = "~"
 
+// IPFamily is the address family of an ip, ipv4 or ipv6
+type IPFamily string
+
+const (
+	IPv4Family IPFamily = "ipv4"
+	IPv6Family IPFamily = "ipv6"
+)
+
+// FamilyOf returns the address family of ip
+func FamilyOf(ip net.IP) IPFamily {
+	if ip.To4() != nil {
+		return IPv4Family
+	}
+	return IPv6Family
+}
+
+// ParseIPFamily parses ip family from string ipv4 or ipv6
+func ParseIPFamily(str string) (IPFamily, error) {
+	switch IPFamily(strings.ToLower(strings.TrimSpace(str))) {
+	case IPv4Family:
+		return IPv4Family, nil
+	case IPv6Family:
+		return IPv6Family, nil
+	}
+	return "", fmt.Errorf("unknown ip family %q", str)
+}
+
+// DefaultFamilies returns ipv4 family if families is empty
+func DefaultFamilies(families []IPFamily) []IPFamily {
+	if len(families) == 0 {
+		return []IPFamily{IPv4Family}
+	}
+	return families
+}
+
 // IPNet add marshal and unmarshal func for net.IPNet
 type IPNet net.IPNet
 
@@ -100,16 +138,29 @@ type IPRange struct {
 	First, Last net.IP
 }
 
-func (ipr IPRange) Size() uint32 {
+// Size returns the number of ips in the range, it returns math.MaxUint64 if the ipv6 range is larger than that
+func (ipr IPRange) Size() uint64 {
 	if len(ipr.First) == 0 || len(ipr.Last) == 0 {
 		return 0
 	}
-	return IPToInt(ipr.Last) - IPToInt(ipr.First) + 1
+	size := new(big.Int).Sub(IPToBigInt(ipr.Last), IPToBigInt(ipr.First))
+	size.Add(size, big.NewInt(1))
+	if !size.IsUint64() {
+		return math.MaxUint64
+	}
+	return size.Uint64()
 }
 
 func (ipr IPRange) Contains(ip net.IP) bool {
-	ipInt := IPToInt(ip)
-	return ipInt >= IPToInt(ipr.First) && ipInt <= IPToInt(ipr.Last)
+	if len(ip) == 0 || FamilyOf(ip) != FamilyOf(ipr.First) {
+		return false
+	}
+	return CompareIP(ip, ipr.First) >= 0 && CompareIP(ip, ipr.Last) <= 0
+}
+
+// Family returns the address family of the range
+func (ipr IPRange) Family() IPFamily {
+	return FamilyOf(ipr.First)
 }
 
 func (ipr IPRange) String() string {
@@ -136,7 +187,7 @@ func ParseIPRange(ipr string) *IPRange {
 		if last == nil {
 			return nil
 		}
-		if IPToInt(first) > IPToInt(last) {
+		if FamilyOf(first) != FamilyOf(last) || CompareIP(first, last) > 0 {
 			return nil
 		}
 		return &IPRange{first, last}
@@ -184,16 +235,26 @@ func (subnet SparseSubnet) String() string {
 	return fmt.Sprintf("{%s %d}", subnet.IPNet().String(), subnet.Vlan)
 }
 
-func (subnet SparseSubnet) Size() uint32 {
-	var size uint32
+// Size returns the number of ips in the subnet, it returns math.MaxUint64 if it is larger than that
+func (subnet SparseSubnet) Size() uint64 {
+	var size uint64
 	for _, ipr := range subnet.IPRanges {
-		size += ipr.Size()
+		s := ipr.Size()
+		if size+s < size {
+			return math.MaxUint64
+		}
+		size += s
 	}
 	return size
 }
 
-// IPv4ToInt convert ip to uint32
-// returns 0 if it's an invalid ip
+// Family returns the address family of the subnet
+func (subnet SparseSubnet) Family() IPFamily {
+	return FamilyOf(subnet.Gateway)
+}
+
+// IPToInt convert ipv4 to uint32
+// returns 0 if it's an invalid ip. Use IPToBigInt for ipv6
 func IPToInt(ip net.IP) uint32 {
 	if len(ip) == net.IPv6len {
 		return binary.BigEndian.Uint32(ip[12:16])
@@ -225,3 +286,101 @@ func LastIPV4(ipNet *net.IPNet) net.IP {
 func FirstAndLastIP(ipNet *net.IPNet) (uint32, uint32) {
 	return IPToInt(ipNet.IP.Mask(ipNet.Mask)), IPToInt(LastIPV4(ipNet))
 }
+
+// normalize returns the 4 bytes form of an ipv4 and 16 bytes form of an ipv6
+func normalize(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+// IPToBigInt converts ipv4 or ipv6 to big.Int
+func IPToBigInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(normalize(ip))
+}
+
+// BigIntToIP converts big.Int to an ip of the given family
+// returns nil if i overflows
+func BigIntToIP(i *big.Int, family IPFamily) net.IP {
+	size := net.IPv6len
+	if family == IPv4Family {
+		size = net.IPv4len
+	}
+	if i.Sign() < 0 || (i.BitLen()+7)/8 > size {
+		return nil
+	}
+	return i.FillBytes(make(net.IP, size))
+}
+
+// CompareIP compares two ips of the same family, returns -1 if a < b, 0 if a == b and 1 if a > b.
+// An ipv4 is always less than an ipv6.
+func CompareIP(a, b net.IP) int {
+	a, b = normalize(a), normalize(b)
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(a, b)
+}
+
+// NextIP returns the next ip of ip, returns nil if ip is the last ip of its family
+func NextIP(ip net.IP) net.IP {
+	return addIP(ip, 1)
+}
+
+// PrevIP returns the previous ip of ip, returns nil if ip is the first ip of its family
+func PrevIP(ip net.IP) net.IP {
+	return addIP(ip, -1)
+}
+
+func addIP(ip net.IP, delta int) net.IP {
+	ip = normalize(ip)
+	if ip == nil {
+		return nil
+	}
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	if delta > 0 {
+		for i := len(next) - 1; i >= 0; i-- {
+			next[i]++
+			if next[i] != 0 {
+				return next
+			}
+		}
+	} else {
+		for i := len(next) - 1; i >= 0; i-- {
+			next[i]--
+			if next[i] != 0xff {
+				return next
+			}
+		}
+	}
+	// overflow
+	return nil
+}
+
+// SubtractIPRanges returns the parts of ranges which are not covered by any of others
+func SubtractIPRanges(ranges, others []IPRange) []IPRange {
+	result := make([]IPRange, len(ranges))
+	copy(result, ranges)
+	for _, o := range others {
+		var left []IPRange
+		for _, r := range result {
+			if CompareIP(r.First, o.Last) > 0 || CompareIP(o.First, r.Last) > 0 {
+				left = append(left, r)
+				continue
+			}
+			if CompareIP(r.First, o.First) < 0 {
+				left = append(left, IPRange{First: r.First, Last: PrevIP(o.First)})
+			}
+			if CompareIP(o.Last, r.Last) < 0 {
+				left = append(left, IPRange{First: NextIP(o.Last), Last: r.Last})
+			}
+		}
+		result = left
+	}
+	return result
+}
@@ -18,6 +18,8 @@ package nets
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net"
 	"testing"
 )
@@ -182,3 +184,100 @@ func TestFirstAndLastIP(t *testing.T) {
 		t.Fatal(last)
 	}
 }
+
+func TestIPv6Range(t *testing.T) {
+	ipr := ParseIPRange("2001:db8::1~2001:db8::1:0")
+	if ipr == nil {
+		t.Fatal()
+	}
+	if ipr.Family() != IPv6Family {
+		t.Fatal(ipr.Family())
+	}
+	if ipr.Size() != 65536 {
+		t.Fatal(ipr.Size())
+	}
+	if !ipr.Contains(net.ParseIP("2001:db8::ffff")) {
+		t.Fatal()
+	}
+	if ipr.Contains(net.ParseIP("2001:db8::1:1")) || ipr.Contains(net.ParseIP("0.0.0.1")) {
+		t.Fatal()
+	}
+	if ParseIPRange("2001:db8::2~2001:db8::1") != nil {
+		t.Fatal()
+	}
+	if ParseIPRange("10.0.0.1~2001:db8::1") != nil {
+		t.Fatal()
+	}
+	huge := ParseIPRange("::~ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")
+	if huge.Size() != math.MaxUint64 {
+		t.Fatal(huge.Size())
+	}
+}
+
+func TestNextAndPrevIP(t *testing.T) {
+	for _, c := range []struct {
+		ip, next string
+	}{
+		{"10.0.0.255", "10.0.1.0"},
+		{"2001:db8::ffff", "2001:db8::1:0"},
+		{"2001:db8::", "2001:db8::1"},
+	} {
+		next := NextIP(net.ParseIP(c.ip))
+		if next.String() != c.next {
+			t.Fatalf("expect %s, got %s", c.next, next.String())
+		}
+		if prev := PrevIP(next); prev.String() != c.ip {
+			t.Fatalf("expect %s, got %s", c.ip, prev.String())
+		}
+	}
+	if NextIP(net.ParseIP("255.255.255.255")) != nil {
+		t.Fatal()
+	}
+	if PrevIP(net.ParseIP("::")) != nil {
+		t.Fatal()
+	}
+}
+
+func TestBigIntIP(t *testing.T) {
+	ip := net.ParseIP("2001:db8::1")
+	if !BigIntToIP(IPToBigInt(ip), IPv6Family).Equal(ip) {
+		t.Fatal()
+	}
+	ip = net.ParseIP("10.0.0.1")
+	if !BigIntToIP(IPToBigInt(ip), IPv4Family).Equal(ip) {
+		t.Fatal()
+	}
+	if BigIntToIP(IPToBigInt(net.ParseIP("2001:db8::1")), IPv4Family) != nil {
+		t.Fatal()
+	}
+	if CompareIP(net.ParseIP("10.0.0.1"), net.ParseIP("::1")) != -1 {
+		t.Fatal()
+	}
+}
+
+func TestSubtractIPRanges(t *testing.T) {
+	parse := func(strs ...string) []IPRange {
+		var ranges []IPRange
+		for _, str := range strs {
+			ranges = append(ranges, *ParseIPRange(str))
+		}
+		return ranges
+	}
+	for i, c := range []struct {
+		ranges, others []IPRange
+		expect         string
+	}{
+		{parse("10.0.0.1~10.0.0.10"), nil, "[10.0.0.1~10.0.0.10]"},
+		{parse("10.0.0.1~10.0.0.10"), parse("10.0.0.1~10.0.0.10"), "[]"},
+		{parse("10.0.0.1~10.0.0.10"), parse("10.0.0.3~10.0.0.4", "10.0.0.10"), "[10.0.0.1~10.0.0.2 10.0.0.5~10.0.0.9]"},
+		{parse("10.0.0.1~10.0.0.10"), parse("10.0.0.0~10.0.0.5"), "[10.0.0.6~10.0.0.10]"},
+		{parse("10.0.0.1~10.0.0.10", "10.0.1.1"), parse("10.0.0.11~10.0.0.20"), "[10.0.0.1~10.0.0.10 10.0.1.1]"},
+		{parse("2001:db8::1~2001:db8::10"), parse("10.0.0.1~10.0.0.10", "2001:db8::2~2001:db8::f"),
+			"[2001:db8::1 2001:db8::10]"},
+	} {
+		got := fmt.Sprintf("%v", SubtractIPRanges(c.ranges, c.others))
+		if got != c.expect {
+			t.Errorf("case %d: expect %s, got %s", i, c.expect, got)
+		}
+	}
+}
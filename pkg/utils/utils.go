@@ -28,7 +28,7 @@ import (
 	"strings"
 
 	"github.com/containernetworking/cni/pkg/skel"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/vishvananda/netlink"
 	"tkestack.io/galaxy/pkg/api/cniutil"
@@ -95,8 +95,11 @@ func genMAC(ip net.IP) net.HardwareAddr {
 	// Fill the remaining 4 bytes based on the input
 	if ip == nil {
 		rand.Read(hw[2:]) // nolint: errcheck
-	} else {
+	} else if ip.To4() != nil {
 		copy(hw[2:], ip.To4())
+	} else {
+		// use the last 4 bytes of an ipv6 address
+		copy(hw[2:], ip.To16()[12:])
 	}
 	return hw
 }
@@ -294,7 +297,8 @@ func AddHostRoute(containerIP *net.IPNet, host netlink.Link, src net.IP) error {
 // #lizard forgives
 // VethConnectsHostWithContainer creates veth device pairs and connects container with host
 // If bridgeName specified, it attaches host side veth device to the bridge
-func VethConnectsHostWithContainer(result *t020.Result, args *skel.CmdArgs, bridgeName string, suffix string, src net.IP) error {
+// Both veth devices are appended to interfaces of the result
+func VethConnectsHostWithContainer(result *current.Result, args *skel.CmdArgs, bridgeName string, suffix string, src net.IP) error {
 	host, sbox, err := CreateVeth(args.ContainerID, 1500, suffix)
 	if err != nil {
 		return err
@@ -325,15 +329,36 @@ func VethConnectsHostWithContainer(result *t020.Result, args *skel.CmdArgs, brid
 		return fmt.Errorf("could not set link up for host interface %q: %v", host.Attrs().Name, err)
 	}
 	if bridgeName == "" {
-		desIP := result.IP4.IP.IP
-		ipn := net.IPNet{IP: desIP, Mask: net.CIDRMask(32, 32)}
-		if err = AddHostRoute(&ipn, host, src); err != nil {
-			return err
+		for _, ipc := range result.IPs {
+			if ipc.Interface != nil {
+				continue
+			}
+			if ipc.Address.IP.To4() != nil {
+				ipn := net.IPNet{IP: ipc.Address.IP, Mask: net.CIDRMask(32, 32)}
+				if err = AddHostRoute(&ipn, host, src); err != nil {
+					return err
+				}
+				continue
+			}
+			// the host side veth answers neighbor solicitations of the gateway just as proxy_arp does for ipv4
+			if err = SetProxyNdp(host.Attrs().Name); err != nil {
+				return fmt.Errorf("error set proxy_ndp: %v", err)
+			}
+			if err = AddNeighProxy(ipc.Gateway, host); err != nil {
+				return err
+			}
+			ipn := net.IPNet{IP: ipc.Address.IP, Mask: net.CIDRMask(128, 128)}
+			if err = AddHostRoute(&ipn, host, nil); err != nil {
+				return err
+			}
 		}
 	}
-	if err = configSboxDevice(result, args, sbox); err != nil {
+	var container *current.Interface
+	if container, err = configSboxDevice(result, args, sbox); err != nil {
 		return err
 	}
+	cniutil.AddInterfaces(result, &current.Interface{Name: host.Attrs().Name,
+		Mac: host.Attrs().HardwareAddr.String()}, container)
 	return nil
 }
 
@@ -366,7 +391,8 @@ func SendGratuitousARP(dev, ip, nns string, useArpRequest bool) error {
 }
 
 // MacVlanConnectsHostWithContainer creates macvlan device onto parent and connects container with host
-func MacVlanConnectsHostWithContainer(result *t020.Result, args *skel.CmdArgs, parent int, mtu int) error {
+// The macvlan device is appended to interfaces of the result
+func MacVlanConnectsHostWithContainer(result *current.Result, args *skel.CmdArgs, parent int, mtu int) error {
 	var err error
 	macVlan := &netlink.Macvlan{
 		Mode: netlink.MACVLAN_MODE_BRIDGE,
@@ -384,14 +410,17 @@ func MacVlanConnectsHostWithContainer(result *t020.Result, args *skel.CmdArgs, p
 			netlink.LinkDel(macVlan)
 		}
 	}()
-	if err = configSboxDevice(result, args, macVlan); err != nil {
+	var container *current.Interface
+	if container, err = configSboxDevice(result, args, macVlan); err != nil {
 		return err
 	}
+	cniutil.AddInterfaces(result, nil, container)
 	return nil
 }
 
 // IPVlanConnectsHostWithContainer creates ipvlan device onto parent device and connects container with host
-func IPVlanConnectsHostWithContainer(result *t020.Result, args *skel.CmdArgs, parent int, mode netlink.IPVlanMode, mtu int) error {
+// The ipvlan device is appended to interfaces of the result
+func IPVlanConnectsHostWithContainer(result *current.Result, args *skel.CmdArgs, parent int, mode netlink.IPVlanMode, mtu int) error {
 	var err error
 	ipVlan := &netlink.IPVlan{
 		Mode: mode,
@@ -409,32 +438,36 @@ func IPVlanConnectsHostWithContainer(result *t020.Result, args *skel.CmdArgs, pa
 			netlink.LinkDel(ipVlan)
 		}
 	}()
-	if err = configSboxDevice(result, args, ipVlan); err != nil {
+	var container *current.Interface
+	if container, err = configSboxDevice(result, args, ipVlan); err != nil {
 		return err
 	}
+	cniutil.AddInterfaces(result, nil, container)
 	return nil
 }
 
-func configSboxDevice(result *t020.Result, args *skel.CmdArgs, sbox netlink.Link) error {
+func configSboxDevice(result *current.Result, args *skel.CmdArgs, sbox netlink.Link) (*current.Interface, error) {
 	// Down the interface before configuring mac address.
 	if err := netlink.LinkSetDown(sbox); err != nil {
-		return fmt.Errorf("could not set link down for container interface %q: %v", sbox.Attrs().Name, err)
+		return nil, fmt.Errorf("could not set link down for container interface %q: %v", sbox.Attrs().Name, err)
 	}
 	if sbox.Type() != "ipvlan" {
-		if err := netlink.LinkSetHardwareAddr(sbox, GenerateMACFromIP(result.IP4.IP.IP)); err != nil {
-			return fmt.Errorf("could not set mac address for container interface %q: %v", sbox.Attrs().Name, err)
+		if err := netlink.LinkSetHardwareAddr(sbox, GenerateMACFromIP(cniutil.ResultIP(result))); err != nil {
+			return nil, fmt.Errorf("could not set mac address for container interface %q: %v", sbox.Attrs().Name,
+				err)
 		}
 	}
 	netns, err := ns.GetNS(args.Netns)
 	if err != nil {
-		return fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
+		return nil, fmt.Errorf("failed to open netns %q: %v", args.Netns, err)
 	}
 	defer netns.Close() // nolint: errcheck
 	// move sbox device to ns
 	if err = netlink.LinkSetNsFd(sbox, int(netns.Fd())); err != nil {
-		return fmt.Errorf("failed to move sbox device %q to netns: %v", sbox.Attrs().Name, err)
+		return nil, fmt.Errorf("failed to move sbox device %q to netns: %v", sbox.Attrs().Name, err)
 	}
-	return netns.Do(func(_ ns.NetNS) error {
+	container := &current.Interface{Name: args.IfName, Sandbox: args.Netns}
+	return container, netns.Do(func(_ ns.NetNS) error {
 		if err := netlink.LinkSetName(sbox, args.IfName); err != nil {
 			return fmt.Errorf("failed to rename sbox device %q to %q: %v", sbox.Attrs().Name, args.IfName, err)
 		}
@@ -447,6 +480,16 @@ func configSboxDevice(result *t020.Result, args *skel.CmdArgs, sbox netlink.Link
 		if err := DisableRpFilter("all"); err != nil {
 			return fmt.Errorf("failed disable rp_filter to all: %v", err)
 		}
+		if cniutil.ResultIPv6(result) != nil {
+			if err := EnableIPv6(args.IfName); err != nil {
+				return fmt.Errorf("failed enable ipv6 to dev %s: %v", args.IfName, err)
+			}
+		}
+		link, err := netlink.LinkByName(args.IfName)
+		if err != nil {
+			return fmt.Errorf("failed to lookup %q: %v", args.IfName, err)
+		}
+		container.Mac = link.Attrs().HardwareAddr.String()
 		// Add IP and routes to sbox, including default route
 		return cniutil.ConfigureIface(args.IfName, result)
 	})
@@ -457,6 +500,81 @@ func SetProxyArp(dev string) error {
 	return ioutil.WriteFile(file, []byte("1\n"), 0644)
 }
 
+func SetProxyNdp(dev string) error {
+	file := fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/proxy_ndp", dev)
+	return ioutil.WriteFile(file, []byte("1\n"), 0644)
+}
+
+func EnableIPv6(dev string) error {
+	file := fmt.Sprintf("/proc/sys/net/ipv6/conf/%s/disable_ipv6", dev)
+	return ioutil.WriteFile(file, []byte("0\n"), 0644)
+}
+
+// AddNeighProxy makes the link answer neighbor solicitations of the ipv6 address
+func AddNeighProxy(ip net.IP, link netlink.Link) error {
+	if err := netlink.NeighSet(&netlink.Neigh{
+		LinkIndex: link.Attrs().Index,
+		Family:    netlink.FAMILY_V6,
+		Flags:     netlink.NTF_PROXY,
+		IP:        ip,
+	}); err != nil {
+		return fmt.Errorf("failed to add neighbor proxy %s dev %s: %v", ip.String(), link.Attrs().Name, err)
+	}
+	return nil
+}
+
+// DelNeighProxy deletes the neighbor proxy entries of the ipv6 address on all links
+func DelNeighProxy(ip net.IP) error {
+	neighs, err := netlink.NeighProxyList(0, netlink.FAMILY_V6)
+	if err != nil {
+		return fmt.Errorf("failed to list neighbor proxies: %v", err)
+	}
+	for i := range neighs {
+		if !neighs[i].IP.Equal(ip) {
+			continue
+		}
+		if err := netlink.NeighDel(&neighs[i]); err != nil {
+			return fmt.Errorf("failed to delete neighbor proxy %s: %v", ip.String(), err)
+		}
+	}
+	return nil
+}
+
+// ContainerIPv6Addrs returns the global ipv6 addresses of veth devices within the netns
+func ContainerIPv6Addrs(netnsPath string) ([]net.IP, error) {
+	netns, err := ns.GetNS(netnsPath)
+	if err != nil {
+		if _, ok := err.(ns.NSPathNotExistErr); ok {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open netns %q: %v", netnsPath, err)
+	}
+	defer netns.Close() // nolint: errcheck
+	var ips []net.IP
+	err = netns.Do(func(_ ns.NetNS) error {
+		links, err := netlink.LinkList()
+		if err != nil {
+			return fmt.Errorf("failed to list links in netns %s", netnsPath)
+		}
+		for _, link := range links {
+			if link.Type() != "veth" {
+				continue
+			}
+			addrs, err := netlink.AddrList(link, netlink.FAMILY_V6)
+			if err != nil {
+				return fmt.Errorf("failed to list addrs of %s: %v", link.Attrs().Name, err)
+			}
+			for i := range addrs {
+				if addrs[i].IP.IsGlobalUnicast() {
+					ips = append(ips, addrs[i].IP)
+				}
+			}
+		}
+		return nil
+	})
+	return ips, err
+}
+
 func DisableRpFilter(dev string) error {
 	file := fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/rp_filter", dev)
 	return ioutil.WriteFile(file, []byte("0\n"), 0644)
@@ -0,0 +1,98 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/client/clientset/versioned"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+)
+
+// ipam_migrate copies allocated floating ips between galaxy-ipam storage drivers. Stop galaxy-ipam before
+// migrating, otherwise allocations made during migration may be lost.
+var (
+	flagFrom       = flag.String("from", floatingip.CrdStoreDriver, "source storage driver, crd or bolt")
+	flagTo         = flag.String("to", floatingip.BoltStoreDriver, "destination storage driver, crd or bolt")
+	flagMaster     = flag.String("master", "", "The address of the Kubernetes API server, used by crd driver")
+	flagKubeConf   = flag.String("kubeconfig", "", "The kube config file location, used by crd driver")
+	flagNamespace  = flag.String("namespace", "kube-system", "configMapNamespace of galaxy-ipam, used by crd driver")
+	flagBoltDBPath = flag.String("bolt-db", "/var/lib/galaxy-ipam/ipam.db", "bolt file path, used by bolt driver")
+	flagPrune      = flag.Bool("prune", false, "delete ips which only exist in the destination store")
+)
+
+func main() {
+	glog.InitFlags(nil)
+	flag.Parse()
+	if *flagFrom == *flagTo {
+		glog.Fatalf("source and destination storage driver are the same: %s", *flagFrom)
+	}
+	from, err := newStore(*flagFrom)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	to, err := newStore(*flagTo)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	n, extra, err := floatingip.Migrate(from, to, *flagPrune)
+	if err != nil {
+		glog.Fatalf("migrated %d ips before error: %v", n, err)
+	}
+	for _, fip := range extra {
+		if *flagPrune {
+			fmt.Printf("pruned %s of %s from %s\n", fip.IP.String(), fip.Key, *flagTo)
+		} else {
+			fmt.Printf("%s of %s only exists in %s, rerun with --prune to delete it\n", fip.IP.String(), fip.Key,
+				*flagTo)
+		}
+	}
+	for _, store := range []floatingip.Store{from, to} {
+		if closer, ok := store.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+	fmt.Printf("migrated %d ips from %s to %s\n", n, *flagFrom, *flagTo)
+}
+
+func newStore(driver string) (floatingip.Store, error) {
+	switch driver {
+	case floatingip.CrdStoreDriver:
+		cfg, err := clientcmd.BuildConfigFromFlags(*flagMaster, *flagKubeConf)
+		if err != nil {
+			return nil, fmt.Errorf("error building kubeconfig: %v", err)
+		}
+		client, err := versioned.NewForConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error building galaxy clientset: %v", err)
+		}
+		kubeClient, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error building kubernetes clientset: %v", err)
+		}
+		return floatingip.NewCrdStore(client, kubeClient, *flagNamespace), nil
+	case floatingip.BoltStoreDriver:
+		return floatingip.NewBoltStore(*flagBoltDBPath)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %s", driver)
+	}
+}
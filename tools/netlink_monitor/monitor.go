@@ -53,7 +53,7 @@ func (dev *device) MonitorMisses() {
 	}
 
 	for {
-		msgs, err := nlsock.Receive()
+		msgs, _, err := nlsock.Receive()
 		if err != nil {
 			log.Errorf("Failed to receive from netlink: %v ", err)
 
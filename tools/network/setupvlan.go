@@ -22,7 +22,7 @@ import (
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
+	current "github.com/containernetworking/cni/pkg/types/100"
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/network/vlan"
 	"tkestack.io/galaxy/pkg/utils"
@@ -68,17 +68,17 @@ func main() {
 		if err != nil {
 			glog.Fatalf("Error creating vlan device %v", err)
 		}
-		if err := utils.VethConnectsHostWithContainer(&t020.Result{
-			IP4: &t020.IPConfig{
-				IP:      *ipNet,
+		if err := utils.VethConnectsHostWithContainer(&current.Result{
+			IPs: []*current.IPConfig{{
+				Address: *ipNet,
 				Gateway: gateway,
-				Routes: []types.Route{{
-					Dst: net.IPNet{
-						IP:   net.IPv4(0, 0, 0, 0),
-						Mask: net.IPv4Mask(0, 0, 0, 0),
-					},
-				}},
-			},
+			}},
+			Routes: []*types.Route{{
+				Dst: net.IPNet{
+					IP:   net.IPv4(0, 0, 0, 0),
+					Mask: net.IPv4Mask(0, 0, 0, 0),
+				},
+			}},
 		}, &skel.CmdArgs{Netns: *flagNetns, IfName: "eth0"}, bridgeName, "", nil); err != nil {
 			glog.Fatalf("Error creating veth %v", err)
 		}